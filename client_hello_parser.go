@@ -0,0 +1,142 @@
+package quic
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/quic-go/quic-go/internal/handshake"
+	"github.com/quic-go/quic-go/internal/protocol"
+	"github.com/quic-go/quic-go/internal/wire"
+)
+
+// The clientHelloParser reassembles the TLS ClientHello from the CRYPTO frames contained in the client's Initial packets.
+// This allows the server to inspect the ClientHello before creating a connection.
+// Packets are decrypted using a copy of the packet data, so they can still be passed to the connection afterwards.
+type clientHelloParser struct {
+	frames []*wire.CryptoFrame
+}
+
+// A pendingClientHello holds the packets of a connection attempt until the ClientHello was received completely.
+type pendingClientHello struct {
+	parser     clientHelloParser
+	packets    []receivedPacket
+	expiration time.Time
+}
+
+// HandlePacket queues an Initial packet, and returns the ClientHello once it was received completely.
+// If more packets are needed to complete the ClientHello, it returns nil.
+func (h *pendingClientHello) HandlePacket(p receivedPacket, hdr *wire.Header) (*handshake.ClientHello, error) {
+	h.packets = append(h.packets, p)
+	if err := h.parser.HandlePacket(p.data, hdr); err != nil {
+		return nil, err
+	}
+	return h.parser.ClientHello()
+}
+
+// clientHelloQueues holds the pending ClientHellos, by the connection ID chosen by the client.
+// It is used by the listener router and by the server.
+type clientHelloQueues map[protocol.ConnectionID]*pendingClientHello
+
+// GetOrCreate returns the pending ClientHello for a connection ID.
+// If there's none yet, it creates a new one, unless MaxPendingClientHellos are already pending.
+// The second return value is true if a new pending ClientHello was created.
+func (q clientHelloQueues) GetOrCreate(connID protocol.ConnectionID, now time.Time) (*pendingClientHello, bool) {
+	if pending, ok := q[connID]; ok {
+		return pending, false
+	}
+	if len(q) >= protocol.MaxPendingClientHellos {
+		return nil, false
+	}
+	pending := &pendingClientHello{expiration: now.Add(protocol.MaxClientHelloQueueingDuration)}
+	q[connID] = pending
+	return pending, true
+}
+
+// Cleanup removes the pending ClientHellos that expired, and calls drop for all their packets.
+// It returns the time when the next pending ClientHello expires.
+func (q clientHelloQueues) Cleanup(now time.Time, drop func(receivedPacket)) time.Time {
+	var nextCleanup time.Time
+	for connID, pending := range q {
+		if pending.expiration.After(now) {
+			if nextCleanup.IsZero() || nextCleanup.After(pending.expiration) {
+				nextCleanup = pending.expiration
+			}
+			continue
+		}
+		for _, p := range pending.packets {
+			drop(p)
+		}
+		delete(q, connID)
+	}
+	return nextCleanup
+}
+
+var errClientHelloTooLarge = errors.New("ClientHello too large")
+
+// HandlePacket processes the first packet contained in data.
+// hdr is the already parsed header of this packet, and must be an Initial packet.
+func (p *clientHelloParser) HandlePacket(data []byte, hdr *wire.Header) error {
+	packetLen := hdr.ParsedLen() + hdr.Length
+	if protocol.ByteCount(len(data)) < packetLen {
+		return errors.New("packet too short")
+	}
+	b := make([]byte, packetLen)
+	copy(b, data)
+	_, opener := handshake.NewInitialAEAD(hdr.DestConnectionID, protocol.PerspectiveServer, hdr.Version)
+	extHdr, err := unpackLongHeader(opener, hdr, b, hdr.Version)
+	if err != nil {
+		return err
+	}
+	hdrLen := extHdr.ParsedLen()
+	payload, err := opener.Open(b[hdrLen:hdrLen], b[hdrLen:], extHdr.PacketNumber, b[:hdrLen])
+	if err != nil {
+		return err
+	}
+	frameParser := wire.NewFrameParser(false)
+	for len(payload) > 0 {
+		l, frame, err := frameParser.ParseNext(payload, protocol.EncryptionInitial, hdr.Version)
+		if err != nil {
+			return err
+		}
+		payload = payload[l:]
+		if frame == nil {
+			break
+		}
+		if f, ok := frame.(*wire.CryptoFrame); ok {
+			if f.Offset+protocol.ByteCount(len(f.Data)) > protocol.MaxCryptoStreamOffset {
+				return errClientHelloTooLarge
+			}
+			p.frames = append(p.frames, f)
+		}
+	}
+	return nil
+}
+
+// ClientHello returns the parsed ClientHello.
+// If the ClientHello hasn't been received completely yet, it returns nil.
+func (p *clientHelloParser) ClientHello() (*handshake.ClientHello, error) {
+	data := p.contiguousData()
+	l, ok := handshake.ClientHelloLen(data)
+	if !ok || len(data) < l {
+		return nil, nil
+	}
+	return handshake.ParseClientHello(data[:l])
+}
+
+// contiguousData returns the data received starting at offset 0, until the first gap.
+func (p *clientHelloParser) contiguousData() []byte {
+	sort.Slice(p.frames, func(i, j int) bool { return p.frames[i].Offset < p.frames[j].Offset })
+	var data []byte
+	for _, f := range p.frames {
+		end := f.Offset + protocol.ByteCount(len(f.Data))
+		if f.Offset > protocol.ByteCount(len(data)) {
+			break
+		}
+		if end <= protocol.ByteCount(len(data)) {
+			continue
+		}
+		data = append(data, f.Data[protocol.ByteCount(len(data))-f.Offset:]...)
+	}
+	return data
+}
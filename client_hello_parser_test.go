@@ -0,0 +1,127 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go/internal/handshake"
+	"github.com/quic-go/quic-go/internal/protocol"
+	"github.com/quic-go/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var clientInitialRemoteAddr = &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1234}
+
+// composeClientHello generates a ClientHello, as sent by a QUIC client.
+func composeClientHello(serverName string, alpns ...string) []byte {
+	conn := tls.QUICClient(&tls.QUICConfig{TLSConfig: &tls.Config{
+		ServerName: serverName,
+		NextProtos: alpns,
+		MinVersion: tls.VersionTLS13,
+	}})
+	conn.SetTransportParameters((&wire.TransportParameters{}).Marshal(protocol.PerspectiveClient))
+	ExpectWithOffset(1, conn.Start(context.Background())).To(Succeed())
+	defer conn.Close()
+	for {
+		ev := conn.NextEvent()
+		switch ev.Kind {
+		case tls.QUICNoEvent:
+			Fail("didn't receive a ClientHello")
+		case tls.QUICWriteData:
+			return append([]byte{}, ev.Data...)
+		}
+	}
+}
+
+// composeClientInitial composes an Initial packet, as sent by a QUIC client.
+func composeClientInitial(connID protocol.ConnectionID, pn protocol.PacketNumber, frames ...wire.Frame) receivedPacket {
+	const version = protocol.Version1
+	sealer, _ := handshake.NewInitialAEAD(connID, protocol.PerspectiveClient, version)
+	var payload []byte
+	for _, f := range frames {
+		var err error
+		payload, err = f.Append(payload, version)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	}
+	payload = append(payload, make([]byte, protocol.MinInitialPacketSize-len(payload))...)
+	hdr := &wire.ExtendedHeader{
+		Header: wire.Header{
+			Type:             protocol.PacketTypeInitial,
+			SrcConnectionID:  protocol.ParseConnectionID([]byte{1, 2, 3, 4}),
+			DestConnectionID: connID,
+			Length:           protocol.ByteCount(len(payload) + 4 + sealer.Overhead()),
+			Version:          version,
+		},
+		PacketNumberLen: protocol.PacketNumberLen4,
+		PacketNumber:    pn,
+	}
+	raw, err := hdr.Append(nil, version)
+	ExpectWithOffset(1, err).ToNot(HaveOccurred())
+	hdrLen := len(raw)
+	raw = sealer.Seal(raw, payload, pn, raw)
+	sealer.EncryptHeader(raw[hdrLen:hdrLen+16], &raw[0], raw[hdrLen-4:hdrLen])
+	buf := getPacketBuffer()
+	buf.Data = append(buf.Data[:0], raw...)
+	return receivedPacket{
+		remoteAddr: clientInitialRemoteAddr,
+		rcvTime:    time.Now(),
+		data:       buf.Data,
+		buffer:     buf,
+	}
+}
+
+var _ = Describe("ClientHello Parser", func() {
+	connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4})
+
+	handlePacket := func(parser *clientHelloParser, p receivedPacket) error {
+		hdr, _, _, err := wire.ParsePacket(p.data)
+		Expect(err).ToNot(HaveOccurred())
+		return parser.HandlePacket(p.data, hdr)
+	}
+
+	It("parses a ClientHello", func() {
+		var parser clientHelloParser
+		p := composeClientInitial(connID, 0, &wire.PingFrame{}, &wire.CryptoFrame{Data: composeClientHello("quic-go.net", "h3")})
+		data := append([]byte{}, p.data...)
+		Expect(handlePacket(&parser, p)).To(Succeed())
+		Expect(p.data).To(Equal(data)) // the packet is not modified
+		ch, err := parser.ClientHello()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ch.ServerName).To(Equal("quic-go.net"))
+		Expect(ch.ALPNs).To(Equal([]string{"h3"}))
+	})
+
+	It("reassembles a ClientHello from multiple packets", func() {
+		var parser clientHelloParser
+		b := composeClientHello("quic-go.net")
+		Expect(handlePacket(&parser, composeClientInitial(connID, 2, &wire.CryptoFrame{Offset: 200, Data: b[200:]}))).To(Succeed())
+		ch, err := parser.ClientHello()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ch).To(BeNil())
+		Expect(handlePacket(&parser, composeClientInitial(connID, 0, &wire.CryptoFrame{Data: b[:150]}))).To(Succeed())
+		ch, err = parser.ClientHello()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ch).To(BeNil())
+		Expect(handlePacket(&parser, composeClientInitial(connID, 1, &wire.CryptoFrame{Offset: 100, Data: b[100:250]}))).To(Succeed())
+		ch, err = parser.ClientHello()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ch.ServerName).To(Equal("quic-go.net"))
+	})
+
+	It("errors on packets that can't be decrypted", func() {
+		var parser clientHelloParser
+		p := composeClientInitial(connID, 0, &wire.CryptoFrame{Data: composeClientHello("quic-go.net")})
+		p.data[len(p.data)-1] ^= 0xff
+		Expect(handlePacket(&parser, p)).To(HaveOccurred())
+	})
+
+	It("errors when the ClientHello is too large", func() {
+		var parser clientHelloParser
+		p := composeClientInitial(connID, 0, &wire.CryptoFrame{Offset: protocol.MaxCryptoStreamOffset - 10, Data: make([]byte, 11)})
+		Expect(handlePacket(&parser, p)).To(MatchError(errClientHelloTooLarge))
+	})
+})
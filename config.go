@@ -5,6 +5,7 @@ import (
 	"net"
 	"time"
 
+	"github.com/quic-go/quic-go/internal/handshake"
 	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/quicvarint"
 )
@@ -23,6 +24,13 @@ func (c *Config) maxRetryTokenAge() time.Duration {
 	return c.handshakeTimeout()
 }
 
+func (c *Config) keyUpdatePolicy() handshake.KeyUpdatePolicy {
+	return handshake.KeyUpdatePolicy{
+		Interval: c.KeyUpdateInterval,
+		Period:   c.KeyUpdatePeriod,
+	}
+}
+
 func validateConfig(config *Config) error {
 	if config == nil {
 		return nil
@@ -40,6 +48,9 @@ func validateConfig(config *Config) error {
 	if config.MaxConnectionReceiveWindow > quicvarint.Max {
 		config.MaxConnectionReceiveWindow = quicvarint.Max
 	}
+	if config.KeyUpdateInterval > protocol.MaxKeyUpdateInterval {
+		config.KeyUpdateInterval = protocol.MaxKeyUpdateInterval
+	}
 	// check that all QUIC versions are actually supported
 	for _, v := range config.Versions {
 		if !protocol.IsValidVersion(v) {
@@ -106,6 +117,15 @@ func populateConfig(config *Config) *Config {
 		maxIncomingUniStreams = 0
 	}
 
+	datagramSendQueueLen := config.DatagramSendQueueLen
+	if datagramSendQueueLen <= 0 {
+		datagramSendQueueLen = protocol.DefaultDatagramSendQueueLen
+	}
+	datagramReceiveQueueLen := config.DatagramReceiveQueueLen
+	if datagramReceiveQueueLen <= 0 {
+		datagramReceiveQueueLen = protocol.DefaultDatagramReceiveQueueLen
+	}
+
 	return &Config{
 		GetConfigForClient:             config.GetConfigForClient,
 		Versions:                       versions,
@@ -113,15 +133,23 @@ func populateConfig(config *Config) *Config {
 		MaxIdleTimeout:                 idleTimeout,
 		RequireAddressValidation:       config.RequireAddressValidation,
 		KeepAlivePeriod:                config.KeepAlivePeriod,
+		KeyUpdateInterval:              config.KeyUpdateInterval,
+		KeyUpdatePeriod:                config.KeyUpdatePeriod,
 		InitialStreamReceiveWindow:     initialStreamReceiveWindow,
 		MaxStreamReceiveWindow:         maxStreamReceiveWindow,
 		InitialConnectionReceiveWindow: initialConnectionReceiveWindow,
 		MaxConnectionReceiveWindow:     maxConnectionReceiveWindow,
 		AllowConnectionWindowIncrease:  config.AllowConnectionWindowIncrease,
+		AllowStreamWindowIncrease:      config.AllowStreamWindowIncrease,
 		MaxIncomingStreams:             maxIncomingStreams,
 		MaxIncomingUniStreams:          maxIncomingUniStreams,
+		StreamSendBufferSize:           config.StreamSendBufferSize,
 		TokenStore:                     config.TokenStore,
 		EnableDatagrams:                config.EnableDatagrams,
+		DatagramSendQueueLen:           datagramSendQueueLen,
+		DatagramReceiveQueueLen:        datagramReceiveQueueLen,
+		DatagramSendQueuePolicy:        config.DatagramSendQueuePolicy,
+		DatagramReceiveQueuePolicy:     config.DatagramReceiveQueuePolicy,
 		DisablePathMTUDiscovery:        config.DisablePathMTUDiscovery,
 		Allow0RTT:                      config.Allow0RTT,
 		Tracer:                         config.Tracer,
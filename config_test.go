@@ -51,6 +51,12 @@ var _ = Describe("Config", func() {
 			Expect(conf.MaxStreamReceiveWindow).To(BeEquivalentTo(uint64(quicvarint.Max)))
 			Expect(conf.MaxConnectionReceiveWindow).To(BeEquivalentTo(uint64(quicvarint.Max)))
 		})
+
+		It("clips too large values for the key update interval", func() {
+			conf := &Config{KeyUpdateInterval: protocol.MaxKeyUpdateInterval + 1}
+			Expect(validateConfig(conf)).To(Succeed())
+			Expect(conf.KeyUpdateInterval).To(BeEquivalentTo(uint64(protocol.MaxKeyUpdateInterval)))
+		})
 	})
 
 	configWithNonZeroNonFunctionFields := func() *Config {
@@ -66,7 +72,7 @@ var _ = Describe("Config", func() {
 			}
 
 			switch fn := typ.Field(i).Name; fn {
-			case "GetConfigForClient", "RequireAddressValidation", "GetLogWriter", "AllowConnectionWindowIncrease", "Tracer":
+			case "GetConfigForClient", "RequireAddressValidation", "GetLogWriter", "AllowConnectionWindowIncrease", "AllowStreamWindowIncrease", "Tracer":
 				// Can't compare functions.
 			case "Versions":
 				f.Set(reflect.ValueOf([]VersionNumber{1, 2, 3}))
@@ -92,12 +98,26 @@ var _ = Describe("Config", func() {
 				f.Set(reflect.ValueOf(int64(11)))
 			case "MaxIncomingUniStreams":
 				f.Set(reflect.ValueOf(int64(12)))
+			case "StreamSendBufferSize":
+				f.Set(reflect.ValueOf(uint64(13)))
 			case "StatelessResetKey":
 				f.Set(reflect.ValueOf(&StatelessResetKey{1, 2, 3, 4}))
 			case "KeepAlivePeriod":
 				f.Set(reflect.ValueOf(time.Second))
+			case "KeyUpdateInterval":
+				f.Set(reflect.ValueOf(uint64(1000)))
+			case "KeyUpdatePeriod":
+				f.Set(reflect.ValueOf(time.Minute))
 			case "EnableDatagrams":
 				f.Set(reflect.ValueOf(true))
+			case "DatagramSendQueueLen":
+				f.Set(reflect.ValueOf(14))
+			case "DatagramReceiveQueueLen":
+				f.Set(reflect.ValueOf(15))
+			case "DatagramSendQueuePolicy":
+				f.Set(reflect.ValueOf(DatagramQueueDropOldest))
+			case "DatagramReceiveQueuePolicy":
+				f.Set(reflect.ValueOf(DatagramQueueDropNewest))
 			case "DisableVersionNegotiationPackets":
 				f.Set(reflect.ValueOf(true))
 			case "DisablePathMTUDiscovery":
@@ -118,10 +138,11 @@ var _ = Describe("Config", func() {
 
 	Context("cloning", func() {
 		It("clones function fields", func() {
-			var calledAddrValidation, calledAllowConnectionWindowIncrease, calledTracer bool
+			var calledAddrValidation, calledAllowConnectionWindowIncrease, calledAllowStreamWindowIncrease, calledTracer bool
 			c1 := &Config{
 				GetConfigForClient:            func(info *ClientHelloInfo) (*Config, error) { return nil, errors.New("nope") },
 				AllowConnectionWindowIncrease: func(Connection, uint64) bool { calledAllowConnectionWindowIncrease = true; return true },
+				AllowStreamWindowIncrease:     func(Connection, StreamID, uint64) bool { calledAllowStreamWindowIncrease = true; return true },
 				RequireAddressValidation:      func(net.Addr) bool { calledAddrValidation = true; return true },
 				Tracer: func(context.Context, logging.Perspective, ConnectionID) *logging.ConnectionTracer {
 					calledTracer = true
@@ -133,6 +154,8 @@ var _ = Describe("Config", func() {
 			Expect(calledAddrValidation).To(BeTrue())
 			c2.AllowConnectionWindowIncrease(nil, 1234)
 			Expect(calledAllowConnectionWindowIncrease).To(BeTrue())
+			c2.AllowStreamWindowIncrease(nil, 4, 1234)
+			Expect(calledAllowStreamWindowIncrease).To(BeTrue())
 			_, err := c2.GetConfigForClient(&ClientHelloInfo{})
 			Expect(err).To(MatchError("nope"))
 			c2.Tracer(context.Background(), logging.PerspectiveClient, protocol.ConnectionID{})
@@ -183,6 +206,8 @@ var _ = Describe("Config", func() {
 			Expect(c.MaxConnectionReceiveWindow).To(BeEquivalentTo(protocol.DefaultMaxReceiveConnectionFlowControlWindow))
 			Expect(c.MaxIncomingStreams).To(BeEquivalentTo(protocol.DefaultMaxIncomingStreams))
 			Expect(c.MaxIncomingUniStreams).To(BeEquivalentTo(protocol.DefaultMaxIncomingUniStreams))
+			Expect(c.DatagramSendQueueLen).To(Equal(protocol.DefaultDatagramSendQueueLen))
+			Expect(c.DatagramReceiveQueueLen).To(Equal(protocol.DefaultDatagramReceiveQueueLen))
 			Expect(c.DisablePathMTUDiscovery).To(BeFalse())
 			Expect(c.GetConfigForClient).To(BeNil())
 		})
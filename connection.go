@@ -54,8 +54,10 @@ type streamManager interface {
 type cryptoStreamHandler interface {
 	StartHandshake() error
 	ChangeConnectionID(protocol.ConnectionID)
+	ChangeVersion(protocol.VersionNumber)
 	SetLargest1RTTAcked(protocol.PacketNumber) error
 	SetHandshakeConfirmed()
+	RequestKeyUpdate()
 	GetSessionTicket() ([]byte, error)
 	NextEvent() handshake.Event
 	DiscardInitialKeys()
@@ -73,18 +75,23 @@ type receivedPacket struct {
 	ecn protocol.ECN
 
 	info packetInfo // only valid if the contained IP address is valid
+
+	// clientHello is the ClientHello parsed by the listener router.
+	// It is only set on the first packet of a connection attempt.
+	clientHello *handshake.ClientHello
 }
 
 func (p *receivedPacket) Size() protocol.ByteCount { return protocol.ByteCount(len(p.data)) }
 
 func (p *receivedPacket) Clone() *receivedPacket {
 	return &receivedPacket{
-		remoteAddr: p.remoteAddr,
-		rcvTime:    p.rcvTime,
-		data:       p.data,
-		buffer:     p.buffer,
-		ecn:        p.ecn,
-		info:       p.info,
+		remoteAddr:  p.remoteAddr,
+		rcvTime:     p.rcvTime,
+		data:        p.data,
+		buffer:      p.buffer,
+		ecn:         p.ecn,
+		info:        p.info,
+		clientHello: p.clientHello,
 	}
 }
 
@@ -154,6 +161,9 @@ type connection struct {
 	frameParser   wire.FrameParser
 	packer        packer
 	mtuDiscoverer mtuDiscoverer // initialized when the handshake completes
+	// maxPayloadSizeEstimate is a (conservative) estimate of the payload size of a short header packet.
+	// It is updated when the MTU increases, and accessed from SendDatagram.
+	maxPayloadSizeEstimate atomic.Uint32
 
 	initialStream       cryptoStream
 	handshakeStream     cryptoStream
@@ -283,7 +293,9 @@ var newConnection = func(
 		s.tracer,
 		s.logger,
 	)
-	s.mtuDiscoverer = newMTUDiscoverer(s.rttStats, getMaxPacketSize(s.conn.RemoteAddr()), s.sentPacketHandler.SetMaxDatagramSize)
+	initialPacketSize := getMaxPacketSize(s.conn.RemoteAddr())
+	s.maxPayloadSizeEstimate.Store(uint32(estimateMaxPayloadSize(initialPacketSize)))
+	s.mtuDiscoverer = newMTUDiscoverer(s.rttStats, initialPacketSize, s.onMTUIncreased)
 	params := &wire.TransportParameters{
 		InitialMaxStreamDataBidiLocal:   protocol.ByteCount(s.config.InitialStreamReceiveWindow),
 		InitialMaxStreamDataBidiRemote:  protocol.ByteCount(s.config.InitialStreamReceiveWindow),
@@ -305,6 +317,10 @@ var newConnection = func(
 		ActiveConnectionIDLimit:   protocol.MaxActiveConnectionIDs,
 		InitialSourceConnectionID: srcConnID,
 		RetrySourceConnectionID:   retrySrcConnID,
+		VersionInformation: &wire.VersionInformation{
+			ChosenVersion:     s.version,
+			AvailableVersions: s.config.Versions,
+		},
 	}
 	if s.config.EnableDatagrams {
 		params.MaxDatagramFrameSize = wire.MaxDatagramSize
@@ -321,6 +337,7 @@ var newConnection = func(
 		params,
 		tlsConf,
 		conf.Allow0RTT,
+		conf.keyUpdatePolicy(),
 		s.rttStats,
 		tracer,
 		logger,
@@ -392,7 +409,9 @@ var newClientConnection = func(
 		s.tracer,
 		s.logger,
 	)
-	s.mtuDiscoverer = newMTUDiscoverer(s.rttStats, getMaxPacketSize(s.conn.RemoteAddr()), s.sentPacketHandler.SetMaxDatagramSize)
+	initialPacketSize := getMaxPacketSize(s.conn.RemoteAddr())
+	s.maxPayloadSizeEstimate.Store(uint32(estimateMaxPayloadSize(initialPacketSize)))
+	s.mtuDiscoverer = newMTUDiscoverer(s.rttStats, initialPacketSize, s.onMTUIncreased)
 	oneRTTStream := newCryptoStream()
 	params := &wire.TransportParameters{
 		InitialMaxStreamDataBidiRemote: protocol.ByteCount(s.config.InitialStreamReceiveWindow),
@@ -412,6 +431,10 @@ var newClientConnection = func(
 		// See https://github.com/quic-go/quic-go/pull/3806.
 		ActiveConnectionIDLimit:   protocol.MaxActiveConnectionIDs,
 		InitialSourceConnectionID: srcConnID,
+		VersionInformation: &wire.VersionInformation{
+			ChosenVersion:     s.version,
+			AvailableVersions: s.config.Versions,
+		},
 	}
 	if s.config.EnableDatagrams {
 		params.MaxDatagramFrameSize = wire.MaxDatagramSize
@@ -426,6 +449,7 @@ var newClientConnection = func(
 		params,
 		tlsConf,
 		enable0RTT,
+		conf.keyUpdatePolicy(),
 		s.rttStats,
 		tracer,
 		logger,
@@ -474,6 +498,7 @@ func (s *connection) preSetup() {
 		s.newFlowController,
 		uint64(s.config.MaxIncomingStreams),
 		uint64(s.config.MaxIncomingUniStreams),
+		protocol.ByteCount(min(s.config.StreamSendBufferSize, uint64(protocol.MaxByteCount))),
 		s.perspective,
 	)
 	s.framer = newFramer(s.streamsMap)
@@ -487,7 +512,14 @@ func (s *connection) preSetup() {
 	s.creationTime = now
 
 	s.windowUpdateQueue = newWindowUpdateQueue(s.streamsMap, s.connFlowController, s.framer.QueueControlFrame)
-	s.datagramQueue = newDatagramQueue(s.scheduleSending, s.logger)
+	s.datagramQueue = newDatagramQueue(
+		s.scheduleSending,
+		s.config.DatagramSendQueueLen,
+		s.config.DatagramReceiveQueueLen,
+		s.config.DatagramSendQueuePolicy,
+		s.config.DatagramReceiveQueuePolicy,
+		s.logger,
+	)
 	s.connState.Version = s.version
 }
 
@@ -837,7 +869,7 @@ func (s *connection) handlePacketImpl(rp receivedPacket) bool {
 			}
 			lastConnID = hdr.DestConnectionID
 
-			if hdr.Version != s.version {
+			if hdr.Version != s.version && !s.maybeSwitchToCompatibleVersion(hdr, packetData) {
 				if s.tracer != nil && s.tracer.DroppedPacket != nil {
 					s.tracer.DroppedPacket(logging.PacketTypeFromHeader(hdr), protocol.InvalidPacketNumber, protocol.ByteCount(len(data)), logging.PacketDropUnexpectedVersion)
 				}
@@ -1139,6 +1171,52 @@ func (s *connection) handleVersionNegotiationPacket(p receivedPacket) {
 	})
 }
 
+// maybeSwitchToCompatibleVersion is called by the client when receiving a packet with a different version.
+// The server can switch to a compatible version in its first flight (RFC 9368).
+// The client only switches if the packet can be unprotected using the Initial keys of the new version,
+// such that a packet injected by an attacker can't make the client switch versions.
+// It returns true if the client switched to the version of the packet.
+func (s *connection) maybeSwitchToCompatibleVersion(hdr *wire.Header, data []byte) bool {
+	if s.perspective == protocol.PerspectiveServer || s.receivedFirstPacket || hdr.Type != protocol.PacketTypeInitial {
+		return false
+	}
+	if !protocol.IsSupportedVersion(s.config.Versions, hdr.Version) || !protocol.AreCompatibleVersions(s.version, hdr.Version) {
+		return false
+	}
+	if !canOpenInitialPacket(s.handshakeDestConnID, hdr, data) {
+		s.logger.Debugf("Failed to unprotect Initial packet using QUIC version %s.", hdr.Version)
+		return false
+	}
+	s.logger.Infof("Server switched to compatible QUIC version %s.", hdr.Version)
+	s.cryptoStreamHandler.ChangeVersion(hdr.Version)
+	s.setVersion(hdr.Version)
+	return true
+}
+
+// canOpenInitialPacket says if an Initial packet sent by the server can be unprotected using the
+// Initial keys derived from connID for the version of the packet.
+// The packet is unprotected on a copy, data is not modified.
+func canOpenInitialPacket(connID protocol.ConnectionID, hdr *wire.Header, data []byte) bool {
+	b := make([]byte, len(data))
+	copy(b, data)
+	_, opener := handshake.NewInitialAEAD(connID, protocol.PerspectiveClient, hdr.Version)
+	extHdr, err := unpackLongHeader(opener, hdr, b, hdr.Version)
+	if err != nil {
+		return false
+	}
+	hdrLen := extHdr.ParsedLen()
+	pn := opener.DecodePacketNumber(extHdr.PacketNumber, extHdr.PacketNumberLen)
+	_, err = opener.Open(b[hdrLen:hdrLen], b[hdrLen:], pn, b[:hdrLen])
+	return err == nil
+}
+
+func (s *connection) setVersion(v protocol.VersionNumber) {
+	s.version = v
+	s.connStateMutex.Lock()
+	s.connState.Version = v
+	s.connStateMutex.Unlock()
+}
+
 func (s *connection) handleUnpackedLongHeaderPacket(
 	packet *unpackedPacket,
 	ecn protocol.ECN,
@@ -1147,16 +1225,6 @@ func (s *connection) handleUnpackedLongHeaderPacket(
 ) error {
 	if !s.receivedFirstPacket {
 		s.receivedFirstPacket = true
-		if !s.versionNegotiated && s.tracer != nil && s.tracer.NegotiatedVersion != nil {
-			var clientVersions, serverVersions []protocol.VersionNumber
-			switch s.perspective {
-			case protocol.PerspectiveClient:
-				clientVersions = s.config.Versions
-			case protocol.PerspectiveServer:
-				serverVersions = s.config.Versions
-			}
-			s.tracer.NegotiatedVersion(s.version, clientVersions, serverVersions)
-		}
 		// The server can change the source connection ID with the first Handshake packet.
 		if s.perspective == protocol.PerspectiveClient && packet.hdr.SrcConnectionID != s.handshakeDestConnID {
 			cid := packet.hdr.SrcConnectionID
@@ -1398,6 +1466,9 @@ func (s *connection) handleHandshakeEvents() error {
 			s.undecryptablePackets = nil
 		case handshake.EventDiscard0RTTKeys:
 			err = s.dropEncryptionLevel(protocol.Encryption0RTT)
+		case handshake.EventChangedVersion:
+			s.logger.Infof("Switching to compatible QUIC version %s.", ev.Version)
+			s.setVersion(ev.Version)
 		case handshake.EventWriteInitialData:
 			_, err = s.initialStream.Write(ev.Data)
 		case handshake.EventWriteHandshakeData:
@@ -1695,6 +1766,23 @@ func (s *connection) handleTransportParameters(params *wire.TransportParameters)
 			ErrorMessage: err.Error(),
 		}
 	}
+	if err := s.checkVersionInformation(params.VersionInformation); err != nil {
+		return &qerr.TransportError{
+			ErrorCode:    qerr.VersionNegotiationErrorErrorCode,
+			ErrorMessage: err.Error(),
+		}
+	}
+	if !s.versionNegotiated && s.tracer != nil && s.tracer.NegotiatedVersion != nil {
+		var peerVersions []protocol.VersionNumber
+		if params.VersionInformation != nil {
+			peerVersions = params.VersionInformation.AvailableVersions
+		}
+		if s.perspective == protocol.PerspectiveClient {
+			s.tracer.NegotiatedVersion(s.version, s.config.Versions, peerVersions)
+		} else {
+			s.tracer.NegotiatedVersion(s.version, peerVersions, s.config.Versions)
+		}
+	}
 
 	if s.perspective == protocol.PerspectiveClient && s.peerParams != nil && s.ConnectionState().Used0RTT && !params.ValidForUpdate(s.peerParams) {
 		return &qerr.TransportError{
@@ -1749,6 +1837,25 @@ func (s *connection) checkTransportParameters(params *wire.TransportParameters)
 	return nil
 }
 
+// checkVersionInformation performs the client-side downgrade checks of RFC 9368.
+// The server's checks are performed by the crypto setup.
+func (s *connection) checkVersionInformation(vi *wire.VersionInformation) error {
+	if s.perspective == protocol.PerspectiveServer || vi == nil {
+		return nil
+	}
+	if vi.ChosenVersion != s.version {
+		return fmt.Errorf("server's chosen version (%s) doesn't match the negotiated version (%s)", vi.ChosenVersion, s.version)
+	}
+	// If we received a Version Negotiation packet, check that we would have chosen the same version
+	// if we had known the server's Available Versions right away.
+	if s.versionNegotiated {
+		if v, ok := protocol.ChooseSupportedVersion(s.config.Versions, vi.AvailableVersions); !ok || v != s.version {
+			return fmt.Errorf("version downgrade detected (server's available versions: %s)", vi.AvailableVersions)
+		}
+	}
+	return nil
+}
+
 func (s *connection) applyTransportParameters() {
 	params := s.peerParams
 	// Our local idle timeout will always be > 0.
@@ -2285,6 +2392,12 @@ func (s *connection) newFlowController(id protocol.StreamID) flowcontrol.StreamF
 		protocol.ByteCount(s.config.MaxStreamReceiveWindow),
 		initialSendWindow,
 		s.onHasStreamWindowUpdate,
+		func(size protocol.ByteCount) bool {
+			if s.config.AllowStreamWindowIncrease == nil {
+				return true
+			}
+			return s.config.AllowStreamWindowIncrease(s, id, uint64(size))
+		},
 		s.rttStats,
 		s.logger,
 	)
@@ -2345,19 +2458,60 @@ func (s *connection) onStreamCompleted(id protocol.StreamID) {
 }
 
 func (s *connection) SendDatagram(p []byte) error {
+	return s.sendDatagram(p, nil)
+}
+
+func (s *connection) SendDatagramWithCallback(p []byte, cb func(acked bool)) error {
+	var handler ackhandler.FrameHandler
+	if cb != nil {
+		handler = datagramAckHandler(cb)
+	}
+	return s.sendDatagram(p, handler)
+}
+
+func (s *connection) sendDatagram(p []byte, handler ackhandler.FrameHandler) error {
 	if !s.supportsDatagrams() {
 		return errors.New("datagram support disabled")
 	}
 
-	f := &wire.DatagramFrame{DataLenPresent: true}
-	if protocol.ByteCount(len(p)) > f.MaxDataLen(s.peerParams.MaxDatagramFrameSize, s.version) {
+	if maxSize := s.maxDatagramPayloadSize(); protocol.ByteCount(len(p)) > maxSize {
 		return &DatagramTooLargeError{
+			MaxDatagramPayloadSize:   int64(maxSize),
 			PeerMaxDatagramFrameSize: int64(s.peerParams.MaxDatagramFrameSize),
 		}
 	}
+	f := &wire.DatagramFrame{DataLenPresent: true}
 	f.Data = make([]byte, len(p))
 	copy(f.Data, p)
-	return s.datagramQueue.Add(f)
+	return s.datagramQueue.Add(f, handler)
+}
+
+func (s *connection) MaxDatagramSize() int {
+	if !s.supportsDatagrams() {
+		return 0
+	}
+	return int(s.maxDatagramPayloadSize())
+}
+
+// maxDatagramPayloadSize is the maximum payload size of a DATAGRAM frame that can currently be sent.
+// The estimate is conservative, under many circumstances we could send a few more bytes.
+func (s *connection) maxDatagramPayloadSize() protocol.ByteCount {
+	f := &wire.DatagramFrame{DataLenPresent: true}
+	return min(
+		f.MaxDataLen(s.peerParams.MaxDatagramFrameSize, s.version),
+		f.MaxDataLen(protocol.ByteCount(s.maxPayloadSizeEstimate.Load()), s.version),
+	)
+}
+
+func (s *connection) onMTUIncreased(mtu protocol.ByteCount) {
+	s.maxPayloadSizeEstimate.Store(uint32(estimateMaxPayloadSize(mtu)))
+	s.sentPacketHandler.SetMaxDatagramSize(mtu)
+}
+
+// estimateMaxPayloadSize estimates the maximum payload size for short header packets.
+// It assumes the maximum connection ID and packet number length, and subtracts the size of the AEAD tag.
+func estimateMaxPayloadSize(mtu protocol.ByteCount) protocol.ByteCount {
+	return mtu - 1 /* type byte */ - protocol.MaxConnIDLen - protocol.ByteCount(protocol.PacketNumberLen4) - 16 /* AEAD tag */
 }
 
 func (s *connection) ReceiveDatagram(ctx context.Context) ([]byte, error) {
@@ -2367,6 +2521,22 @@ func (s *connection) ReceiveDatagram(ctx context.Context) ([]byte, error) {
 	return s.datagramQueue.Receive(ctx)
 }
 
+func (s *connection) UpdateKeys() error {
+	select {
+	case <-s.ctx.Done():
+		return context.Cause(s.ctx)
+	default:
+	}
+	select {
+	case <-s.HandshakeComplete():
+	default:
+		return errors.New("handshake not complete")
+	}
+	s.cryptoStreamHandler.RequestKeyUpdate()
+	s.scheduleSending()
+	return nil
+}
+
 func (s *connection) LocalAddr() net.Addr {
 	return s.conn.LocalAddr()
 }
@@ -2484,6 +2484,26 @@ var _ = Describe("Connection", func() {
 	It("returns the remote address", func() {
 		Expect(conn.RemoteAddr()).To(Equal(remoteAddr))
 	})
+
+	Context("updating keys", func() {
+		It("doesn't update keys before the handshake completes", func() {
+			Expect(conn.UpdateKeys()).To(MatchError("handshake not complete"))
+		})
+
+		It("requests a key update", func() {
+			conn.handshakeCtxCancel()
+			cryptoSetup.EXPECT().RequestKeyUpdate()
+			Expect(conn.UpdateKeys()).To(Succeed())
+			Expect(conn.sendingScheduled).To(Receive())
+		})
+
+		It("doesn't update keys after the connection was closed", func() {
+			conn.handshakeCtxCancel()
+			testErr := errors.New("test error")
+			conn.ctxCancel(testErr)
+			Expect(conn.UpdateKeys()).To(MatchError(testErr))
+		})
+	})
 })
 
 var _ = Describe("Client Connection", func() {
@@ -2676,6 +2696,56 @@ var _ = Describe("Client Connection", func() {
 		Eventually(areConnsRunning).Should(BeFalse())
 	})
 
+	Context("datagrams", func() {
+		It("doesn't allow sending datagrams if the peer doesn't support them", func() {
+			conn.peerParams = &wire.TransportParameters{}
+			Expect(conn.MaxDatagramSize()).To(BeZero())
+			Expect(conn.SendDatagram([]byte("foobar"))).To(MatchError("datagram support disabled"))
+		})
+
+		It("limits the datagram size to the peer's max_datagram_frame_size", func() {
+			conn.peerParams = &wire.TransportParameters{MaxDatagramFrameSize: 100}
+			Expect(conn.MaxDatagramSize()).To(Equal(97))
+			err := conn.SendDatagram(make([]byte, 98))
+			var tooLargeErr *DatagramTooLargeError
+			Expect(errors.As(err, &tooLargeErr)).To(BeTrue())
+			Expect(tooLargeErr.MaxDatagramPayloadSize).To(BeEquivalentTo(97))
+			Expect(tooLargeErr.PeerMaxDatagramFrameSize).To(BeEquivalentTo(100))
+			Expect(conn.SendDatagram(make([]byte, 97))).To(Succeed())
+		})
+
+		It("notifies the application when a datagram is acknowledged", func() {
+			conn.peerParams = &wire.TransportParameters{MaxDatagramFrameSize: 100}
+			acked := make(chan bool, 1)
+			Expect(conn.SendDatagramWithCallback([]byte("foobar"), func(a bool) { acked <- a })).To(Succeed())
+			f := conn.datagramQueue.Peek()
+			Expect(f.Data).To(Equal([]byte("foobar")))
+			handler := conn.datagramQueue.Pop()
+			Expect(handler).ToNot(BeNil())
+			handler.OnAcked(f)
+			Expect(acked).To(Receive(BeTrue()))
+		})
+
+		It("limits the datagram size to the current packet size", func() {
+			conn.peerParams = &wire.TransportParameters{MaxDatagramFrameSize: wire.MaxDatagramSize}
+			sph := mockackhandler.NewMockSentPacketHandler(mockCtrl)
+			conn.sentPacketHandler = sph
+			sph.EXPECT().SetMaxDatagramSize(protocol.ByteCount(1300))
+			conn.onMTUIncreased(1300)
+			// 1300 bytes - 41 bytes for the packet overhead - 3 bytes for the DATAGRAM frame header
+			Expect(conn.MaxDatagramSize()).To(Equal(1256))
+			err := conn.SendDatagram(make([]byte, 1257))
+			var tooLargeErr *DatagramTooLargeError
+			Expect(errors.As(err, &tooLargeErr)).To(BeTrue())
+			Expect(tooLargeErr.MaxDatagramPayloadSize).To(BeEquivalentTo(1256))
+
+			sph.EXPECT().SetMaxDatagramSize(protocol.ByteCount(1400))
+			conn.onMTUIncreased(1400)
+			Expect(conn.MaxDatagramSize()).To(Equal(1356))
+			Expect(conn.SendDatagram(make([]byte, 1257))).To(Succeed())
+		})
+	})
+
 	Context("handling tokens", func() {
 		var mockTokenStore *MockTokenStore
 
@@ -3184,6 +3254,32 @@ var _ = Describe("Client Connection", func() {
 			Expect(conn.handlePacketImpl(wrapPacket(initialPacket))).To(BeTrue())
 		})
 
+		It("doesn't switch to a compatible version if the Initial packet can't be unprotected", func() {
+			conn.config.Versions = []protocol.VersionNumber{protocol.Version1, protocol.Version2}
+			Expect(conn.version).To(Equal(protocol.Version1))
+			// the packet is protected using keys derived from a different connection ID
+			wrongKey := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef})
+			initialPacket := testutils.ComposeInitialPacket(srcConnID, destConnID, protocol.Version2, wrongKey, nil)
+			data := append([]byte{}, initialPacket...)
+			tracer.EXPECT().DroppedPacket(logging.PacketTypeInitial, protocol.InvalidPacketNumber, gomock.Any(), logging.PacketDropUnexpectedVersion)
+			Expect(conn.handlePacketImpl(wrapPacket(initialPacket))).To(BeFalse())
+			Expect(conn.version).To(Equal(protocol.Version1))
+			// the packet was unprotected on a copy
+			Expect(initialPacket).To(Equal(data))
+		})
+
+		It("switches to a compatible version once the Initial packet was unprotected", func() {
+			conn.config.Versions = []protocol.VersionNumber{protocol.Version1, protocol.Version2}
+			unpacker = NewMockUnpacker(mockCtrl)
+			conn.unpacker = unpacker
+			initialPacket := testutils.ComposeInitialPacket(srcConnID, destConnID, protocol.Version2, conn.handshakeDestConnID, nil)
+			cryptoSetup.EXPECT().ChangeVersion(protocol.Version2)
+			unpacker.EXPECT().UnpackLongHeader(gomock.Any(), gomock.Any(), gomock.Any(), protocol.Version2).Return(nil, handshake.ErrDecryptionFailed)
+			tracer.EXPECT().DroppedPacket(logging.PacketTypeInitial, protocol.InvalidPacketNumber, gomock.Any(), logging.PacketDropPayloadDecryptError)
+			Expect(conn.handlePacketImpl(wrapPacket(initialPacket))).To(BeFalse())
+			Expect(conn.version).To(Equal(protocol.Version2))
+		})
+
 		// Illustrates that attacker who injects a Retry packet and changes the connection ID
 		// can cause subsequent real Initial packets to be ignored
 		It("ignores Initial packets which use original source id, after accepting a Retry", func() {
@@ -4,24 +4,32 @@ import (
 	"context"
 	"sync"
 
+	"github.com/quic-go/quic-go/internal/ackhandler"
 	"github.com/quic-go/quic-go/internal/utils"
 	"github.com/quic-go/quic-go/internal/utils/ringbuffer"
 	"github.com/quic-go/quic-go/internal/wire"
 )
 
-const (
-	maxDatagramSendQueueLen = 32
-	maxDatagramRcvQueueLen  = 128
-)
+// A queuedDatagram is a DATAGRAM frame queued for sending.
+type queuedDatagram struct {
+	frame   *wire.DatagramFrame
+	handler ackhandler.FrameHandler // nil if the application doesn't need to be notified about acknowledgement and loss
+}
 
 type datagramQueue struct {
-	sendMx    sync.Mutex
-	sendQueue ringbuffer.RingBuffer[*wire.DatagramFrame]
-	sent      chan struct{} // used to notify Add that a datagram was dequeued
-
-	rcvMx    sync.Mutex
-	rcvQueue [][]byte
-	rcvd     chan struct{} // used to notify Receive that a new datagram was received
+	sendMx        sync.Mutex
+	sendQueue     ringbuffer.RingBuffer[queuedDatagram]
+	sendQueueLen  int
+	sendPolicy    DatagramQueuePolicy
+	peeked        queuedDatagram // the datagram returned by the last call to Peek
+	peekedDropped bool           // set if the peeked datagram was removed from the queue to make room for a new one
+	sent          chan struct{}  // used to notify Add that a datagram was dequeued
+
+	rcvMx       sync.Mutex
+	rcvQueue    [][]byte
+	rcvQueueLen int
+	rcvPolicy   DatagramQueuePolicy
+	rcvd        chan struct{} // used to notify Receive that a new datagram was received
 
 	closeErr error
 	closed   chan struct{}
@@ -31,29 +39,65 @@ type datagramQueue struct {
 	logger utils.Logger
 }
 
-func newDatagramQueue(hasData func(), logger utils.Logger) *datagramQueue {
+func newDatagramQueue(
+	hasData func(),
+	sendQueueLen, rcvQueueLen int,
+	sendPolicy, rcvPolicy DatagramQueuePolicy,
+	logger utils.Logger,
+) *datagramQueue {
 	return &datagramQueue{
-		hasData: hasData,
-		rcvd:    make(chan struct{}, 1),
-		sent:    make(chan struct{}, 1),
-		closed:  make(chan struct{}),
-		logger:  logger,
+		hasData:      hasData,
+		sendQueueLen: sendQueueLen,
+		sendPolicy:   sendPolicy,
+		rcvQueueLen:  rcvQueueLen,
+		rcvPolicy:    rcvPolicy,
+		rcvd:         make(chan struct{}, 1),
+		sent:         make(chan struct{}, 1),
+		closed:       make(chan struct{}),
+		logger:       logger,
 	}
 }
 
 // Add queues a new DATAGRAM frame for sending.
-// Up to 32 DATAGRAM frames will be queued.
-// Once that limit is reached, Add blocks until the queue size has reduced.
-func (h *datagramQueue) Add(f *wire.DatagramFrame) error {
+// Up to sendQueueLen DATAGRAM frames will be queued.
+// Once that limit is reached, the send policy determines what happens:
+// Add either blocks until the queue size has reduced, drops the oldest queued frame,
+// or returns ErrDatagramQueueFull.
+// If set, the handler is notified when the frame is acknowledged or lost.
+// Frames that are dropped before being sent are reported as lost.
+func (h *datagramQueue) Add(f *wire.DatagramFrame, handler ackhandler.FrameHandler) error {
 	h.sendMx.Lock()
 
 	for {
-		if h.sendQueue.Len() < maxDatagramSendQueueLen {
-			h.sendQueue.PushBack(f)
+		if h.sendQueue.Len() < h.sendQueueLen {
+			h.sendQueue.PushBack(queuedDatagram{frame: f, handler: handler})
 			h.sendMx.Unlock()
 			h.hasData()
 			return nil
 		}
+		switch h.sendPolicy {
+		case DatagramQueueDropNewest:
+			h.sendMx.Unlock()
+			return ErrDatagramQueueFull
+		case DatagramQueueDropOldest:
+			dropped := h.sendQueue.PopFront()
+			if h.peeked.frame != nil && dropped.frame == h.peeked.frame {
+				// The packer might be about to send this frame.
+				// If it doesn't, the loss is reported by the next call to Peek.
+				h.peekedDropped = true
+				dropped.handler = nil
+			}
+			h.sendQueue.PushBack(queuedDatagram{frame: f, handler: handler})
+			h.sendMx.Unlock()
+			if h.logger.Debug() {
+				h.logger.Debugf("Discarding queued DATAGRAM frame (%d bytes payload)", len(dropped.frame.Data))
+			}
+			if dropped.handler != nil {
+				dropped.handler.OnLost(dropped.frame)
+			}
+			h.hasData()
+			return nil
+		}
 		select {
 		case <-h.sent: // drain the queue so we don't loop immediately
 		default:
@@ -72,21 +116,44 @@ func (h *datagramQueue) Add(f *wire.DatagramFrame) error {
 // If actually sent out, Pop needs to be called before the next call to Peek.
 func (h *datagramQueue) Peek() *wire.DatagramFrame {
 	h.sendMx.Lock()
-	defer h.sendMx.Unlock()
+	var lost queuedDatagram
+	if h.peekedDropped {
+		// The previously peeked frame was dropped from the queue, and Pop wasn't called for it.
+		lost = h.peeked
+		h.peekedDropped = false
+	}
 	if h.sendQueue.Empty() {
-		return nil
+		h.peeked = queuedDatagram{}
+	} else {
+		h.peeked = h.sendQueue.PeekFront()
+	}
+	f := h.peeked.frame
+	h.sendMx.Unlock()
+
+	if lost.handler != nil {
+		lost.handler.OnLost(lost.frame)
 	}
-	return h.sendQueue.PeekFront()
+	return f
 }
 
-func (h *datagramQueue) Pop() {
+// Pop removes the DATAGRAM frame returned by Peek from the queue.
+// It returns the handler that needs to be notified about acknowledgement and loss of the frame.
+func (h *datagramQueue) Pop() ackhandler.FrameHandler {
 	h.sendMx.Lock()
 	defer h.sendMx.Unlock()
+	peeked, peekedDropped := h.peeked, h.peekedDropped
+	h.peeked = queuedDatagram{}
+	h.peekedDropped = false
+	// If the peeked frame was dropped in the meantime, it was already removed from the queue.
+	if peekedDropped || h.sendQueue.Empty() {
+		return peeked.handler
+	}
 	_ = h.sendQueue.PopFront()
 	select {
 	case h.sent <- struct{}{}:
 	default:
 	}
+	return peeked.handler
 }
 
 // HandleDatagramFrame handles a received DATAGRAM frame.
@@ -95,7 +162,14 @@ func (h *datagramQueue) HandleDatagramFrame(f *wire.DatagramFrame) {
 	copy(data, f.Data)
 	var queued bool
 	h.rcvMx.Lock()
-	if len(h.rcvQueue) < maxDatagramRcvQueueLen {
+	if len(h.rcvQueue) >= h.rcvQueueLen && h.rcvPolicy == DatagramQueueDropOldest {
+		h.rcvQueue[0] = nil
+		h.rcvQueue = h.rcvQueue[1:]
+		if h.logger.Debug() {
+			h.logger.Debugf("Discarding queued DATAGRAM frame")
+		}
+	}
+	if len(h.rcvQueue) < h.rcvQueueLen {
 		h.rcvQueue = append(h.rcvQueue, data)
 		queued = true
 		select {
@@ -135,3 +209,11 @@ func (h *datagramQueue) CloseWithError(e error) {
 	h.closeErr = e
 	close(h.closed)
 }
+
+// datagramAckHandler notifies the application about the acknowledgement or loss of a DATAGRAM frame.
+type datagramAckHandler func(acked bool)
+
+var _ ackhandler.FrameHandler = datagramAckHandler(nil)
+
+func (h datagramAckHandler) OnAcked(wire.Frame) { h(true) }
+func (h datagramAckHandler) OnLost(wire.Frame)  { h(false) }
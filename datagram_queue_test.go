@@ -5,6 +5,8 @@ import (
 	"errors"
 	"time"
 
+	"github.com/quic-go/quic-go/internal/ackhandler"
+	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/internal/utils"
 	"github.com/quic-go/quic-go/internal/wire"
 
@@ -18,7 +20,14 @@ var _ = Describe("Datagram Queue", func() {
 
 	BeforeEach(func() {
 		queued = make(chan struct{}, 100)
-		queue = newDatagramQueue(func() { queued <- struct{}{} }, utils.DefaultLogger)
+		queue = newDatagramQueue(
+			func() { queued <- struct{}{} },
+			protocol.DefaultDatagramSendQueueLen,
+			protocol.DefaultDatagramReceiveQueueLen,
+			DatagramQueueBlock,
+			DatagramQueueBlock,
+			utils.DefaultLogger,
+		)
 	})
 
 	Context("sending", func() {
@@ -28,7 +37,7 @@ var _ = Describe("Datagram Queue", func() {
 
 		It("queues a datagram", func() {
 			frame := &wire.DatagramFrame{Data: []byte("foobar")}
-			Expect(queue.Add(frame)).To(Succeed())
+			Expect(queue.Add(frame, nil)).To(Succeed())
 			Expect(queued).To(HaveLen(1))
 			f := queue.Peek()
 			Expect(f.Data).To(Equal([]byte("foobar")))
@@ -37,20 +46,20 @@ var _ = Describe("Datagram Queue", func() {
 		})
 
 		It("blocks when the maximum number of datagrams have been queued", func() {
-			for i := 0; i < maxDatagramSendQueueLen; i++ {
-				Expect(queue.Add(&wire.DatagramFrame{Data: []byte{0}})).To(Succeed())
+			for i := 0; i < protocol.DefaultDatagramSendQueueLen; i++ {
+				Expect(queue.Add(&wire.DatagramFrame{Data: []byte{0}}, nil)).To(Succeed())
 			}
 			errChan := make(chan error, 1)
 			go func() {
 				defer GinkgoRecover()
-				errChan <- queue.Add(&wire.DatagramFrame{Data: []byte("foobar")})
+				errChan <- queue.Add(&wire.DatagramFrame{Data: []byte("foobar")}, nil)
 			}()
 			Consistently(errChan, 50*time.Millisecond).ShouldNot(Receive())
 			Expect(queue.Peek()).ToNot(BeNil())
 			Consistently(errChan, 50*time.Millisecond).ShouldNot(Receive())
 			queue.Pop()
 			Eventually(errChan).Should(Receive(BeNil()))
-			for i := 1; i < maxDatagramSendQueueLen; i++ {
+			for i := 1; i < protocol.DefaultDatagramSendQueueLen; i++ {
 				queue.Pop()
 			}
 			f := queue.Peek()
@@ -59,8 +68,8 @@ var _ = Describe("Datagram Queue", func() {
 		})
 
 		It("returns the same datagram multiple times, when Pop isn't called", func() {
-			Expect(queue.Add(&wire.DatagramFrame{Data: []byte("foo")})).To(Succeed())
-			Expect(queue.Add(&wire.DatagramFrame{Data: []byte("bar")})).To(Succeed())
+			Expect(queue.Add(&wire.DatagramFrame{Data: []byte("foo")}, nil)).To(Succeed())
+			Expect(queue.Add(&wire.DatagramFrame{Data: []byte("bar")}, nil)).To(Succeed())
 
 			Eventually(queued).Should(HaveLen(2))
 			f := queue.Peek()
@@ -73,14 +82,102 @@ var _ = Describe("Datagram Queue", func() {
 			Expect(f.Data).To(Equal([]byte("bar")))
 		})
 
+		It("drops the oldest datagram when the queue is full", func() {
+			queue.sendPolicy = DatagramQueueDropOldest
+			for i := 0; i < protocol.DefaultDatagramSendQueueLen; i++ {
+				Expect(queue.Add(&wire.DatagramFrame{Data: []byte{byte(i)}}, nil)).To(Succeed())
+			}
+			Expect(queue.Add(&wire.DatagramFrame{Data: []byte("foobar")}, nil)).To(Succeed())
+			Expect(queued).To(HaveLen(protocol.DefaultDatagramSendQueueLen + 1))
+			f := queue.Peek()
+			Expect(f.Data).To(Equal([]byte{1}))
+			for i := 1; i < protocol.DefaultDatagramSendQueueLen; i++ {
+				queue.Pop()
+			}
+			f = queue.Peek()
+			Expect(f.Data).To(Equal([]byte("foobar")))
+		})
+
+		It("doesn't dequeue another datagram if the peeked datagram was dropped", func() {
+			queue.sendPolicy = DatagramQueueDropOldest
+			for i := 0; i < protocol.DefaultDatagramSendQueueLen; i++ {
+				Expect(queue.Add(&wire.DatagramFrame{Data: []byte{byte(i)}}, nil)).To(Succeed())
+			}
+			Expect(queue.Peek().Data).To(Equal([]byte{0}))
+			Expect(queue.Add(&wire.DatagramFrame{Data: []byte("foobar")}, nil)).To(Succeed())
+			queue.Pop()
+			Expect(queue.Peek().Data).To(Equal([]byte{1}))
+		})
+
+		It("rejects new datagrams when the queue is full", func() {
+			queue.sendPolicy = DatagramQueueDropNewest
+			for i := 0; i < protocol.DefaultDatagramSendQueueLen; i++ {
+				Expect(queue.Add(&wire.DatagramFrame{Data: []byte{byte(i)}}, nil)).To(Succeed())
+			}
+			Expect(queue.Add(&wire.DatagramFrame{Data: []byte("foobar")}, nil)).To(MatchError(ErrDatagramQueueFull))
+			Expect(queue.Peek().Data).To(Equal([]byte{0}))
+		})
+
+		Context("acknowledgement and loss notifications", func() {
+			var lost []byte
+
+			newHandler := func(b byte) ackhandler.FrameHandler {
+				return datagramAckHandler(func(acked bool) {
+					Expect(acked).To(BeFalse())
+					lost = append(lost, b)
+				})
+			}
+
+			BeforeEach(func() {
+				lost = nil
+				queue.sendPolicy = DatagramQueueDropOldest
+				for i := 0; i < protocol.DefaultDatagramSendQueueLen; i++ {
+					Expect(queue.Add(&wire.DatagramFrame{Data: []byte{byte(i)}}, newHandler(byte(i)))).To(Succeed())
+				}
+			})
+
+			It("returns the handler when popping a datagram", func() {
+				Expect(queue.Peek().Data).To(Equal([]byte{0}))
+				handler := queue.Pop()
+				Expect(handler).ToNot(BeNil())
+				handler.OnLost(nil)
+				Expect(lost).To(Equal([]byte{0}))
+			})
+
+			It("reports datagrams that are dropped from the queue as lost", func() {
+				Expect(queue.Add(&wire.DatagramFrame{Data: []byte("foo")}, nil)).To(Succeed())
+				Expect(queue.Add(&wire.DatagramFrame{Data: []byte("bar")}, nil)).To(Succeed())
+				Expect(lost).To(Equal([]byte{0, 1}))
+			})
+
+			It("returns the handler of the peeked datagram, if it was dropped before popping", func() {
+				Expect(queue.Peek().Data).To(Equal([]byte{0}))
+				Expect(queue.Add(&wire.DatagramFrame{Data: []byte("foo")}, nil)).To(Succeed())
+				Expect(lost).To(BeEmpty())
+				handler := queue.Pop()
+				Expect(handler).ToNot(BeNil())
+				handler.OnLost(nil)
+				Expect(lost).To(Equal([]byte{0}))
+				Expect(queue.Peek().Data).To(Equal([]byte{1}))
+			})
+
+			It("reports the peeked datagram as lost, if it was dropped and not popped", func() {
+				Expect(queue.Peek().Data).To(Equal([]byte{0}))
+				Expect(queue.Add(&wire.DatagramFrame{Data: []byte("foo")}, nil)).To(Succeed())
+				Expect(lost).To(BeEmpty())
+				Expect(queue.Peek().Data).To(Equal([]byte{1}))
+				Expect(lost).To(Equal([]byte{0}))
+			})
+		})
+
 		It("closes", func() {
-			for i := 0; i < maxDatagramSendQueueLen; i++ {
-				Expect(queue.Add(&wire.DatagramFrame{Data: []byte("foo")})).To(Succeed())
+			for i := 0; i < protocol.DefaultDatagramSendQueueLen; i++ {
+				Expect(queue.Add(&wire.DatagramFrame{Data: []byte("foo")}, nil)).To(Succeed())
 			}
 			errChan := make(chan error, 1)
 			go func() {
 				defer GinkgoRecover()
-				errChan <- queue.Add(&wire.DatagramFrame{Data: []byte("foo")})
+				errChan <- queue.Add(&wire.DatagramFrame{Data: []byte("foo")}, nil)
 			}()
 			Consistently(errChan, 25*time.Millisecond).ShouldNot(Receive())
 			testErr := errors.New("test error")
@@ -101,6 +198,40 @@ var _ = Describe("Datagram Queue", func() {
 			Expect(data).To(Equal([]byte("bar")))
 		})
 
+		It("drops newly received DATAGRAM frames when the queue is full", func() {
+			for i := 0; i < protocol.DefaultDatagramReceiveQueueLen; i++ {
+				queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte{byte(i)}})
+			}
+			queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("foobar")})
+			for i := 0; i < protocol.DefaultDatagramReceiveQueueLen; i++ {
+				data, err := queue.Receive(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte{byte(i)}))
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			_, err := queue.Receive(ctx)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+
+		It("drops the oldest DATAGRAM frame when the queue is full", func() {
+			queue.rcvPolicy = DatagramQueueDropOldest
+			for i := 0; i < protocol.DefaultDatagramReceiveQueueLen; i++ {
+				queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte{byte(i)}})
+			}
+			queue.HandleDatagramFrame(&wire.DatagramFrame{Data: []byte("foobar")})
+			data, err := queue.Receive(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte{1}))
+			for i := 2; i < protocol.DefaultDatagramReceiveQueueLen; i++ {
+				_, err := queue.Receive(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+			}
+			data, err = queue.Receive(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foobar")))
+		})
+
 		It("blocks until a frame is received", func() {
 			c := make(chan []byte, 1)
 			go func() {
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/quic-go/quic-go/internal/qerr"
@@ -39,6 +40,8 @@ const (
 	KeyUpdateError            = qerr.KeyUpdateError
 	AEADLimitReached          = qerr.AEADLimitReached
 	NoViablePathError         = qerr.NoViablePathError
+	// RFC 9368
+	VersionNegotiationErrorErrorCode = qerr.VersionNegotiationErrorErrorCode
 )
 
 // A StreamError is used for Stream.CancelRead and Stream.CancelWrite.
@@ -64,6 +67,10 @@ func (e *StreamError) Error() string {
 
 // DatagramTooLargeError is returned from Connection.SendDatagram if the payload is too large to be sent.
 type DatagramTooLargeError struct {
+	// MaxDatagramPayloadSize is the maximum payload size that can currently be sent.
+	// It takes into account both the peer's max_datagram_frame_size and the current packet size.
+	MaxDatagramPayloadSize int64
+	// PeerMaxDatagramFrameSize is the max_datagram_frame_size transport parameter sent by the peer.
 	PeerMaxDatagramFrameSize int64
 }
 
@@ -73,3 +80,7 @@ func (e *DatagramTooLargeError) Is(target error) bool {
 }
 
 func (e *DatagramTooLargeError) Error() string { return "DATAGRAM frame too large" }
+
+// ErrDatagramQueueFull is returned from Connection.SendDatagram if the send queue is full,
+// and Config.DatagramSendQueuePolicy is DatagramQueueDropNewest.
+var ErrDatagramQueueFull = errors.New("DATAGRAM send queue full")
@@ -0,0 +1,135 @@
+package quic
+
+import (
+	"net"
+	"net/netip"
+	"time"
+)
+
+// HandshakeRateLimit configures rate limiting of new connection attempts per source subnet.
+// Connection attempts exceeding the rate limit are refused with a CONNECTION_REFUSED error.
+//
+// Since the source address of a connection attempt can be spoofed, it is recommended to
+// combine rate limiting with address validation (see Config.RequireAddressValidation and
+// Transport.AddressValidationThreshold).
+type HandshakeRateLimit struct {
+	// Rate is the number of new connection attempts per second that are permitted from a single subnet.
+	Rate float64
+	// Burst is the maximum number of connection attempts from a single subnet that are permitted at once.
+	// If zero, it defaults to 1.
+	Burst int
+	// IPv4PrefixLen is the length of the prefix used to group IPv4 addresses into subnets.
+	// If zero, it defaults to 32, i.e. every IPv4 address is rate limited individually.
+	IPv4PrefixLen int
+	// IPv6PrefixLen is the length of the prefix used to group IPv6 addresses into subnets.
+	// If zero, it defaults to 64.
+	IPv6PrefixLen int
+}
+
+// maxHandshakeRateLimitEntries is the maximum number of subnets that the rate limiter keeps track of.
+const maxHandshakeRateLimitEntries = 1 << 16
+
+type tokenBucket struct {
+	tokens     float64
+	lastUpdate time.Time
+}
+
+// The handshakeRateLimiter implements a token bucket for every subnet.
+// It is not safe for concurrent use.
+type handshakeRateLimiter struct {
+	rate          float64
+	burst         float64
+	ipv4PrefixLen int
+	ipv6PrefixLen int
+
+	buckets map[netip.Prefix]*tokenBucket
+}
+
+func newHandshakeRateLimiter(conf *HandshakeRateLimit) *handshakeRateLimiter {
+	burst := conf.Burst
+	if burst == 0 {
+		burst = 1
+	}
+	ipv4PrefixLen := conf.IPv4PrefixLen
+	if ipv4PrefixLen == 0 {
+		ipv4PrefixLen = 32
+	}
+	ipv6PrefixLen := conf.IPv6PrefixLen
+	if ipv6PrefixLen == 0 {
+		ipv6PrefixLen = 64
+	}
+	return &handshakeRateLimiter{
+		rate:          conf.Rate,
+		burst:         float64(burst),
+		ipv4PrefixLen: ipv4PrefixLen,
+		ipv6PrefixLen: ipv6PrefixLen,
+		buckets:       make(map[netip.Prefix]*tokenBucket),
+	}
+}
+
+// Allow says if a new connection attempt from addr is permitted at time now.
+func (l *handshakeRateLimiter) Allow(addr net.Addr, now time.Time) bool {
+	prefix, ok := l.prefix(addr)
+	if !ok {
+		return true
+	}
+	b, ok := l.buckets[prefix]
+	if !ok {
+		if len(l.buckets) >= maxHandshakeRateLimitEntries {
+			l.removeFullBuckets(now)
+		}
+		// If we're still tracking too many subnets, we can't keep track of this one.
+		if len(l.buckets) >= maxHandshakeRateLimitEntries {
+			return true
+		}
+		b = &tokenBucket{tokens: l.burst, lastUpdate: now}
+		l.buckets[prefix] = b
+	}
+	l.refill(b, now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+func (l *handshakeRateLimiter) refill(b *tokenBucket, now time.Time) {
+	if now.After(b.lastUpdate) {
+		b.tokens = min(l.burst, b.tokens+now.Sub(b.lastUpdate).Seconds()*l.rate)
+		b.lastUpdate = now
+	}
+}
+
+// removeFullBuckets removes all buckets that have been refilled completely.
+// They behave exactly like a newly created bucket.
+func (l *handshakeRateLimiter) removeFullBuckets(now time.Time) {
+	for prefix, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, prefix)
+		}
+	}
+}
+
+func (l *handshakeRateLimiter) prefix(addr net.Addr) (netip.Prefix, bool) {
+	var ip netip.Addr
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		ip = udpAddr.AddrPort().Addr()
+	} else {
+		addrPort, err := netip.ParseAddrPort(addr.String())
+		if err != nil {
+			return netip.Prefix{}, false
+		}
+		ip = addrPort.Addr()
+	}
+	ip = ip.Unmap()
+	prefixLen := l.ipv6PrefixLen
+	if ip.Is4() {
+		prefixLen = l.ipv4PrefixLen
+	}
+	prefix, err := ip.Prefix(prefixLen)
+	if err != nil {
+		return netip.Prefix{}, false
+	}
+	return prefix, true
+}
@@ -0,0 +1,86 @@
+package quic
+
+import (
+	"net"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Handshake Rate Limiter", func() {
+	It("allows a burst of connection attempts", func() {
+		l := newHandshakeRateLimiter(&HandshakeRateLimit{Rate: 1, Burst: 3})
+		now := time.Now()
+		addr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234}
+		for i := 0; i < 3; i++ {
+			Expect(l.Allow(addr, now)).To(BeTrue())
+		}
+		Expect(l.Allow(addr, now)).To(BeFalse())
+	})
+
+	It("refills the bucket over time", func() {
+		l := newHandshakeRateLimiter(&HandshakeRateLimit{Rate: 10, Burst: 2})
+		now := time.Now()
+		addr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234}
+		Expect(l.Allow(addr, now)).To(BeTrue())
+		Expect(l.Allow(addr, now)).To(BeTrue())
+		Expect(l.Allow(addr, now)).To(BeFalse())
+		Expect(l.Allow(addr, now.Add(50*time.Millisecond))).To(BeFalse())
+		Expect(l.Allow(addr, now.Add(100*time.Millisecond))).To(BeTrue())
+		Expect(l.Allow(addr, now.Add(100*time.Millisecond))).To(BeFalse())
+		// the bucket never holds more than the burst size
+		Expect(l.Allow(addr, now.Add(time.Hour))).To(BeTrue())
+		Expect(l.Allow(addr, now.Add(time.Hour))).To(BeTrue())
+		Expect(l.Allow(addr, now.Add(time.Hour))).To(BeFalse())
+	})
+
+	It("rate limits IPv4 addresses individually by default", func() {
+		l := newHandshakeRateLimiter(&HandshakeRateLimit{Rate: 1})
+		now := time.Now()
+		Expect(l.Allow(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234}, now)).To(BeTrue())
+		Expect(l.Allow(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 4321}, now)).To(BeFalse())
+		Expect(l.Allow(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 5), Port: 1234}, now)).To(BeTrue())
+	})
+
+	It("groups IPv4 addresses into subnets", func() {
+		l := newHandshakeRateLimiter(&HandshakeRateLimit{Rate: 1, IPv4PrefixLen: 24})
+		now := time.Now()
+		Expect(l.Allow(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 1234}, now)).To(BeTrue())
+		Expect(l.Allow(&net.UDPAddr{IP: net.IPv4(1, 2, 3, 5), Port: 1234}, now)).To(BeFalse())
+		Expect(l.Allow(&net.UDPAddr{IP: net.IPv4(1, 2, 4, 5), Port: 1234}, now)).To(BeTrue())
+	})
+
+	It("groups IPv6 addresses into /64 subnets by default", func() {
+		l := newHandshakeRateLimiter(&HandshakeRateLimit{Rate: 1})
+		now := time.Now()
+		Expect(l.Allow(&net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234}, now)).To(BeTrue())
+		Expect(l.Allow(&net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 1234}, now)).To(BeFalse())
+		Expect(l.Allow(&net.UDPAddr{IP: net.ParseIP("2001:db8:0:1::1"), Port: 1234}, now)).To(BeTrue())
+	})
+
+	It("allows connection attempts from non-IP addresses", func() {
+		l := newHandshakeRateLimiter(&HandshakeRateLimit{Rate: 1})
+		now := time.Now()
+		addr := &net.UnixAddr{Name: "foobar", Net: "unixgram"}
+		Expect(l.Allow(addr, now)).To(BeTrue())
+		Expect(l.Allow(addr, now)).To(BeTrue())
+	})
+
+	It("removes buckets that have been refilled when tracking too many subnets", func() {
+		l := newHandshakeRateLimiter(&HandshakeRateLimit{Rate: 1})
+		now := time.Now()
+		for i := 0; i < maxHandshakeRateLimitEntries; i++ {
+			Expect(l.Allow(&net.UDPAddr{IP: net.IPv4(10, 0, byte(i>>8), byte(i))}, now)).To(BeTrue())
+		}
+		Expect(l.buckets).To(HaveLen(maxHandshakeRateLimitEntries))
+		// We can't track any more subnets.
+		addr := &net.UDPAddr{IP: net.IPv4(1, 2, 3, 4)}
+		Expect(l.Allow(addr, now)).To(BeTrue())
+		Expect(l.Allow(addr, now)).To(BeTrue())
+		// After one second, all buckets are full again, and can be removed.
+		Expect(l.Allow(addr, now.Add(time.Second))).To(BeTrue())
+		Expect(l.buckets).To(HaveLen(1))
+		Expect(l.Allow(addr, now.Add(time.Second))).To(BeFalse())
+	})
+})
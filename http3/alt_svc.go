@@ -0,0 +1,251 @@
+package http3
+
+import (
+	"container/list"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultAltSvcMaxAge is the freshness lifetime of an alternative service without a ma parameter,
+// see Section 3.1 of RFC 7838.
+const defaultAltSvcMaxAge = 24 * time.Hour
+
+// An altSvc is an HTTP/3 endpoint that an origin is available at.
+type altSvc struct {
+	authority string // host:port
+	expires   time.Time
+}
+
+// parseAltSvc parses the value of the Alt-Svc header field, as defined in Section 3 of RFC 7838.
+// It only returns the alternative services that support HTTP/3.
+// The host of an alternative service defaults to originHost.
+// The "clear" value is reported by returning clear true.
+func parseAltSvc(value, originHost string, now time.Time) (_ []altSvc, clear bool) {
+	if strings.TrimSpace(value) == "clear" {
+		return nil, true
+	}
+	var svcs []altSvc
+	for _, alt := range strings.Split(value, ",") {
+		params := strings.Split(alt, ";")
+		protocolID, authority, ok := strings.Cut(strings.TrimSpace(params[0]), "=")
+		if !ok {
+			continue
+		}
+		// the protocol ID is percent-encoded
+		protocolID, err := url.PathUnescape(protocolID)
+		if err != nil || protocolID != NextProtoH3 {
+			continue
+		}
+		if len(authority) < 2 || authority[0] != '"' || authority[len(authority)-1] != '"' {
+			continue
+		}
+		host, port, err := net.SplitHostPort(authority[1 : len(authority)-1])
+		if err != nil {
+			continue
+		}
+		if p, err := strconv.ParseUint(port, 10, 16); err != nil || p == 0 {
+			continue
+		}
+		if host == "" {
+			host = originHost
+		}
+		maxAge := defaultAltSvcMaxAge
+		for _, param := range params[1:] {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if !strings.EqualFold(key, "ma") {
+				continue
+			}
+			if ma, err := strconv.ParseUint(strings.Trim(val, `"`), 10, 32); err == nil {
+				maxAge = time.Duration(ma) * time.Second
+			}
+		}
+		svcs = append(svcs, altSvc{
+			authority: net.JoinHostPort(host, port),
+			expires:   now.Add(maxAge),
+		})
+	}
+	return svcs, false
+}
+
+// defaultAltSvcCacheSize is the maximum number of origins that the altSvcCache keeps state for.
+const defaultAltSvcCacheSize = 1024
+
+// altSvcCache caches the HTTP/3 endpoints of origins.
+// Once the capacity is reached, the least recently used origin is evicted.
+type altSvcCache struct {
+	mutex    sync.Mutex
+	capacity int // if 0, defaultAltSvcCacheSize is used
+
+	origins map[string]*list.Element // keyed by the origin's host:port, the values are *altSvcEntry
+	lru     list.List                // most recently used origins at the front
+}
+
+// altSvcEntry holds the state of an origin.
+type altSvcEntry struct {
+	origin string // host:port
+	svcs   []altSvc
+	// The alternative services that are considered broken, and until when, keyed by their host:port.
+	// Tracked separately from the svcs, such that re-advertising an alternative doesn't clear the broken state.
+	broken map[string]time.Time
+	// lookedUpUntil is the time until which the result of the origin's HTTPS record lookup is valid.
+	lookedUpUntil time.Time
+}
+
+// update processes the Alt-Svc header fields of a response received from origin.
+// An Alt-Svc header field replaces all alternative services cached for the origin, see Section 4 of RFC 7838.
+func (c *altSvcCache) update(origin string, hdr http.Header, now time.Time) {
+	values := hdr.Values("Alt-Svc")
+	if len(values) == 0 {
+		return
+	}
+	host, _, err := net.SplitHostPort(origin)
+	if err != nil {
+		return
+	}
+	svcs, clear := parseAltSvc(strings.Join(values, ","), host, now)
+	if clear {
+		svcs = nil
+	}
+	c.set(origin, svcs)
+}
+
+// set replaces the HTTP/3 endpoints cached for the origin.
+func (c *altSvcCache) set(origin string, svcs []altSvc) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(svcs) == 0 {
+		if e := c.lookup(origin); e != nil {
+			e.svcs = nil
+			if len(e.broken) == 0 && e.lookedUpUntil.IsZero() {
+				c.remove(origin)
+			}
+		}
+		return
+	}
+	c.getOrCreate(origin).svcs = svcs
+}
+
+// get returns the first HTTP/3 endpoint for the origin that hasn't expired yet, and isn't considered broken.
+func (c *altSvcCache) get(origin string, now time.Time) (string, bool) {
+	alts := c.getAll(origin, now)
+	if len(alts) == 0 {
+		return "", false
+	}
+	return alts[0], true
+}
+
+// getAll returns the HTTP/3 endpoints for the origin that haven't expired yet, and aren't considered broken,
+// in the order they should be tried.
+func (c *altSvcCache) getAll(origin string, now time.Time) []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e := c.lookup(origin)
+	if e == nil {
+		return nil
+	}
+	e.removeExpired(now)
+	if len(e.svcs) == 0 && len(e.broken) == 0 && !now.Before(e.lookedUpUntil) {
+		c.remove(origin)
+		return nil
+	}
+	var alts []string
+	for _, svc := range e.svcs {
+		if _, ok := e.broken[svc.authority]; ok {
+			continue
+		}
+		alts = append(alts, svc.authority)
+	}
+	return alts
+}
+
+// markBroken marks an alternative service of the origin as broken until the given time,
+// see Section 2.4 of RFC 7838.
+// The origin's other alternative services, and the alternative services of other origins, are not affected.
+func (c *altSvcCache) markBroken(origin, authority string, until time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e := c.getOrCreate(origin)
+	if e.broken == nil {
+		e.broken = make(map[string]time.Time)
+	}
+	e.broken[authority] = until
+}
+
+// lookedUp says if the HTTPS records of the origin were looked up, and the result is still valid.
+func (c *altSvcCache) lookedUp(origin string, now time.Time) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	e := c.lookup(origin)
+	return e != nil && now.Before(e.lookedUpUntil)
+}
+
+// setLookedUp records that the HTTPS records of the origin were looked up,
+// and that the result is valid until the given time.
+func (c *altSvcCache) setLookedUp(origin string, until time.Time) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.getOrCreate(origin).lookedUpUntil = until
+}
+
+// lookup returns the entry for the origin, and marks it as recently used.
+// It returns nil if there's no entry for the origin.
+func (c *altSvcCache) lookup(origin string) *altSvcEntry {
+	el, ok := c.origins[origin]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*altSvcEntry)
+}
+
+// getOrCreate returns the entry for the origin, creating it if necessary.
+// If the cache is full, the least recently used origin is evicted.
+func (c *altSvcCache) getOrCreate(origin string) *altSvcEntry {
+	if e := c.lookup(origin); e != nil {
+		return e
+	}
+	if c.origins == nil {
+		c.origins = make(map[string]*list.Element)
+	}
+	capacity := c.capacity
+	if capacity == 0 {
+		capacity = defaultAltSvcCacheSize
+	}
+	if c.lru.Len() >= capacity {
+		c.remove(c.lru.Back().Value.(*altSvcEntry).origin)
+	}
+	e := &altSvcEntry{origin: origin}
+	c.origins[origin] = c.lru.PushFront(e)
+	return e
+}
+
+func (c *altSvcCache) remove(origin string) {
+	if el, ok := c.origins[origin]; ok {
+		c.lru.Remove(el)
+		delete(c.origins, origin)
+	}
+}
+
+func (e *altSvcEntry) removeExpired(now time.Time) {
+	svcs := e.svcs[:0]
+	for _, svc := range e.svcs {
+		if now.Before(svc.expires) {
+			svcs = append(svcs, svc)
+		}
+	}
+	e.svcs = svcs
+	for authority, until := range e.broken {
+		if !now.Before(until) {
+			delete(e.broken, authority)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package http3
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	defaultHeadStart       = 250 * time.Millisecond
+	defaultBrokenTimeout   = 5 * time.Minute
+	defaultEndpointTimeout = 3 * time.Second
+)
+
+// altSvcDialError is returned when establishing a QUIC connection to an HTTP/3 endpoint fails.
+// In that case, the request was not sent.
+type altSvcDialError struct {
+	broken []string // the HTTP/3 endpoints that couldn't be reached
+	err    error
+}
+
+func (e *altSvcDialError) Error() string { return e.err.Error() }
+func (e *altSvcDialError) Unwrap() error { return e.err }
+
+// AltSvcRoundTripper is an http.RoundTripper that upgrades to HTTP/3 for origins that advertise
+// HTTP/3 support using the Alt-Svc header field (RFC 7838), as set by Server.SetQuicHeaders.
+// Requests to all other origins are sent using the Fallback RoundTripper, usually using HTTP/1.1 or HTTP/2.
+//
+// Requests that can safely be sent twice (requests using a safe method, whose body can be replayed)
+// are raced: HTTP/3 is given a head start, and if no response was received after the head start,
+// the request is also sent using the Fallback RoundTripper. The first response received is used.
+// All other requests are sent using HTTP/3, and only use the Fallback RoundTripper if establishing
+// the QUIC connection failed.
+//
+// The HTTP/3 endpoints of an origin are tried in order, until a QUIC connection is established.
+// When establishing a QUIC connection to an alternative service fails, e.g. because UDP is blocked
+// on the current network, the alternative service is considered broken for the BrokenTimeout,
+// see Section 2.4 of RFC 7838. This only affects the origin the alternative service was used for.
+type AltSvcRoundTripper struct {
+	// Fallback is the RoundTripper used for requests that are not sent using HTTP/3.
+	// If nil, http.DefaultTransport is used.
+	Fallback http.RoundTripper
+
+	// TLSClientConfig specifies the TLS configuration to use for HTTP/3 connections.
+	// If nil, the default configuration is used.
+	TLSClientConfig *tls.Config
+
+	// QuicConfig is the quic.Config used for dialing new HTTP/3 connections.
+	// If nil, reasonable default values will be used.
+	QuicConfig *quic.Config
+
+	// HeadStart is the time HTTP/3 is given before a request is also sent using the Fallback RoundTripper.
+	// If zero, a default value of 250ms is used.
+	HeadStart time.Duration
+
+	// BrokenTimeout is the time an alternative service is not used after establishing a QUIC connection to it failed.
+	// If zero, a default value of 5 minutes is used.
+	BrokenTimeout time.Duration
+
+	// EndpointTimeout is the time allowed for establishing a QUIC connection to an HTTP/3 endpoint,
+	// before the next endpoint of the origin is tried. It doesn't apply to the last endpoint.
+	// If zero, a default value of 3 seconds is used.
+	EndpointTimeout time.Duration
+
+	// HTTPSResolver is used to look up the HTTPS DNS records (RFC 9460) of origins that aren't known
+	// to support HTTP/3 yet. If the records advertise HTTP/3 support, HTTP/3 is used for the first
+	// request to the origin, saving the request sent using the Fallback RoundTripper.
+	// If nil, HTTP/3 support is only discovered using the Alt-Svc header field.
+	HTTPSResolver HTTPSResolver
+
+	initOnce sync.Once
+	h3       http.RoundTripper // the HTTP/3 RoundTripper, created on first use, so we can mock it in tests
+	cache    altSvcCache
+
+	mutex   sync.Mutex
+	lookups map[string]*httpsLookup // origin -> HTTPS record lookup in progress
+}
+
+// httpsLookup is an HTTPS record lookup in progress.
+// Concurrent requests to the same origin wait for the lookup instead of starting their own.
+type httpsLookup struct {
+	done chan struct{}
+	ok   bool // set before done is closed
+}
+
+var (
+	_ http.RoundTripper = &AltSvcRoundTripper{}
+	_ io.Closer         = &AltSvcRoundTripper{}
+)
+
+func (r *AltSvcRoundTripper) init() {
+	r.initOnce.Do(func() {
+		if r.h3 == nil {
+			r.h3 = &RoundTripper{
+				TLSClientConfig: r.TLSClientConfig,
+				QuicConfig:      r.QuicConfig,
+				Dial:            r.dial,
+			}
+		}
+	})
+}
+
+// dial establishes a QUIC connection to one of the HTTP/3 endpoints of the origin addr.
+// The endpoints are tried in order, and every attempt except for the last one is limited to the EndpointTimeout.
+func (r *AltSvcRoundTripper) dial(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+	alts := r.cache.getAll(addr, time.Now())
+	if len(alts) == 0 {
+		alts = []string{addr}
+	}
+	var broken []string
+	var err error
+	for i, alt := range alts {
+		attemptCtx := ctx
+		cancel := func() {}
+		if i < len(alts)-1 {
+			attemptCtx, cancel = context.WithTimeout(ctx, r.endpointTimeout())
+		}
+		var conn quic.EarlyConnection
+		conn, err = dialAddr(attemptCtx, alt, tlsCfg, cfg)
+		cancel()
+		if err == nil {
+			return conn, nil
+		}
+		if ctx.Err() != nil {
+			// The request was canceled. This doesn't tell us anything about the endpoint.
+			break
+		}
+		broken = append(broken, alt)
+	}
+	return nil, &altSvcDialError{broken: broken, err: err}
+}
+
+// RoundTrip sends a request, using HTTP/3 if the origin is known to support it.
+func (r *AltSvcRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.init()
+
+	if req.URL == nil || req.URL.Scheme != "https" {
+		return r.fallback().RoundTrip(req)
+	}
+	origin := authorityAddr("https", hostnameFromRequest(req))
+	if !r.useHTTP3(req.Context(), origin) {
+		return r.roundTrip(r.fallback(), req, origin)
+	}
+	if !canRace(req) {
+		rsp, err := r.roundTrip(r.h3, req, origin)
+		var dialErr *altSvcDialError
+		if errors.As(err, &dialErr) {
+			// The request wasn't sent, since the QUIC connection couldn't be established.
+			r.markBroken(origin, dialErr.broken)
+			return r.roundTrip(r.fallback(), req, origin)
+		}
+		return rsp, err
+	}
+	return r.race(req, origin)
+}
+
+func (r *AltSvcRoundTripper) roundTrip(rt http.RoundTripper, req *http.Request, origin string) (*http.Response, error) {
+	rsp, err := rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.update(origin, rsp.Header, time.Now())
+	return rsp, nil
+}
+
+type raceResult struct {
+	rsp   *http.Response
+	err   error
+	http3 bool
+}
+
+// race sends the request using HTTP/3, and using the Fallback RoundTripper if HTTP/3 doesn't
+// return a response within the head start.
+func (r *AltSvcRoundTripper) race(req *http.Request, origin string) (*http.Response, error) {
+	results := make(chan raceResult, 2)
+	start := func(rt http.RoundTripper, req *http.Request, http3 bool) context.CancelFunc {
+		ctx, cancel := context.WithCancel(req.Context())
+		go func() {
+			rsp, err := r.roundTrip(rt, req.WithContext(ctx), origin)
+			results <- raceResult{rsp: rsp, err: err, http3: http3}
+		}()
+		return cancel
+	}
+	cancelH3 := start(r.h3, req, true)
+	var cancelFallback context.CancelFunc // nil until the request is sent using the Fallback RoundTripper
+	startFallback := func() bool {
+		fallbackReq, err := replayableRequest(req)
+		if err != nil {
+			return false
+		}
+		cancelFallback = start(r.fallback(), fallbackReq, false)
+		return true
+	}
+
+	timer := time.NewTimer(r.headStart())
+	defer timer.Stop()
+	pending := 1
+	for {
+		select {
+		case <-timer.C:
+			if cancelFallback == nil && startFallback() {
+				pending++
+			}
+		case res := <-results:
+			pending--
+			cancel := cancelH3
+			if !res.http3 {
+				cancel = cancelFallback
+			}
+			if res.http3 {
+				r.checkBroken(origin, res.err)
+			}
+			if res.err != nil {
+				cancel()
+				if cancelFallback == nil && startFallback() {
+					pending++
+					continue
+				}
+				if pending == 0 {
+					return nil, res.err
+				}
+				continue
+			}
+			if pending > 0 {
+				if res.http3 {
+					cancelFallback()
+					go r.discard(results, origin, cancelFallback)
+				} else {
+					// The HTTP/3 request is not canceled, such that we can detect if HTTP/3 is broken on this network.
+					go r.discard(results, origin, cancelH3)
+				}
+			}
+			res.rsp.Body = &cancelingBody{ReadCloser: res.rsp.Body, cancel: cancel}
+			return res.rsp, nil
+		}
+	}
+}
+
+// discard waits for the request that lost the race to complete.
+func (r *AltSvcRoundTripper) discard(results <-chan raceResult, origin string, cancel context.CancelFunc) {
+	res := <-results
+	defer cancel()
+	if res.http3 {
+		r.checkBroken(origin, res.err)
+	}
+	if res.err == nil {
+		res.rsp.Body.Close()
+	}
+}
+
+// checkBroken marks the alternative services of the origin that couldn't be reached as broken.
+func (r *AltSvcRoundTripper) checkBroken(origin string, err error) {
+	var dialErr *altSvcDialError
+	if errors.As(err, &dialErr) {
+		r.markBroken(origin, dialErr.broken)
+	}
+}
+
+func (r *AltSvcRoundTripper) useHTTP3(ctx context.Context, origin string) bool {
+	now := time.Now()
+	if _, ok := r.cache.get(origin, now); ok {
+		return true
+	}
+	if r.HTTPSResolver == nil {
+		return false
+	}
+	return r.lookupHTTPS(ctx, origin, now)
+}
+
+// lookupHTTPS looks up the HTTPS records of the origin, and caches the HTTP/3 endpoints.
+// To avoid delaying every request to origins that don't support HTTP/3, the lookup is
+// only repeated once the TTL of the records has expired.
+// Only a single lookup per origin is performed at a time.
+func (r *AltSvcRoundTripper) lookupHTTPS(ctx context.Context, origin string, now time.Time) bool {
+	r.mutex.Lock()
+	if r.cache.lookedUp(origin, now) {
+		r.mutex.Unlock()
+		return false
+	}
+	if l, ok := r.lookups[origin]; ok {
+		r.mutex.Unlock()
+		select {
+		case <-l.done:
+			return l.ok
+		case <-ctx.Done():
+			return false
+		}
+	}
+	l := &httpsLookup{done: make(chan struct{})}
+	if r.lookups == nil {
+		r.lookups = make(map[string]*httpsLookup)
+	}
+	r.lookups[origin] = l
+	r.mutex.Unlock()
+
+	endpoints, ttl, err := lookupHTTPSEndpoints(ctx, r.HTTPSResolver, origin)
+	if ttl == 0 {
+		ttl = defaultHTTPSRecordTTL
+	}
+	l.ok = err == nil && len(endpoints) > 0
+	if l.ok {
+		svcs := make([]altSvc, 0, len(endpoints))
+		for _, endpoint := range endpoints {
+			svcs = append(svcs, altSvc{authority: endpoint, expires: now.Add(ttl)})
+		}
+		r.cache.set(origin, svcs)
+	}
+	r.mutex.Lock()
+	delete(r.lookups, origin)
+	// If the request was canceled, the lookup is repeated by the next request.
+	if ctx.Err() == nil {
+		r.cache.setLookedUp(origin, now.Add(ttl))
+	}
+	r.mutex.Unlock()
+	close(l.done)
+	return l.ok
+}
+
+func (r *AltSvcRoundTripper) markBroken(origin string, authorities []string) {
+	until := time.Now().Add(r.brokenTimeout())
+	for _, authority := range authorities {
+		r.cache.markBroken(origin, authority, until)
+	}
+}
+
+func (r *AltSvcRoundTripper) fallback() http.RoundTripper {
+	if r.Fallback != nil {
+		return r.Fallback
+	}
+	return http.DefaultTransport
+}
+
+func (r *AltSvcRoundTripper) headStart() time.Duration {
+	if r.HeadStart == 0 {
+		return defaultHeadStart
+	}
+	return r.HeadStart
+}
+
+func (r *AltSvcRoundTripper) endpointTimeout() time.Duration {
+	if r.EndpointTimeout == 0 {
+		return defaultEndpointTimeout
+	}
+	return r.EndpointTimeout
+}
+
+func (r *AltSvcRoundTripper) brokenTimeout() time.Duration {
+	if r.BrokenTimeout == 0 {
+		return defaultBrokenTimeout
+	}
+	return r.BrokenTimeout
+}
+
+// Close closes the HTTP/3 connections that this RoundTripper has used.
+func (r *AltSvcRoundTripper) Close() error {
+	r.init()
+	if c, ok := r.h3.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// CloseIdleConnections closes idle connections of both the HTTP/3 and the Fallback RoundTripper.
+func (r *AltSvcRoundTripper) CloseIdleConnections() {
+	r.init()
+	type closeIdler interface{ CloseIdleConnections() }
+	if c, ok := r.h3.(closeIdler); ok {
+		c.CloseIdleConnections()
+	}
+	if c, ok := r.fallback().(closeIdler); ok {
+		c.CloseIdleConnections()
+	}
+}
+
+// canRace says if a request can be sent twice.
+func canRace(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// replayableRequest returns a copy of the request with a new body.
+func replayableRequest(req *http.Request) (*http.Request, error) {
+	r := *req
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return nil, errors.New("http3: request body can't be replayed")
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	return &r, nil
+}
+
+// cancelingBody cancels the request context when the response body is closed.
+type cancelingBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,458 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	mockquic "github.com/quic-go/quic-go/internal/mocks/quic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+var _ = Describe("Alt-Svc RoundTripper", func() {
+	var (
+		rt                    *AltSvcRoundTripper
+		h3Requests, tcpReqs   chan *http.Request
+		h3Handler, tcpHandler func(*http.Request) (*http.Response, error)
+	)
+
+	response := func(altSvc string) *http.Response {
+		rsp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("foobar"))}
+		if altSvc != "" {
+			rsp.Header.Set("Alt-Svc", altSvc)
+		}
+		return rsp
+	}
+
+	BeforeEach(func() {
+		h3Requests = make(chan *http.Request, 10)
+		tcpReqs = make(chan *http.Request, 10)
+		h3Handler = func(*http.Request) (*http.Response, error) { return response(""), nil }
+		tcpHandler = func(*http.Request) (*http.Response, error) { return response(`h3=":443"`), nil }
+		rt = &AltSvcRoundTripper{
+			Fallback: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				tcpReqs <- req
+				return tcpHandler(req)
+			}),
+			HeadStart: scaleDuration(50 * time.Millisecond),
+			h3: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				h3Requests <- req
+				return h3Handler(req)
+			}),
+		}
+	})
+
+	get := func(method string, body io.Reader) (*http.Response, error) {
+		req, err := http.NewRequest(method, "https://example.com/foo", body)
+		ExpectWithOffset(1, err).ToNot(HaveOccurred())
+		return rt.RoundTrip(req)
+	}
+
+	It("uses the fallback for origins that don't support HTTP/3", func() {
+		tcpHandler = func(*http.Request) (*http.Response, error) { return response(""), nil }
+		for i := 0; i < 2; i++ {
+			rsp, err := get(http.MethodGet, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+			Expect(tcpReqs).To(Receive())
+		}
+		Expect(h3Requests).ToNot(Receive())
+	})
+
+	It("uses the fallback for http:// URLs", func() {
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(HaveLen(2))
+		Expect(h3Requests).To(BeEmpty())
+	})
+
+	It("upgrades to HTTP/3", func() {
+		_, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+		rsp, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(h3Requests).To(Receive())
+		Expect(tcpReqs).ToNot(Receive())
+		data, err := io.ReadAll(rsp.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal([]byte("foobar")))
+		Expect(rsp.Body.Close()).To(Succeed())
+	})
+
+	It("races HTTP/3 against the fallback", func() {
+		_, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+
+		h3Canceled := make(chan struct{})
+		h3Handler = func(req *http.Request) (*http.Response, error) {
+			<-req.Context().Done()
+			close(h3Canceled)
+			return nil, req.Context().Err()
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://example.com/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		start := time.Now()
+		rsp, err := rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(time.Since(start)).To(BeNumerically(">=", rt.HeadStart))
+		Expect(h3Requests).To(Receive())
+		Expect(tcpReqs).To(Receive())
+		// the HTTP/3 request is not canceled when the fallback wins
+		Consistently(h3Canceled, scaleDuration(50*time.Millisecond)).ShouldNot(BeClosed())
+		Expect(rsp.Body.Close()).To(Succeed())
+		cancel()
+		Eventually(h3Canceled).Should(BeClosed())
+	})
+
+	It("cancels the fallback request when HTTP/3 wins", func() {
+		_, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+
+		h3Response := make(chan struct{})
+		h3Handler = func(req *http.Request) (*http.Response, error) {
+			<-h3Response
+			return response(""), nil
+		}
+		tcpCanceled := make(chan struct{})
+		tcpHandler = func(req *http.Request) (*http.Response, error) {
+			defer close(tcpCanceled)
+			close(h3Response)
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		}
+		rsp, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.Header.Get("Alt-Svc")).To(BeEmpty()) // the HTTP/3 response
+		Eventually(tcpCanceled).Should(BeClosed())
+	})
+
+	It("starts the fallback request immediately when HTTP/3 fails", func() {
+		_, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+
+		rt.HeadStart = time.Hour
+		h3Handler = func(*http.Request) (*http.Response, error) { return nil, errors.New("stream reset") }
+		rsp, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		Expect(tcpReqs).To(Receive())
+		// HTTP/3 is still used for the next request
+		h3Handler = func(*http.Request) (*http.Response, error) { return response(""), nil }
+		_, err = get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(h3Requests).To(HaveLen(2))
+	})
+
+	It("returns the error if both requests fail", func() {
+		_, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+
+		h3Handler = func(*http.Request) (*http.Response, error) { return nil, errors.New("h3 error") }
+		tcpHandler = func(*http.Request) (*http.Response, error) { return nil, errors.New("tcp error") }
+		_, err = get(http.MethodGet, nil)
+		Expect(err).To(MatchError("tcp error"))
+	})
+
+	It("replays the request body", func() {
+		_, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+
+		h3Handler = func(*http.Request) (*http.Response, error) { return nil, errors.New("stream reset") }
+		bodies := make(chan []byte, 2)
+		tcpHandler = func(req *http.Request) (*http.Response, error) {
+			b, err := io.ReadAll(req.Body)
+			Expect(err).ToNot(HaveOccurred())
+			bodies <- b
+			return response(""), nil
+		}
+		_, err = get(http.MethodGet, bytes.NewReader([]byte("request body")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(bodies).To(Receive(Equal([]byte("request body"))))
+	})
+
+	It("doesn't race requests that can't be sent twice", func() {
+		_, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+
+		h3Handler = func(*http.Request) (*http.Response, error) { return nil, errors.New("stream reset") }
+		_, err = get(http.MethodPost, nil)
+		Expect(err).To(MatchError("stream reset"))
+		Expect(tcpReqs).To(BeEmpty())
+	})
+
+	It("falls back if the QUIC connection can't be established", func() {
+		_, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+
+		h3Handler = func(*http.Request) (*http.Response, error) {
+			return nil, &altSvcDialError{broken: []string{"example.com:443"}, err: &quic.IdleTimeoutError{}}
+		}
+		rsp, err := get(http.MethodPost, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		Expect(h3Requests).To(Receive())
+		Expect(tcpReqs).To(Receive())
+
+		// HTTP/3 is now considered broken
+		_, err = get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(h3Requests).To(BeEmpty())
+		Expect(tcpReqs).To(Receive())
+	})
+
+	It("retries HTTP/3 after the broken timeout", func() {
+		rt.BrokenTimeout = scaleDuration(50 * time.Millisecond)
+		_, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+
+		h3Handler = func(*http.Request) (*http.Response, error) {
+			return nil, &altSvcDialError{broken: []string{"example.com:443"}, err: &quic.IdleTimeoutError{}}
+		}
+		_, err = get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(h3Requests).To(Receive())
+		Expect(tcpReqs).To(Receive())
+
+		time.Sleep(rt.BrokenTimeout)
+		h3Handler = func(*http.Request) (*http.Response, error) { return response(""), nil }
+		_, err = get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(h3Requests).To(Receive())
+	})
+
+	It("marks HTTP/3 as broken when the QUIC connection fails after the fallback won", func() {
+		_, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+
+		dialFailed := make(chan struct{})
+		h3Handler = func(*http.Request) (*http.Response, error) {
+			<-dialFailed
+			return nil, &altSvcDialError{broken: []string{"example.com:443"}, err: &quic.IdleTimeoutError{}}
+		}
+		_, err = get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+		Expect(h3Requests).To(Receive())
+		close(dialFailed)
+		Eventually(func() bool { return rt.useHTTP3(context.Background(), "example.com:443") }).Should(BeFalse())
+	})
+
+	It("only marks the alternative service of the origin as broken", func() {
+		_, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+		req, err := http.NewRequest(http.MethodGet, "https://example.org/foo", nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(tcpReqs).To(Receive())
+
+		h3Handler = func(req *http.Request) (*http.Response, error) {
+			if req.URL.Host == "example.com" {
+				return nil, &altSvcDialError{broken: []string{"example.com:443"}, err: &quic.IdleTimeoutError{}}
+			}
+			return response(""), nil
+		}
+		_, err = get(http.MethodPost, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(h3Requests).To(Receive())
+		Expect(tcpReqs).To(Receive())
+		Expect(rt.useHTTP3(context.Background(), "example.com:443")).To(BeFalse())
+		// HTTP/3 is still used for the other origin
+		_, err = rt.RoundTrip(req)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(h3Requests).To(Receive())
+		Expect(tcpReqs).To(BeEmpty())
+	})
+
+	It("refuses to replay a request body that can't be recreated", func() {
+		req, err := http.NewRequest(http.MethodGet, "https://example.com/foo", io.NopCloser(strings.NewReader("foobar")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(req.GetBody).To(BeNil())
+		_, err = replayableRequest(req)
+		Expect(err).To(MatchError("http3: request body can't be replayed"))
+	})
+
+	It("uses HTTP/3 for the first request if the HTTPS record advertises it", func() {
+		resolver := &stubHTTPSResolver{records: map[string][]HTTPSRecord{
+			"example.com": {{Priority: 1, ALPN: []string{"h3"}, Port: 8443}},
+		}}
+		rt.HTTPSResolver = resolver
+		_, err := get(http.MethodGet, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(h3Requests).To(Receive())
+		Expect(tcpReqs).To(BeEmpty())
+		alt, ok := rt.cache.get("example.com:443", time.Now())
+		Expect(ok).To(BeTrue())
+		Expect(alt).To(Equal("example.com:8443"))
+	})
+
+	It("doesn't repeat HTTPS record lookups for origins that don't support HTTP/3", func() {
+		tcpHandler = func(*http.Request) (*http.Response, error) { return response(""), nil }
+		resolver := &stubHTTPSResolver{records: map[string][]HTTPSRecord{
+			"example.com": {{Priority: 1, ALPN: []string{"h2"}, TTL: time.Hour}},
+		}}
+		rt.HTTPSResolver = resolver
+		for i := 0; i < 2; i++ {
+			_, err := get(http.MethodGet, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(tcpReqs).To(Receive())
+		}
+		Expect(h3Requests).To(BeEmpty())
+		Expect(resolver.lookups).To(Equal([]string{"example.com"}))
+	})
+
+	It("dials the alternative service", func() {
+		rt = &AltSvcRoundTripper{}
+		rt.cache.update("example.com:443", http.Header{"Alt-Svc": []string{`h3="alt.example.com:8443"`}}, time.Now())
+		origDialAddr := dialAddr
+		defer func() { dialAddr = origDialAddr }()
+		conn := mockquic.NewMockEarlyConnection(mockCtrl)
+		dialAddr = func(_ context.Context, addr string, tlsConf *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+			Expect(addr).To(Equal("alt.example.com:8443"))
+			Expect(tlsConf.ServerName).To(Equal("example.com"))
+			return conn, nil
+		}
+		c, err := rt.dial(context.Background(), "example.com:443", &tls.Config{ServerName: "example.com"}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(conn))
+
+		testErr := errors.New("dial error")
+		dialAddr = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+			return nil, testErr
+		}
+		_, err = rt.dial(context.Background(), "example.com:443", &tls.Config{}, nil)
+		Expect(err).To(MatchError(testErr))
+		var dialErr *altSvcDialError
+		Expect(errors.As(err, &dialErr)).To(BeTrue())
+	})
+
+	It("tries the alternative services in order", func() {
+		rt = &AltSvcRoundTripper{EndpointTimeout: scaleDuration(25 * time.Millisecond)}
+		rt.cache.update("example.com:443", http.Header{"Alt-Svc": []string{`h3="a.example.com:443", h3="b.example.com:443"`}}, time.Now())
+		origDialAddr := dialAddr
+		defer func() { dialAddr = origDialAddr }()
+		conn := mockquic.NewMockEarlyConnection(mockCtrl)
+		var dialed []string
+		dialAddr = func(ctx context.Context, addr string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+			dialed = append(dialed, addr)
+			_, hasDeadline := ctx.Deadline()
+			if addr == "a.example.com:443" {
+				Expect(hasDeadline).To(BeTrue())
+				<-ctx.Done()
+				return nil, ctx.Err()
+			}
+			Expect(hasDeadline).To(BeFalse())
+			return conn, nil
+		}
+		c, err := rt.dial(context.Background(), "example.com:443", &tls.Config{}, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c).To(Equal(conn))
+		Expect(dialed).To(Equal([]string{"a.example.com:443", "b.example.com:443"}))
+	})
+
+	It("reports all alternative services that couldn't be reached", func() {
+		rt = &AltSvcRoundTripper{}
+		rt.cache.update("example.com:443", http.Header{"Alt-Svc": []string{`h3="a.example.com:443", h3="b.example.com:443"`}}, time.Now())
+		origDialAddr := dialAddr
+		defer func() { dialAddr = origDialAddr }()
+		testErr := errors.New("dial error")
+		dialAddr = func(context.Context, string, *tls.Config, *quic.Config) (quic.EarlyConnection, error) {
+			return nil, testErr
+		}
+		_, err := rt.dial(context.Background(), "example.com:443", &tls.Config{}, nil)
+		Expect(err).To(MatchError(testErr))
+		var dialErr *altSvcDialError
+		Expect(errors.As(err, &dialErr)).To(BeTrue())
+		Expect(dialErr.broken).To(Equal([]string{"a.example.com:443", "b.example.com:443"}))
+		rt.checkBroken("example.com:443", err)
+		_, ok := rt.cache.get("example.com:443", time.Now())
+		Expect(ok).To(BeFalse())
+	})
+
+	It("doesn't consider an alternative service broken if the request is canceled", func() {
+		rt = &AltSvcRoundTripper{}
+		rt.cache.update("example.com:443", http.Header{"Alt-Svc": []string{`h3="a.example.com:443", h3="b.example.com:443"`}}, time.Now())
+		origDialAddr := dialAddr
+		defer func() { dialAddr = origDialAddr }()
+		ctx, cancel := context.WithCancel(context.Background())
+		var dialed []string
+		dialAddr = func(ctx context.Context, addr string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+			dialed = append(dialed, addr)
+			cancel()
+			return nil, ctx.Err()
+		}
+		_, err := rt.dial(ctx, "example.com:443", &tls.Config{}, nil)
+		Expect(err).To(MatchError(context.Canceled))
+		var dialErr *altSvcDialError
+		Expect(errors.As(err, &dialErr)).To(BeTrue())
+		Expect(dialErr.broken).To(BeEmpty())
+		Expect(dialed).To(Equal([]string{"a.example.com:443"}))
+	})
+
+	It("only performs a single HTTPS record lookup per origin at a time", func() {
+		resolver := &blockingHTTPSResolver{
+			unblock: make(chan struct{}),
+			records: []HTTPSRecord{{Priority: 1, ALPN: []string{"h3"}, Port: 8443}},
+		}
+		rt.HTTPSResolver = resolver
+		const num = 5
+		results := make(chan bool, num)
+		for i := 0; i < num; i++ {
+			go func() { results <- rt.useHTTP3(context.Background(), "example.com:443") }()
+		}
+		Eventually(resolver.lookups.Load).Should(BeEquivalentTo(1))
+		Consistently(results).ShouldNot(Receive())
+		close(resolver.unblock)
+		for i := 0; i < num; i++ {
+			Eventually(results).Should(Receive(BeTrue()))
+		}
+		Expect(resolver.lookups.Load()).To(BeEquivalentTo(1))
+	})
+})
+
+type blockingHTTPSResolver struct {
+	unblock chan struct{}
+	records []HTTPSRecord
+	lookups atomic.Int32
+}
+
+var _ HTTPSResolver = &blockingHTTPSResolver{}
+
+func (r *blockingHTTPSResolver) LookupHTTPS(ctx context.Context, _ string) ([]HTTPSRecord, error) {
+	r.lookups.Add(1)
+	select {
+	case <-r.unblock:
+		return r.records, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,185 @@
+package http3
+
+import (
+	"net/http"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Alt-Svc", func() {
+	now := time.Now()
+
+	Context("parsing", func() {
+		It("parses the header emitted by the server", func() {
+			svcs, clear := parseAltSvc(`h3=":443"; ma=2592000,h3=":8443"; ma=2592000`, "example.com", now)
+			Expect(clear).To(BeFalse())
+			Expect(svcs).To(Equal([]altSvc{
+				{authority: "example.com:443", expires: now.Add(2592000 * time.Second)},
+				{authority: "example.com:8443", expires: now.Add(2592000 * time.Second)},
+			}))
+		})
+
+		It("uses the default max age", func() {
+			svcs, _ := parseAltSvc(`h3="alt.example.com:443"`, "example.com", now)
+			Expect(svcs).To(Equal([]altSvc{{authority: "alt.example.com:443", expires: now.Add(24 * time.Hour)}}))
+		})
+
+		It("parses IPv6 addresses", func() {
+			svcs, _ := parseAltSvc(`h3="[::1]:443"; ma=60`, "example.com", now)
+			Expect(svcs).To(Equal([]altSvc{{authority: "[::1]:443", expires: now.Add(time.Minute)}}))
+		})
+
+		It("ignores other protocols", func() {
+			svcs, clear := parseAltSvc(`h2=":443", h3-29=":443"; ma=60, h3=":443"; persist=1; ma="60"`, "example.com", now)
+			Expect(clear).To(BeFalse())
+			Expect(svcs).To(Equal([]altSvc{{authority: "example.com:443", expires: now.Add(time.Minute)}}))
+		})
+
+		It("decodes percent-encoded protocol IDs", func() {
+			svcs, _ := parseAltSvc(`%68%33=":443"`, "example.com", now)
+			Expect(svcs).To(HaveLen(1))
+		})
+
+		It("ignores invalid values", func() {
+			for _, v := range []string{`h3`, `h3=:443`, `h3="443"`, `h3=":0"`, `h3=":foo"`, `h3="`} {
+				svcs, clear := parseAltSvc(v, "example.com", now)
+				Expect(clear).To(BeFalse())
+				Expect(svcs).To(BeEmpty())
+			}
+		})
+
+		It("parses clear", func() {
+			_, clear := parseAltSvc(" clear ", "example.com", now)
+			Expect(clear).To(BeTrue())
+		})
+	})
+
+	Context("caching", func() {
+		var cache *altSvcCache
+
+		BeforeEach(func() {
+			cache = &altSvcCache{}
+		})
+
+		header := func(values ...string) http.Header {
+			hdr := http.Header{}
+			for _, v := range values {
+				hdr.Add("Alt-Svc", v)
+			}
+			return hdr
+		}
+
+		It("caches alternative services", func() {
+			_, ok := cache.get("example.com:443", now)
+			Expect(ok).To(BeFalse())
+			cache.update("example.com:443", header(`h3=":8443"; ma=60`), now)
+			alt, ok := cache.get("example.com:443", now)
+			Expect(ok).To(BeTrue())
+			Expect(alt).To(Equal("example.com:8443"))
+			_, ok = cache.get("example.org:443", now)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("ignores responses without an Alt-Svc header", func() {
+			cache.update("example.com:443", header(`h3=":443"`), now)
+			cache.update("example.com:443", http.Header{}, now)
+			_, ok := cache.get("example.com:443", now)
+			Expect(ok).To(BeTrue())
+		})
+
+		It("expires alternative services", func() {
+			cache.update("example.com:443", header(`h3=":443"; ma=10`, `h3=":8443"; ma=60`), now)
+			alt, ok := cache.get("example.com:443", now.Add(9*time.Second))
+			Expect(ok).To(BeTrue())
+			Expect(alt).To(Equal("example.com:443"))
+			alt, ok = cache.get("example.com:443", now.Add(10*time.Second))
+			Expect(ok).To(BeTrue())
+			Expect(alt).To(Equal("example.com:8443"))
+			_, ok = cache.get("example.com:443", now.Add(time.Minute))
+			Expect(ok).To(BeFalse())
+		})
+
+		It("replaces alternative services", func() {
+			cache.update("example.com:443", header(`h3=":443"`), now)
+			cache.update("example.com:443", header(`h3=":1234"`), now)
+			alt, ok := cache.get("example.com:443", now)
+			Expect(ok).To(BeTrue())
+			Expect(alt).To(Equal("example.com:1234"))
+		})
+
+		It("clears alternative services", func() {
+			cache.update("example.com:443", header(`h3=":443"`), now)
+			cache.update("example.com:443", header("clear"), now)
+			_, ok := cache.get("example.com:443", now)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("removes alternative services when HTTP/3 is not advertised anymore", func() {
+			cache.update("example.com:443", header(`h3=":443"`), now)
+			cache.update("example.com:443", header(`h2=":443"`), now)
+			_, ok := cache.get("example.com:443", now)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("skips broken alternative services", func() {
+			cache.update("example.com:443", header(`h3=":443"`, `h3=":8443"`), now)
+			cache.markBroken("example.com:443", "example.com:443", now.Add(time.Minute))
+			alt, ok := cache.get("example.com:443", now)
+			Expect(ok).To(BeTrue())
+			Expect(alt).To(Equal("example.com:8443"))
+			// re-advertising the alternative service doesn't clear the broken state
+			cache.update("example.com:443", header(`h3=":443"`), now)
+			_, ok = cache.get("example.com:443", now)
+			Expect(ok).To(BeFalse())
+			alt, ok = cache.get("example.com:443", now.Add(time.Minute))
+			Expect(ok).To(BeTrue())
+			Expect(alt).To(Equal("example.com:443"))
+		})
+
+		It("tracks broken alternative services per origin", func() {
+			cache.update("example.com:443", header(`h3="alt.example.com:443"`), now)
+			cache.update("example.org:443", header(`h3="alt.example.com:443"`), now)
+			cache.markBroken("example.com:443", "alt.example.com:443", now.Add(time.Minute))
+			_, ok := cache.get("example.com:443", now)
+			Expect(ok).To(BeFalse())
+			alt, ok := cache.get("example.org:443", now)
+			Expect(ok).To(BeTrue())
+			Expect(alt).To(Equal("alt.example.com:443"))
+		})
+
+		It("evicts the least recently used origin when the capacity is reached", func() {
+			cache.capacity = 2
+			cache.update("a.example.com:443", header(`h3=":443"`), now)
+			cache.update("b.example.com:443", header(`h3=":443"`), now)
+			_, ok := cache.get("a.example.com:443", now)
+			Expect(ok).To(BeTrue())
+			cache.markBroken("c.example.com:443", "c.example.com:443", now.Add(time.Minute))
+			Expect(cache.origins).To(HaveLen(2))
+			Expect(cache.origins).To(HaveKey("a.example.com:443"))
+			Expect(cache.origins).To(HaveKey("c.example.com:443"))
+			_, ok = cache.get("b.example.com:443", now)
+			Expect(ok).To(BeFalse())
+		})
+
+		It("removes origins once their state has expired", func() {
+			cache.update("example.com:443", header(`h3=":443"; ma=10`), now)
+			cache.markBroken("example.com:443", "example.com:443", now.Add(time.Minute))
+			_, ok := cache.get("example.com:443", now.Add(time.Minute))
+			Expect(ok).To(BeFalse())
+			Expect(cache.origins).To(BeEmpty())
+			Expect(cache.lru.Len()).To(BeZero())
+		})
+
+		It("remembers HTTPS record lookups until they expire", func() {
+			Expect(cache.lookedUp("example.com:443", now)).To(BeFalse())
+			cache.setLookedUp("example.com:443", now.Add(time.Minute))
+			Expect(cache.lookedUp("example.com:443", now)).To(BeTrue())
+			Expect(cache.lookedUp("example.com:443", now.Add(time.Minute))).To(BeFalse())
+			_, ok := cache.get("example.com:443", now.Add(time.Minute))
+			Expect(ok).To(BeFalse())
+			Expect(cache.origins).To(BeEmpty())
+		})
+	})
+})
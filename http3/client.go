@@ -8,23 +8,39 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3/internal/qpackdyn"
 	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/internal/utils"
 	"github.com/quic-go/quic-go/quicvarint"
-
-	"github.com/quic-go/qpack"
 )
 
-// MethodGet0RTT allows a GET request to be sent using 0-RTT.
+// MethodGet0RTT allows a GET request to be sent using 0-RTT,
+// regardless of the RoundTripper's Allow0RTTRequest policy.
 // Note that 0-RTT data doesn't provide replay protection.
 const MethodGet0RTT = "GET_0RTT"
 
+// used0RTTContextKey is set on the Response.Request of responses to requests sent in 0-RTT.
+var used0RTTContextKey = &contextKey{"used-0rtt"}
+
+// ResponseUsed0RTT reports whether the response was served for a request sent in 0-RTT,
+// i.e. before completion of the handshake.
+// If the server rejected 0-RTT, or responded with 425 (Too Early), the request is replayed
+// after completion of the handshake, and ResponseUsed0RTT returns false.
+func ResponseUsed0RTT(rsp *http.Response) bool {
+	if rsp.Request == nil {
+		return false
+	}
+	used, _ := rsp.Request.Context().Value(used0RTTContextKey).(bool)
+	return used
+}
+
 const (
 	defaultUserAgent              = "quic-go HTTP/3"
 	defaultMaxResponseHeaderBytes = 10 * 1 << 20 // 10 MB
@@ -40,12 +56,17 @@ type dialFunc func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *qu
 var dialAddr dialFunc = quic.DialAddrEarly
 
 type roundTripperOpts struct {
-	DisableCompression bool
-	EnableDatagram     bool
-	MaxHeaderBytes     int64
-	AdditionalSettings map[uint64]uint64
-	StreamHijacker     func(FrameType, quic.Connection, quic.Stream, error) (hijacked bool, err error)
-	UniStreamHijacker  func(StreamType, quic.Connection, quic.ReceiveStream, error) (hijacked bool)
+	DisableCompression    bool
+	EnableDatagram        bool
+	MaxHeaderBytes        int64
+	QPACKMaxTableCapacity int
+	QPACKBlockedStreams   int
+	AdditionalSettings    map[uint64]uint64
+	Allow0RTTRequest      func(*http.Request) bool
+	StreamHijacker        func(FrameType, quic.Connection, quic.Stream, error) (hijacked bool, err error)
+	UniStreamHijacker     func(StreamType, quic.Connection, quic.ReceiveStream, error) (hijacked bool)
+	PushHandler           func(*PushPromise)
+	MaxConcurrentPushes   int
 }
 
 // client is a HTTP3 client doing requests
@@ -60,10 +81,20 @@ type client struct {
 
 	requestWriter *requestWriter
 
-	decoder *qpack.Decoder
+	qpackMaxTableCapacity uint64
+	qpackBlockedStreams   uint64
+	encoder               *qpackdyn.Encoder
+	decoder               *qpackdyn.Decoder // set when dialing
 
 	hostname string
 	conn     atomic.Pointer[quic.EarlyConnection]
+	goAway   atomic.Bool // set when the server sent a GOAWAY frame
+
+	// The number of requests that are currently being processed.
+	// Once the server sent a GOAWAY frame, the connection is closed when this drops to zero.
+	activeRequests atomic.Int64
+
+	pushes *clientPushes // nil if server push is disabled
 
 	logger utils.Logger
 }
@@ -103,29 +134,43 @@ func newClient(hostname string, tlsConf *tls.Config, opts *roundTripperOpts, con
 	// Replace existing ALPNs by H3
 	tlsConf.NextProtos = []string{versionToALPN(conf.Versions[0])}
 
+	maxTableCapacity, blockedStreams := qpackLimits(opts.QPACKMaxTableCapacity, opts.QPACKBlockedStreams)
+	encoder := qpackdyn.NewEncoder(maxTableCapacity)
+	var pushes *clientPushes
+	if opts.PushHandler != nil {
+		pushes = newClientPushes(opts.MaxConcurrentPushes)
+	}
 	return &client{
-		hostname:      authorityAddr("https", hostname),
-		tlsConf:       tlsConf,
-		requestWriter: newRequestWriter(logger),
-		decoder:       qpack.NewDecoder(func(hf qpack.HeaderField) {}),
-		config:        conf,
-		opts:          opts,
-		dialer:        dialer,
-		logger:        logger,
+		hostname:              authorityAddr("https", hostname),
+		tlsConf:               tlsConf,
+		requestWriter:         newRequestWriter(encoder, logger),
+		qpackMaxTableCapacity: maxTableCapacity,
+		qpackBlockedStreams:   blockedStreams,
+		encoder:               encoder,
+		config:                conf,
+		opts:                  opts,
+		dialer:                dialer,
+		pushes:                pushes,
+		logger:                logger,
 	}, nil
 }
 
 func (c *client) dial(ctx context.Context) error {
+	trace := httptrace.ContextClientTrace(ctx)
 	var err error
 	var conn quic.EarlyConnection
 	if c.dialer != nil {
+		// The dialer resolves the address, and is responsible for tracing the start of the handshake.
 		conn, err = c.dialer(ctx, c.hostname, c.tlsConf, c.config)
 	} else {
+		traceTLSHandshakeStart(trace)
 		conn, err = dialAddr(ctx, c.hostname, c.tlsConf, c.config)
 	}
 	if err != nil {
+		traceTLSHandshakeDone(trace, tls.ConnectionState{}, err)
 		return err
 	}
+	c.decoder = newConnQPACKDecoder(conn, c.qpackMaxTableCapacity, c.qpackBlockedStreams)
 	c.conn.Store(&conn)
 
 	// send the SETTINGs frame, using 0-RTT data, if possible
@@ -152,7 +197,16 @@ func (c *client) setupConn(conn quic.EarlyConnection) error {
 	b := make([]byte, 0, 64)
 	b = quicvarint.Append(b, streamTypeControlStream)
 	// send the SETTINGS frame
-	b = (&settingsFrame{Datagram: c.opts.EnableDatagram, Other: c.opts.AdditionalSettings}).Append(b)
+	b = (&settingsFrame{
+		QPACKMaxTableCapacity: c.qpackMaxTableCapacity,
+		QPACKBlockedStreams:   c.qpackBlockedStreams,
+		Datagram:              c.opts.EnableDatagram,
+		Other:                 c.opts.AdditionalSettings,
+	}).Append(b)
+	if c.pushes != nil {
+		// enable server push
+		return c.pushes.setControlStream(str, b)
+	}
 	_, err = str.Write(b)
 	return err
 }
@@ -161,6 +215,10 @@ func (c *client) handleBidirectionalStreams(conn quic.EarlyConnection) {
 	for {
 		str, err := conn.AcceptStream(context.Background())
 		if err != nil {
+			if errors.Is(err, quic.Err0RTTRejected) {
+				conn.NextConnection()
+				continue
+			}
 			c.logger.Debugf("accepting bidirectional stream failed: %s", err)
 			return
 		}
@@ -180,10 +238,23 @@ func (c *client) handleBidirectionalStreams(conn quic.EarlyConnection) {
 }
 
 func (c *client) handleUnidirectionalStreams(conn quic.EarlyConnection) {
+	var rcvdQPACKEncoderStr, rcvdQPACKDecoderStr atomic.Bool
+
 	for {
 		str, err := conn.AcceptUniStream(context.Background())
 		if err != nil {
+			if errors.Is(err, quic.Err0RTTRejected) {
+				// The server rejected 0-RTT, and the control stream we opened in 0-RTT was lost.
+				// Once the handshake completes, we need to send our SETTINGS again.
+				conn.NextConnection()
+				if err := c.setupConn(conn); err != nil {
+					c.logger.Debugf("Setting up connection failed: %s", err)
+					conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeInternalError), "")
+				}
+				continue
+			}
 			c.logger.Debugf("accepting unidirectional stream failed: %s", err)
+			c.decoder.Close(err)
 			return
 		}
 
@@ -199,13 +270,22 @@ func (c *client) handleUnidirectionalStreams(conn quic.EarlyConnection) {
 			// We're only interested in the control stream here.
 			switch streamType {
 			case streamTypeControlStream:
-			case streamTypeQPACKEncoderStream, streamTypeQPACKDecoderStream:
-				// Our QPACK implementation doesn't use the dynamic table yet.
-				// TODO: check that only one stream of each type is opened.
+			case streamTypeQPACKEncoderStream:
+				if !rcvdQPACKEncoderStr.CompareAndSwap(false, true) {
+					conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeStreamCreationError), "duplicate QPACK encoder stream")
+					return
+				}
+				handleQPACKStream(conn, str, c.decoder.ReadEncoderStream, qpackdyn.ErrEncoderStream, ErrCodeQPACKEncoderStreamError)
+				return
+			case streamTypeQPACKDecoderStream:
+				if !rcvdQPACKDecoderStr.CompareAndSwap(false, true) {
+					conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeStreamCreationError), "duplicate QPACK decoder stream")
+					return
+				}
+				handleQPACKStream(conn, str, c.encoder.ReadDecoderStream, qpackdyn.ErrDecoderStream, ErrCodeQPACKDecoderStreamError)
 				return
 			case streamTypePushStream:
-				// We never increased the Push ID, so we don't expect any push streams.
-				conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeIDError), "")
+				c.handlePushStream(conn, str)
 				return
 			default:
 				if c.opts.UniStreamHijacker != nil && c.opts.UniStreamHijacker(StreamType(streamType), conn, str, nil) {
@@ -224,14 +304,45 @@ func (c *client) handleUnidirectionalStreams(conn quic.EarlyConnection) {
 				conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeMissingSettings), "")
 				return
 			}
-			if !sf.Datagram {
+			if err := enableQPACKEncoder(conn, c.encoder, sf); err != nil {
+				c.logger.Debugf("enabling the QPACK dynamic table failed: %s", err)
+				conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeInternalError), "")
 				return
 			}
 			// If datagram support was enabled on our side as well as on the server side,
 			// we can expect it to have been negotiated both on the transport and on the HTTP/3 layer.
 			// Note: ConnectionState() will block until the handshake is complete (relevant when using 0-RTT).
-			if c.opts.EnableDatagram && !conn.ConnectionState().SupportsDatagrams {
+			if sf.Datagram && c.opts.EnableDatagram && !conn.ConnectionState().SupportsDatagrams {
 				conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeSettingsError), "missing QUIC Datagram support")
+				return
+			}
+			for {
+				f, err := parseNextFrame(str, nil)
+				if err != nil {
+					return
+				}
+				switch f := f.(type) {
+				case *goAwayFrame:
+					// The server is shutting down the connection.
+					// Requests that were already sent will still be processed, but new requests need to use a new connection.
+					// Once all of them have completed, we close the connection, see Section 5.2 of RFC 9114.
+					c.goAway.Store(true)
+					if c.activeRequests.Load() == 0 {
+						conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), "")
+					}
+				case *cancelPushFrame:
+					if c.pushes == nil {
+						conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeIDError), "")
+						return
+					}
+					if err := c.pushes.cancelPush(c, f.PushID); err != nil {
+						conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeIDError), err.Error())
+						return
+					}
+				default:
+					conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), "")
+					return
+				}
 			}
 		}(str)
 	}
@@ -263,34 +374,122 @@ func (c *client) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Respon
 }
 
 func (c *client) roundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Response, error) {
-	if authorityAddr("https", hostnameFromRequest(req)) != c.hostname {
+	if !c.CanServeOrigin(authorityAddr("https", hostnameFromRequest(req))) {
 		return nil, fmt.Errorf("http3 client BUG: RoundTripOpt called for the wrong client (expected %s, got %s)", c.hostname, req.Host)
 	}
 
+	trace := httptrace.ContextClientTrace(req.Context())
+	var dialed bool
 	c.dialOnce.Do(func() {
+		dialed = true
 		c.handshakeErr = c.dial(req.Context())
 	})
 	if c.handshakeErr != nil {
 		return nil, c.handshakeErr
 	}
+	if c.goAway.Load() {
+		return nil, errGoAway
+	}
 
 	// At this point, c.conn is guaranteed to be set.
 	conn := *c.conn.Load()
 
-	// Immediately send out this request, if this is a 0-RTT request.
+	// Immediately send out this request, if it is eligible for 0-RTT.
+	// Otherwise, wait for the handshake to complete.
+	var early bool
+	handshakeComplete := conn.HandshakeComplete()
+	select {
+	case <-handshakeComplete:
+	default:
+		if req.Method == MethodGet0RTT || c.allow0RTTRequest(req) {
+			early = true
+		} else {
+			select {
+			case <-handshakeComplete:
+			case <-req.Context().Done():
+				return nil, req.Context().Err()
+			}
+		}
+	}
 	if req.Method == MethodGet0RTT {
 		req.Method = http.MethodGet
-	} else {
-		// wait for the handshake to complete
-		select {
-		case <-conn.HandshakeComplete():
-		case <-req.Context().Done():
-			return nil, req.Context().Err()
+	}
+	if dialed {
+		traceHandshakeDone(trace, conn)
+	}
+	traceGotConn(trace, conn, !dialed, early)
+
+	rsp, err := c.sendRequest(req, conn, opt)
+	if !early {
+		return rsp, err
+	}
+	// If the server rejected 0-RTT, or it refused to process the request since it was sent in 0-RTT,
+	// the request is replayed after completion of the handshake, see Section 4.2 of RFC 8470.
+	var rejected bool
+	switch {
+	case errors.Is(err, quic.Err0RTTRejected):
+		rejected = true
+	case err == nil && rsp.StatusCode == http.StatusTooEarly:
+		rsp.Body.Close()
+	case err == nil:
+		rsp.Request = rsp.Request.WithContext(context.WithValue(rsp.Request.Context(), used0RTTContextKey, true))
+		return rsp, nil
+	default:
+		return nil, err
+	}
+	select {
+	case <-handshakeComplete:
+	case <-conn.Context().Done():
+		return nil, context.Cause(conn.Context())
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+	if rejected {
+		conn.NextConnection()
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
 		}
+		r := *req
+		r.Body = body
+		req = &r
+	}
+	// The request was already sent on this connection, so it has to be replayed here.
+	opt.failIfBlocked = false
+	return c.sendRequest(req, conn, opt)
+}
+
+// allow0RTTRequest decides whether a request may be sent before completion of the handshake.
+// Only requests that can be replayed are eligible, since the server might reject 0-RTT.
+func (c *client) allow0RTTRequest(req *http.Request) bool {
+	hasBody := req.Body != nil && req.Body != http.NoBody
+	if hasBody && req.GetBody == nil {
+		return false
 	}
+	if c.opts.Allow0RTTRequest != nil {
+		return c.opts.Allow0RTTRequest(req)
+	}
+	if hasBody {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
 
-	str, err := conn.OpenStreamSync(req.Context())
+func (c *client) sendRequest(req *http.Request, conn quic.EarlyConnection, opt RoundTripOpt) (*http.Response, error) {
+	c.activeRequests.Add(1)
+	if c.goAway.Load() {
+		c.requestDone(conn)
+		return nil, errGoAway
+	}
+	str, err := c.openRequestStream(req.Context(), conn, opt)
 	if err != nil {
+		c.requestDone(conn)
 		return nil, err
 	}
 
@@ -307,6 +506,9 @@ func (c *client) roundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Respon
 			str.CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
 		case <-reqDone:
 		}
+		if !opt.DontCloseRequestStream {
+			c.requestDone(conn)
+		}
 	}()
 
 	doneChan := reqDone
@@ -317,6 +519,9 @@ func (c *client) roundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Respon
 	if rerr.err != nil { // if any error occurred
 		close(reqDone)
 		<-done
+		if opt.DontCloseRequestStream {
+			c.requestDone(conn)
+		}
 		if rerr.streamErr != 0 { // if it was a stream error
 			str.CancelWrite(quic.StreamErrorCode(rerr.streamErr))
 		}
@@ -332,10 +537,24 @@ func (c *client) roundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Respon
 	if opt.DontCloseRequestStream {
 		close(reqDone)
 		<-done
+		// The application keeps using the stream, e.g. for WebTransport.
+		// The request is active until the stream is closed.
+		go func() {
+			<-str.Context().Done()
+			c.requestDone(conn)
+		}()
 	}
 	return rsp, maybeReplaceError(rerr.err)
 }
 
+// requestDone is called when the application is done processing a request.
+// If the server sent a GOAWAY frame, the connection is closed once all requests have completed.
+func (c *client) requestDone(conn quic.Connection) {
+	if c.activeRequests.Add(-1) == 0 && c.goAway.Load() {
+		conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), "")
+	}
+}
+
 // cancelingReader reads from the io.Reader.
 // It cancels writing on the stream if any error other than io.EOF occurs.
 type cancelingReader struct {
@@ -351,6 +570,24 @@ func (r *cancelingReader) Read(b []byte) (int, error) {
 	return n, err
 }
 
+// openRequestStream opens a new request stream.
+// If opt.failIfBlocked is set, it doesn't wait for the server to allow opening another stream,
+// but returns errStreamLimitReached instead.
+func (c *client) openRequestStream(ctx context.Context, conn quic.EarlyConnection, opt RoundTripOpt) (quic.Stream, error) {
+	if !opt.failIfBlocked {
+		return conn.OpenStreamSync(ctx)
+	}
+	str, err := conn.OpenStream()
+	if err != nil {
+		// quic-go returns a temporary error if the stream limit is reached
+		if nerr, ok := err.(interface{ Temporary() bool }); ok && nerr.Temporary() {
+			return nil, errStreamLimitReached
+		}
+		return nil, err
+	}
+	return str, nil
+}
+
 func (c *client) sendRequestBody(str Stream, body io.ReadCloser, contentLength int64) error {
 	defer body.Close()
 	buf := make([]byte, bodyCopyBufferSize)
@@ -380,15 +617,22 @@ func (c *client) doRequest(req *http.Request, conn quic.EarlyConnection, str qui
 	if !c.opts.DisableCompression && req.Method != "HEAD" && req.Header.Get("Accept-Encoding") == "" && req.Header.Get("Range") == "" {
 		requestGzip = true
 	}
+	trace := httptrace.ContextClientTrace(req.Context())
 	if err := c.requestWriter.WriteRequestHeader(str, req, requestGzip); err != nil {
+		traceWroteRequest(trace, err)
 		return nil, newStreamError(ErrCodeInternalError, err)
 	}
+	traceWroteHeaders(trace)
 
-	if req.Body == nil && !opt.DontCloseRequestStream {
-		str.Close()
+	if req.Body == nil {
+		if !opt.DontCloseRequestStream {
+			str.Close()
+		}
+		traceWroteRequest(trace, nil)
 	}
 
 	hstr := newStream(str, func() { conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), "") })
+	hstr.onPushPromise = func(f *pushPromiseFrame) error { return c.handlePushPromise(req, conn, str, f) }
 	if req.Body != nil {
 		// send the request body asynchronously
 		go func() {
@@ -398,18 +642,37 @@ func (c *client) doRequest(req *http.Request, conn quic.EarlyConnection, str qui
 			if req.ContentLength > 0 {
 				contentLength = req.ContentLength
 			}
-			if err := c.sendRequestBody(hstr, req.Body, contentLength); err != nil {
+			err := c.sendRequestBody(hstr, req.Body, contentLength)
+			if err != nil {
 				c.logger.Errorf("Error writing request: %s", err)
 			}
+			traceWroteRequest(trace, err)
 			if !opt.DontCloseRequestStream {
 				hstr.Close()
 			}
 		}()
 	}
 
-	frame, err := parseNextFrame(str, nil)
-	if err != nil {
-		return nil, newStreamError(ErrCodeFrameError, err)
+	var frame frame
+	var gotFirstByte bool
+	for {
+		var err error
+		frame, err = parseNextFrame(str, nil)
+		if err != nil {
+			return nil, newStreamError(ErrCodeFrameError, err)
+		}
+		if trace != nil && !gotFirstByte {
+			gotFirstByte = true
+			traceGotFirstResponseByte(trace)
+		}
+		// The server might promise pushes before sending the response.
+		pf, ok := frame.(*pushPromiseFrame)
+		if !ok {
+			break
+		}
+		if err := c.handlePushPromise(req, conn, str, pf); err != nil {
+			return nil, requestError{err: err}
+		}
 	}
 	hf, ok := frame.(*headersFrame)
 	if !ok {
@@ -422,10 +685,12 @@ func (c *client) doRequest(req *http.Request, conn quic.EarlyConnection, str qui
 	if _, err := io.ReadFull(str, headerBlock); err != nil {
 		return nil, newStreamError(ErrCodeRequestIncomplete, err)
 	}
-	hfs, err := c.decoder.DecodeFull(headerBlock)
+	hfs, err := decodeHeaders(req.Context(), c.decoder, str, headerBlock)
 	if err != nil {
-		// TODO: use the right error code
-		return nil, newConnError(ErrCodeGeneralProtocolError, err)
+		if errors.Is(err, qpackdyn.ErrDecompressionFailed) {
+			return nil, newConnError(ErrCodeQPACKDecompressionFailed, err)
+		}
+		return nil, newStreamError(ErrCodeRequestIncomplete, err)
 	}
 
 	res, err := responseFromHeaders(hfs)
@@ -472,6 +737,31 @@ func (c *client) doRequest(req *http.Request, conn quic.EarlyConnection, str qui
 	return res, requestError{}
 }
 
+// CanServeOrigin says if requests for the origin (host:port) can be sent on this connection.
+// Besides the origin that the connection was established for, this is the case for all origins
+// using the same port that are covered by the server's certificate, see Section 3.3 of RFC 9114.
+func (c *client) CanServeOrigin(hostname string) bool {
+	if hostname == c.hostname {
+		return true
+	}
+	if c.tlsConf.InsecureSkipVerify || !c.HandshakeComplete() {
+		return false
+	}
+	conn := *c.conn.Load()
+	if conn.Context().Err() != nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(hostname)
+	if err != nil {
+		return false
+	}
+	if _, p, err := net.SplitHostPort(c.hostname); err != nil || p != port {
+		return false
+	}
+	certs := conn.ConnectionState().TLS.PeerCertificates
+	return len(certs) > 0 && certs[0].VerifyHostname(host) == nil
+}
+
 func (c *client) HandshakeComplete() bool {
 	conn := c.conn.Load()
 	if conn == nil {
@@ -5,14 +5,19 @@ import (
 	"compress/gzip"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptrace"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3/internal/qpackdyn"
 	mockquic "github.com/quic-go/quic-go/internal/mocks/quic"
 	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/internal/utils"
@@ -25,6 +30,13 @@ import (
 	"go.uber.org/mock/gomock"
 )
 
+// streamLimitError is the error returned by quic-go when the peer's stream limit is reached.
+type streamLimitError struct{}
+
+func (streamLimitError) Error() string   { return "too many open streams" }
+func (streamLimitError) Temporary() bool { return true }
+func (streamLimitError) Timeout() bool   { return false }
+
 var _ = Describe("Client", func() {
 	var (
 		cl            *client
@@ -201,6 +213,43 @@ var _ = Describe("Client", func() {
 		})
 	})
 
+	Context("coalescing connections", func() {
+		var conn *mockquic.MockEarlyConnection
+
+		BeforeEach(func() {
+			conn = mockquic.NewMockEarlyConnection(mockCtrl)
+			var c quic.EarlyConnection = conn
+			cl.conn.Store(&c)
+		})
+
+		setCertificate := func(dnsNames ...string) {
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			conn.EXPECT().ConnectionState().Return(quic.ConnectionState{
+				TLS: tls.ConnectionState{PeerCertificates: []*x509.Certificate{{DNSNames: dnsNames}}},
+			}).AnyTimes()
+		}
+
+		It("serves origins covered by the certificate", func() {
+			setCertificate("*.clemente.io")
+			Expect(cl.CanServeOrigin("quic.clemente.io:1337")).To(BeTrue())
+			Expect(cl.CanServeOrigin("www.clemente.io:1337")).To(BeTrue())
+			Expect(cl.CanServeOrigin("www.clemente.io:443")).To(BeFalse())
+			Expect(cl.CanServeOrigin("example.com:1337")).To(BeFalse())
+		})
+
+		It("doesn't serve other origins before completion of the handshake", func() {
+			conn.EXPECT().HandshakeComplete().Return(make(chan struct{}))
+			Expect(cl.CanServeOrigin("www.clemente.io:1337")).To(BeFalse())
+		})
+
+		It("doesn't serve other origins if the certificate isn't verified", func() {
+			cl.tlsConf.InsecureSkipVerify = true
+			setCertificate("*.clemente.io")
+			Expect(cl.CanServeOrigin("www.clemente.io:1337")).To(BeFalse())
+		})
+	})
+
 	Context("hijacking bidirectional streams", func() {
 		var (
 			request              *http.Request
@@ -487,6 +536,63 @@ var _ = Describe("Client", func() {
 			time.Sleep(scaleDuration(20 * time.Millisecond)) // don't EXPECT any calls to conn.CloseWithError
 		})
 
+		It("stops sending requests and closes the idle connection after receiving a GOAWAY frame", func() {
+			pr, pw := io.Pipe()
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Read(gomock.Any()).DoAndReturn(pr.Read).AnyTimes()
+			conn.EXPECT().AcceptUniStream(gomock.Any()).Return(controlStr, nil)
+			conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-testDone
+				return nil, errors.New("test done")
+			})
+			sendGoAway := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer pw.Close()
+				b := quicvarint.Append(nil, streamTypeControlStream)
+				b = (&settingsFrame{}).Append(b)
+				_, err := pw.Write(b)
+				Expect(err).ToNot(HaveOccurred())
+				<-sendGoAway
+				_, err = pw.Write((&goAwayFrame{StreamID: 4}).Append(nil))
+				Expect(err).ToNot(HaveOccurred())
+			}()
+			closed := make(chan struct{})
+			conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), gomock.Any()).Do(func(quic.ApplicationErrorCode, string) error {
+				close(closed)
+				return nil
+			})
+			_, err := cl.RoundTripOpt(req, RoundTripOpt{})
+			Expect(err).To(MatchError("done"))
+			close(sendGoAway)
+			Eventually(cl.goAway.Load).Should(BeTrue())
+			Eventually(closed).Should(BeClosed())
+			_, err = cl.RoundTripOpt(req, RoundTripOpt{})
+			Expect(err).To(MatchError(errGoAway))
+		})
+
+		It("closes the connection when receiving an unexpected frame on the control stream", func() {
+			b := quicvarint.Append(nil, streamTypeControlStream)
+			b = (&settingsFrame{}).Append(b)
+			b = (&dataFrame{}).Append(b)
+			r := bytes.NewReader(b)
+			controlStr := mockquic.NewMockStream(mockCtrl)
+			controlStr.EXPECT().Read(gomock.Any()).DoAndReturn(r.Read).AnyTimes()
+			conn.EXPECT().AcceptUniStream(gomock.Any()).Return(controlStr, nil)
+			conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+				<-testDone
+				return nil, errors.New("test done")
+			})
+			done := make(chan struct{})
+			conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), gomock.Any()).Do(func(quic.ApplicationErrorCode, string) error {
+				close(done)
+				return nil
+			})
+			_, err := cl.RoundTripOpt(req, RoundTripOpt{})
+			Expect(err).To(MatchError("done"))
+			Eventually(done).Should(BeClosed())
+		})
+
 		for _, t := range []uint64{streamTypeQPACKEncoderStream, streamTypeQPACKDecoderStream} {
 			streamType := t
 			name := "encoder"
@@ -494,7 +600,7 @@ var _ = Describe("Client", func() {
 				name = "decoder"
 			}
 
-			It(fmt.Sprintf("ignores the QPACK %s streams", name), func() {
+			It(fmt.Sprintf("closes the connection when the QPACK %s stream is closed", name), func() {
 				buf := bytes.NewBuffer(quicvarint.Append(nil, streamType))
 				str := mockquic.NewMockStream(mockCtrl)
 				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
@@ -506,9 +612,39 @@ var _ = Describe("Client", func() {
 					<-testDone
 					return nil, errors.New("test done")
 				})
+				done := make(chan struct{})
+				conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeClosedCriticalStream), gomock.Any()).Do(func(quic.ApplicationErrorCode, string) error {
+					close(done)
+					return nil
+				})
+				_, err := cl.RoundTripOpt(req, RoundTripOpt{})
+				Expect(err).To(MatchError("done"))
+				Eventually(done).Should(BeClosed())
+			})
+
+			It(fmt.Sprintf("rejects duplicate QPACK %s streams", name), func() {
+				buf1 := bytes.NewBuffer(quicvarint.Append(nil, streamType))
+				str1 := mockquic.NewMockStream(mockCtrl)
+				str1.EXPECT().Read(gomock.Any()).DoAndReturn(buf1.Read).AnyTimes()
+				buf2 := bytes.NewBuffer(quicvarint.Append(nil, streamType))
+				str2 := mockquic.NewMockStream(mockCtrl)
+				str2.EXPECT().Read(gomock.Any()).DoAndReturn(buf2.Read).AnyTimes()
+
+				conn.EXPECT().AcceptUniStream(gomock.Any()).Return(str1, nil)
+				conn.EXPECT().AcceptUniStream(gomock.Any()).Return(str2, nil)
+				conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-testDone
+					return nil, errors.New("test done")
+				})
+				done := make(chan struct{})
+				conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeClosedCriticalStream), gomock.Any())
+				conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeStreamCreationError), fmt.Sprintf("duplicate QPACK %s stream", name)).Do(func(quic.ApplicationErrorCode, string) error {
+					close(done)
+					return nil
+				})
 				_, err := cl.RoundTripOpt(req, RoundTripOpt{})
 				Expect(err).To(MatchError("done"))
-				time.Sleep(scaleDuration(20 * time.Millisecond)) // don't EXPECT any calls to str.CancelRead
+				Eventually(done).Should(BeClosed())
 			})
 		}
 
@@ -655,8 +791,9 @@ var _ = Describe("Client", func() {
 		getResponse := func(status int) []byte {
 			buf := &bytes.Buffer{}
 			rstr := mockquic.NewMockStream(mockCtrl)
+			rstr.EXPECT().StreamID().AnyTimes()
 			rstr.EXPECT().Write(gomock.Any()).Do(buf.Write).AnyTimes()
-			rw := newResponseWriter(rstr, nil, utils.DefaultLogger)
+			rw := newResponseWriter(rstr, nil, qpackdyn.NewEncoder(0), utils.DefaultLogger)
 			rw.WriteHeader(status)
 			rw.Flush()
 			return buf.Bytes()
@@ -675,6 +812,8 @@ var _ = Describe("Client", func() {
 				return len(b), nil
 			}) // SETTINGS frame
 			str = mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().StreamID().AnyTimes()
+			str.EXPECT().Context().Return(context.Background()).AnyTimes()
 			conn = mockquic.NewMockEarlyConnection(mockCtrl)
 			conn.EXPECT().OpenUniStream().Return(controlStr, nil)
 			conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
@@ -703,10 +842,19 @@ var _ = Describe("Client", func() {
 			Expect(err).To(MatchError(testErr))
 		})
 
+		It("doesn't block if the stream limit is reached", func() {
+			conn.EXPECT().OpenStream().Return(nil, &streamLimitError{})
+			conn.EXPECT().CloseWithError(gomock.Any(), gomock.Any()).MaxTimes(1)
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+			_, err := cl.RoundTripOpt(req, RoundTripOpt{failIfBlocked: true})
+			Expect(err).To(MatchError(errStreamLimitReached))
+		})
+
 		It("performs a 0-RTT request", func() {
 			testErr := errors.New("stream open error")
 			req.Method = MethodGet0RTT
-			// don't EXPECT any calls to HandshakeComplete()
+			cl.opts.Allow0RTTRequest = func(*http.Request) bool { return false }
+			conn.EXPECT().HandshakeComplete().Return(make(chan struct{}))
 			conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
 			buf := &bytes.Buffer{}
 			str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write).AnyTimes()
@@ -720,6 +868,130 @@ var _ = Describe("Client", func() {
 			Expect(decodeHeader(buf)).To(HaveKeyWithValue(":method", "GET"))
 		})
 
+		Context("0-RTT", func() {
+			var handshakeChan chan struct{}
+
+			BeforeEach(func() {
+				handshakeChan = make(chan struct{})
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{}).AnyTimes()
+				conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			})
+
+			expectResponse := func(str *mockquic.MockStream, status int) {
+				rspBuf := bytes.NewBuffer(getResponse(status))
+				str.EXPECT().StreamID().AnyTimes()
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close()
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			}
+
+			It("sends safe requests in 0-RTT", func() {
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				expectResponse(str, 200)
+				rsp, err := cl.RoundTripOpt(req, RoundTripOpt{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(ResponseUsed0RTT(rsp)).To(BeTrue())
+			})
+
+			It("doesn't send requests in 0-RTT that are not allowed by the policy", func() {
+				cl.opts.Allow0RTTRequest = func(r *http.Request) bool { return r.URL.Path != "/file1.dat" }
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					rsp, err := cl.RoundTripOpt(req, RoundTripOpt{})
+					Expect(err).ToNot(HaveOccurred())
+					Expect(ResponseUsed0RTT(rsp)).To(BeFalse())
+				}()
+				Consistently(done).ShouldNot(BeClosed())
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil)
+				expectResponse(str, 200)
+				close(handshakeChan)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("doesn't send requests in 0-RTT if the body can't be replayed", func() {
+				cl.opts.Allow0RTTRequest = func(*http.Request) bool { return true }
+				req.Method = http.MethodPut
+				req.Body = io.NopCloser(strings.NewReader("foobar"))
+				errChan := make(chan error, 1)
+				go func() {
+					_, err := cl.RoundTripOpt(req, RoundTripOpt{})
+					errChan <- err
+				}()
+				Consistently(errChan).ShouldNot(Receive())
+				testErr := errors.New("test done")
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(nil, testErr)
+				close(handshakeChan)
+				Eventually(errChan).Should(Receive(MatchError(testErr)))
+			})
+
+			It("replays requests when the server responds with 425 (Too Early)", func() {
+				str2 := mockquic.NewMockStream(mockCtrl)
+				str2.EXPECT().Context().Return(context.Background()).AnyTimes()
+				gomock.InOrder(
+					conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil),
+					conn.EXPECT().OpenStreamSync(context.Background()).Return(str2, nil),
+				)
+				expectResponse(str, http.StatusTooEarly)
+				str.EXPECT().CancelRead(gomock.Any()).Do(func(quic.StreamErrorCode) { close(handshakeChan) })
+				expectResponse(str2, 200)
+				rsp, err := cl.RoundTripOpt(req, RoundTripOpt{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(ResponseUsed0RTT(rsp)).To(BeFalse())
+			})
+
+			It("replays requests when 0-RTT is rejected", func() {
+				gomock.InOrder(
+					conn.EXPECT().OpenStreamSync(context.Background()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+						close(handshakeChan)
+						return nil, quic.Err0RTTRejected
+					}),
+					conn.EXPECT().NextConnection().Return(conn),
+					conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil),
+				)
+				expectResponse(str, 200)
+				rsp, err := cl.RoundTripOpt(req, RoundTripOpt{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Expect(ResponseUsed0RTT(rsp)).To(BeFalse())
+			})
+
+			It("replays the request body", func() {
+				cl.opts.Allow0RTTRequest = func(*http.Request) bool { return true }
+				var err error
+				req, err = http.NewRequest(http.MethodPut, "https://quic.clemente.io:1337/upload", strings.NewReader("foobar"))
+				Expect(err).ToNot(HaveOccurred())
+				str2 := mockquic.NewMockStream(mockCtrl)
+				str2.EXPECT().Context().Return(context.Background()).AnyTimes()
+				gomock.InOrder(
+					conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil),
+					conn.EXPECT().OpenStreamSync(context.Background()).Return(str2, nil),
+				)
+				rspBuf := bytes.NewBuffer(getResponse(http.StatusTooEarly))
+				str.EXPECT().StreamID().AnyTimes()
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().Close().MaxTimes(1)
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any()).Do(func(quic.StreamErrorCode) { close(handshakeChan) })
+				rspBuf2 := bytes.NewBuffer(getResponse(200))
+				reqBuf := &bytes.Buffer{}
+				bodySent := make(chan struct{})
+				str2.EXPECT().StreamID().AnyTimes()
+				str2.EXPECT().Write(gomock.Any()).DoAndReturn(reqBuf.Write).AnyTimes()
+				str2.EXPECT().Close().Do(func() error { close(bodySent); return nil })
+				str2.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf2.Read).AnyTimes()
+				rsp, err := cl.RoundTripOpt(req, RoundTripOpt{})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(200))
+				Eventually(bodySent).Should(BeClosed())
+				Expect(reqBuf.String()).To(HaveSuffix("foobar"))
+			})
+		})
+
 		It("returns a response", func() {
 			rspBuf := bytes.NewBuffer(getResponse(418))
 			gomock.InOrder(
@@ -754,6 +1026,87 @@ var _ = Describe("Client", func() {
 			Expect(rsp.StatusCode).To(Equal(418))
 		})
 
+		It("keeps the request active until the stream is closed, with DontCloseRequestStream set", func() {
+			str := mockquic.NewMockStream(mockCtrl)
+			strCtx, strCancel := context.WithCancel(context.Background())
+			str.EXPECT().Context().Return(strCtx).AnyTimes()
+			str.EXPECT().StreamID().AnyTimes()
+			rspBuf := bytes.NewBuffer(getResponse(200))
+			gomock.InOrder(
+				conn.EXPECT().HandshakeComplete().Return(handshakeChan),
+				conn.EXPECT().OpenStreamSync(context.Background()).Return(str, nil),
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{}),
+			)
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			_, err := cl.RoundTripOpt(req, RoundTripOpt{DontCloseRequestStream: true})
+			Expect(err).ToNot(HaveOccurred())
+			Consistently(cl.activeRequests.Load, scaleDuration(20*time.Millisecond)).Should(BeEquivalentTo(1))
+			// the application closes the stream, e.g. when the WebTransport session ends
+			strCancel()
+			Eventually(cl.activeRequests.Load).Should(BeZero())
+		})
+
+		It("traces the request", func() {
+			var events []string
+			var gotConnInfo httptrace.GotConnInfo
+			trace := &httptrace.ClientTrace{
+				TLSHandshakeStart: func() { events = append(events, "TLSHandshakeStart") },
+				TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+					Expect(err).ToNot(HaveOccurred())
+					events = append(events, "TLSHandshakeDone")
+				},
+				GotConn: func(info httptrace.GotConnInfo) {
+					gotConnInfo = info
+					events = append(events, "GotConn")
+				},
+				WroteHeaderField: func(key string, _ []string) {
+					if key == ":method" {
+						events = append(events, "WroteHeaderField")
+					}
+				},
+				WroteHeaders: func() { events = append(events, "WroteHeaders") },
+				WroteRequest: func(info httptrace.WroteRequestInfo) {
+					Expect(info.Err).ToNot(HaveOccurred())
+					events = append(events, "WroteRequest")
+				},
+				GotFirstResponseByte: func() { events = append(events, "GotFirstResponseByte") },
+			}
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+			rspBuf := bytes.NewBuffer(getResponse(200))
+			conn.EXPECT().HandshakeComplete().Return(handshakeChan).AnyTimes()
+			conn.EXPECT().ConnectionState().Return(quic.ConnectionState{}).AnyTimes()
+			conn.EXPECT().OpenStreamSync(gomock.Any()).Return(str, nil)
+			conn.EXPECT().RemoteAddr().Return(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337})
+			str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
+			str.EXPECT().Close()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(rspBuf.Read).AnyTimes()
+			rsp, err := cl.RoundTripOpt(req, RoundTripOpt{})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.StatusCode).To(Equal(200))
+			Expect(events).To(Equal([]string{
+				"TLSHandshakeStart",
+				"TLSHandshakeDone",
+				"GotConn",
+				"WroteHeaderField",
+				"WroteHeaders",
+				"WroteRequest",
+				"GotFirstResponseByte",
+			}))
+			Expect(gotConnInfo.Reused).To(BeFalse())
+			Expect(gotConnInfo.Conn.RemoteAddr()).To(Equal(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}))
+			Expect(gotConnInfo.Conn.(interface{ Used0RTT() bool }).Used0RTT()).To(BeFalse())
+			// the connection can't be used for reading or writing
+			_, err = gotConnInfo.Conn.Read(make([]byte, 10))
+			Expect(err).To(MatchError(errors.ErrUnsupported))
+			_, err = gotConnInfo.Conn.Write([]byte("foobar"))
+			Expect(err).To(MatchError(errors.ErrUnsupported))
+			Expect(gotConnInfo.Conn.SetDeadline(time.Now())).To(MatchError(errors.ErrUnsupported))
+			Expect(gotConnInfo.Conn.SetReadDeadline(time.Now())).To(MatchError(errors.ErrUnsupported))
+			Expect(gotConnInfo.Conn.SetWriteDeadline(time.Now())).To(MatchError(errors.ErrUnsupported))
+			Expect(gotConnInfo.Conn.Close()).To(MatchError(errors.ErrUnsupported))
+		})
+
 		Context("requests containing a Body", func() {
 			var strBuf *bytes.Buffer
 
@@ -887,6 +1240,7 @@ var _ = Describe("Client", func() {
 					It("cancels a request while waiting for the handshake to complete", func() {
 						ctx, cancel := context.WithCancel(context.Background())
 						req := req.WithContext(ctx)
+						req.Method = http.MethodPost // POST requests are not sent in 0-RTT
 						conn.EXPECT().HandshakeComplete().Return(make(chan struct{}))
 
 						errChan := make(chan error)
@@ -993,8 +1347,9 @@ var _ = Describe("Client", func() {
 				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
 				buf := &bytes.Buffer{}
 				rstr := mockquic.NewMockStream(mockCtrl)
+				rstr.EXPECT().StreamID().AnyTimes()
 				rstr.EXPECT().Write(gomock.Any()).Do(buf.Write).AnyTimes()
-				rw := newResponseWriter(rstr, nil, utils.DefaultLogger)
+				rw := newResponseWriter(rstr, nil, qpackdyn.NewEncoder(0), utils.DefaultLogger)
 				rw.Header().Set("Content-Encoding", "gzip")
 				gz := gzip.NewWriter(rw)
 				gz.Write([]byte("gzipped response"))
@@ -1019,8 +1374,9 @@ var _ = Describe("Client", func() {
 				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{})
 				buf := &bytes.Buffer{}
 				rstr := mockquic.NewMockStream(mockCtrl)
+				rstr.EXPECT().StreamID().AnyTimes()
 				rstr.EXPECT().Write(gomock.Any()).Do(buf.Write).AnyTimes()
-				rw := newResponseWriter(rstr, nil, utils.DefaultLogger)
+				rw := newResponseWriter(rstr, nil, qpackdyn.NewEncoder(0), utils.DefaultLogger)
 				rw.Write([]byte("not gzipped"))
 				rw.Flush()
 				str.EXPECT().Write(gomock.Any()).AnyTimes().DoAndReturn(func(p []byte) (int, error) { return len(p), nil })
@@ -27,6 +27,10 @@ const (
 	ErrCodeConnectError         ErrCode = 0x10f
 	ErrCodeVersionFallback      ErrCode = 0x110
 	ErrCodeDatagramError        ErrCode = 0x33
+
+	ErrCodeQPACKDecompressionFailed ErrCode = 0x200
+	ErrCodeQPACKEncoderStreamError  ErrCode = 0x201
+	ErrCodeQPACKDecoderStreamError  ErrCode = 0x202
 )
 
 func (e ErrCode) String() string {
@@ -75,6 +79,12 @@ func (e ErrCode) string() string {
 		return "H3_VERSION_FALLBACK"
 	case ErrCodeDatagramError:
 		return "H3_DATAGRAM_ERROR"
+	case ErrCodeQPACKDecompressionFailed:
+		return "QPACK_DECOMPRESSION_FAILED"
+	case ErrCodeQPACKEncoderStreamError:
+		return "QPACK_ENCODER_STREAM_ERROR"
+	case ErrCodeQPACKDecoderStreamError:
+		return "QPACK_DECODER_STREAM_ERROR"
 	default:
 		return ""
 	}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/quicvarint"
 )
@@ -58,10 +59,14 @@ func parseNextFrame(r io.Reader, unknownFrameHandler unknownFrameHandlerFunc) (f
 			return &headersFrame{Length: l}, nil
 		case 0x4:
 			return parseSettingsFrame(r, l)
-		case 0x3: // CANCEL_PUSH
-		case 0x5: // PUSH_PROMISE
-		case 0x7: // GOAWAY
-		case 0xd: // MAX_PUSH_ID
+		case 0x3:
+			return parseCancelPushFrame(r, l)
+		case 0x5:
+			return parsePushPromiseFrame(qr, l)
+		case 0x7:
+			return parseGoAwayFrame(r, l)
+		case 0xd:
+			return parseMaxPushIDFrame(r, l)
 		}
 		// skip over unknown frames
 		if _, err := io.CopyN(io.Discard, qr, int64(l)); err != nil {
@@ -88,11 +93,17 @@ func (f *headersFrame) Append(b []byte) []byte {
 	return quicvarint.Append(b, f.Length)
 }
 
-const settingDatagram = 0x33
+const (
+	settingQPACKMaxTableCapacity = 0x1
+	settingQPACKBlockedStreams   = 0x7
+	settingDatagram              = 0x33
+)
 
 type settingsFrame struct {
-	Datagram bool
-	Other    map[uint64]uint64 // all settings that we don't explicitly recognize
+	QPACKMaxTableCapacity uint64
+	QPACKBlockedStreams   uint64
+	Datagram              bool
+	Other                 map[uint64]uint64 // all settings that we don't explicitly recognize
 }
 
 func parseSettingsFrame(r io.Reader, l uint64) (*settingsFrame, error) {
@@ -108,7 +119,7 @@ func parseSettingsFrame(r io.Reader, l uint64) (*settingsFrame, error) {
 	}
 	frame := &settingsFrame{}
 	b := bytes.NewReader(buf)
-	var readDatagram bool
+	var readDatagram, readQPACKMaxTableCapacity, readQPACKBlockedStreams bool
 	for b.Len() > 0 {
 		id, err := quicvarint.Read(b)
 		if err != nil { // should not happen. We allocated the whole frame already.
@@ -120,6 +131,18 @@ func parseSettingsFrame(r io.Reader, l uint64) (*settingsFrame, error) {
 		}
 
 		switch id {
+		case settingQPACKMaxTableCapacity:
+			if readQPACKMaxTableCapacity {
+				return nil, fmt.Errorf("duplicate setting: %d", id)
+			}
+			readQPACKMaxTableCapacity = true
+			frame.QPACKMaxTableCapacity = val
+		case settingQPACKBlockedStreams:
+			if readQPACKBlockedStreams {
+				return nil, fmt.Errorf("duplicate setting: %d", id)
+			}
+			readQPACKBlockedStreams = true
+			frame.QPACKBlockedStreams = val
 		case settingDatagram:
 			if readDatagram {
 				return nil, fmt.Errorf("duplicate setting: %d", id)
@@ -148,10 +171,24 @@ func (f *settingsFrame) Append(b []byte) []byte {
 	for id, val := range f.Other {
 		l += quicvarint.Len(id) + quicvarint.Len(val)
 	}
+	if f.QPACKMaxTableCapacity > 0 {
+		l += quicvarint.Len(settingQPACKMaxTableCapacity) + quicvarint.Len(f.QPACKMaxTableCapacity)
+	}
+	if f.QPACKBlockedStreams > 0 {
+		l += quicvarint.Len(settingQPACKBlockedStreams) + quicvarint.Len(f.QPACKBlockedStreams)
+	}
 	if f.Datagram {
 		l += quicvarint.Len(settingDatagram) + quicvarint.Len(1)
 	}
 	b = quicvarint.Append(b, uint64(l))
+	if f.QPACKMaxTableCapacity > 0 {
+		b = quicvarint.Append(b, settingQPACKMaxTableCapacity)
+		b = quicvarint.Append(b, f.QPACKMaxTableCapacity)
+	}
+	if f.QPACKBlockedStreams > 0 {
+		b = quicvarint.Append(b, settingQPACKBlockedStreams)
+		b = quicvarint.Append(b, f.QPACKBlockedStreams)
+	}
 	if f.Datagram {
 		b = quicvarint.Append(b, settingDatagram)
 		b = quicvarint.Append(b, 1)
@@ -162,3 +199,120 @@ func (f *settingsFrame) Append(b []byte) []byte {
 	}
 	return b
 }
+
+// A goAwayFrame initiates the graceful shutdown of a connection, see Section 5.2 of RFC 9114.
+// Sent by the server, StreamID is the first client-initiated bidirectional stream that won't be processed.
+type goAwayFrame struct {
+	StreamID quic.StreamID
+}
+
+func parseGoAwayFrame(r io.Reader, l uint64) (*goAwayFrame, error) {
+	id, err := parseVarIntFrame(r, l)
+	if err != nil {
+		if err == errInvalidVarIntFrame {
+			return nil, errors.New("invalid GOAWAY frame")
+		}
+		return nil, err
+	}
+	return &goAwayFrame{StreamID: quic.StreamID(id)}, nil
+}
+
+func (f *goAwayFrame) Append(b []byte) []byte {
+	return appendVarIntFrame(b, 0x7, uint64(f.StreamID))
+}
+
+// A pushPromiseFrame is sent by the server on a request stream, see Section 7.2.5 of RFC 9114.
+// Like for the HEADERS frame, the encoded field section of the promised request follows the frame header.
+// Length is the length of the field section, excluding the Push ID.
+type pushPromiseFrame struct {
+	PushID uint64
+	Length uint64
+}
+
+func parsePushPromiseFrame(r io.ByteReader, l uint64) (*pushPromiseFrame, error) {
+	id, err := quicvarint.Read(r)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, io.EOF
+		}
+		return nil, err
+	}
+	if n := uint64(quicvarint.Len(id)); n <= l {
+		return &pushPromiseFrame{PushID: id, Length: l - n}, nil
+	}
+	return nil, errors.New("invalid PUSH_PROMISE frame")
+}
+
+func (f *pushPromiseFrame) Append(b []byte) []byte {
+	b = quicvarint.Append(b, 0x5)
+	b = quicvarint.Append(b, uint64(quicvarint.Len(f.PushID))+f.Length)
+	return quicvarint.Append(b, f.PushID)
+}
+
+// A cancelPushFrame requests the cancellation of a server push, see Section 7.2.3 of RFC 9114.
+type cancelPushFrame struct {
+	PushID uint64
+}
+
+func parseCancelPushFrame(r io.Reader, l uint64) (*cancelPushFrame, error) {
+	id, err := parseVarIntFrame(r, l)
+	if err != nil {
+		if err == errInvalidVarIntFrame {
+			return nil, errors.New("invalid CANCEL_PUSH frame")
+		}
+		return nil, err
+	}
+	return &cancelPushFrame{PushID: id}, nil
+}
+
+func (f *cancelPushFrame) Append(b []byte) []byte {
+	return appendVarIntFrame(b, 0x3, f.PushID)
+}
+
+// A maxPushIDFrame is sent by the client to control the number of server pushes, see Section 7.2.7 of RFC 9114.
+type maxPushIDFrame struct {
+	PushID uint64
+}
+
+func parseMaxPushIDFrame(r io.Reader, l uint64) (*maxPushIDFrame, error) {
+	id, err := parseVarIntFrame(r, l)
+	if err != nil {
+		if err == errInvalidVarIntFrame {
+			return nil, errors.New("invalid MAX_PUSH_ID frame")
+		}
+		return nil, err
+	}
+	return &maxPushIDFrame{PushID: id}, nil
+}
+
+func (f *maxPushIDFrame) Append(b []byte) []byte {
+	return appendVarIntFrame(b, 0xd, f.PushID)
+}
+
+var errInvalidVarIntFrame = errors.New("invalid frame")
+
+// parseVarIntFrame parses the payload of a frame that consists of a single variable-length integer.
+func parseVarIntFrame(r io.Reader, l uint64) (uint64, error) {
+	if l > 8 {
+		return 0, errInvalidVarIntFrame
+	}
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, io.EOF
+		}
+		return 0, err
+	}
+	b := bytes.NewReader(buf)
+	v, err := quicvarint.Read(b)
+	if err != nil || b.Len() > 0 {
+		return 0, errInvalidVarIntFrame
+	}
+	return v, nil
+}
+
+func appendVarIntFrame(b []byte, t, v uint64) []byte {
+	b = quicvarint.Append(b, t)
+	b = quicvarint.Append(b, uint64(quicvarint.Len(v)))
+	return quicvarint.Append(b, v)
+}
@@ -100,7 +100,7 @@ var _ = Describe("Frames", func() {
 
 		It("writes", func() {
 			sf := &settingsFrame{Other: map[uint64]uint64{
-				1:  2,
+				42: 2,
 				99: 999,
 				13: 37,
 			}}
@@ -127,6 +127,46 @@ var _ = Describe("Frames", func() {
 			}
 		})
 
+		Context("QPACK", func() {
+			It("reads the QPACK settings", func() {
+				settings := quicvarint.Append(nil, settingQPACKMaxTableCapacity)
+				settings = quicvarint.Append(settings, 4096)
+				settings = quicvarint.Append(settings, settingQPACKBlockedStreams)
+				settings = quicvarint.Append(settings, 16)
+				data := quicvarint.Append(nil, 4) // type byte
+				data = quicvarint.Append(data, uint64(len(settings)))
+				data = append(data, settings...)
+				f, err := parseNextFrame(bytes.NewReader(data), nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(f).To(BeAssignableToTypeOf(&settingsFrame{}))
+				sf := f.(*settingsFrame)
+				Expect(sf.QPACKMaxTableCapacity).To(BeEquivalentTo(4096))
+				Expect(sf.QPACKBlockedStreams).To(BeEquivalentTo(16))
+				Expect(sf.Other).To(BeEmpty())
+			})
+
+			It("rejects duplicate QPACK settings", func() {
+				for _, id := range []uint64{settingQPACKMaxTableCapacity, settingQPACKBlockedStreams} {
+					settings := quicvarint.Append(nil, id)
+					settings = quicvarint.Append(settings, 1)
+					settings = quicvarint.Append(settings, id)
+					settings = quicvarint.Append(settings, 2)
+					data := quicvarint.Append(nil, 4) // type byte
+					data = quicvarint.Append(data, uint64(len(settings)))
+					data = append(data, settings...)
+					_, err := parseNextFrame(bytes.NewReader(data), nil)
+					Expect(err).To(MatchError(fmt.Sprintf("duplicate setting: %d", id)))
+				}
+			})
+
+			It("writes the QPACK settings", func() {
+				sf := &settingsFrame{QPACKMaxTableCapacity: 1234, QPACKBlockedStreams: 42}
+				frame, err := parseNextFrame(bytes.NewReader(sf.Append(nil)), nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame).To(Equal(sf))
+			})
+		})
+
 		Context("H3_DATAGRAM", func() {
 			It("reads the H3_DATAGRAM value", func() {
 				settings := quicvarint.Append(nil, settingDatagram)
@@ -172,6 +212,109 @@ var _ = Describe("Frames", func() {
 		})
 	})
 
+	Context("GOAWAY frames", func() {
+		It("writes and parses", func() {
+			b := (&goAwayFrame{StreamID: 1337}).Append(nil)
+			frame, err := parseNextFrame(bytes.NewReader(b), nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&goAwayFrame{StreamID: 1337}))
+		})
+
+		It("errors on EOF", func() {
+			b := (&goAwayFrame{StreamID: 1337}).Append(nil)
+			for i := range b {
+				_, err := parseNextFrame(bytes.NewReader(b[:i]), nil)
+				Expect(err).To(MatchError(io.EOF))
+			}
+		})
+
+		It("rejects frames with trailing data", func() {
+			b := quicvarint.Append(nil, 0x7)
+			b = quicvarint.Append(b, 2)
+			b = append(b, 0x4, 0x0)
+			_, err := parseNextFrame(bytes.NewReader(b), nil)
+			Expect(err).To(MatchError("invalid GOAWAY frame"))
+		})
+	})
+
+	Context("PUSH_PROMISE frames", func() {
+		It("writes and parses", func() {
+			b := (&pushPromiseFrame{PushID: 1337, Length: 42}).Append(nil)
+			b = append(b, make([]byte, 42)...)
+			r := bytes.NewReader(b)
+			frame, err := parseNextFrame(r, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&pushPromiseFrame{PushID: 1337, Length: 42}))
+			Expect(r.Len()).To(Equal(42))
+		})
+
+		It("errors on EOF", func() {
+			b := (&pushPromiseFrame{PushID: 1337, Length: 42}).Append(nil)
+			for i := range b {
+				_, err := parseNextFrame(bytes.NewReader(b[:i]), nil)
+				Expect(err).To(MatchError(io.EOF))
+			}
+		})
+
+		It("rejects frames that are too short for the push ID", func() {
+			b := quicvarint.Append(nil, 0x5)
+			b = quicvarint.Append(b, 1)
+			b = quicvarint.Append(b, 1337)
+			_, err := parseNextFrame(bytes.NewReader(b), nil)
+			Expect(err).To(MatchError("invalid PUSH_PROMISE frame"))
+		})
+	})
+
+	Context("CANCEL_PUSH frames", func() {
+		It("writes and parses", func() {
+			b := (&cancelPushFrame{PushID: 1337}).Append(nil)
+			frame, err := parseNextFrame(bytes.NewReader(b), nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&cancelPushFrame{PushID: 1337}))
+		})
+
+		It("errors on EOF", func() {
+			b := (&cancelPushFrame{PushID: 1337}).Append(nil)
+			for i := range b {
+				_, err := parseNextFrame(bytes.NewReader(b[:i]), nil)
+				Expect(err).To(MatchError(io.EOF))
+			}
+		})
+
+		It("rejects frames with trailing data", func() {
+			b := quicvarint.Append(nil, 0x3)
+			b = quicvarint.Append(b, 2)
+			b = append(b, 0x4, 0x0)
+			_, err := parseNextFrame(bytes.NewReader(b), nil)
+			Expect(err).To(MatchError("invalid CANCEL_PUSH frame"))
+		})
+	})
+
+	Context("MAX_PUSH_ID frames", func() {
+		It("writes and parses", func() {
+			b := (&maxPushIDFrame{PushID: 1337}).Append(nil)
+			frame, err := parseNextFrame(bytes.NewReader(b), nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&maxPushIDFrame{PushID: 1337}))
+		})
+
+		It("errors on EOF", func() {
+			b := (&maxPushIDFrame{PushID: 1337}).Append(nil)
+			for i := range b {
+				_, err := parseNextFrame(bytes.NewReader(b[:i]), nil)
+				Expect(err).To(MatchError(io.EOF))
+			}
+		})
+
+		It("rejects frames that are too long", func() {
+			b := quicvarint.Append(nil, 0xd)
+			b = quicvarint.Append(b, 1000)
+			b = append(b, make([]byte, 1000)...)
+			_, err := parseNextFrame(bytes.NewReader(b), nil)
+			Expect(err).To(MatchError("invalid MAX_PUSH_ID frame"))
+		})
+	})
+
 	Context("hijacking", func() {
 		It("reads a frame without hijacking the stream", func() {
 			buf := bytes.NewBuffer(quicvarint.Append(nil, 1337))
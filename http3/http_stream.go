@@ -19,6 +19,7 @@ type stream struct {
 	buf []byte
 
 	onFrameError          func()
+	onPushPromise         func(*pushPromiseFrame) error // only set for request streams on the client side
 	bytesRemainingInFrame uint64
 }
 
@@ -47,6 +48,14 @@ func (s *stream) Read(b []byte) (int, error) {
 			case *dataFrame:
 				s.bytesRemainingInFrame = f.Length
 				break parseLoop
+			case *pushPromiseFrame:
+				if s.onPushPromise == nil {
+					s.onFrameError()
+					return 0, errors.New("peer sent an unexpected PUSH_PROMISE frame")
+				}
+				if err := s.onPushPromise(f); err != nil {
+					return 0, err
+				}
 			default:
 				s.onFrameError()
 				// parseNextFrame skips over unknown frame types
@@ -71,6 +80,16 @@ func (s *stream) hasMoreData() bool {
 	return s.bytesRemainingInFrame > 0
 }
 
+// ReadChunk is not supported, since the chunks returned by the QUIC stream contain HTTP/3 frame headers.
+func (s *stream) ReadChunk() ([]byte, func(), error) {
+	return nil, nil, errors.New("http3: ReadChunk is not supported on HTTP/3 streams")
+}
+
+// ReadUnordered is not supported, since the chunks returned by the QUIC stream contain HTTP/3 frame headers.
+func (s *stream) ReadUnordered() (int64, []byte, func(), error) {
+	return 0, nil, nil, errors.New("http3: ReadUnordered is not supported on HTTP/3 streams")
+}
+
 func (s *stream) Write(b []byte) (int, error) {
 	s.buf = s.buf[:0]
 	s.buf = (&dataFrame{Length: uint64(len(b))}).Append(s.buf)
@@ -121,6 +121,33 @@ var _ = Describe("Stream", func() {
 			Expect(err).To(MatchError("peer sent an unexpected frame: *http3.settingsFrame"))
 			Expect(errorCbCalled).To(BeTrue())
 		})
+
+		It("passes PUSH_PROMISE frames to the callback", func() {
+			b := getDataFrame([]byte("foo"))
+			b = (&pushPromiseFrame{PushID: 42, Length: 6}).Append(b)
+			b = append(b, []byte("foobar")...)
+			b = append(b, getDataFrame([]byte("bar"))...)
+			buf.Write(b)
+			var pushIDs []uint64
+			str.(*stream).onPushPromise = func(f *pushPromiseFrame) error {
+				pushIDs = append(pushIDs, f.PushID)
+				_, err := io.CopyN(io.Discard, buf, int64(f.Length))
+				return err
+			}
+			r := make([]byte, 6)
+			n, err := io.ReadFull(str, r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(6))
+			Expect(r).To(Equal([]byte("foobar")))
+			Expect(pushIDs).To(Equal([]uint64{42}))
+		})
+
+		It("errors on PUSH_PROMISE frames if there's no callback", func() {
+			buf.Write((&pushPromiseFrame{PushID: 42}).Append(nil))
+			_, err := str.Read([]byte{0})
+			Expect(err).To(MatchError("peer sent an unexpected PUSH_PROMISE frame"))
+			Expect(errorCbCalled).To(BeTrue())
+		})
 	})
 
 	Context("writing", func() {
@@ -0,0 +1,170 @@
+package http3
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/netip"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// maxHTTPSAliasChain is the maximum number of AliasMode records that are followed when resolving an HTTPS record.
+const maxHTTPSAliasChain = 8
+
+// defaultHTTPSRecordTTL is the time the result of an HTTPS record lookup is used,
+// if the resolver doesn't return a TTL.
+const defaultHTTPSRecordTTL = 5 * time.Minute
+
+// An HTTPSRecord is a DNS HTTPS resource record, as defined in RFC 9460.
+// Only the SvcParams relevant for establishing HTTP/3 connections are represented.
+type HTTPSRecord struct {
+	// Priority is the SvcPriority. A priority of 0 denotes an AliasMode record.
+	Priority uint16
+	// Target is the TargetName. "." (or the empty string) denotes the owner name of the record.
+	Target string
+	// ALPN is the list of protocol IDs of the alpn SvcParam.
+	ALPN []string
+	// NoDefaultALPN is set if the no-default-alpn SvcParam is present.
+	NoDefaultALPN bool
+	// Port is the value of the port SvcParam. 0 if not present.
+	Port uint16
+	// IPv4Hint and IPv6Hint are the values of the ipv4hint and ipv6hint SvcParams.
+	IPv4Hint []netip.Addr
+	IPv6Hint []netip.Addr
+	// TTL is the time to live of the record.
+	// If zero, the result of the lookup is used for 5 minutes.
+	TTL time.Duration
+}
+
+// An HTTPSResolver looks up HTTPS resource records (RFC 9460).
+// quic-go doesn't implement DNS resolution itself, implementations will usually use a DNS library.
+type HTTPSResolver interface {
+	// LookupHTTPS returns the HTTPS records for name.
+	// If no records exist, it returns an empty slice and no error.
+	LookupHTTPS(ctx context.Context, name string) ([]HTTPSRecord, error)
+}
+
+// httpsQueryName returns the QNAME used to look up the HTTPS records of an origin, see Section 9.1 of RFC 9460.
+// Origins that don't use the default port use a port prefix, e.g. _8443._https.example.com.
+func httpsQueryName(host, port string) string {
+	if port == "443" {
+		return host
+	}
+	return "_" + port + "._https." + host
+}
+
+// lookupHTTPSEndpoints looks up the HTTPS records for origin (host:port), and returns the addresses
+// of the HTTP/3 endpoints, in the order they should be tried.
+// For every endpoint, the IPv4 and IPv6 hints are returned first, followed by the target name.
+// If the origin doesn't advertise HTTP/3 support, no endpoints are returned.
+// The returned TTL is the minimum TTL of all records used.
+func lookupHTTPSEndpoints(ctx context.Context, resolver HTTPSResolver, origin string) ([]string, time.Duration, error) {
+	host, port, err := net.SplitHostPort(origin)
+	if err != nil {
+		return nil, 0, err
+	}
+	if _, err := netip.ParseAddr(host); err == nil {
+		// IP addresses don't have HTTPS records
+		return nil, 0, nil
+	}
+	host = strings.TrimSuffix(host, ".")
+
+	var ttl time.Duration
+	updateTTL := func(records []HTTPSRecord) {
+		for _, rec := range records {
+			if rec.TTL > 0 && (ttl == 0 || rec.TTL < ttl) {
+				ttl = rec.TTL
+			}
+		}
+	}
+
+	name := httpsQueryName(host, port)
+	ownerHost := host
+	var services []HTTPSRecord
+	for i := 0; ; i++ {
+		records, err := resolver.LookupHTTPS(ctx, name)
+		if err != nil {
+			return nil, ttl, err
+		}
+		updateTTL(records)
+		alias := -1
+		services = nil
+		for j, rec := range records {
+			if rec.Priority == 0 {
+				alias = j
+				continue
+			}
+			services = append(services, rec)
+		}
+		// AliasMode records take precedence, see Section 2.4.2 of RFC 9460.
+		if alias == -1 {
+			break
+		}
+		target := strings.TrimSuffix(records[alias].Target, ".")
+		if target == "" || i+1 >= maxHTTPSAliasChain {
+			// An AliasMode record with the TargetName "." means that the service is not available.
+			return nil, ttl, nil
+		}
+		name = target
+		ownerHost = target
+	}
+
+	sort.SliceStable(services, func(i, j int) bool { return services[i].Priority < services[j].Priority })
+	var endpoints []string
+	add := func(addr string) {
+		if !slices.Contains(endpoints, addr) {
+			endpoints = append(endpoints, addr)
+		}
+	}
+	for _, rec := range services {
+		// The default ALPN of HTTPS records is http/1.1, so HTTP/3 needs to be advertised explicitly.
+		if !slices.Contains(rec.ALPN, NextProtoH3) {
+			continue
+		}
+		target := strings.TrimSuffix(rec.Target, ".")
+		if target == "" {
+			target = ownerHost
+		}
+		p := port
+		if rec.Port != 0 {
+			p = strconv.FormatUint(uint64(rec.Port), 10)
+		}
+		for _, ip := range rec.IPv4Hint {
+			add(net.JoinHostPort(ip.String(), p))
+		}
+		for _, ip := range rec.IPv6Hint {
+			add(net.JoinHostPort(ip.String(), p))
+		}
+		add(net.JoinHostPort(target, p))
+	}
+	return endpoints, ttl, nil
+}
+
+// httpsRecordDialer returns a dial function that looks up the HTTPS records of the origin before dialing,
+// and dials the HTTP/3 endpoints advertised in these records.
+// If the lookup fails, or the origin doesn't advertise any HTTP/3 endpoints, the origin is dialed.
+func httpsRecordDialer(resolver HTTPSResolver, dial dialFunc) dialFunc {
+	return func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+		endpoints, _, err := lookupHTTPSEndpoints(ctx, resolver, addr)
+		if err != nil || len(endpoints) == 0 {
+			return dial(ctx, addr, tlsCfg, cfg)
+		}
+		for _, endpoint := range endpoints {
+			var conn quic.EarlyConnection
+			conn, err = dial(ctx, endpoint, tlsCfg, cfg)
+			if err == nil {
+				return conn, nil
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, err
+	}
+}
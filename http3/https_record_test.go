@@ -0,0 +1,165 @@
+package http3
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/netip"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	mockquic "github.com/quic-go/quic-go/internal/mocks/quic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type stubHTTPSResolver struct {
+	records map[string][]HTTPSRecord
+	err     error
+	lookups []string
+}
+
+var _ HTTPSResolver = &stubHTTPSResolver{}
+
+func (r *stubHTTPSResolver) LookupHTTPS(_ context.Context, name string) ([]HTTPSRecord, error) {
+	r.lookups = append(r.lookups, name)
+	return r.records[name], r.err
+}
+
+var _ = Describe("HTTPS records", func() {
+	var resolver *stubHTTPSResolver
+
+	BeforeEach(func() {
+		resolver = &stubHTTPSResolver{records: make(map[string][]HTTPSRecord)}
+	})
+
+	Context("looking up endpoints", func() {
+		It("uses the target name and port", func() {
+			resolver.records["example.com"] = []HTTPSRecord{
+				{Priority: 1, Target: "h3.example.com.", ALPN: []string{"h3", "h2"}, Port: 8443, TTL: time.Minute},
+			}
+			endpoints, ttl, err := lookupHTTPSEndpoints(context.Background(), resolver, "example.com:443")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoints).To(Equal([]string{"h3.example.com:8443"}))
+			Expect(ttl).To(Equal(time.Minute))
+		})
+
+		It("uses the address hints", func() {
+			resolver.records["example.com"] = []HTTPSRecord{{
+				Priority: 1,
+				Target:   ".",
+				ALPN:     []string{"h3"},
+				IPv4Hint: []netip.Addr{netip.MustParseAddr("192.0.2.1")},
+				IPv6Hint: []netip.Addr{netip.MustParseAddr("2001:db8::1")},
+			}}
+			endpoints, ttl, err := lookupHTTPSEndpoints(context.Background(), resolver, "example.com:443")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoints).To(Equal([]string{"192.0.2.1:443", "[2001:db8::1]:443", "example.com:443"}))
+			Expect(ttl).To(BeZero())
+		})
+
+		It("sorts by priority and ignores records that don't support HTTP/3", func() {
+			resolver.records["example.com"] = []HTTPSRecord{
+				{Priority: 3, Target: "c.example.com", ALPN: []string{"h3"}},
+				{Priority: 1, Target: "a.example.com", ALPN: []string{"h2"}},
+				{Priority: 2, Target: "b.example.com", ALPN: []string{"h3"}, TTL: time.Hour},
+				{Priority: 2, Target: "d.example.com", ALPN: []string{"h3"}, TTL: time.Minute},
+			}
+			endpoints, ttl, err := lookupHTTPSEndpoints(context.Background(), resolver, "example.com:443")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoints).To(Equal([]string{"b.example.com:443", "d.example.com:443", "c.example.com:443"}))
+			Expect(ttl).To(Equal(time.Minute))
+		})
+
+		It("uses the port prefix for non-default ports", func() {
+			resolver.records["_8443._https.example.com"] = []HTTPSRecord{{Priority: 1, Target: ".", ALPN: []string{"h3"}}}
+			endpoints, _, err := lookupHTTPSEndpoints(context.Background(), resolver, "example.com:8443")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoints).To(Equal([]string{"example.com:8443"}))
+		})
+
+		It("follows aliases", func() {
+			resolver.records["example.com"] = []HTTPSRecord{{Priority: 0, Target: "cdn.example.net."}}
+			resolver.records["cdn.example.net"] = []HTTPSRecord{{Priority: 1, Target: ".", ALPN: []string{"h3"}}}
+			endpoints, _, err := lookupHTTPSEndpoints(context.Background(), resolver, "example.com:443")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoints).To(Equal([]string{"cdn.example.net:443"}))
+			Expect(resolver.lookups).To(Equal([]string{"example.com", "cdn.example.net"}))
+		})
+
+		It("stops following alias loops", func() {
+			resolver.records["example.com"] = []HTTPSRecord{{Priority: 0, Target: "example.com"}}
+			endpoints, _, err := lookupHTTPSEndpoints(context.Background(), resolver, "example.com:443")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoints).To(BeEmpty())
+			Expect(resolver.lookups).To(HaveLen(maxHTTPSAliasChain))
+		})
+
+		It("doesn't look up IP addresses", func() {
+			endpoints, _, err := lookupHTTPSEndpoints(context.Background(), resolver, "[::1]:443")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(endpoints).To(BeEmpty())
+			Expect(resolver.lookups).To(BeEmpty())
+		})
+
+		It("returns lookup errors", func() {
+			resolver.err = errors.New("SERVFAIL")
+			_, _, err := lookupHTTPSEndpoints(context.Background(), resolver, "example.com:443")
+			Expect(err).To(MatchError("SERVFAIL"))
+		})
+	})
+
+	Context("dialing", func() {
+		var dialed []string
+		var dialErrs map[string]error
+
+		dial := func(_ context.Context, addr string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+			dialed = append(dialed, addr)
+			if err, ok := dialErrs[addr]; ok {
+				return nil, err
+			}
+			return mockquic.NewMockEarlyConnection(mockCtrl), nil
+		}
+
+		BeforeEach(func() {
+			dialed = nil
+			dialErrs = make(map[string]error)
+		})
+
+		It("dials the endpoints in order", func() {
+			resolver.records["example.com"] = []HTTPSRecord{{
+				Priority: 1,
+				ALPN:     []string{"h3"},
+				Port:     8443,
+				IPv4Hint: []netip.Addr{netip.MustParseAddr("192.0.2.1")},
+			}}
+			dialErrs["192.0.2.1:8443"] = errors.New("timeout")
+			_, err := httpsRecordDialer(resolver, dial)(context.Background(), "example.com:443", &tls.Config{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dialed).To(Equal([]string{"192.0.2.1:8443", "example.com:8443"}))
+		})
+
+		It("returns the error if dialing all endpoints fails", func() {
+			resolver.records["example.com"] = []HTTPSRecord{{Priority: 1, ALPN: []string{"h3"}, Port: 8443}}
+			dialErrs["example.com:8443"] = errors.New("timeout")
+			_, err := httpsRecordDialer(resolver, dial)(context.Background(), "example.com:443", &tls.Config{}, nil)
+			Expect(err).To(MatchError("timeout"))
+			Expect(dialed).To(Equal([]string{"example.com:8443"}))
+		})
+
+		It("dials the origin if HTTP/3 isn't advertised", func() {
+			resolver.records["example.com"] = []HTTPSRecord{{Priority: 1, ALPN: []string{"h2"}, Port: 8443}}
+			_, err := httpsRecordDialer(resolver, dial)(context.Background(), "example.com:443", &tls.Config{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dialed).To(Equal([]string{"example.com:443"}))
+		})
+
+		It("dials the origin if the lookup fails", func() {
+			resolver.err = errors.New("SERVFAIL")
+			_, err := httpsRecordDialer(resolver, dial)(context.Background(), "example.com:443", &tls.Config{}, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(dialed).To(Equal([]string{"example.com:443"}))
+		})
+	})
+})
@@ -0,0 +1,453 @@
+package qpackdyn
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/quic-go/qpack"
+)
+
+var (
+	// ErrDecompressionFailed is returned when a field section can't be decoded.
+	ErrDecompressionFailed = errors.New("QPACK decompression failed")
+	// ErrEncoderStream is returned when the peer sends an invalid instruction on the encoder stream.
+	ErrEncoderStream = errors.New("QPACK encoder stream error")
+)
+
+// A Decoder decodes field sections for all streams of a connection.
+type Decoder struct {
+	maxTableCapacity  uint64 // our SETTINGS_QPACK_MAX_TABLE_CAPACITY
+	maxBlockedStreams uint64 // our SETTINGS_QPACK_BLOCKED_STREAMS
+
+	// openStream opens the decoder stream.
+	// It is only called once the first instruction needs to be sent.
+	openStream func() (io.Writer, error)
+
+	mutex          sync.Mutex
+	str            io.Writer
+	table          dynamicTable
+	ackedInserts   uint64        // the number of inserts that the encoder knows we've received
+	blockedStreams uint64        // the number of streams currently waiting for inserts
+	inserted       chan struct{} // closed (and replaced) whenever entries are inserted
+	closeErr       error
+}
+
+// NewDecoder creates a new Decoder.
+// The decoder stream is opened using openStream once the first instruction needs to be sent.
+func NewDecoder(maxTableCapacity, maxBlockedStreams uint64, openStream func() (io.Writer, error)) *Decoder {
+	return &Decoder{
+		maxTableCapacity:  maxTableCapacity,
+		maxBlockedStreams: maxBlockedStreams,
+		openStream:        openStream,
+		inserted:          make(chan struct{}),
+	}
+}
+
+// Close unblocks all streams that are waiting for dynamic table inserts.
+func (d *Decoder) Close(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.closeErr != nil {
+		return
+	}
+	d.closeErr = err
+	close(d.inserted)
+}
+
+// Decode decodes a field section received on the stream with the given stream ID.
+// If the field section references dynamic table entries that weren't received yet,
+// it blocks until these entries are inserted, or until the context is canceled.
+// If the context is canceled, a Stream Cancellation instruction is sent, see Section 4.4.2 of RFC 9204.
+// Callers should therefore cancel the context when the stream is reset.
+func (d *Decoder) Decode(ctx context.Context, streamID uint64, data []byte) ([]qpack.HeaderField, error) {
+	r := bytes.NewReader(data)
+	requiredInsertCount, base, err := d.readPrefix(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrDecompressionFailed, err)
+	}
+	if requiredInsertCount > 0 {
+		if err := d.waitForInserts(ctx, streamID, requiredInsertCount); err != nil {
+			return nil, err
+		}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	var fields []qpack.HeaderField
+	for r.Len() > 0 {
+		f, err := d.readFieldLine(r, requiredInsertCount, base)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrDecompressionFailed, err)
+		}
+		fields = append(fields, f)
+	}
+	if requiredInsertCount > 0 {
+		// Section Acknowledgment: 1xxxxxxx
+		b := appendVarInt(nil, 7, streamID)
+		b[0] |= 0x80
+		if err := d.writeInstruction(b); err != nil {
+			return nil, err
+		}
+		d.ackedInserts = max(d.ackedInserts, requiredInsertCount)
+	}
+	return fields, nil
+}
+
+// readPrefix reads the Encoded Field Section Prefix, see Section 4.5.1 of RFC 9204.
+func (d *Decoder) readPrefix(r *bytes.Reader) (requiredInsertCount, base uint64, _ error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	encodedInsertCount, err := readVarInt(r, 8, first)
+	if err != nil {
+		return 0, 0, err
+	}
+	first, err = r.ReadByte()
+	if err != nil {
+		return 0, 0, err
+	}
+	deltaBase, err := readVarInt(r, 7, first)
+	if err != nil {
+		return 0, 0, err
+	}
+	if encodedInsertCount == 0 {
+		if first&0x80 > 0 || deltaBase != 0 {
+			return 0, 0, errors.New("invalid Base")
+		}
+		return 0, 0, nil
+	}
+
+	d.mutex.Lock()
+	totalInserts := d.table.insertCount()
+	d.mutex.Unlock()
+	maxEntries := d.maxTableCapacity / entryOverhead
+	fullRange := 2 * maxEntries
+	if encodedInsertCount > fullRange {
+		return 0, 0, errors.New("invalid Required Insert Count")
+	}
+	maxValue := totalInserts + maxEntries
+	maxWrapped := maxValue / fullRange * fullRange
+	requiredInsertCount = maxWrapped + encodedInsertCount - 1
+	if requiredInsertCount > maxValue {
+		if requiredInsertCount <= fullRange {
+			return 0, 0, errors.New("invalid Required Insert Count")
+		}
+		requiredInsertCount -= fullRange
+	}
+	if requiredInsertCount == 0 {
+		return 0, 0, errors.New("invalid Required Insert Count")
+	}
+	if first&0x80 == 0 {
+		base = requiredInsertCount + deltaBase
+	} else {
+		if deltaBase >= requiredInsertCount {
+			return 0, 0, errors.New("invalid Base")
+		}
+		base = requiredInsertCount - deltaBase - 1
+	}
+	return requiredInsertCount, base, nil
+}
+
+func (d *Decoder) waitForInserts(ctx context.Context, streamID, requiredInsertCount uint64) error {
+	d.mutex.Lock()
+	if d.table.insertCount() >= requiredInsertCount {
+		d.mutex.Unlock()
+		return nil
+	}
+	if d.blockedStreams >= d.maxBlockedStreams {
+		d.mutex.Unlock()
+		return fmt.Errorf("%w: too many blocked streams", ErrDecompressionFailed)
+	}
+	d.blockedStreams++
+	defer func() {
+		d.mutex.Lock()
+		d.blockedStreams--
+		d.mutex.Unlock()
+	}()
+	for {
+		if d.closeErr != nil {
+			err := d.closeErr
+			d.mutex.Unlock()
+			return err
+		}
+		if d.table.insertCount() >= requiredInsertCount {
+			d.mutex.Unlock()
+			return nil
+		}
+		inserted := d.inserted
+		d.mutex.Unlock()
+
+		select {
+		case <-inserted:
+		case <-ctx.Done():
+			d.cancelStream(streamID)
+			return ctx.Err()
+		}
+		d.mutex.Lock()
+	}
+}
+
+// cancelStream sends a Stream Cancellation instruction.
+func (d *Decoder) cancelStream(streamID uint64) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	// Stream Cancellation: 01xxxxxx
+	b := appendVarInt(nil, 6, streamID)
+	b[0] |= 0x40
+	d.writeInstruction(b)
+}
+
+func (d *Decoder) readFieldLine(r *bytes.Reader, requiredInsertCount, base uint64) (qpack.HeaderField, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return qpack.HeaderField{}, err
+	}
+	maxLen := uint64(r.Len())
+	switch {
+	case first&0x80 > 0: // Indexed Field Line: 1Txxxxxx
+		index, err := readVarInt(r, 6, first)
+		if err != nil {
+			return qpack.HeaderField{}, err
+		}
+		if first&0x40 > 0 {
+			return d.getStatic(index)
+		}
+		if index >= base {
+			return qpack.HeaderField{}, fmt.Errorf("invalid relative index: %d", index)
+		}
+		return d.getDynamic(base-1-index, requiredInsertCount)
+	case first&0xc0 == 0x40: // Literal Field Line with Name Reference: 01NTxxxx
+		index, err := readVarInt(r, 4, first)
+		if err != nil {
+			return qpack.HeaderField{}, err
+		}
+		var f qpack.HeaderField
+		if first&0x10 > 0 {
+			f, err = d.getStatic(index)
+		} else if index >= base {
+			err = fmt.Errorf("invalid relative index: %d", index)
+		} else {
+			f, err = d.getDynamic(base-1-index, requiredInsertCount)
+		}
+		if err != nil {
+			return qpack.HeaderField{}, err
+		}
+		f.Value, err = d.readValue(r, maxLen)
+		return f, err
+	case first&0xe0 == 0x20: // Literal Field Line with Literal Name: 001NHxxx
+		name, err := readString(r, 3, first, maxLen)
+		if err != nil {
+			return qpack.HeaderField{}, err
+		}
+		value, err := d.readValue(r, maxLen)
+		return qpack.HeaderField{Name: name, Value: value}, err
+	case first&0xf0 == 0x10: // Indexed Field Line with Post-Base Index: 0001xxxx
+		index, err := readVarInt(r, 4, first)
+		if err != nil {
+			return qpack.HeaderField{}, err
+		}
+		return d.getDynamic(base+index, requiredInsertCount)
+	default: // Literal Field Line with Post-Base Name Reference: 0000Nxxx
+		index, err := readVarInt(r, 3, first)
+		if err != nil {
+			return qpack.HeaderField{}, err
+		}
+		f, err := d.getDynamic(base+index, requiredInsertCount)
+		if err != nil {
+			return qpack.HeaderField{}, err
+		}
+		f.Value, err = d.readValue(r, maxLen)
+		return f, err
+	}
+}
+
+func (d *Decoder) readValue(r *bytes.Reader, maxLen uint64) (string, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	return readString(r, 7, first, maxLen)
+}
+
+func (d *Decoder) getStatic(index uint64) (qpack.HeaderField, error) {
+	if index >= uint64(len(staticTable)) {
+		return qpack.HeaderField{}, fmt.Errorf("invalid static table index: %d", index)
+	}
+	return staticTable[index], nil
+}
+
+func (d *Decoder) getDynamic(absIndex, requiredInsertCount uint64) (qpack.HeaderField, error) {
+	if absIndex >= requiredInsertCount {
+		return qpack.HeaderField{}, fmt.Errorf("reference to dynamic table entry %d exceeds the Required Insert Count", absIndex)
+	}
+	f, ok := d.table.get(absIndex)
+	if !ok {
+		return qpack.HeaderField{}, fmt.Errorf("invalid dynamic table index: %d", absIndex)
+	}
+	return f, nil
+}
+
+// ReadEncoderStream processes the instructions received on the peer's encoder stream.
+// It only returns when reading from the stream fails, or when the peer violates the protocol.
+func (d *Decoder) ReadEncoderStream(str io.Reader) error {
+	r := bufio.NewReader(str)
+	for {
+		if err := d.readInstruction(r); err != nil {
+			if errors.Is(err, errVarintOverflow) {
+				return fmt.Errorf("%w: %w", ErrEncoderStream, err)
+			}
+			return err
+		}
+		// Acknowledge all inserts once we've processed all instructions that were received so far.
+		if r.Buffered() == 0 {
+			if err := d.sendInsertCountIncrement(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (d *Decoder) readInstruction(r *bufio.Reader) error {
+	first, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch {
+	case first&0x80 > 0: // Insert with Name Reference: 1Txxxxxx
+		isStatic := first&0x40 > 0
+		index, err := readVarInt(r, 6, first)
+		if err != nil {
+			return err
+		}
+		first, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		value, err := readString(r, 7, first, d.maxTableCapacity)
+		if err != nil {
+			return d.encoderStreamError(err)
+		}
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		var f qpack.HeaderField
+		if isStatic {
+			f, err = d.getStatic(index)
+		} else {
+			f, err = d.getRelative(index)
+		}
+		if err != nil {
+			return d.encoderStreamError(err)
+		}
+		f.Value = value
+		return d.insert(f)
+	case first&0x40 > 0: // Insert with Literal Name: 01Hxxxxx
+		name, err := readString(r, 5, first, d.maxTableCapacity)
+		if err != nil {
+			return d.encoderStreamError(err)
+		}
+		first, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		value, err := readString(r, 7, first, d.maxTableCapacity)
+		if err != nil {
+			return d.encoderStreamError(err)
+		}
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		return d.insert(qpack.HeaderField{Name: name, Value: value})
+	case first&0x20 > 0: // Set Dynamic Table Capacity: 001xxxxx
+		capacity, err := readVarInt(r, 5, first)
+		if err != nil {
+			return err
+		}
+		if capacity > d.maxTableCapacity {
+			return fmt.Errorf("%w: dynamic table capacity %d exceeds the maximum (%d)", ErrEncoderStream, capacity, d.maxTableCapacity)
+		}
+		d.mutex.Lock()
+		d.table.setCapacity(capacity)
+		d.mutex.Unlock()
+		return nil
+	default: // Duplicate: 000xxxxx
+		index, err := readVarInt(r, 5, first)
+		if err != nil {
+			return err
+		}
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		f, err := d.getRelative(index)
+		if err != nil {
+			return d.encoderStreamError(err)
+		}
+		return d.insert(f)
+	}
+}
+
+func (d *Decoder) encoderStreamError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrEncoderStream, err)
+}
+
+// getRelative returns the entry for an index relative to the Insert Count, as used on the encoder stream.
+func (d *Decoder) getRelative(index uint64) (qpack.HeaderField, error) {
+	insertCount := d.table.insertCount()
+	if index >= insertCount {
+		return qpack.HeaderField{}, fmt.Errorf("invalid relative index: %d", index)
+	}
+	f, ok := d.table.get(insertCount - 1 - index)
+	if !ok {
+		return qpack.HeaderField{}, fmt.Errorf("invalid relative index: %d", index)
+	}
+	return f, nil
+}
+
+func (d *Decoder) insert(f qpack.HeaderField) error {
+	if !d.table.insert(f) {
+		return fmt.Errorf("%w: entry of size %d exceeds the dynamic table capacity (%d)", ErrEncoderStream, entrySize(f), d.table.capacity)
+	}
+	if d.closeErr == nil {
+		close(d.inserted)
+		d.inserted = make(chan struct{})
+	}
+	return nil
+}
+
+func (d *Decoder) sendInsertCountIncrement() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	insertCount := d.table.insertCount()
+	if insertCount <= d.ackedInserts {
+		return nil
+	}
+	// Insert Count Increment: 00xxxxxx
+	b := appendVarInt(nil, 6, insertCount-d.ackedInserts)
+	d.ackedInserts = insertCount
+	return d.writeInstruction(b)
+}
+
+// writeInstruction writes an instruction on the decoder stream.
+// It must be called with the mutex held, such that instructions are sent in order.
+func (d *Decoder) writeInstruction(b []byte) error {
+	if d.str == nil {
+		if d.openStream == nil {
+			return nil
+		}
+		str, err := d.openStream()
+		if err != nil {
+			return err
+		}
+		d.str = str
+	}
+	_, err := d.str.Write(b)
+	return err
+}
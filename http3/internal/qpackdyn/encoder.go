@@ -0,0 +1,391 @@
+package qpackdyn
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/quic-go/qpack"
+)
+
+// ErrDecoderStream is returned when the peer sends an invalid instruction on the decoder stream.
+var ErrDecoderStream = errors.New("QPACK decoder stream error")
+
+// noIndexHeaders are header fields whose values are unlikely to be repeated.
+// Inserting them into the dynamic table would just evict more useful entries.
+var noIndexHeaders = map[string]struct{}{
+	":path":             {},
+	"content-length":    {},
+	"content-range":     {},
+	"date":              {},
+	"etag":              {},
+	"if-modified-since": {},
+	"if-none-match":     {},
+	"last-modified":     {},
+	"location":          {},
+	"range":             {},
+	"referer":           {},
+}
+
+// A fieldSection is an encoded field section that wasn't acknowledged by the peer yet.
+type fieldSection struct {
+	requiredInsertCount uint64
+	refs                []uint64 // absolute indices of the dynamic table entries referenced
+}
+
+// An Encoder encodes field sections for all streams of a connection.
+// Until Enable is called, it only uses the static table.
+type Encoder struct {
+	mutex sync.Mutex
+
+	maxTableCapacity uint64 // the maximum capacity we're willing to use
+
+	str               io.Writer // the encoder stream, nil until enable is called
+	maxEntries        uint64    // derived from the peer's SETTINGS_QPACK_MAX_TABLE_CAPACITY
+	maxBlockedStreams uint64    // the peer's SETTINGS_QPACK_BLOCKED_STREAMS
+
+	table        dynamicTable
+	fieldIndex   map[qpack.HeaderField]uint64 // absolute index of the newest entry with this name and value
+	nameIndex    map[string]uint64            // absolute index of the newest entry with this name
+	refCounts    map[uint64]int               // number of unacknowledged field sections referencing an entry
+	sections     map[uint64][]*fieldSection
+	knownInserts uint64 // the Known Received Count, see Section 2.1.4 of RFC 9204
+
+	buf []byte
+}
+
+// NewEncoder creates a new Encoder.
+// It never uses a dynamic table larger than maxTableCapacity.
+func NewEncoder(maxTableCapacity uint64) *Encoder {
+	return &Encoder{
+		maxTableCapacity: maxTableCapacity,
+		fieldIndex:       make(map[qpack.HeaderField]uint64),
+		nameIndex:        make(map[string]uint64),
+		refCounts:        make(map[uint64]int),
+		sections:         make(map[uint64][]*fieldSection),
+	}
+}
+
+// MaxTableCapacity returns the maximum dynamic table capacity that the encoder is willing to use.
+func (e *Encoder) MaxTableCapacity() uint64 { return e.maxTableCapacity }
+
+// Enable enables the use of the dynamic table, using the limits announced by the peer's SETTINGS frame.
+// Instructions are sent on the encoder stream str.
+func (e *Encoder) Enable(str io.Writer, peerMaxTableCapacity, peerMaxBlockedStreams uint64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.str != nil {
+		return errors.New("QPACK encoder already enabled")
+	}
+	e.str = str
+	e.maxEntries = peerMaxTableCapacity / entryOverhead
+	e.maxBlockedStreams = peerMaxBlockedStreams
+	capacity := min(e.maxTableCapacity, peerMaxTableCapacity)
+	e.table.setCapacity(capacity)
+	// Set Dynamic Table Capacity: 001xxxxx
+	b := appendVarInt(nil, 5, capacity)
+	b[0] |= 0x20
+	_, err := e.str.Write(b)
+	return err
+}
+
+// Encode encodes a field section for the stream with the given stream ID.
+// Any encoder instructions are written to the encoder stream before the encoded field section is returned.
+func (e *Encoder) Encode(streamID uint64, fields []qpack.HeaderField) ([]byte, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	blocking := e.isBlocking(streamID)
+	canReference := func(absIndex uint64) bool {
+		if absIndex < e.knownInserts || blocking {
+			return true
+		}
+		// Referencing an entry that the peer might not have received yet can block the stream.
+		if e.numBlockedStreams() < e.maxBlockedStreams {
+			blocking = true
+			return true
+		}
+		return false
+	}
+
+	e.buf = e.buf[:0]
+	var section fieldSection
+	reference := func(absIndex uint64) {
+		e.refCounts[absIndex]++
+		section.refs = append(section.refs, absIndex)
+		section.requiredInsertCount = max(section.requiredInsertCount, absIndex+1)
+	}
+	// All dynamic table references are encoded relative to the Base,
+	// which equals the Required Insert Count of the field section.
+	// Since the Required Insert Count is only known after all fields have been encoded,
+	// dynamic table references are encoded in a second pass.
+	type fieldLine struct {
+		static     bool
+		indexed    bool
+		hasNameRef bool
+		index      uint64 // static index or absolute index
+		field      qpack.HeaderField
+	}
+	lines := make([]fieldLine, 0, len(fields))
+	for _, f := range fields {
+		si, hasStaticName := staticLookup[f.Name]
+		if hasStaticName {
+			if idx, ok := si.values[f.Value]; ok {
+				lines = append(lines, fieldLine{static: true, indexed: true, index: idx})
+				continue
+			}
+		}
+		if idx, ok := e.fieldIndex[f]; ok && canReference(idx) {
+			reference(idx)
+			lines = append(lines, fieldLine{indexed: true, index: idx})
+			continue
+		}
+		if e.shouldIndex(f) {
+			if idx, ok := e.insert(f, hasStaticName, si.name); ok && canReference(idx) {
+				reference(idx)
+				lines = append(lines, fieldLine{indexed: true, index: idx})
+				continue
+			}
+		}
+		if hasStaticName {
+			lines = append(lines, fieldLine{static: true, hasNameRef: true, index: si.name, field: f})
+			continue
+		}
+		if idx, ok := e.nameIndex[f.Name]; ok && canReference(idx) {
+			reference(idx)
+			lines = append(lines, fieldLine{hasNameRef: true, index: idx, field: f})
+			continue
+		}
+		lines = append(lines, fieldLine{field: f})
+	}
+
+	if len(e.buf) > 0 {
+		if _, err := e.str.Write(e.buf); err != nil {
+			return nil, err
+		}
+	}
+
+	base := section.requiredInsertCount
+	var b []byte
+	// Encoded Field Section Prefix, see Section 4.5.1 of RFC 9204.
+	// The Delta Base is always 0, since the Base equals the Required Insert Count.
+	if section.requiredInsertCount == 0 {
+		b = append(b, 0, 0)
+	} else {
+		b = appendVarInt(b, 8, section.requiredInsertCount%(2*e.maxEntries)+1)
+		b = append(b, 0)
+	}
+	for _, l := range lines {
+		index := l.index
+		if !l.static {
+			index = base - 1 - l.index
+		}
+		offset := len(b)
+		switch {
+		case l.indexed:
+			// Indexed Field Line: 1Txxxxxx
+			b = appendVarInt(b, 6, index)
+			b[offset] |= 0x80
+			if l.static {
+				b[offset] |= 0x40
+			}
+		case l.hasNameRef:
+			// Literal Field Line with Name Reference: 01NTxxxx
+			b = appendVarInt(b, 4, index)
+			b[offset] |= 0x40
+			if l.static {
+				b[offset] |= 0x10
+			}
+			b = appendString(b, 7, l.field.Value)
+		default:
+			// Literal Field Line with Literal Name: 001NHxxx
+			b = appendString(b, 3, l.field.Name)
+			b[offset] |= 0x20
+			b = appendString(b, 7, l.field.Value)
+		}
+	}
+	if section.requiredInsertCount > 0 {
+		e.sections[streamID] = append(e.sections[streamID], &section)
+	}
+	return b, nil
+}
+
+func (e *Encoder) shouldIndex(f qpack.HeaderField) bool {
+	if e.table.capacity == 0 {
+		return false
+	}
+	_, noIndex := noIndexHeaders[f.Name]
+	return !noIndex && entrySize(f) <= e.table.capacity/2
+}
+
+// insert inserts a new entry into the dynamic table, and appends the respective instruction to e.buf.
+// Entries that are referenced by unacknowledged field sections are never evicted.
+func (e *Encoder) insert(f qpack.HeaderField, hasStaticName bool, staticNameIndex uint64) (uint64, bool) {
+	size := entrySize(f)
+	var evictable uint64
+	// Check that we can make enough room for the new entry.
+	for i, entry := range e.table.entries {
+		if e.table.size-evictable+size <= e.table.capacity {
+			break
+		}
+		if e.refCounts[e.table.dropped+uint64(i)] > 0 {
+			return 0, false
+		}
+		evictable += entrySize(entry)
+	}
+	if e.table.size-evictable+size > e.table.capacity {
+		return 0, false
+	}
+
+	offset := len(e.buf)
+	if hasStaticName {
+		// Insert with Name Reference: 1Txxxxxx
+		e.buf = appendVarInt(e.buf, 6, staticNameIndex)
+		e.buf[offset] |= 0x80 | 0x40
+	} else {
+		// Insert with Literal Name: 01Hxxxxx
+		e.buf = appendString(e.buf, 5, f.Name)
+		e.buf[offset] |= 0x40
+	}
+	e.buf = appendString(e.buf, 7, f.Value)
+
+	for e.table.size+size > e.table.capacity {
+		e.evict()
+	}
+	e.table.insert(f)
+	idx := e.table.insertCount() - 1
+	e.fieldIndex[f] = idx
+	e.nameIndex[f.Name] = idx
+	return idx, true
+}
+
+func (e *Encoder) evict() {
+	idx := e.table.dropped
+	f := e.table.entries[0]
+	if i, ok := e.fieldIndex[f]; ok && i == idx {
+		delete(e.fieldIndex, f)
+	}
+	if i, ok := e.nameIndex[f.Name]; ok && i == idx {
+		delete(e.nameIndex, f.Name)
+	}
+	delete(e.refCounts, idx)
+	e.table.evict()
+}
+
+// isBlocking says if the stream has unacknowledged field sections that might block the peer's decoder.
+func (e *Encoder) isBlocking(streamID uint64) bool {
+	for _, s := range e.sections[streamID] {
+		if s.requiredInsertCount > e.knownInserts {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Encoder) numBlockedStreams() uint64 {
+	var n uint64
+	for streamID := range e.sections {
+		if e.isBlocking(streamID) {
+			n++
+		}
+	}
+	return n
+}
+
+// ReadDecoderStream processes the instructions received on the peer's decoder stream.
+// It only returns when reading from the stream fails, or when the peer violates the protocol.
+func (e *Encoder) ReadDecoderStream(str io.Reader) error {
+	r := bufio.NewReader(str)
+	for {
+		if err := e.readInstruction(r); err != nil {
+			if errors.Is(err, errVarintOverflow) {
+				return fmt.Errorf("%w: %w", ErrDecoderStream, err)
+			}
+			return err
+		}
+	}
+}
+
+func (e *Encoder) readInstruction(r *bufio.Reader) error {
+	first, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	switch {
+	case first&0x80 > 0: // Section Acknowledgment: 1xxxxxxx
+		streamID, err := readVarInt(r, 7, first)
+		if err != nil {
+			return err
+		}
+		if err := e.handleSectionAcknowledgement(streamID); err != nil {
+			return err
+		}
+	case first&0x40 > 0: // Stream Cancellation: 01xxxxxx
+		streamID, err := readVarInt(r, 6, first)
+		if err != nil {
+			return err
+		}
+		e.handleStreamCancellation(streamID)
+	default: // Insert Count Increment: 00xxxxxx
+		increment, err := readVarInt(r, 6, first)
+		if err != nil {
+			return err
+		}
+		if err := e.handleInsertCountIncrement(increment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) handleSectionAcknowledgement(streamID uint64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	sections := e.sections[streamID]
+	if len(sections) == 0 {
+		return fmt.Errorf("%w: unexpected Section Acknowledgment for stream %d", ErrDecoderStream, streamID)
+	}
+	e.release(sections[0])
+	if len(sections) == 1 {
+		delete(e.sections, streamID)
+	} else {
+		e.sections[streamID] = sections[1:]
+	}
+	e.knownInserts = max(e.knownInserts, sections[0].requiredInsertCount)
+	return nil
+}
+
+func (e *Encoder) handleStreamCancellation(streamID uint64) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	for _, s := range e.sections[streamID] {
+		e.release(s)
+	}
+	delete(e.sections, streamID)
+}
+
+func (e *Encoder) handleInsertCountIncrement(increment uint64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if increment == 0 || e.knownInserts+increment > e.table.insertCount() {
+		return fmt.Errorf("%w: invalid Insert Count Increment: %d", ErrDecoderStream, increment)
+	}
+	e.knownInserts += increment
+	return nil
+}
+
+func (e *Encoder) release(s *fieldSection) {
+	for _, idx := range s.refs {
+		if e.refCounts[idx] <= 1 {
+			delete(e.refCounts, idx)
+		} else {
+			e.refCounts[idx]--
+		}
+	}
+}
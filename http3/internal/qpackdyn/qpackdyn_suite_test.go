@@ -0,0 +1,13 @@
+package qpackdyn
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestQPACK(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "QPACK Suite")
+}
@@ -0,0 +1,296 @@
+package qpackdyn
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+
+	"github.com/quic-go/qpack"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QPACK", func() {
+	Context("variable-length integers", func() {
+		It("encodes and decodes", func() {
+			for _, i := range []uint64{0, 1, 30, 31, 32, 127, 128, 1337, 1 << 40} {
+				b := appendVarInt(nil, 5, i)
+				r := bytes.NewReader(b[1:])
+				n, err := readVarInt(r, 5, b[0])
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(i))
+				Expect(r.Len()).To(BeZero())
+			}
+		})
+
+		It("preserves the bits before the prefix", func() {
+			b := appendVarInt([]byte{}, 6, 10)
+			b[0] |= 0x80
+			n, err := readVarInt(bytes.NewReader(b[1:]), 6, b[0])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(n).To(Equal(uint64(10)))
+		})
+
+		It("errors on overflows", func() {
+			b := append([]byte{0x1f}, bytes.Repeat([]byte{0xff}, 10)...)
+			_, err := readVarInt(bytes.NewReader(b[1:]), 5, b[0])
+			Expect(err).To(MatchError(errVarintOverflow))
+		})
+	})
+
+	Context("strings", func() {
+		It("encodes and decodes", func() {
+			for _, s := range []string{"", "foobar", "application/json", strings.Repeat("x", 200), "\x00\x01\xff"} {
+				b := appendString(nil, 7, s)
+				r := bytes.NewReader(b[1:])
+				str, err := readString(r, 7, b[0], 1000)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(str).To(Equal(s))
+				Expect(r.Len()).To(BeZero())
+			}
+		})
+
+		It("rejects strings that are too long", func() {
+			b := appendString(nil, 7, strings.Repeat("\xff", 100))
+			_, err := readString(bytes.NewReader(b[1:]), 7, b[0], 50)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("dynamic table", func() {
+		It("evicts the oldest entries", func() {
+			var t dynamicTable
+			f := qpack.HeaderField{Name: "foo", Value: "bar"} // size: 38
+			t.setCapacity(100)
+			Expect(t.insert(f)).To(BeTrue())
+			Expect(t.insert(f)).To(BeTrue())
+			Expect(t.size).To(Equal(uint64(76)))
+			Expect(t.insert(f)).To(BeTrue())
+			Expect(t.insertCount()).To(Equal(uint64(3)))
+			_, ok := t.get(0)
+			Expect(ok).To(BeFalse())
+			e, ok := t.get(2)
+			Expect(ok).To(BeTrue())
+			Expect(e).To(Equal(f))
+		})
+
+		It("refuses entries larger than the capacity", func() {
+			var t dynamicTable
+			t.setCapacity(40)
+			Expect(t.insert(qpack.HeaderField{Name: "foo", Value: "foobar"})).To(BeFalse())
+		})
+	})
+
+	Context("encoding and decoding", func() {
+		var (
+			encoder          *Encoder
+			decoder          *Decoder
+			encStr, decStr   *bytes.Buffer
+			headersWithValue = func(v string) []qpack.HeaderField {
+				return []qpack.HeaderField{
+					{Name: ":method", Value: "GET"},
+					{Name: ":path", Value: "/foo"},
+					{Name: "user-agent", Value: "quic-go"},
+					{Name: "x-custom", Value: v},
+				}
+			}
+		)
+
+		BeforeEach(func() {
+			encStr = &bytes.Buffer{}
+			decStr = &bytes.Buffer{}
+			encoder = NewEncoder(4096)
+			decoder = NewDecoder(4096, 16, func() (io.Writer, error) { return decStr, nil })
+		})
+
+		processEncoderStream := func() {
+			Expect(decoder.ReadEncoderStream(encStr)).To(MatchError(io.EOF))
+		}
+		processDecoderStream := func() {
+			Expect(encoder.ReadDecoderStream(decStr)).To(MatchError(io.EOF))
+		}
+
+		It("only uses the static table if the dynamic table is not enabled", func() {
+			fields := headersWithValue("foobar")
+			data, err := encoder.Encode(4, fields)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data[:2]).To(Equal([]byte{0, 0}))
+			decoded, err := decoder.Decode(context.Background(), 4, data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded).To(Equal(fields))
+			Expect(decStr.Len()).To(BeZero())
+		})
+
+		It("decodes field sections encoded by the qpack package", func() {
+			buf := &bytes.Buffer{}
+			enc := qpack.NewEncoder(buf)
+			fields := headersWithValue("foobar")
+			for _, f := range fields {
+				Expect(enc.WriteField(f)).To(Succeed())
+			}
+			decoded, err := decoder.Decode(context.Background(), 0, buf.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded).To(Equal(fields))
+		})
+
+		It("uses the dynamic table", func() {
+			Expect(encoder.Enable(encStr, 4096, 16)).To(Succeed())
+			fields := headersWithValue("foobar")
+			data1, err := encoder.Encode(0, fields)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encStr.Len()).ToNot(BeZero())
+			processEncoderStream()
+			decoded, err := decoder.Decode(context.Background(), 0, data1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded).To(Equal(fields))
+			processDecoderStream()
+			Expect(encoder.knownInserts).To(Equal(encoder.table.insertCount()))
+
+			// the second field section only references existing entries
+			data2, err := encoder.Encode(4, fields)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encStr.Len()).To(BeZero())
+			staticOnly, err := NewEncoder(0).Encode(4, fields)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(len(data2)).To(BeNumerically("<", len(staticOnly)))
+			decoded, err = decoder.Decode(context.Background(), 4, data2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded).To(Equal(fields))
+			processDecoderStream()
+			Expect(encoder.sections).To(BeEmpty())
+			Expect(encoder.refCounts).To(BeEmpty())
+		})
+
+		It("doesn't insert fields that are unlikely to be repeated", func() {
+			Expect(encoder.Enable(encStr, 4096, 16)).To(Succeed())
+			encStr.Reset()
+			_, err := encoder.Encode(0, []qpack.HeaderField{{Name: ":path", Value: "/foobar"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encStr.Len()).To(BeZero())
+			Expect(encoder.table.insertCount()).To(BeZero())
+		})
+
+		It("blocks streams until the referenced entries are received", func() {
+			Expect(encoder.Enable(encStr, 4096, 16)).To(Succeed())
+			fields := headersWithValue("foobar")
+			data, err := encoder.Encode(0, fields)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encoder.numBlockedStreams()).To(Equal(uint64(1)))
+
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				decoded, err := decoder.Decode(context.Background(), 0, data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(decoded).To(Equal(fields))
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			processEncoderStream()
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't block more streams than allowed by the peer", func() {
+			Expect(encoder.Enable(encStr, 4096, 1)).To(Succeed())
+			_, err := encoder.Encode(0, headersWithValue("foo"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encoder.numBlockedStreams()).To(Equal(uint64(1)))
+			data, err := encoder.Encode(4, headersWithValue("bar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encoder.isBlocking(4)).To(BeFalse())
+			// this field section can be decoded without processing the encoder stream
+			decoded, err := decoder.Decode(context.Background(), 4, data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded).To(Equal(headersWithValue("bar")))
+		})
+
+		It("errors when too many streams are blocked", func() {
+			decoder = NewDecoder(4096, 0, func() (io.Writer, error) { return decStr, nil })
+			Expect(encoder.Enable(encStr, 4096, 16)).To(Succeed())
+			data, err := encoder.Encode(0, headersWithValue("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = decoder.Decode(context.Background(), 0, data)
+			Expect(err).To(MatchError(ErrDecompressionFailed))
+		})
+
+		It("cancels blocked streams when the context is canceled", func() {
+			Expect(encoder.Enable(encStr, 4096, 16)).To(Succeed())
+			data, err := encoder.Encode(8, headersWithValue("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			_, err = decoder.Decode(ctx, 8, data)
+			Expect(err).To(MatchError(context.Canceled))
+			Expect(decStr.Bytes()).To(Equal([]byte{0x40 | 8})) // Stream Cancellation
+			processDecoderStream()
+			Expect(encoder.sections).To(BeEmpty())
+			Expect(encoder.refCounts).To(BeEmpty())
+		})
+
+		It("unblocks streams when the decoder is closed", func() {
+			Expect(encoder.Enable(encStr, 4096, 16)).To(Succeed())
+			data, err := encoder.Encode(0, headersWithValue("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				_, err := decoder.Decode(context.Background(), 0, data)
+				Expect(err).To(MatchError(io.ErrUnexpectedEOF))
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			decoder.Close(io.ErrUnexpectedEOF)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("doesn't evict entries that are still referenced", func() {
+			Expect(encoder.Enable(encStr, 100, 16)).To(Succeed()) // room for 2 entries
+			_, err := encoder.Encode(0, []qpack.HeaderField{{Name: "x-a", Value: "aaa"}, {Name: "x-b", Value: "bbb"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encoder.table.insertCount()).To(Equal(uint64(2)))
+			// the table is full, and both entries are still referenced by stream 0
+			data, err := encoder.Encode(4, []qpack.HeaderField{{Name: "x-c", Value: "ccc"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(encoder.table.insertCount()).To(Equal(uint64(2)))
+			processEncoderStream()
+			decoded, err := decoder.Decode(context.Background(), 4, data)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(decoded).To(Equal([]qpack.HeaderField{{Name: "x-c", Value: "ccc"}}))
+		})
+
+		It("rejects Section Acknowledgments for unknown streams", func() {
+			err := encoder.ReadDecoderStream(bytes.NewReader([]byte{0x80 | 4}))
+			Expect(err).To(MatchError(ErrDecoderStream))
+		})
+
+		It("rejects invalid Insert Count Increments", func() {
+			err := encoder.ReadDecoderStream(bytes.NewReader([]byte{0}))
+			Expect(err).To(MatchError(ErrDecoderStream))
+			err = encoder.ReadDecoderStream(bytes.NewReader([]byte{5}))
+			Expect(err).To(MatchError(ErrDecoderStream))
+		})
+
+		It("rejects a dynamic table capacity exceeding the maximum", func() {
+			b := appendVarInt(nil, 5, 8192)
+			b[0] |= 0x20
+			Expect(decoder.ReadEncoderStream(bytes.NewReader(b))).To(MatchError(ErrEncoderStream))
+		})
+
+		It("rejects inserts referencing non-existent entries", func() {
+			// Duplicate, relative index 3
+			Expect(decoder.ReadEncoderStream(bytes.NewReader([]byte{3}))).To(MatchError(ErrEncoderStream))
+		})
+
+		It("rejects references to entries beyond the Required Insert Count", func() {
+			Expect(encoder.Enable(encStr, 4096, 16)).To(Succeed())
+			_, err := encoder.Encode(0, headersWithValue("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			processEncoderStream()
+			// Required Insert Count 0, but references dynamic table entry (relative index 0)
+			_, err = decoder.Decode(context.Background(), 4, []byte{0, 0, 0x80})
+			Expect(err).To(MatchError(ErrDecompressionFailed))
+		})
+	})
+})
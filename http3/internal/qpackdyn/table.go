@@ -0,0 +1,278 @@
+// Package qpackdyn implements QPACK field section encoding and decoding using the dynamic table (RFC 9204).
+// Field sections that only use the static table can be decoded by the github.com/quic-go/qpack package.
+package qpackdyn
+
+import (
+	"errors"
+	"io"
+
+	"golang.org/x/net/http2/hpack"
+
+	"github.com/quic-go/qpack"
+)
+
+// staticTable is the QPACK static table, see Appendix A of RFC 9204.
+var staticTable = [...]qpack.HeaderField{
+	{Name: ":authority"},
+	{Name: ":path", Value: "/"},
+	{Name: "age", Value: "0"},
+	{Name: "content-disposition"},
+	{Name: "content-length", Value: "0"},
+	{Name: "cookie"},
+	{Name: "date"},
+	{Name: "etag"},
+	{Name: "if-modified-since"},
+	{Name: "if-none-match"},
+	{Name: "last-modified"},
+	{Name: "link"},
+	{Name: "location"},
+	{Name: "referer"},
+	{Name: "set-cookie"},
+	{Name: ":method", Value: "CONNECT"},
+	{Name: ":method", Value: "DELETE"},
+	{Name: ":method", Value: "GET"},
+	{Name: ":method", Value: "HEAD"},
+	{Name: ":method", Value: "OPTIONS"},
+	{Name: ":method", Value: "POST"},
+	{Name: ":method", Value: "PUT"},
+	{Name: ":scheme", Value: "http"},
+	{Name: ":scheme", Value: "https"},
+	{Name: ":status", Value: "103"},
+	{Name: ":status", Value: "200"},
+	{Name: ":status", Value: "304"},
+	{Name: ":status", Value: "404"},
+	{Name: ":status", Value: "503"},
+	{Name: "accept", Value: "*/*"},
+	{Name: "accept", Value: "application/dns-message"},
+	{Name: "accept-encoding", Value: "gzip, deflate, br"},
+	{Name: "accept-ranges", Value: "bytes"},
+	{Name: "access-control-allow-headers", Value: "cache-control"},
+	{Name: "access-control-allow-headers", Value: "content-type"},
+	{Name: "access-control-allow-origin", Value: "*"},
+	{Name: "cache-control", Value: "max-age=0"},
+	{Name: "cache-control", Value: "max-age=2592000"},
+	{Name: "cache-control", Value: "max-age=604800"},
+	{Name: "cache-control", Value: "no-cache"},
+	{Name: "cache-control", Value: "no-store"},
+	{Name: "cache-control", Value: "public, max-age=31536000"},
+	{Name: "content-encoding", Value: "br"},
+	{Name: "content-encoding", Value: "gzip"},
+	{Name: "content-type", Value: "application/dns-message"},
+	{Name: "content-type", Value: "application/javascript"},
+	{Name: "content-type", Value: "application/json"},
+	{Name: "content-type", Value: "application/x-www-form-urlencoded"},
+	{Name: "content-type", Value: "image/gif"},
+	{Name: "content-type", Value: "image/jpeg"},
+	{Name: "content-type", Value: "image/png"},
+	{Name: "content-type", Value: "text/css"},
+	{Name: "content-type", Value: "text/html; charset=utf-8"},
+	{Name: "content-type", Value: "text/plain"},
+	{Name: "content-type", Value: "text/plain;charset=utf-8"},
+	{Name: "range", Value: "bytes=0-"},
+	{Name: "strict-transport-security", Value: "max-age=31536000"},
+	{Name: "strict-transport-security", Value: "max-age=31536000; includesubdomains"},
+	{Name: "strict-transport-security", Value: "max-age=31536000; includesubdomains; preload"},
+	{Name: "vary", Value: "accept-encoding"},
+	{Name: "vary", Value: "origin"},
+	{Name: "x-content-type-options", Value: "nosniff"},
+	{Name: "x-xss-protection", Value: "1; mode=block"},
+	{Name: ":status", Value: "100"},
+	{Name: ":status", Value: "204"},
+	{Name: ":status", Value: "206"},
+	{Name: ":status", Value: "302"},
+	{Name: ":status", Value: "400"},
+	{Name: ":status", Value: "403"},
+	{Name: ":status", Value: "421"},
+	{Name: ":status", Value: "425"},
+	{Name: ":status", Value: "500"},
+	{Name: "accept-language"},
+	{Name: "access-control-allow-credentials", Value: "FALSE"},
+	{Name: "access-control-allow-credentials", Value: "TRUE"},
+	{Name: "access-control-allow-headers", Value: "*"},
+	{Name: "access-control-allow-methods", Value: "get"},
+	{Name: "access-control-allow-methods", Value: "get, post, options"},
+	{Name: "access-control-allow-methods", Value: "options"},
+	{Name: "access-control-expose-headers", Value: "content-length"},
+	{Name: "access-control-request-headers", Value: "content-type"},
+	{Name: "access-control-request-method", Value: "get"},
+	{Name: "access-control-request-method", Value: "post"},
+	{Name: "alt-svc", Value: "clear"},
+	{Name: "authorization"},
+	{Name: "content-security-policy", Value: "script-src 'none'; object-src 'none'; base-uri 'none'"},
+	{Name: "early-data", Value: "1"},
+	{Name: "expect-ct"},
+	{Name: "forwarded"},
+	{Name: "if-range"},
+	{Name: "origin"},
+	{Name: "purpose", Value: "prefetch"},
+	{Name: "server"},
+	{Name: "timing-allow-origin", Value: "*"},
+	{Name: "upgrade-insecure-requests", Value: "1"},
+	{Name: "user-agent"},
+	{Name: "x-forwarded-for"},
+	{Name: "x-frame-options", Value: "deny"},
+	{Name: "x-frame-options", Value: "sameorigin"},
+}
+
+type staticIndex struct {
+	name   uint64            // index of the first entry with this name
+	values map[string]uint64 // indices of the entries with this name that have a value
+}
+
+// staticLookup maps header names to their indices in the static table.
+var staticLookup = make(map[string]staticIndex)
+
+func init() {
+	for i, hf := range staticTable {
+		idx, ok := staticLookup[hf.Name]
+		if !ok {
+			idx = staticIndex{name: uint64(i), values: make(map[string]uint64)}
+			staticLookup[hf.Name] = idx
+		}
+		if _, ok := idx.values[hf.Value]; !ok {
+			idx.values[hf.Value] = uint64(i)
+		}
+	}
+}
+
+// entryOverhead is the overhead of a dynamic table entry, see Section 3.2.1 of RFC 9204.
+const entryOverhead = 32
+
+func entrySize(hf qpack.HeaderField) uint64 {
+	return uint64(len(hf.Name)+len(hf.Value)) + entryOverhead
+}
+
+// dynamicTable is the QPACK dynamic table.
+// Entries are addressed by their absolute index, see Section 3.2.4 of RFC 9204.
+type dynamicTable struct {
+	entries  []qpack.HeaderField // entries[0] is the oldest entry that wasn't evicted yet
+	dropped  uint64              // number of entries that were evicted, i.e. the absolute index of entries[0]
+	size     uint64
+	capacity uint64
+}
+
+// insertCount is the total number of insertions into the table.
+func (t *dynamicTable) insertCount() uint64 {
+	return t.dropped + uint64(len(t.entries))
+}
+
+func (t *dynamicTable) get(absIndex uint64) (qpack.HeaderField, bool) {
+	if absIndex < t.dropped || absIndex >= t.insertCount() {
+		return qpack.HeaderField{}, false
+	}
+	return t.entries[absIndex-t.dropped], true
+}
+
+// evict evicts the oldest entry
+func (t *dynamicTable) evict() {
+	t.size -= entrySize(t.entries[0])
+	t.entries[0] = qpack.HeaderField{}
+	t.entries = t.entries[1:]
+	t.dropped++
+}
+
+// setCapacity sets the capacity, evicting entries if necessary.
+func (t *dynamicTable) setCapacity(c uint64) {
+	t.capacity = c
+	for t.size > t.capacity {
+		t.evict()
+	}
+}
+
+// insert inserts a new entry, evicting entries if necessary.
+// It returns false if the entry is larger than the capacity of the table.
+func (t *dynamicTable) insert(hf qpack.HeaderField) bool {
+	size := entrySize(hf)
+	if size > t.capacity {
+		return false
+	}
+	for t.size+size > t.capacity {
+		t.evict()
+	}
+	t.entries = append(t.entries, hf)
+	t.size += size
+	return true
+}
+
+var errVarintOverflow = errors.New("integer overflow")
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// appendVarInt appends i, encoded as a prefixed integer with an n bit prefix.
+// See Section 4.1.1 of RFC 9204.
+// The bits of the first byte that are not part of the prefix are left unset.
+func appendVarInt(b []byte, n uint8, i uint64) []byte {
+	k := uint64(1)<<n - 1
+	if i < k {
+		return append(b, byte(i))
+	}
+	b = append(b, byte(k))
+	i -= k
+	for ; i >= 128; i >>= 7 {
+		b = append(b, byte(0x80|(i&0x7f)))
+	}
+	return append(b, byte(i))
+}
+
+// readVarInt reads a prefixed integer with an n bit prefix.
+// The first byte (that contains the prefix) has already been read.
+func readVarInt(r io.ByteReader, n uint8, first byte) (uint64, error) {
+	k := uint64(1)<<n - 1
+	i := uint64(first) & k
+	if i < k {
+		return i, nil
+	}
+	var m uint
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		i += uint64(b&0x7f) << m
+		if b&0x80 == 0 {
+			return i, nil
+		}
+		m += 7
+		if m >= 63 {
+			return 0, errVarintOverflow
+		}
+	}
+}
+
+// appendString appends a string literal, using an n bit prefix for the length.
+// The Huffman flag is the bit preceding the prefix.
+// Huffman encoding is used if it reduces the length of the string.
+func appendString(b []byte, n uint8, s string) []byte {
+	offset := len(b)
+	if l := hpack.HuffmanEncodeLength(s); l < uint64(len(s)) {
+		b = appendVarInt(b, n, l)
+		b[offset] |= 1 << n
+		return hpack.AppendHuffmanString(b, s)
+	}
+	b = appendVarInt(b, n, uint64(len(s)))
+	return append(b, s...)
+}
+
+// readString reads a string literal with an n bit prefix for the length.
+// The first byte (that contains the prefix and the Huffman flag) has already been read.
+// Strings with an encoded length larger than maxLen are rejected.
+func readString(r byteReader, n uint8, first byte, maxLen uint64) (string, error) {
+	l, err := readVarInt(r, n, first)
+	if err != nil {
+		return "", err
+	}
+	if l > maxLen {
+		return "", errors.New("string literal too long")
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	if first&(1<<n) == 0 {
+		return string(b), nil
+	}
+	return hpack.HuffmanDecodeToString(b)
+}
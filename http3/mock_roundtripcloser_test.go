@@ -38,6 +38,44 @@ func (m *MockRoundTripCloser) EXPECT() *MockRoundTripCloserMockRecorder {
 	return m.recorder
 }
 
+// CanServeOrigin mocks base method.
+func (m *MockRoundTripCloser) CanServeOrigin(arg0 string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CanServeOrigin", arg0)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// CanServeOrigin indicates an expected call of CanServeOrigin.
+func (mr *MockRoundTripCloserMockRecorder) CanServeOrigin(arg0 any) *RoundTripCloserCanServeOriginCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CanServeOrigin", reflect.TypeOf((*MockRoundTripCloser)(nil).CanServeOrigin), arg0)
+	return &RoundTripCloserCanServeOriginCall{Call: call}
+}
+
+// RoundTripCloserCanServeOriginCall wrap *gomock.Call
+type RoundTripCloserCanServeOriginCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *RoundTripCloserCanServeOriginCall) Return(arg0 bool) *RoundTripCloserCanServeOriginCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *RoundTripCloserCanServeOriginCall) Do(f func(string) bool) *RoundTripCloserCanServeOriginCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *RoundTripCloserCanServeOriginCall) DoAndReturn(f func(string) bool) *RoundTripCloserCanServeOriginCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // Close mocks base method.
 func (m *MockRoundTripCloser) Close() error {
 	m.ctrl.T.Helper()
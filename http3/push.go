@@ -0,0 +1,639 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3/internal/qpackdyn"
+	"github.com/quic-go/quic-go/quicvarint"
+
+	"github.com/quic-go/qpack"
+)
+
+const defaultMaxConcurrentPushes = 100
+
+var (
+	errPushLimitReached = errors.New("http3: push would exceed the client's MAX_PUSH_ID")
+	errPushCanceled     = errors.New("http3: push canceled")
+)
+
+// A pusher pushes responses associated with a request, see Section 4.6 of RFC 9114.
+type pusher struct {
+	server  *Server
+	conn    quic.Connection
+	pushes  *serverPushes
+	encoder *qpackdyn.Encoder
+	req     *http.Request // the request that the pushes are associated with
+}
+
+// push sends a PUSH_PROMISE frame on the request stream, and handles the promised request.
+func (p *pusher) push(w *responseWriter, target string, opts *http.PushOptions) error {
+	if opts == nil {
+		opts = &http.PushOptions{}
+	}
+	method := opts.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	// Only requests that are cacheable, safe and don't have a body can be pushed.
+	if method != http.MethodGet && method != http.MethodHead {
+		return fmt.Errorf("http3: method %q must be GET or HEAD", method)
+	}
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" {
+		if !strings.HasPrefix(target, "/") {
+			return fmt.Errorf("http3: target must be an absolute URL or an absolute path: %q", target)
+		}
+		u.Scheme = "https"
+		u.Host = p.req.Host
+	} else if u.Scheme != "https" {
+		return fmt.Errorf("http3: cannot push URL with scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return errors.New("http3: URL must have a host")
+	}
+	for k := range opts.Header {
+		if strings.HasPrefix(k, ":") {
+			return fmt.Errorf("http3: promised request headers cannot include pseudo header %q", k)
+		}
+		switch strings.ToLower(k) {
+		case "content-length", "content-encoding", "trailer", "te", "expect", "host", "connection", "transfer-encoding":
+			return fmt.Errorf("http3: promised request headers cannot include %q", k)
+		}
+	}
+
+	pushID, err := p.pushes.allocate()
+	if err != nil {
+		return err
+	}
+	fields := make([]qpack.HeaderField, 0, len(opts.Header)+4)
+	fields = append(fields,
+		qpack.HeaderField{Name: ":method", Value: method},
+		qpack.HeaderField{Name: ":scheme", Value: u.Scheme},
+		qpack.HeaderField{Name: ":authority", Value: u.Host},
+		qpack.HeaderField{Name: ":path", Value: u.RequestURI()},
+	)
+	for k, v := range opts.Header {
+		for _, val := range v {
+			fields = append(fields, qpack.HeaderField{Name: strings.ToLower(k), Value: val})
+		}
+	}
+	headers, err := p.encoder.Encode(uint64(w.str.StreamID()), fields)
+	if err != nil {
+		p.pushes.done(pushID)
+		return err
+	}
+	b := make([]byte, 0, frameHeaderLen+8+len(headers))
+	b = (&pushPromiseFrame{PushID: pushID, Length: uint64(len(headers))}).Append(b)
+	b = append(b, headers...)
+	if err := w.writeFrame(b); err != nil {
+		p.pushes.done(pushID)
+		return maybeReplaceError(err)
+	}
+
+	req := &http.Request{
+		Method:     method,
+		URL:        u,
+		Proto:      "HTTP/3.0",
+		ProtoMajor: 3,
+		Header:     opts.Header.Clone(),
+		Body:       http.NoBody,
+		Host:       u.Host,
+		RequestURI: u.RequestURI(),
+		RemoteAddr: p.req.RemoteAddr,
+		TLS:        p.req.TLS,
+	}
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	go p.server.handlePush(p.conn, p.pushes, p.encoder, pushID, req)
+	return nil
+}
+
+// handlePush opens the push stream and serves the promised request.
+func (s *Server) handlePush(conn quic.Connection, pushes *serverPushes, encoder *qpackdyn.Encoder, pushID uint64, req *http.Request) {
+	str, err := conn.OpenUniStreamSync(conn.Context())
+	if err != nil {
+		s.logger.Debugf("opening push stream failed: %s", err)
+		pushes.abandon(pushID)
+		return
+	}
+	if !pushes.open(pushID, str) {
+		// the client canceled the push
+		str.CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled))
+		return
+	}
+	defer pushes.done(pushID)
+
+	b := quicvarint.Append(make([]byte, 0, 9), streamTypePushStream)
+	b = quicvarint.Append(b, pushID)
+	if _, err := str.Write(b); err != nil {
+		s.logger.Debugf("writing to push stream failed: %s", err)
+		return
+	}
+	if s.logger.Debug() {
+		s.logger.Infof("Pushing %s %s%s, on stream %d", req.Method, req.Host, req.RequestURI, str.StreamID())
+	}
+	req = req.WithContext(s.newRequestContext(str.Context(), conn, nil))
+	w := newResponseWriter(sendOnlyStream{str}, conn, encoder, s.logger)
+	if req.Method == http.MethodHead {
+		w.isHead = true
+	}
+	if panicked := s.serveHTTP(w, req); panicked {
+		str.CancelWrite(quic.StreamErrorCode(ErrCodeInternalError))
+		return
+	}
+	w.finish()
+	str.Close()
+}
+
+// serverPushes tracks the pushes on a connection, on the server side.
+type serverPushes struct {
+	ctrlStr quic.SendStream
+
+	mutex      sync.Mutex
+	enabled    bool // set when the client sends the first MAX_PUSH_ID frame
+	maxPushID  uint64
+	nextPushID uint64
+	goingAway  bool
+	goAwayID   uint64 // pushes with this ID or larger won't be processed by the client
+	pushes     map[uint64]*serverPush
+}
+
+type serverPush struct {
+	str      quic.SendStream // set once the push stream is opened
+	canceled bool
+}
+
+func newServerPushes(ctrlStr quic.SendStream) *serverPushes {
+	return &serverPushes{
+		ctrlStr: ctrlStr,
+		pushes:  make(map[uint64]*serverPush),
+	}
+}
+
+// allocate allocates a push ID.
+func (p *serverPushes) allocate() (uint64, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.enabled {
+		return 0, http.ErrNotSupported
+	}
+	if p.nextPushID > p.maxPushID || (p.goingAway && p.nextPushID >= p.goAwayID) {
+		return 0, errPushLimitReached
+	}
+	id := p.nextPushID
+	p.nextPushID++
+	p.pushes[id] = &serverPush{}
+	return id, nil
+}
+
+// open is called when the push stream was opened.
+// It returns false if the client already canceled the push.
+func (p *serverPushes) open(id uint64, str quic.SendStream) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	push, ok := p.pushes[id]
+	if !ok || push.canceled {
+		delete(p.pushes, id)
+		return false
+	}
+	push.str = str
+	return true
+}
+
+// done is called when the push has completed.
+func (p *serverPushes) done(id uint64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.pushes, id)
+}
+
+// abandon is called when the server can't fulfill a push that it already promised.
+// The client is notified by a CANCEL_PUSH frame.
+func (p *serverPushes) abandon(id uint64) {
+	p.done(id)
+	p.ctrlStr.Write((&cancelPushFrame{PushID: id}).Append(nil))
+}
+
+func (p *serverPushes) setMaxPushID(id uint64) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.enabled && id < p.maxPushID {
+		return fmt.Errorf("MAX_PUSH_ID reduced from %d to %d", p.maxPushID, id)
+	}
+	p.enabled = true
+	p.maxPushID = id
+	return nil
+}
+
+// cancel is called when the client sends a CANCEL_PUSH frame.
+func (p *serverPushes) cancel(id uint64) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.enabled || id > p.maxPushID {
+		return fmt.Errorf("CANCEL_PUSH for push ID %d exceeds MAX_PUSH_ID", id)
+	}
+	push, ok := p.pushes[id]
+	if !ok {
+		// The push has already completed, or wasn't promised yet.
+		return nil
+	}
+	push.canceled = true
+	if push.str != nil {
+		push.str.CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled))
+	}
+	return nil
+}
+
+// goAway is called when the client sends a GOAWAY frame.
+func (p *serverPushes) goAway(id uint64) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.goingAway && id > p.goAwayID {
+		return fmt.Errorf("GOAWAY increased push ID from %d to %d", p.goAwayID, id)
+	}
+	p.goingAway = true
+	p.goAwayID = id
+	return nil
+}
+
+// A PushPromise is a response that the server promised to push, see Section 4.6 of RFC 9114.
+// It is passed to the RoundTripper's PushHandler.
+type PushPromise struct {
+	// Request is the promised request.
+	// Its context is the context of the request that the push is associated with.
+	Request *http.Request
+
+	id     uint64
+	client *client
+
+	strChan  chan quic.ReceiveStream // receives the push stream
+	canceled chan struct{}           // closed when the push is canceled
+
+	// the following fields are protected by the clientPushes mutex
+	promised bool
+	str      quic.ReceiveStream
+	done     bool
+}
+
+// Response waits for the pushed response.
+// It must only be called once, from the PushHandler.
+// It is the caller's responsibility to close the response body.
+func (p *PushPromise) Response(ctx context.Context) (*http.Response, error) {
+	conn := *p.client.conn.Load()
+	select {
+	case str := <-p.strChan:
+		if !p.client.pushes.complete(p) {
+			return nil, errPushCanceled
+		}
+		return p.client.readPushedResponse(ctx, conn, p.Request, str)
+	case <-p.canceled:
+		return nil, errPushCanceled
+	case <-ctx.Done():
+		p.Cancel()
+		return nil, ctx.Err()
+	case <-conn.Context().Done():
+		return nil, context.Cause(conn.Context())
+	}
+}
+
+// Cancel cancels the push.
+// It has no effect once Response returned the pushed response. Close the Response.Body instead.
+func (p *PushPromise) Cancel() {
+	p.client.pushes.cancel(p, true)
+}
+
+// clientPushes tracks the pushes on a connection, on the client side.
+// PUSH_PROMISE frames and push streams can arrive in any order.
+// The same push can be promised on multiple request streams, but the PushHandler is only called once.
+// Therefore, pushes are tracked for the lifetime of the connection.
+type clientPushes struct {
+	mutex     sync.Mutex
+	ctrlStr   quic.SendStream
+	maxPushID uint64
+	pushes    map[uint64]*PushPromise
+}
+
+func newClientPushes(maxConcurrentPushes int) *clientPushes {
+	if maxConcurrentPushes <= 0 {
+		maxConcurrentPushes = defaultMaxConcurrentPushes
+	}
+	return &clientPushes{
+		maxPushID: uint64(maxConcurrentPushes) - 1,
+		pushes:    make(map[uint64]*PushPromise),
+	}
+}
+
+// setControlStream sends b, followed by a MAX_PUSH_ID frame, on the control stream.
+// The MAX_PUSH_ID frame is sent again on this stream every time a push completes.
+func (p *clientPushes) setControlStream(str quic.SendStream, b []byte) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.ctrlStr = str
+	_, err := str.Write((&maxPushIDFrame{PushID: p.maxPushID}).Append(b))
+	return err
+}
+
+// get returns the push with the given ID. It must be called with the mutex held.
+func (p *clientPushes) get(c *client, id uint64) (*PushPromise, error) {
+	if id > p.maxPushID {
+		return nil, fmt.Errorf("push ID %d exceeds MAX_PUSH_ID %d", id, p.maxPushID)
+	}
+	push, ok := p.pushes[id]
+	if !ok {
+		push = &PushPromise{
+			id:       id,
+			client:   c,
+			strChan:  make(chan quic.ReceiveStream, 1),
+			canceled: make(chan struct{}),
+		}
+		p.pushes[id] = push
+	}
+	return push, nil
+}
+
+// promise is called when a PUSH_PROMISE frame is received.
+// isNew is false if the push was already promised on another request stream, or if it was canceled.
+func (p *clientPushes) promise(c *client, id uint64) (push *PushPromise, isNew bool, _ error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	push, err := p.get(c, id)
+	if err != nil {
+		return nil, false, err
+	}
+	if push.promised {
+		return push, false, nil
+	}
+	push.promised = true
+	return push, !push.done, nil
+}
+
+// receivedStream is called when a push stream is accepted.
+func (p *clientPushes) receivedStream(c *client, id uint64, str quic.ReceiveStream) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	push, err := p.get(c, id)
+	if err != nil {
+		return err
+	}
+	if push.str != nil {
+		return fmt.Errorf("duplicate push stream for push ID %d", id)
+	}
+	push.str = str
+	if push.done {
+		str.CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+		return nil
+	}
+	push.strChan <- str
+	return nil
+}
+
+// cancelPush is called when the server sends a CANCEL_PUSH frame.
+func (p *clientPushes) cancelPush(c *client, id uint64) error {
+	p.mutex.Lock()
+	push, err := p.get(c, id)
+	p.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	p.cancel(push, false)
+	return nil
+}
+
+// cancel cancels a push. If it was canceled locally, the server is notified.
+func (p *clientPushes) cancel(push *PushPromise, local bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if push.done {
+		return
+	}
+	close(push.canceled)
+	if local {
+		if push.str != nil {
+			push.str.CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+		} else if p.ctrlStr != nil {
+			p.ctrlStr.Write((&cancelPushFrame{PushID: push.id}).Append(nil))
+		}
+	}
+	p.completeLocked(push)
+}
+
+// complete is called when the push stream was passed to the application.
+// It returns false if the push was canceled.
+func (p *clientPushes) complete(push *PushPromise) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if push.done {
+		return false
+	}
+	p.completeLocked(push)
+	return true
+}
+
+// completeLocked allows the server to initiate another push.
+func (p *clientPushes) completeLocked(push *PushPromise) {
+	push.done = true
+	p.maxPushID++
+	if p.ctrlStr != nil {
+		p.ctrlStr.Write((&maxPushIDFrame{PushID: p.maxPushID}).Append(nil))
+	}
+}
+
+// handlePushPromise handles a PUSH_PROMISE frame received on a request stream.
+// If the frame violates the protocol, the connection is closed.
+func (c *client) handlePushPromise(req *http.Request, conn quic.Connection, str quic.Stream, f *pushPromiseFrame) error {
+	if c.pushes == nil {
+		// We never sent a MAX_PUSH_ID frame.
+		conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeIDError), "")
+		return errors.New("received a PUSH_PROMISE frame, but server push is disabled")
+	}
+	tooLarge := f.Length > c.maxHeaderBytes()
+	var hfs []qpack.HeaderField
+	if tooLarge {
+		if _, err := io.CopyN(io.Discard, str, int64(f.Length)); err != nil {
+			return err
+		}
+	} else {
+		headerBlock := make([]byte, f.Length)
+		if _, err := io.ReadFull(str, headerBlock); err != nil {
+			return err
+		}
+		var err error
+		hfs, err = decodeHeaders(req.Context(), c.decoder, str, headerBlock)
+		if err != nil {
+			if errors.Is(err, qpackdyn.ErrDecompressionFailed) {
+				conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeQPACKDecompressionFailed), err.Error())
+			}
+			return err
+		}
+	}
+	push, isNew, err := c.pushes.promise(c, f.PushID)
+	if err != nil {
+		conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeIDError), err.Error())
+		return err
+	}
+	if !isNew {
+		return nil
+	}
+	if tooLarge {
+		c.logger.Debugf("PUSH_PROMISE frame too large: %d bytes (max: %d)", f.Length, c.maxHeaderBytes())
+		push.Cancel()
+		return nil
+	}
+	promised, err := requestFromHeaders(hfs)
+	if err != nil || !c.canAcceptPush(promised) {
+		// Clients SHOULD cancel pushes that can't be used, see Section 4.6 of RFC 9114.
+		push.Cancel()
+		return nil
+	}
+	promised.URL.Scheme = "https"
+	promised.URL.Host = promised.Host
+	push.Request = promised.WithContext(req.Context())
+	go func() {
+		c.opts.PushHandler(push)
+		// cancel the push if the handler didn't call Response
+		push.Cancel()
+	}()
+	return nil
+}
+
+// canAcceptPush says if the promised request is cacheable, safe, doesn't have a body,
+// and if the server is authoritative for it.
+func (c *client) canAcceptPush(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if req.ContentLength > 0 {
+		return false
+	}
+	return c.CanServeOrigin(authorityAddr("https", req.Host))
+}
+
+// handlePushStream handles a push stream. The stream type was already read.
+func (c *client) handlePushStream(conn quic.Connection, str quic.ReceiveStream) {
+	if c.pushes == nil {
+		// We never sent a MAX_PUSH_ID frame, so we don't expect any push streams.
+		conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeIDError), "")
+		return
+	}
+	id, err := quicvarint.Read(quicvarint.NewReader(str))
+	if err != nil {
+		c.logger.Debugf("reading push ID on stream %d failed: %s", str.StreamID(), err)
+		str.CancelRead(quic.StreamErrorCode(ErrCodeRequestIncomplete))
+		return
+	}
+	if err := c.pushes.receivedStream(c, id, str); err != nil {
+		conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeIDError), err.Error())
+	}
+}
+
+// readPushedResponse reads the response headers from the push stream.
+func (c *client) readPushedResponse(ctx context.Context, conn quic.EarlyConnection, req *http.Request, str quic.ReceiveStream) (*http.Response, error) {
+	frame, err := parseNextFrame(str, nil)
+	if err != nil {
+		str.CancelRead(quic.StreamErrorCode(ErrCodeFrameError))
+		return nil, err
+	}
+	hf, ok := frame.(*headersFrame)
+	if !ok {
+		err := errors.New("expected first frame to be a HEADERS frame")
+		conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), err.Error())
+		return nil, err
+	}
+	if hf.Length > c.maxHeaderBytes() {
+		str.CancelRead(quic.StreamErrorCode(ErrCodeFrameError))
+		return nil, fmt.Errorf("HEADERS frame too large: %d bytes (max: %d)", hf.Length, c.maxHeaderBytes())
+	}
+	headerBlock := make([]byte, hf.Length)
+	if _, err := io.ReadFull(str, headerBlock); err != nil {
+		str.CancelRead(quic.StreamErrorCode(ErrCodeRequestIncomplete))
+		return nil, err
+	}
+	hfs, err := c.decoder.Decode(ctx, uint64(str.StreamID()), headerBlock)
+	if err != nil {
+		if errors.Is(err, qpackdyn.ErrDecompressionFailed) {
+			conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeQPACKDecompressionFailed), err.Error())
+		} else {
+			str.CancelRead(quic.StreamErrorCode(ErrCodeRequestIncomplete))
+		}
+		return nil, err
+	}
+	res, err := responseFromHeaders(hfs)
+	if err != nil {
+		str.CancelRead(quic.StreamErrorCode(ErrCodeMessageError))
+		return nil, err
+	}
+	connState := conn.ConnectionState().TLS
+	res.TLS = &connState
+	res.Request = req
+
+	hstr := newStream(receiveOnlyStream{ReceiveStream: str, ctx: conn.Context()}, func() {
+		conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), "")
+	})
+	var httpStr Stream = hstr
+	res.ContentLength = -1
+	if clens, ok := res.Header["Content-Length"]; ok && len(clens) == 1 {
+		if clen64, err := strconv.ParseInt(clens[0], 10, 64); err == nil {
+			res.ContentLength = clen64
+			httpStr = newLengthLimitedStream(hstr, clen64)
+		}
+	}
+	res.Body = newResponseBody(httpStr, conn, nil)
+	return res, nil
+}
+
+// sendOnlyStream allows using the push stream with the responseWriter.
+type sendOnlyStream struct {
+	quic.SendStream
+}
+
+var _ quic.Stream = sendOnlyStream{}
+
+func (s sendOnlyStream) Read([]byte) (int, error)                      { return 0, io.EOF }
+func (s sendOnlyStream) CancelRead(quic.StreamErrorCode)               {}
+func (s sendOnlyStream) ReadChunk() ([]byte, func(), error)            { return nil, nil, io.EOF }
+func (s sendOnlyStream) ReadUnordered() (int64, []byte, func(), error) { return 0, nil, nil, io.EOF }
+func (s sendOnlyStream) SetReadDeadline(time.Time) error               { return nil }
+func (s sendOnlyStream) SetReceiveWindow(uint64, uint64)               {}
+func (s sendOnlyStream) SetDeadline(t time.Time) error                 { return s.SetWriteDeadline(t) }
+
+// receiveOnlyStream allows reading the pushed response from the push stream like from a request stream.
+type receiveOnlyStream struct {
+	quic.ReceiveStream
+	ctx context.Context
+}
+
+var _ quic.Stream = receiveOnlyStream{}
+
+func (s receiveOnlyStream) Write([]byte) (int, error) {
+	return 0, errors.New("http3: cannot write to a push stream")
+}
+func (s receiveOnlyStream) Close() error                     { return nil }
+func (s receiveOnlyStream) CancelWrite(quic.StreamErrorCode) {}
+func (s receiveOnlyStream) Context() context.Context         { return s.ctx }
+func (s receiveOnlyStream) SetWriteDeadline(time.Time) error { return nil }
+func (s receiveOnlyStream) SetSendBufferSize(uint64)         {}
+func (s receiveOnlyStream) SetDeadline(t time.Time) error    { return s.SetReadDeadline(t) }
@@ -0,0 +1,367 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3/internal/qpackdyn"
+	mockquic "github.com/quic-go/quic-go/internal/mocks/quic"
+	"github.com/quic-go/quic-go/internal/utils"
+	"github.com/quic-go/quic-go/quicvarint"
+
+	"github.com/quic-go/qpack"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.uber.org/mock/gomock"
+)
+
+var _ = Describe("Server Push", func() {
+	decodeFields := func(r io.Reader, l uint64) map[string]string {
+		data := make([]byte, l)
+		_, err := io.ReadFull(r, data)
+		Expect(err).ToNot(HaveOccurred())
+		hfs, err := qpack.NewDecoder(nil).DecodeFull(data)
+		Expect(err).ToNot(HaveOccurred())
+		fields := make(map[string]string)
+		for _, hf := range hfs {
+			fields[hf.Name] = hf.Value
+		}
+		return fields
+	}
+
+	Context("pushing", func() {
+		var (
+			conn    *mockquic.MockEarlyConnection
+			reqBuf  *bytes.Buffer
+			rw      *responseWriter
+			pushes  *serverPushes
+			handler http.HandlerFunc
+		)
+
+		BeforeEach(func() {
+			reqBuf = &bytes.Buffer{}
+			reqStr := mockquic.NewMockStream(mockCtrl)
+			reqStr.EXPECT().StreamID().Return(quic.StreamID(4)).AnyTimes()
+			reqStr.EXPECT().Write(gomock.Any()).DoAndReturn(reqBuf.Write).AnyTimes()
+			conn = mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			conn.EXPECT().LocalAddr().AnyTimes()
+			conn.EXPECT().RemoteAddr().AnyTimes()
+			encoder := qpackdyn.NewEncoder(0)
+			pushes = newServerPushes(nil)
+			s := &Server{
+				Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { handler(w, r) }),
+				logger:  utils.DefaultLogger,
+			}
+			rw = newResponseWriter(reqStr, conn, encoder, utils.DefaultLogger)
+			rw.pusher = &pusher{
+				server:  s,
+				conn:    conn,
+				pushes:  pushes,
+				encoder: encoder,
+				req:     httptest.NewRequest(http.MethodGet, "https://example.com/index.html", nil),
+			}
+		})
+
+		It("sends the PUSH_PROMISE frame and serves the promised request", func() {
+			pushBuf := &bytes.Buffer{}
+			pushStr := mockquic.NewMockStream(mockCtrl)
+			pushStr.EXPECT().StreamID().Return(quic.StreamID(15)).AnyTimes()
+			pushStr.EXPECT().Context().Return(context.Background())
+			pushStr.EXPECT().Write(gomock.Any()).DoAndReturn(pushBuf.Write).AnyTimes()
+			done := make(chan struct{})
+			pushStr.EXPECT().Close().Do(func() error { close(done); return nil })
+			conn.EXPECT().OpenUniStreamSync(gomock.Any()).Return(pushStr, nil)
+			reqChan := make(chan *http.Request, 1)
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				reqChan <- r
+				w.Write([]byte("body {}"))
+			}
+
+			Expect(pushes.setMaxPushID(10)).To(Succeed())
+			rw.Write([]byte("foobar"))
+			Expect(rw.Push("/style.css", &http.PushOptions{Header: http.Header{"Accept": {"text/css"}}})).To(Succeed())
+			rw.Flush()
+
+			// the PUSH_PROMISE frame is sent before the response
+			frame, err := parseNextFrame(reqBuf, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(BeAssignableToTypeOf(&pushPromiseFrame{}))
+			pf := frame.(*pushPromiseFrame)
+			Expect(pf.PushID).To(BeZero())
+			Expect(decodeFields(reqBuf, pf.Length)).To(Equal(map[string]string{
+				":method":    "GET",
+				":scheme":    "https",
+				":authority": "example.com",
+				":path":      "/style.css",
+				"accept":     "text/css",
+			}))
+			frame, err = parseNextFrame(reqBuf, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(BeAssignableToTypeOf(&headersFrame{}))
+
+			var req *http.Request
+			Eventually(reqChan).Should(Receive(&req))
+			Expect(req.Method).To(Equal(http.MethodGet))
+			Expect(req.URL.String()).To(Equal("https://example.com/style.css"))
+			Expect(req.Header.Get("Accept")).To(Equal("text/css"))
+
+			Eventually(done).Should(BeClosed())
+			r := quicvarint.NewReader(pushBuf)
+			streamType, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(streamType).To(BeEquivalentTo(streamTypePushStream))
+			pushID, err := quicvarint.Read(r)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pushID).To(BeZero())
+			frame, err = parseNextFrame(pushBuf, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(BeAssignableToTypeOf(&headersFrame{}))
+			Expect(decodeFields(pushBuf, frame.(*headersFrame).Length)).To(HaveKeyWithValue(":status", "200"))
+			frame, err = parseNextFrame(pushBuf, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(frame).To(Equal(&dataFrame{Length: 7}))
+		})
+
+		It("doesn't push if the client didn't send a MAX_PUSH_ID frame", func() {
+			Expect(rw.Push("/style.css", nil)).To(MatchError(http.ErrNotSupported))
+			Expect(reqBuf.Len()).To(BeZero())
+		})
+
+		It("doesn't push for pushed responses", func() {
+			rw.pusher = nil
+			Expect(rw.Push("/style.css", nil)).To(MatchError(http.ErrNotSupported))
+		})
+
+		It("doesn't exceed the MAX_PUSH_ID", func() {
+			conn.EXPECT().OpenUniStreamSync(gomock.Any()).Return(nil, errors.New("test done")).AnyTimes()
+			Expect(pushes.setMaxPushID(0)).To(Succeed())
+			pushes.ctrlStr = mockquic.NewMockStream(mockCtrl)
+			done := make(chan struct{})
+			pushes.ctrlStr.(*mockquic.MockStream).EXPECT().Write(gomock.Any()).Do(func([]byte) (int, error) {
+				close(done)
+				return 0, nil
+			})
+			Expect(rw.Push("/style.css", nil)).To(Succeed())
+			Expect(rw.Push("/script.js", nil)).To(MatchError(errPushLimitReached))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("rejects invalid pushes", func() {
+			Expect(pushes.setMaxPushID(10)).To(Succeed())
+			Expect(rw.Push("style.css", nil)).To(MatchError(`http3: target must be an absolute URL or an absolute path: "style.css"`))
+			Expect(rw.Push("http://example.com/style.css", nil)).To(MatchError(`http3: cannot push URL with scheme "http"`))
+			Expect(rw.Push("/style.css", &http.PushOptions{Method: http.MethodPost})).To(MatchError(`http3: method "POST" must be GET or HEAD`))
+			Expect(rw.Push("/style.css", &http.PushOptions{Header: http.Header{"Content-Length": {"42"}}})).To(MatchError(`http3: promised request headers cannot include "Content-Length"`))
+			Expect(reqBuf.Len()).To(BeZero())
+		})
+	})
+
+	Context("tracking pushes on the server side", func() {
+		var pushes *serverPushes
+
+		BeforeEach(func() {
+			pushes = newServerPushes(nil)
+		})
+
+		It("allocates push IDs up to the MAX_PUSH_ID", func() {
+			_, err := pushes.allocate()
+			Expect(err).To(MatchError(http.ErrNotSupported))
+			Expect(pushes.setMaxPushID(1)).To(Succeed())
+			Expect(pushes.allocate()).To(BeEquivalentTo(0))
+			Expect(pushes.allocate()).To(BeEquivalentTo(1))
+			_, err = pushes.allocate()
+			Expect(err).To(MatchError(errPushLimitReached))
+			Expect(pushes.setMaxPushID(2)).To(Succeed())
+			Expect(pushes.allocate()).To(BeEquivalentTo(2))
+		})
+
+		It("rejects reductions of the MAX_PUSH_ID", func() {
+			Expect(pushes.setMaxPushID(10)).To(Succeed())
+			Expect(pushes.setMaxPushID(9)).To(MatchError("MAX_PUSH_ID reduced from 10 to 9"))
+		})
+
+		It("stops pushing after receiving a GOAWAY frame", func() {
+			Expect(pushes.setMaxPushID(10)).To(Succeed())
+			Expect(pushes.goAway(1)).To(Succeed())
+			Expect(pushes.allocate()).To(BeEquivalentTo(0))
+			_, err := pushes.allocate()
+			Expect(err).To(MatchError(errPushLimitReached))
+			Expect(pushes.goAway(2)).To(MatchError("GOAWAY increased push ID from 1 to 2"))
+		})
+
+		It("resets push streams that are canceled", func() {
+			Expect(pushes.setMaxPushID(10)).To(Succeed())
+			id, err := pushes.allocate()
+			Expect(err).ToNot(HaveOccurred())
+			str := mockquic.NewMockStream(mockCtrl)
+			Expect(pushes.open(id, str)).To(BeTrue())
+			str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			Expect(pushes.cancel(id)).To(Succeed())
+		})
+
+		It("doesn't open push streams for canceled pushes", func() {
+			Expect(pushes.setMaxPushID(10)).To(Succeed())
+			id, err := pushes.allocate()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pushes.cancel(id)).To(Succeed())
+			Expect(pushes.open(id, mockquic.NewMockStream(mockCtrl))).To(BeFalse())
+		})
+
+		It("rejects CANCEL_PUSH frames exceeding the MAX_PUSH_ID", func() {
+			Expect(pushes.cancel(0)).To(MatchError("CANCEL_PUSH for push ID 0 exceeds MAX_PUSH_ID"))
+			Expect(pushes.setMaxPushID(10)).To(Succeed())
+			Expect(pushes.cancel(10)).To(Succeed())
+			Expect(pushes.cancel(11)).To(MatchError("CANCEL_PUSH for push ID 11 exceeds MAX_PUSH_ID"))
+		})
+	})
+
+	Context("receiving pushes", func() {
+		var (
+			cl         *client
+			conn       *mockquic.MockEarlyConnection
+			ctrlFrames chan frame // frames sent on the control stream
+		)
+
+		BeforeEach(func() {
+			conn = mockquic.NewMockEarlyConnection(mockCtrl)
+			conn.EXPECT().Context().Return(context.Background()).AnyTimes()
+			ctrlFrames = make(chan frame, 10)
+			ctrlStr := mockquic.NewMockStream(mockCtrl)
+			ctrlStr.EXPECT().Write(gomock.Any()).DoAndReturn(func(b []byte) (int, error) {
+				defer GinkgoRecover()
+				r := bytes.NewReader(b)
+				for r.Len() > 0 {
+					f, err := parseNextFrame(r, nil)
+					Expect(err).ToNot(HaveOccurred())
+					ctrlFrames <- f
+				}
+				return len(b), nil
+			}).AnyTimes()
+			cl = &client{
+				hostname: "example.com:443",
+				opts:     &roundTripperOpts{},
+				decoder:  qpackdyn.NewDecoder(0, 0, nil),
+				pushes:   newClientPushes(2),
+				logger:   utils.DefaultLogger,
+			}
+			var qconn quic.EarlyConnection = conn
+			cl.conn.Store(&qconn)
+			Expect(cl.pushes.setControlStream(ctrlStr, nil)).To(Succeed())
+			Expect(ctrlFrames).To(Receive(Equal(&maxPushIDFrame{PushID: 1})))
+		})
+
+		pushPromise := func(pushID uint64, method, path string) (*pushPromiseFrame, quic.Stream) {
+			headers, err := qpackdyn.NewEncoder(0).Encode(0, []qpack.HeaderField{
+				{Name: ":method", Value: method},
+				{Name: ":scheme", Value: "https"},
+				{Name: ":authority", Value: "example.com"},
+				{Name: ":path", Value: path},
+			})
+			Expect(err).ToNot(HaveOccurred())
+			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().StreamID().AnyTimes()
+			str.EXPECT().Context().Return(context.Background()).AnyTimes()
+			str.EXPECT().Read(gomock.Any()).DoAndReturn(bytes.NewReader(headers).Read).AnyTimes()
+			return &pushPromiseFrame{PushID: pushID, Length: uint64(len(headers))}, str
+		}
+
+		It("passes promised pushes to the PushHandler", func() {
+			promiseChan := make(chan *PushPromise, 1)
+			cl.opts.PushHandler = func(p *PushPromise) {
+				defer GinkgoRecover()
+				promiseChan <- p
+				rsp, err := p.Response(context.Background())
+				Expect(err).ToNot(HaveOccurred())
+				Expect(rsp.StatusCode).To(Equal(http.StatusTeapot))
+			}
+			req := httptest.NewRequest(http.MethodGet, "https://example.com/index.html", nil)
+			f, str := pushPromise(0, http.MethodGet, "/style.css")
+			Expect(cl.handlePushPromise(req, conn, str, f)).To(Succeed())
+			// handle a duplicate promise on a different request stream
+			f, str = pushPromise(0, http.MethodGet, "/style.css")
+			Expect(cl.handlePushPromise(req, conn, str, f)).To(Succeed())
+
+			var p *PushPromise
+			Eventually(promiseChan).Should(Receive(&p))
+			Expect(p.Request.URL.String()).To(Equal("https://example.com/style.css"))
+
+			headers, err := qpackdyn.NewEncoder(0).Encode(0, []qpack.HeaderField{{Name: ":status", Value: "418"}})
+			Expect(err).ToNot(HaveOccurred())
+			b := (&headersFrame{Length: uint64(len(headers))}).Append(nil)
+			b = append(b, headers...)
+			pushStr := mockquic.NewMockStream(mockCtrl)
+			pushStr.EXPECT().StreamID().AnyTimes()
+			pushStr.EXPECT().Read(gomock.Any()).DoAndReturn(bytes.NewReader(b).Read).AnyTimes()
+			conn.EXPECT().ConnectionState()
+			Expect(cl.pushes.receivedStream(cl, 0, pushStr)).To(Succeed())
+			// the server may initiate another push
+			Eventually(ctrlFrames).Should(Receive(Equal(&maxPushIDFrame{PushID: 2})))
+			Consistently(promiseChan).ShouldNot(Receive())
+		})
+
+		It("cancels pushes that the handler doesn't use", func() {
+			done := make(chan struct{})
+			cl.opts.PushHandler = func(*PushPromise) { close(done) }
+			f, str := pushPromise(1, http.MethodGet, "/style.css")
+			Expect(cl.handlePushPromise(httptest.NewRequest(http.MethodGet, "https://example.com/", nil), conn, str, f)).To(Succeed())
+			Eventually(done).Should(BeClosed())
+			Eventually(ctrlFrames).Should(Receive(Equal(&cancelPushFrame{PushID: 1})))
+			Eventually(ctrlFrames).Should(Receive(Equal(&maxPushIDFrame{PushID: 2})))
+		})
+
+		It("cancels pushes of unsafe requests", func() {
+			cl.opts.PushHandler = func(*PushPromise) { Fail("PushHandler should not have been called") }
+			f, str := pushPromise(0, http.MethodPost, "/form")
+			Expect(cl.handlePushPromise(httptest.NewRequest(http.MethodGet, "https://example.com/", nil), conn, str, f)).To(Succeed())
+			Expect(ctrlFrames).To(Receive(Equal(&cancelPushFrame{PushID: 0})))
+		})
+
+		It("stops reading the push stream when canceling a push", func() {
+			pushStr := mockquic.NewMockStream(mockCtrl)
+			Expect(cl.pushes.receivedStream(cl, 0, pushStr)).To(Succeed())
+			p, isNew, err := cl.pushes.promise(cl, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isNew).To(BeTrue())
+			pushStr.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			p.Cancel()
+			_, err = p.Response(context.Background())
+			Expect(err).To(MatchError(errPushCanceled))
+		})
+
+		It("handles pushes canceled by the server", func() {
+			Expect(cl.pushes.cancelPush(cl, 0)).To(Succeed())
+			_, isNew, err := cl.pushes.promise(cl, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(isNew).To(BeFalse())
+			pushStr := mockquic.NewMockStream(mockCtrl)
+			pushStr.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestCanceled))
+			Expect(cl.pushes.receivedStream(cl, 0, pushStr)).To(Succeed())
+		})
+
+		It("rejects push IDs exceeding the MAX_PUSH_ID", func() {
+			_, _, err := cl.pushes.promise(cl, 2)
+			Expect(err).To(MatchError("push ID 2 exceeds MAX_PUSH_ID 1"))
+			Expect(cl.pushes.receivedStream(cl, 2, mockquic.NewMockStream(mockCtrl))).To(MatchError("push ID 2 exceeds MAX_PUSH_ID 1"))
+			Expect(cl.pushes.cancelPush(cl, 2)).To(MatchError("push ID 2 exceeds MAX_PUSH_ID 1"))
+		})
+
+		It("rejects duplicate push streams", func() {
+			Expect(cl.pushes.receivedStream(cl, 0, mockquic.NewMockStream(mockCtrl))).To(Succeed())
+			Expect(cl.pushes.receivedStream(cl, 0, mockquic.NewMockStream(mockCtrl))).To(MatchError("duplicate push stream for push ID 0"))
+		})
+
+		It("closes the connection if push is disabled", func() {
+			cl.pushes = nil
+			f, str := pushPromise(0, http.MethodGet, "/style.css")
+			conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeIDError), gomock.Any())
+			Expect(cl.handlePushPromise(httptest.NewRequest(http.MethodGet, "https://example.com/", nil), conn, str, f)).ToNot(Succeed())
+		})
+	})
+})
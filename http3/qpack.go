@@ -0,0 +1,94 @@
+package http3
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3/internal/qpackdyn"
+	"github.com/quic-go/quic-go/quicvarint"
+
+	"github.com/quic-go/qpack"
+)
+
+const (
+	defaultQPACKMaxTableCapacity = 4096
+	defaultQPACKBlockedStreams   = 16
+)
+
+// qpackLimits returns the QPACK limits configured on a Server or a RoundTripper.
+func qpackLimits(maxTableCapacity, blockedStreams int) (uint64, uint64) {
+	if maxTableCapacity < 0 {
+		return 0, 0
+	}
+	if maxTableCapacity == 0 {
+		maxTableCapacity = defaultQPACKMaxTableCapacity
+	}
+	if blockedStreams < 0 {
+		blockedStreams = 0
+	} else if blockedStreams == 0 {
+		blockedStreams = defaultQPACKBlockedStreams
+	}
+	return uint64(maxTableCapacity), uint64(blockedStreams)
+}
+
+// newConnQPACKDecoder creates a QPACK decoder for a connection.
+// The decoder stream is opened once the decoder needs to send the first instruction.
+func newConnQPACKDecoder(conn quic.Connection, maxTableCapacity, blockedStreams uint64) *qpackdyn.Decoder {
+	return qpackdyn.NewDecoder(maxTableCapacity, blockedStreams, func() (io.Writer, error) {
+		return openQPACKStream(conn, streamTypeQPACKDecoderStream)
+	})
+}
+
+// decodeHeaders decodes a field section received on a request stream.
+// Decoding blocks if the field section references dynamic table entries that weren't received yet.
+// Since the peer cancels a request by resetting the stream and aborting reading (see Section 4.1.1 of RFC 9114),
+// decoding is canceled once the peer aborts reading, which makes the decoder send a Stream Cancellation instruction.
+func decodeHeaders(ctx context.Context, decoder *qpackdyn.Decoder, str quic.Stream, headerBlock []byte) ([]qpack.HeaderField, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stop := context.AfterFunc(str.Context(), func() {
+		// The context is also canceled when we close the stream, which doesn't affect reading.
+		var serr *quic.StreamError
+		if errors.As(context.Cause(str.Context()), &serr) {
+			cancel(serr)
+		}
+	})
+	defer stop()
+	return decoder.Decode(ctx, uint64(str.StreamID()), headerBlock)
+}
+
+func openQPACKStream(conn quic.Connection, streamType uint64) (quic.SendStream, error) {
+	str, err := conn.OpenUniStream()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := str.Write(quicvarint.Append(nil, streamType)); err != nil {
+		return nil, err
+	}
+	return str, nil
+}
+
+// enableQPACKEncoder enables the use of the dynamic table, if allowed by the peer's SETTINGS.
+func enableQPACKEncoder(conn quic.Connection, encoder *qpackdyn.Encoder, sf *settingsFrame) error {
+	if sf.QPACKMaxTableCapacity == 0 || encoder.MaxTableCapacity() == 0 {
+		return nil
+	}
+	str, err := openQPACKStream(conn, streamTypeQPACKEncoderStream)
+	if err != nil {
+		return err
+	}
+	return encoder.Enable(str, sf.QPACKMaxTableCapacity, sf.QPACKBlockedStreams)
+}
+
+// handleQPACKStream processes the peer's QPACK encoder or decoder stream.
+// Since these streams are critical streams, the connection is closed when reading from the stream fails.
+func handleQPACKStream(conn quic.Connection, str quic.ReceiveStream, read func(io.Reader) error, protocolErr error, errCode ErrCode) {
+	err := read(str)
+	if errors.Is(err, protocolErr) {
+		conn.CloseWithError(quic.ApplicationErrorCode(errCode), err.Error())
+		return
+	}
+	conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeClosedCriticalStream), "")
+}
@@ -0,0 +1,75 @@
+package http3
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3/internal/qpackdyn"
+	mockquic "github.com/quic-go/quic-go/internal/mocks/quic"
+
+	"github.com/quic-go/qpack"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("QPACK", func() {
+	Context("decoding headers", func() {
+		var (
+			encStr, decStr *bytes.Buffer
+			decoder        *qpackdyn.Decoder
+			headerBlock    []byte
+			str            *mockquic.MockStream
+			strCtx         context.Context
+			strCancel      context.CancelCauseFunc
+		)
+		fields := []qpack.HeaderField{{Name: ":status", Value: "200"}, {Name: "x-custom", Value: "foobar"}}
+
+		BeforeEach(func() {
+			encStr = &bytes.Buffer{}
+			decStr = &bytes.Buffer{}
+			encoder := qpackdyn.NewEncoder(4096)
+			Expect(encoder.Enable(encStr, 4096, 16)).To(Succeed())
+			var err error
+			headerBlock, err = encoder.Encode(4, fields)
+			Expect(err).ToNot(HaveOccurred())
+			decoder = qpackdyn.NewDecoder(4096, 16, func() (io.Writer, error) { return decStr, nil })
+			str = mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().StreamID().Return(quic.StreamID(4)).AnyTimes()
+			strCtx, strCancel = context.WithCancelCause(context.Background())
+			str.EXPECT().Context().Return(strCtx).AnyTimes()
+		})
+
+		It("decodes headers once the referenced entries are received", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				hfs, err := decodeHeaders(context.Background(), decoder, str, headerBlock)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(hfs).To(Equal(fields))
+			}()
+			// closing the stream for writing doesn't cancel decoding
+			strCancel(nil)
+			Consistently(done).ShouldNot(BeClosed())
+			Expect(decoder.ReadEncoderStream(encStr)).To(MatchError(io.EOF))
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("sends a Stream Cancellation when the stream is reset while decoding is blocked", func() {
+			done := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+				defer close(done)
+				_, err := decodeHeaders(context.Background(), decoder, str, headerBlock)
+				Expect(err).To(MatchError(context.Canceled))
+			}()
+			Consistently(done).ShouldNot(BeClosed())
+			strCancel(&quic.StreamError{StreamID: 4, ErrorCode: quic.StreamErrorCode(ErrCodeRequestCanceled), Remote: true})
+			Eventually(done).Should(BeClosed())
+			Expect(decStr.Bytes()).To(Equal([]byte{0x40 | 4})) // Stream Cancellation
+		})
+	})
+})
@@ -7,9 +7,9 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"strconv"
 	"strings"
-	"sync"
 
 	"golang.org/x/net/http/httpguts"
 	"golang.org/x/net/http2/hpack"
@@ -17,55 +17,49 @@ import (
 
 	"github.com/quic-go/qpack"
 	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3/internal/qpackdyn"
 	"github.com/quic-go/quic-go/internal/utils"
 )
 
 const bodyCopyBufferSize = 8 * 1024
 
 type requestWriter struct {
-	mutex     sync.Mutex
-	encoder   *qpack.Encoder
-	headerBuf *bytes.Buffer
+	encoder *qpackdyn.Encoder
 
 	logger utils.Logger
 }
 
-func newRequestWriter(logger utils.Logger) *requestWriter {
-	headerBuf := &bytes.Buffer{}
-	encoder := qpack.NewEncoder(headerBuf)
+func newRequestWriter(encoder *qpackdyn.Encoder, logger utils.Logger) *requestWriter {
 	return &requestWriter{
-		encoder:   encoder,
-		headerBuf: headerBuf,
-		logger:    logger,
+		encoder: encoder,
+		logger:  logger,
 	}
 }
 
 func (w *requestWriter) WriteRequestHeader(str quic.Stream, req *http.Request, gzip bool) error {
 	// TODO: figure out how to add support for trailers
 	buf := &bytes.Buffer{}
-	if err := w.writeHeaders(buf, req, gzip); err != nil {
+	if err := w.writeHeaders(buf, uint64(str.StreamID()), req, gzip); err != nil {
 		return err
 	}
 	_, err := str.Write(buf.Bytes())
 	return err
 }
 
-func (w *requestWriter) writeHeaders(wr io.Writer, req *http.Request, gzip bool) error {
-	w.mutex.Lock()
-	defer w.mutex.Unlock()
-	defer w.encoder.Close()
-	defer w.headerBuf.Reset()
-
-	if err := w.encodeHeaders(req, gzip, "", actualContentLength(req)); err != nil {
+func (w *requestWriter) writeHeaders(wr io.Writer, streamID uint64, req *http.Request, gzip bool) error {
+	fields, err := w.encodeHeaders(req, gzip, "", actualContentLength(req))
+	if err != nil {
 		return err
 	}
-
-	b := make([]byte, 0, 128)
-	b = (&headersFrame{Length: uint64(w.headerBuf.Len())}).Append(b)
-	if _, err := wr.Write(b); err != nil {
+	headers, err := w.encoder.Encode(streamID, fields)
+	if err != nil {
 		return err
 	}
-	_, err := wr.Write(w.headerBuf.Bytes())
+
+	b := make([]byte, 0, frameHeaderLen+len(headers))
+	b = (&headersFrame{Length: uint64(len(headers))}).Append(b)
+	b = append(b, headers...)
+	_, err = wr.Write(b)
 	return err
 }
 
@@ -73,17 +67,17 @@ func (w *requestWriter) writeHeaders(wr io.Writer, req *http.Request, gzip bool)
 // Modified to support Extended CONNECT:
 // Contrary to what the godoc for the http.Request says,
 // we do respect the Proto field if the method is CONNECT.
-func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, trailers string, contentLength int64) error {
+func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, trailers string, contentLength int64) ([]qpack.HeaderField, error) {
 	host := req.Host
 	if host == "" {
 		host = req.URL.Host
 	}
 	host, err := httpguts.PunycodeHostPort(host)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if !httpguts.ValidHostHeader(host) {
-		return errors.New("http3: invalid Host header")
+		return nil, errors.New("http3: invalid Host header")
 	}
 
 	// http.NewRequest sets this field to HTTP/1.1
@@ -97,9 +91,9 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 			path = strings.TrimPrefix(path, req.URL.Scheme+"://"+host)
 			if !validPseudoPath(path) {
 				if req.URL.Opaque != "" {
-					return fmt.Errorf("invalid request :path %q from URL.Opaque = %q", orig, req.URL.Opaque)
+					return nil, fmt.Errorf("invalid request :path %q from URL.Opaque = %q", orig, req.URL.Opaque)
 				} else {
-					return fmt.Errorf("invalid request :path %q", orig)
+					return nil, fmt.Errorf("invalid request :path %q", orig)
 				}
 			}
 		}
@@ -110,11 +104,11 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 	// continue to reuse the hpack encoder for future requests)
 	for k, vv := range req.Header {
 		if !httpguts.ValidHeaderFieldName(k) {
-			return fmt.Errorf("invalid HTTP header name %q", k)
+			return nil, fmt.Errorf("invalid HTTP header name %q", k)
 		}
 		for _, v := range vv {
 			if !httpguts.ValidHeaderFieldValue(v) {
-				return fmt.Errorf("invalid HTTP header value %q for header %q", v, k)
+				return nil, fmt.Errorf("invalid HTTP header value %q for header %q", v, k)
 			}
 		}
 	}
@@ -198,19 +192,20 @@ func (w *requestWriter) encodeHeaders(req *http.Request, addGzipHeader bool, tra
 	// 	return errRequestHeaderListSize
 	// }
 
-	// trace := httptrace.ContextClientTrace(req.Context())
-	// traceHeaders := traceHasWroteHeaderField(trace)
+	trace := httptrace.ContextClientTrace(req.Context())
+	traceHeaders := traceHasWroteHeaderField(trace)
 
 	// Header list size is ok. Write the headers.
+	var fields []qpack.HeaderField
 	enumerateHeaders(func(name, value string) {
 		name = strings.ToLower(name)
-		w.encoder.WriteField(qpack.HeaderField{Name: name, Value: value})
-		// if traceHeaders {
-		// 	traceWroteHeaderField(trace, name, value)
-		// }
+		fields = append(fields, qpack.HeaderField{Name: name, Value: value})
+		if traceHeaders {
+			traceWroteHeaderField(trace, name, value)
+		}
 	})
 
-	return nil
+	return fields, nil
 }
 
 // authorityAddr returns a given authority (a host/IP, or host:port / ip:port)
@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/quic-go/quic-go/http3/internal/qpackdyn"
 	mockquic "github.com/quic-go/quic-go/internal/mocks/quic"
 	"github.com/quic-go/quic-go/internal/utils"
 
@@ -41,9 +42,10 @@ var _ = Describe("Request Writer", func() {
 	}
 
 	BeforeEach(func() {
-		rw = newRequestWriter(utils.DefaultLogger)
+		rw = newRequestWriter(qpackdyn.NewEncoder(0), utils.DefaultLogger)
 		strBuf = &bytes.Buffer{}
 		str = mockquic.NewMockStream(mockCtrl)
+		str.EXPECT().StreamID().AnyTimes()
 		str.EXPECT().Write(gomock.Any()).DoAndReturn(strBuf.Write).AnyTimes()
 	})
 
@@ -2,7 +2,6 @@ package http3
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -10,6 +9,7 @@ import (
 	"time"
 
 	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3/internal/qpackdyn"
 	"github.com/quic-go/quic-go/internal/utils"
 
 	"github.com/quic-go/qpack"
@@ -22,34 +22,48 @@ const frameHeaderLen = 16
 // headerWriter wraps the stream, so that the first Write call flushes the header to the stream
 type headerWriter struct {
 	str     quic.Stream
+	encoder *qpackdyn.Encoder
 	header  http.Header
 	status  int // status code passed to WriteHeader
 	written bool
+	// writeErr is the first error returned when writing to the stream
+	writeErr error
 
 	logger utils.Logger
 }
 
 // writeHeader encodes and flush header to the stream
 func (hw *headerWriter) writeHeader() error {
-	var headers bytes.Buffer
-	enc := qpack.NewEncoder(&headers)
-	enc.WriteField(qpack.HeaderField{Name: ":status", Value: strconv.Itoa(hw.status)})
+	fields := make([]qpack.HeaderField, 0, len(hw.header)+1)
+	fields = append(fields, qpack.HeaderField{Name: ":status", Value: strconv.Itoa(hw.status)})
 
 	for k, v := range hw.header {
 		for index := range v {
-			enc.WriteField(qpack.HeaderField{Name: strings.ToLower(k), Value: v[index]})
+			fields = append(fields, qpack.HeaderField{Name: strings.ToLower(k), Value: v[index]})
 		}
 	}
+	headers, err := hw.encoder.Encode(uint64(hw.str.StreamID()), fields)
+	if err != nil {
+		return err
+	}
 
-	buf := make([]byte, 0, frameHeaderLen+headers.Len())
-	buf = (&headersFrame{Length: uint64(headers.Len())}).Append(buf)
+	buf := make([]byte, 0, frameHeaderLen+len(headers))
+	buf = (&headersFrame{Length: uint64(len(headers))}).Append(buf)
 	hw.logger.Infof("Responding with %d", hw.status)
-	buf = append(buf, headers.Bytes()...)
+	buf = append(buf, headers...)
 
-	_, err := hw.str.Write(buf)
+	_, err = hw.write(buf)
 	return err
 }
 
+func (hw *headerWriter) write(p []byte) (int, error) {
+	n, err := hw.str.Write(p)
+	if err != nil && hw.writeErr == nil {
+		hw.writeErr = err
+	}
+	return n, err
+}
+
 // first Write will trigger flushing header
 func (hw *headerWriter) Write(p []byte) (int, error) {
 	if !hw.written {
@@ -58,12 +72,13 @@ func (hw *headerWriter) Write(p []byte) (int, error) {
 		}
 		hw.written = true
 	}
-	return hw.str.Write(p)
+	return hw.write(p)
 }
 
 type responseWriter struct {
 	*headerWriter
 	conn        quic.Connection
+	pusher      *pusher // nil if the response can't push, e.g. for pushed responses
 	bufferedStr *bufio.Writer
 	buf         []byte
 
@@ -76,14 +91,16 @@ type responseWriter struct {
 var (
 	_ http.ResponseWriter = &responseWriter{}
 	_ http.Flusher        = &responseWriter{}
+	_ http.Pusher         = &responseWriter{}
 	_ Hijacker            = &responseWriter{}
 )
 
-func newResponseWriter(str quic.Stream, conn quic.Connection, logger utils.Logger) *responseWriter {
+func newResponseWriter(str quic.Stream, conn quic.Connection, encoder *qpackdyn.Encoder, logger utils.Logger) *responseWriter {
 	hw := &headerWriter{
-		str:    str,
-		header: http.Header{},
-		logger: logger,
+		str:     str,
+		encoder: encoder,
+		header:  http.Header{},
+		logger:  logger,
 	}
 	return &responseWriter{
 		headerWriter: hw,
@@ -196,6 +213,42 @@ func (w *responseWriter) Flush() {
 	}
 }
 
+// finish is called when the handler returns.
+// If the response hasn't been written to the stream yet, the Content-Length is set.
+// It returns the first error that occurred when writing the response to the stream.
+func (w *responseWriter) finish() error {
+	if !w.written {
+		if _, haveCL := w.header["Content-Length"]; !haveCL {
+			w.header.Set("Content-Length", strconv.FormatInt(w.numWritten, 10))
+		}
+	}
+	w.Flush()
+	return w.writeErr
+}
+
+// Push initiates an HTTP/3 server push, see Section 4.6 of RFC 9114.
+// The promised request is handled by the server's Handler.
+// It returns http.ErrNotSupported if the client didn't enable server push,
+// or if the client's MAX_PUSH_ID frame wasn't received yet.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if w.pusher == nil {
+		return http.ErrNotSupported
+	}
+	return w.pusher.push(w, target, opts)
+}
+
+// writeFrame writes a frame to the stream, after the data that was already written by the handler.
+// If the response header wasn't written yet, the frame is sent before the HEADERS frame.
+func (w *responseWriter) writeFrame(b []byte) error {
+	if w.written {
+		if err := w.bufferedStr.Flush(); err != nil {
+			return err
+		}
+	}
+	_, err := w.write(b)
+	return err
+}
+
 func (w *responseWriter) StreamCreator() StreamCreator {
 	return w.conn
 }
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/quic-go/quic-go/http3/internal/qpackdyn"
 	mockquic "github.com/quic-go/quic-go/internal/mocks/quic"
 	"github.com/quic-go/quic-go/internal/utils"
 
@@ -25,10 +26,11 @@ var _ = Describe("Response Writer", func() {
 	BeforeEach(func() {
 		strBuf = &bytes.Buffer{}
 		str := mockquic.NewMockStream(mockCtrl)
+		str.EXPECT().StreamID().AnyTimes()
 		str.EXPECT().Write(gomock.Any()).DoAndReturn(strBuf.Write).AnyTimes()
 		str.EXPECT().SetReadDeadline(gomock.Any()).Return(nil).AnyTimes()
 		str.EXPECT().SetWriteDeadline(gomock.Any()).Return(nil).AnyTimes()
-		rw = newResponseWriter(str, nil, utils.DefaultLogger)
+		rw = newResponseWriter(str, nil, qpackdyn.NewEncoder(0), utils.DefaultLogger)
 	})
 
 	decodeHeader := func(str io.Reader) map[string][]string {
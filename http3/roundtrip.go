@@ -8,9 +8,11 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"golang.org/x/net/http/httpguts"
 
@@ -20,15 +22,28 @@ import (
 type roundTripCloser interface {
 	RoundTripOpt(*http.Request, RoundTripOpt) (*http.Response, error)
 	HandshakeComplete() bool
+	CanServeOrigin(hostname string) bool
 	io.Closer
 }
 
 type roundTripCloserWithCount struct {
 	roundTripCloser
 	useCount atomic.Int64
+
+	hostname  string      // the origin that the connection was established for
+	idleTimer *time.Timer // protected by the RoundTripper's mutex
 }
 
-// RoundTripper implements the http.RoundTripper interface
+// RoundTripper implements the http.RoundTripper interface.
+//
+// Requests can be traced using an httptrace.ClientTrace. Since HTTP/3 runs on top of QUIC,
+// the handshake is traced using the TLSHandshakeStart and TLSHandshakeDone hooks, and
+// ConnectStart and ConnectDone are not used. The httptrace.GotConnInfo.Conn passed to GotConn
+// doesn't allow reading from or writing to the connection. It implements
+//
+//	interface{ Used0RTT() bool }
+//
+// reporting whether the request is sent in 0-RTT.
 type RoundTripper struct {
 	mutex sync.Mutex
 
@@ -73,19 +88,78 @@ type RoundTripper struct {
 	// In that case, the stream type will not be set.
 	UniStreamHijacker func(StreamType, quic.Connection, quic.ReceiveStream, error) (hijacked bool)
 
+	// Allow0RTTRequest decides whether a request may be sent in 0-RTT, before completion of the handshake.
+	// Requests sent in 0-RTT can be replayed by an attacker, see RFC 8470.
+	// If nil, only requests using a safe method (GET, HEAD, OPTIONS and TRACE) without a request body are sent in 0-RTT.
+	// Requests with a body are only sent in 0-RTT if the body can be replayed using Request.GetBody.
+	// If the server rejects 0-RTT or responds with 425 (Too Early), the request is replayed
+	// after completion of the handshake. Use ResponseUsed0RTT to find out if a response was
+	// served from 0-RTT data.
+	Allow0RTTRequest func(*http.Request) bool
+
+	// PushHandler, when set, enables HTTP/3 server push, see Section 4.6 of RFC 9114.
+	// It is called in a new go routine for every push promised by the server.
+	// The handler obtains the pushed response by calling PushPromise.Response,
+	// or declines it by calling PushPromise.Cancel. If the handler returns without
+	// calling Response, the push is canceled.
+	// Promises for requests that are not safe and cacheable, or for origins that
+	// the connection is not authoritative for, are canceled without calling the handler.
+	PushHandler func(*PushPromise)
+
+	// MaxConcurrentPushes is the number of pushes the server may initiate on a connection
+	// before the PushHandler has processed them.
+	// If zero, a default value of 100 is used.
+	// It only applies if the PushHandler is set.
+	MaxConcurrentPushes int
+
 	// Dial specifies an optional dial function for creating QUIC
 	// connections for requests.
 	// If Dial is nil, a UDPConn will be created at the first request
 	// and will be reused for subsequent connections to other servers.
 	Dial func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error)
 
+	// HTTPSResolver is used to look up the HTTPS DNS records (RFC 9460) of an origin before dialing.
+	// If the records advertise HTTP/3 support (using the ALPN "h3"), the endpoints (including
+	// alternative ports and the ipv4hint and ipv6hint addresses) are dialed instead of the origin.
+	// If nil, or if the lookup fails, the origin is dialed.
+	HTTPSResolver HTTPSResolver
+
 	// MaxResponseHeaderBytes specifies a limit on how many response bytes are
 	// allowed in the server's response header.
 	// Zero means to use a default limit.
 	MaxResponseHeaderBytes int64
 
+	// QPACKMaxTableCapacity limits the size of the QPACK dynamic tables used on a connection,
+	// both for encoding request headers and for decoding response headers.
+	// If zero, a default value of 4096 bytes is used.
+	// If negative, the QPACK dynamic table is disabled.
+	QPACKMaxTableCapacity int
+
+	// QPACKBlockedStreams is the maximum number of request streams that may be blocked
+	// waiting for QPACK dynamic table updates sent by the server.
+	// If zero, a default value of 16 is used.
+	// If negative, the server is not allowed to send headers that could block a stream.
+	QPACKBlockedStreams int
+
+	// MaxConnsPerHost limits the number of connections established to a single origin.
+	// Once the server's stream limit is reached on all connections, a new connection is established,
+	// as long as this limit is not reached. Otherwise, requests wait until the server allows
+	// opening new streams.
+	// If zero, a single connection is used per origin.
+	MaxConnsPerHost int
+
+	// IdleConnTimeout is the maximum amount of time a connection remains open
+	// without any active requests before closing itself.
+	// If zero, connections are only closed when the QUIC idle timeout expires.
+	IdleConnTimeout time.Duration
+
+	// DisableConnectionCoalescing prevents the reuse of connections for other origins.
+	// By default, a connection is used for all origins using the same port that are covered by
+	// the certificate presented by the server, as described in Section 3.3 of RFC 9114.
+	DisableConnectionCoalescing bool
+
 	newClient func(hostname string, tlsConf *tls.Config, opts *roundTripperOpts, conf *quic.Config, dialer dialFunc) (roundTripCloser, error) // so we can mock it in tests
-	clients   map[string]*roundTripCloserWithCount
+	clients   map[string][]*roundTripCloserWithCount                                                                                          // keyed by the origin that the connections were established for
 	transport *quic.Transport
 }
 
@@ -97,6 +171,14 @@ type RoundTripOpt struct {
 	// DontCloseRequestStream controls whether the request stream is closed after sending the request.
 	// If set, context cancellations have no effect after the response headers are received.
 	DontCloseRequestStream bool
+
+	// failIfBlocked makes the request fail with errStreamLimitReached if the server's stream limit is reached,
+	// instead of waiting for the server to allow opening a new stream.
+	failIfBlocked bool
+	// retried is set when a request that was rejected by the server is retried
+	retried bool
+	// retriedAfterGoAway is set when a request is retried on a new connection after receiving a GOAWAY frame
+	retriedAfterGoAway bool
 }
 
 var (
@@ -107,6 +189,13 @@ var (
 // ErrNoCachedConn is returned when RoundTripper.OnlyCachedConn is set
 var ErrNoCachedConn = errors.New("http3: no cached connection was available")
 
+// errStreamLimitReached is returned by the client if the server's stream limit is reached and
+// RoundTripOpt.failIfBlocked is set. In that case, the request wasn't sent.
+var errStreamLimitReached = errors.New("http3: stream limit reached")
+
+// errGoAway is returned by the client if the server sent a GOAWAY frame. In that case, the request wasn't sent.
+var errGoAway = errors.New("http3: server sent GOAWAY")
+
 // RoundTripOpt is like RoundTrip, but takes options.
 func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Response, error) {
 	if req.URL == nil {
@@ -142,14 +231,56 @@ func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.
 	}
 
 	hostname := authorityAddr("https", hostnameFromRequest(req))
-	cl, isReused, err := r.getClient(hostname, opt.OnlyCachedConn)
+	traceGetConn(httptrace.ContextClientTrace(req.Context()), hostname)
+	cl, isReused, canDial, err := r.getClient(hostname, opt.OnlyCachedConn, false)
 	if err != nil {
 		return nil, err
 	}
-	defer cl.useCount.Add(-1)
-	rsp, err := cl.RoundTripOpt(req, opt)
+	for {
+		o := opt
+		o.failIfBlocked = canDial
+		rsp, err := cl.RoundTripOpt(req, o)
+		if !errors.Is(err, errStreamLimitReached) {
+			return r.handleResponse(req, opt, cl, isReused, rsp, err)
+		}
+		// The stream limit is reached on this connection, and we're allowed to establish another one.
+		r.releaseClient(cl)
+		cl, isReused, canDial, err = r.getClient(hostname, false, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// handleResponse releases the client once the response body has been consumed or closed.
+// If the request failed, the client is removed, and requests failed due to a timeout on reused connections are retried.
+func (r *RoundTripper) handleResponse(req *http.Request, opt RoundTripOpt, cl *roundTripCloserWithCount, isReused bool, rsp *http.Response, err error) (*http.Response, error) {
+	if err == nil && rsp != nil && rsp.Body != nil {
+		rsp.Body = newReleasingBody(rsp.Body, func() { r.releaseClient(cl) })
+		return rsp, nil
+	}
+	defer r.releaseClient(cl)
+	if errors.Is(err, errGoAway) {
+		// The request wasn't sent, and can be retried on a new connection.
+		// The old connection is closed by the server, or when it times out.
+		r.removeClient(cl)
+		// Only retry once, so we don't keep dialing a server that sends a GOAWAY on every new connection.
+		if opt.retriedAfterGoAway {
+			return nil, err
+		}
+		opt.retriedAfterGoAway = true
+		return r.RoundTripOpt(req, opt)
+	}
+	if isRequestRejected(err) && !opt.retried {
+		// The server didn't process the request, e.g. since it sent a GOAWAY frame that we didn't receive yet.
+		// Such requests can be retried, see Section 4.1.1 of RFC 9114.
+		if retryReq, rerr := replayableRequest(req); rerr == nil {
+			opt.retried = true
+			return r.RoundTripOpt(retryReq, opt)
+		}
+	}
 	if err != nil {
-		r.removeClient(hostname)
+		r.removeClient(cl)
 		if isReused {
 			if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
 				return r.RoundTripOpt(req, opt)
@@ -159,73 +290,215 @@ func (r *RoundTripper) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.
 	return rsp, err
 }
 
+func isRequestRejected(err error) bool {
+	var serr *quic.StreamError
+	return errors.As(err, &serr) && serr.Remote && serr.ErrorCode == quic.StreamErrorCode(ErrCodeRequestRejected)
+}
+
 // RoundTrip does a round trip.
 func (r *RoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	return r.RoundTripOpt(req, RoundTripOpt{})
 }
 
-func (r *RoundTripper) getClient(hostname string, onlyCached bool) (rtc *roundTripCloserWithCount, isReused bool, err error) {
+// getClient returns a client for the origin.
+// If newConn is set, a new connection is established, unless the MaxConnsPerHost limit is reached.
+// canDial says if another connection could be established for the origin.
+func (r *RoundTripper) getClient(hostname string, onlyCached, newConn bool) (rtc *roundTripCloserWithCount, isReused, canDial bool, err error) {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
 
 	if r.clients == nil {
-		r.clients = make(map[string]*roundTripCloserWithCount)
+		r.clients = make(map[string][]*roundTripCloserWithCount)
 	}
 
-	client, ok := r.clients[hostname]
-	if !ok {
+	clients := r.clients[hostname]
+	maxConns := r.maxConnsPerHost()
+	var client *roundTripCloserWithCount
+	if !newConn || len(clients) >= maxConns {
+		client = r.findClient(hostname)
+	}
+	if client == nil {
 		if onlyCached {
-			return nil, false, ErrNoCachedConn
-		}
-		var err error
-		newCl := newClient
-		if r.newClient != nil {
-			newCl = r.newClient
-		}
-		dial := r.Dial
-		if dial == nil {
-			if r.transport == nil {
-				udpConn, err := net.ListenUDP("udp", nil)
-				if err != nil {
-					return nil, false, err
-				}
-				r.transport = &quic.Transport{Conn: udpConn}
-			}
-			dial = r.makeDialer()
+			return nil, false, false, ErrNoCachedConn
 		}
-		c, err := newCl(
-			hostname,
-			r.TLSClientConfig,
-			&roundTripperOpts{
-				EnableDatagram:     r.EnableDatagrams,
-				DisableCompression: r.DisableCompression,
-				MaxHeaderBytes:     r.MaxResponseHeaderBytes,
-				StreamHijacker:     r.StreamHijacker,
-				UniStreamHijacker:  r.UniStreamHijacker,
-				AdditionalSettings: r.AdditionalSettings,
-			},
-			r.QuicConfig,
-			dial,
-		)
+		c, err := r.dialClient(hostname)
 		if err != nil {
-			return nil, false, err
+			return nil, false, false, err
 		}
-		client = &roundTripCloserWithCount{roundTripCloser: c}
-		r.clients[hostname] = client
+		client = &roundTripCloserWithCount{roundTripCloser: c, hostname: hostname}
+		clients = append(clients, client)
+		r.clients[hostname] = clients
 	} else if client.HandshakeComplete() {
 		isReused = true
 	}
+	if client.idleTimer != nil {
+		client.idleTimer.Stop()
+	}
 	client.useCount.Add(1)
-	return client, isReused, nil
+	return client, isReused, len(clients) < maxConns, nil
+}
+
+// findClient returns the least used client for the origin.
+// If there's no connection for the origin, it tries to find a connection that can be coalesced.
+func (r *RoundTripper) findClient(hostname string) *roundTripCloserWithCount {
+	var client *roundTripCloserWithCount
+	for _, c := range r.clients[hostname] {
+		if client == nil || c.useCount.Load() < client.useCount.Load() {
+			client = c
+		}
+	}
+	if client != nil || r.DisableConnectionCoalescing {
+		return client
+	}
+	for _, clients := range r.clients {
+		for _, c := range clients {
+			if c.CanServeOrigin(hostname) {
+				return c
+			}
+		}
+	}
+	return nil
 }
 
-func (r *RoundTripper) removeClient(hostname string) {
+func (r *RoundTripper) dialClient(hostname string) (roundTripCloser, error) {
+	newCl := newClient
+	if r.newClient != nil {
+		newCl = r.newClient
+	}
+	var dial dialFunc
+	if r.Dial != nil {
+		dial = tracingDialer(r.Dial)
+	} else {
+		if r.transport == nil {
+			udpConn, err := net.ListenUDP("udp", nil)
+			if err != nil {
+				return nil, err
+			}
+			r.transport = &quic.Transport{Conn: udpConn}
+		}
+		dial = r.makeDialer()
+	}
+	if r.HTTPSResolver != nil {
+		dial = httpsRecordDialer(r.HTTPSResolver, dial)
+	}
+	return newCl(
+		hostname,
+		r.TLSClientConfig,
+		&roundTripperOpts{
+			EnableDatagram:        r.EnableDatagrams,
+			DisableCompression:    r.DisableCompression,
+			MaxHeaderBytes:        r.MaxResponseHeaderBytes,
+			QPACKMaxTableCapacity: r.QPACKMaxTableCapacity,
+			QPACKBlockedStreams:   r.QPACKBlockedStreams,
+			StreamHijacker:        r.StreamHijacker,
+			UniStreamHijacker:     r.UniStreamHijacker,
+			AdditionalSettings:    r.AdditionalSettings,
+			Allow0RTTRequest:      r.Allow0RTTRequest,
+			PushHandler:           r.PushHandler,
+			MaxConcurrentPushes:   r.MaxConcurrentPushes,
+		},
+		r.QuicConfig,
+		dial,
+	)
+}
+
+// releaseClient is called when a request has completed.
+// If the IdleConnTimeout is set, the connection is closed once it has been idle for this long.
+func (r *RoundTripper) releaseClient(client *roundTripCloserWithCount) {
+	if client.useCount.Add(-1) > 0 || r.IdleConnTimeout <= 0 {
+		return
+	}
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	if r.clients == nil {
+	if client.idleTimer != nil {
+		client.idleTimer.Reset(r.IdleConnTimeout)
 		return
 	}
-	delete(r.clients, hostname)
+	client.idleTimer = time.AfterFunc(r.IdleConnTimeout, func() {
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		if client.useCount.Load() > 0 || !r.removeClientLocked(client) {
+			return
+		}
+		client.Close()
+	})
+}
+
+// releasingBody calls release once the response body has been read to the end, or was closed.
+// The connection is in use until then, so it must not be closed by the IdleConnTimeout.
+type releasingBody struct {
+	io.ReadCloser
+
+	once    sync.Once
+	release func()
+}
+
+func newReleasingBody(b io.ReadCloser, release func()) io.ReadCloser {
+	rb := &releasingBody{ReadCloser: b, release: release}
+	// Make sure that the body can still be hijacked, e.g. by WebTransport.
+	if hb, ok := b.(hijackableResponseBody); ok {
+		return &hijackableReleasingBody{releasingBody: rb, hijackable: hb}
+	}
+	return rb
+}
+
+func (b *releasingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.once.Do(b.release)
+	}
+	return n, err
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+type hijackableResponseBody interface {
+	HTTPStreamer
+	Hijacker
+}
+
+type hijackableReleasingBody struct {
+	*releasingBody
+	hijackable hijackableResponseBody
+}
+
+var _ hijackableResponseBody = &hijackableReleasingBody{}
+
+func (b *hijackableReleasingBody) HTTPStream() Stream           { return b.hijackable.HTTPStream() }
+func (b *hijackableReleasingBody) StreamCreator() StreamCreator { return b.hijackable.StreamCreator() }
+
+func (r *RoundTripper) removeClient(client *roundTripCloserWithCount) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.removeClientLocked(client)
+}
+
+// removeClientLocked removes the client. It returns false if the client was already removed.
+func (r *RoundTripper) removeClientLocked(client *roundTripCloserWithCount) bool {
+	clients := r.clients[client.hostname]
+	for i, c := range clients {
+		if c != client {
+			continue
+		}
+		if len(clients) == 1 {
+			delete(r.clients, client.hostname)
+		} else {
+			r.clients[client.hostname] = append(clients[:i:i], clients[i+1:]...)
+		}
+		return true
+	}
+	return false
+}
+
+func (r *RoundTripper) maxConnsPerHost() int {
+	if r.MaxConnsPerHost <= 0 {
+		return 1
+	}
+	return r.MaxConnsPerHost
 }
 
 // Close closes the QUIC connections that this RoundTripper has used.
@@ -233,9 +506,14 @@ func (r *RoundTripper) removeClient(hostname string) {
 func (r *RoundTripper) Close() error {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	for _, client := range r.clients {
-		if err := client.Close(); err != nil {
-			return err
+	for _, clients := range r.clients {
+		for _, client := range clients {
+			if client.idleTimer != nil {
+				client.idleTimer.Stop()
+			}
+			if err := client.Close(); err != nil {
+				return err
+			}
 		}
 	}
 	r.clients = nil
@@ -279,13 +557,32 @@ func isNotToken(r rune) bool {
 	return !httpguts.IsTokenRune(r)
 }
 
+// tracingDialer wraps a user-provided dial function, such that the start of the handshake is traced.
+func tracingDialer(dial dialFunc) dialFunc {
+	return func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+		traceTLSHandshakeStart(httptrace.ContextClientTrace(ctx))
+		return dial(ctx, addr, tlsCfg, cfg)
+	}
+}
+
 // makeDialer makes a QUIC dialer using r.udpConn.
 func (r *RoundTripper) makeDialer() func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
 	return func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (quic.EarlyConnection, error) {
+		trace := httptrace.ContextClientTrace(ctx)
+		host, _, _ := net.SplitHostPort(addr)
+		// Like net/http, don't trace DNS resolution for IP literals.
+		isIPLiteral := net.ParseIP(host) != nil
+		if !isIPLiteral {
+			traceDNSStart(trace, host)
+		}
 		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if !isIPLiteral {
+			traceDNSDone(trace, udpAddr, err)
+		}
 		if err != nil {
 			return nil, err
 		}
+		traceTLSHandshakeStart(trace)
 		return r.transport.DialEarly(ctx, udpAddr, tlsCfg, cfg)
 	}
 }
@@ -293,10 +590,12 @@ func (r *RoundTripper) makeDialer() func(ctx context.Context, addr string, tlsCf
 func (r *RoundTripper) CloseIdleConnections() {
 	r.mutex.Lock()
 	defer r.mutex.Unlock()
-	for hostname, client := range r.clients {
-		if client.useCount.Load() == 0 {
-			client.Close()
-			delete(r.clients, hostname)
+	for _, clients := range r.clients {
+		for _, client := range clients {
+			if client.useCount.Load() == 0 {
+				r.removeClientLocked(client)
+				client.Close()
+			}
 		}
 	}
 }
@@ -7,10 +7,10 @@ import (
 	"errors"
 	"io"
 	"net/http"
-	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go"
+	mockquic "github.com/quic-go/quic-go/internal/mocks/quic"
 	"github.com/quic-go/quic-go/internal/qerr"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -110,6 +110,20 @@ var _ = Describe("RoundTripper", func() {
 			Expect(err).To(MatchError("handshake error"))
 			Expect(dialed).To(BeTrue())
 		})
+
+		It("uses the HTTPS record resolver, if provided", func() {
+			rt.HTTPSResolver = &stubHTTPSResolver{records: map[string][]HTTPSRecord{
+				"www.example.org": {{Priority: 1, ALPN: []string{"h3"}, Port: 8443}},
+			}}
+			var dialedAddr string
+			rt.Dial = func(_ context.Context, addr string, _ *tls.Config, _ *quic.Config) (quic.EarlyConnection, error) {
+				dialedAddr = addr
+				return nil, errors.New("handshake error")
+			}
+			_, err := rt.RoundTrip(req)
+			Expect(err).To(MatchError("handshake error"))
+			Expect(dialedAddr).To(Equal("www.example.org:8443"))
+		})
 	})
 
 	Context("reusing clients", func() {
@@ -254,6 +268,231 @@ var _ = Describe("RoundTripper", func() {
 		})
 	})
 
+	Context("connection pooling", func() {
+		It("opens a new connection when the stream limit is reached", func() {
+			rt.MaxConnsPerHost = 2
+			var clients []*MockRoundTripCloser
+			rt.newClient = func(string, *tls.Config, *roundTripperOpts, *quic.Config, dialFunc) (roundTripCloser, error) {
+				cl := NewMockRoundTripCloser(mockCtrl)
+				cl.EXPECT().HandshakeComplete().Return(true).AnyTimes()
+				clients = append(clients, cl)
+				if len(clients) == 1 {
+					cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).DoAndReturn(func(_ *http.Request, opt RoundTripOpt) (*http.Response, error) {
+						Expect(opt.failIfBlocked).To(BeTrue())
+						return nil, errStreamLimitReached
+					})
+					return cl, nil
+				}
+				cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).DoAndReturn(func(_ *http.Request, opt RoundTripOpt) (*http.Response, error) {
+					// MaxConnsPerHost is reached, so the request waits for the server to allow a new stream
+					Expect(opt.failIfBlocked).To(BeFalse())
+					return &http.Response{Request: req}, nil
+				})
+				return cl, nil
+			}
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req))
+			Expect(clients).To(HaveLen(2))
+			Expect(rt.clients["www.example.org:443"]).To(HaveLen(2))
+		})
+
+		It("uses a single connection per host by default", func() {
+			var count int
+			rt.newClient = func(string, *tls.Config, *roundTripperOpts, *quic.Config, dialFunc) (roundTripCloser, error) {
+				count++
+				cl := NewMockRoundTripCloser(mockCtrl)
+				cl.EXPECT().HandshakeComplete().Return(true).AnyTimes()
+				cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).DoAndReturn(func(_ *http.Request, opt RoundTripOpt) (*http.Response, error) {
+					Expect(opt.failIfBlocked).To(BeFalse())
+					return &http.Response{Request: req}, nil
+				}).Times(2)
+				return cl, nil
+			}
+			for i := 0; i < 2; i++ {
+				_, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(count).To(Equal(1))
+		})
+
+		It("closes idle connections after the IdleConnTimeout", func() {
+			rt.IdleConnTimeout = scaleDuration(20 * time.Millisecond)
+			closed := make(chan struct{})
+			rt.newClient = func(string, *tls.Config, *roundTripperOpts, *quic.Config, dialFunc) (roundTripCloser, error) {
+				cl := NewMockRoundTripCloser(mockCtrl)
+				cl.EXPECT().HandshakeComplete().Return(true).AnyTimes()
+				cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).Return(&http.Response{Request: req}, nil).AnyTimes()
+				cl.EXPECT().Close().Do(func() error { close(closed); return nil })
+				return cl, nil
+			}
+			_, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			// using the connection resets the timer
+			for i := 0; i < 4; i++ {
+				time.Sleep(rt.IdleConnTimeout / 2)
+				_, err := rt.RoundTrip(req)
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(closed).ToNot(BeClosed())
+			Eventually(closed).Should(BeClosed())
+			rt.mutex.Lock()
+			Expect(rt.clients).To(BeEmpty())
+			rt.mutex.Unlock()
+		})
+
+		It("doesn't close the connection while the response body is being read", func() {
+			rt.IdleConnTimeout = scaleDuration(20 * time.Millisecond)
+			closed := make(chan struct{})
+			pr, pw := io.Pipe()
+			rt.newClient = func(string, *tls.Config, *roundTripperOpts, *quic.Config, dialFunc) (roundTripCloser, error) {
+				cl := NewMockRoundTripCloser(mockCtrl)
+				cl.EXPECT().HandshakeComplete().Return(true).AnyTimes()
+				cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).Return(&http.Response{Request: req, Body: pr}, nil)
+				cl.EXPECT().Close().Do(func() error { close(closed); return nil })
+				return cl, nil
+			}
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			go func() {
+				defer GinkgoRecover()
+				// the server sends the body slowly
+				for i := 0; i < 4; i++ {
+					time.Sleep(rt.IdleConnTimeout / 2)
+					_, err := pw.Write([]byte("foo"))
+					Expect(err).ToNot(HaveOccurred())
+				}
+				Expect(pw.Close()).To(Succeed())
+			}()
+			data, err := io.ReadAll(rsp.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foofoofoofoo")))
+			Expect(closed).ToNot(BeClosed())
+			// the connection is released when the EOF is read
+			Eventually(closed).Should(BeClosed())
+			// closing the body doesn't release the connection a second time
+			Expect(rsp.Body.Close()).To(Succeed())
+		})
+
+		It("releases the connection when the response body is closed", func() {
+			rt.IdleConnTimeout = scaleDuration(20 * time.Millisecond)
+			closed := make(chan struct{})
+			rt.newClient = func(string, *tls.Config, *roundTripperOpts, *quic.Config, dialFunc) (roundTripCloser, error) {
+				cl := NewMockRoundTripCloser(mockCtrl)
+				cl.EXPECT().HandshakeComplete().Return(true).AnyTimes()
+				cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).Return(&http.Response{Request: req, Body: &mockBody{}}, nil)
+				cl.EXPECT().Close().Do(func() error { close(closed); return nil })
+				return cl, nil
+			}
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Consistently(closed, scaleDuration(50*time.Millisecond)).ShouldNot(BeClosed())
+			Expect(rsp.Body.Close()).To(Succeed())
+			Eventually(closed).Should(BeClosed())
+		})
+
+		It("keeps the response body hijackable", func() {
+			str := mockquic.NewMockStream(mockCtrl)
+			conn := mockquic.NewMockEarlyConnection(mockCtrl)
+			rt.newClient = func(string, *tls.Config, *roundTripperOpts, *quic.Config, dialFunc) (roundTripCloser, error) {
+				cl := NewMockRoundTripCloser(mockCtrl)
+				cl.EXPECT().HandshakeComplete().Return(true).AnyTimes()
+				cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).Return(&http.Response{Request: req, Body: newResponseBody(str, conn, nil)}, nil)
+				return cl, nil
+			}
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Body).To(BeAssignableToTypeOf(&hijackableReleasingBody{}))
+			Expect(rsp.Body.(HTTPStreamer).HTTPStream()).To(Equal(str))
+			Expect(rsp.Body.(Hijacker).StreamCreator()).To(Equal(conn))
+		})
+
+		It("coalesces connections", func() {
+			var count int
+			rt.newClient = func(hostname string, _ *tls.Config, _ *roundTripperOpts, _ *quic.Config, _ dialFunc) (roundTripCloser, error) {
+				count++
+				Expect(hostname).To(Equal("www.example.org:443"))
+				cl := NewMockRoundTripCloser(mockCtrl)
+				cl.EXPECT().HandshakeComplete().Return(true).AnyTimes()
+				cl.EXPECT().CanServeOrigin("example.org:443").Return(true)
+				cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).Return(&http.Response{}, nil).Times(2)
+				return cl, nil
+			}
+			_, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			req2, err := http.NewRequest("GET", "https://example.org/file2.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(1))
+		})
+
+		It("retries requests on a new connection after receiving a GOAWAY frame", func() {
+			var count int
+			rt.newClient = func(string, *tls.Config, *roundTripperOpts, *quic.Config, dialFunc) (roundTripCloser, error) {
+				count++
+				cl := NewMockRoundTripCloser(mockCtrl)
+				cl.EXPECT().HandshakeComplete().Return(true).AnyTimes()
+				if count == 1 {
+					cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).Return(nil, errGoAway)
+					return cl, nil
+				}
+				cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).Return(&http.Response{Request: req}, nil)
+				return cl, nil
+			}
+			rsp, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(rsp.Request).To(Equal(req))
+			Expect(count).To(Equal(2))
+			Expect(rt.clients["www.example.org:443"]).To(HaveLen(1))
+		})
+
+		It("only retries once if every connection receives a GOAWAY frame", func() {
+			var count int
+			rt.newClient = func(string, *tls.Config, *roundTripperOpts, *quic.Config, dialFunc) (roundTripCloser, error) {
+				count++
+				cl := NewMockRoundTripCloser(mockCtrl)
+				cl.EXPECT().HandshakeComplete().Return(true).AnyTimes()
+				cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).Return(nil, errGoAway)
+				return cl, nil
+			}
+			_, err := rt.RoundTrip(req)
+			Expect(err).To(MatchError(errGoAway))
+			Expect(count).To(Equal(2))
+			Expect(rt.clients).To(BeEmpty())
+		})
+
+		It("retries requests rejected by the server once", func() {
+			rejected := &quic.StreamError{ErrorCode: quic.StreamErrorCode(ErrCodeRequestRejected), Remote: true}
+			rt.newClient = func(string, *tls.Config, *roundTripperOpts, *quic.Config, dialFunc) (roundTripCloser, error) {
+				cl := NewMockRoundTripCloser(mockCtrl)
+				cl.EXPECT().HandshakeComplete().Return(true).AnyTimes()
+				cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).Return(nil, rejected).Times(2)
+				return cl, nil
+			}
+			_, err := rt.RoundTrip(req)
+			Expect(err).To(MatchError(rejected))
+		})
+
+		It("doesn't coalesce connections if disabled", func() {
+			rt.DisableConnectionCoalescing = true
+			var hostnames []string
+			rt.newClient = func(hostname string, _ *tls.Config, _ *roundTripperOpts, _ *quic.Config, _ dialFunc) (roundTripCloser, error) {
+				hostnames = append(hostnames, hostname)
+				cl := NewMockRoundTripCloser(mockCtrl)
+				cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).Return(&http.Response{}, nil)
+				return cl, nil
+			}
+			_, err := rt.RoundTrip(req)
+			Expect(err).ToNot(HaveOccurred())
+			req2, err := http.NewRequest("GET", "https://example.org/file2.html", nil)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = rt.RoundTrip(req2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(hostnames).To(Equal([]string{"www.example.org:443", "example.org:443"}))
+		})
+	})
+
 	Context("validating request", func() {
 		It("rejects plain HTTP requests", func() {
 			req, err := http.NewRequest("GET", "http://www.example.org/", nil)
@@ -318,10 +557,10 @@ var _ = Describe("RoundTripper", func() {
 
 	Context("closing", func() {
 		It("closes", func() {
-			rt.clients = make(map[string]*roundTripCloserWithCount)
+			rt.clients = make(map[string][]*roundTripCloserWithCount)
 			cl := NewMockRoundTripCloser(mockCtrl)
 			cl.EXPECT().Close()
-			rt.clients["foo.bar"] = &roundTripCloserWithCount{cl, atomic.Int64{}}
+			rt.clients["foo.bar"] = []*roundTripCloserWithCount{{roundTripCloser: cl, hostname: "foo.bar"}}
 			err := rt.Close()
 			Expect(err).ToNot(HaveOccurred())
 			Expect(len(rt.clients)).To(BeZero())
@@ -350,6 +589,7 @@ var _ = Describe("RoundTripper", func() {
 			rt.newClient = func(hostname string, tlsConf *tls.Config, opts *roundTripperOpts, conf *quic.Config, dialer dialFunc) (roundTripCloser, error) {
 				cl := NewMockRoundTripCloser(mockCtrl)
 				cl.EXPECT().Close()
+				cl.EXPECT().CanServeOrigin(gomock.Any()).Return(false).AnyTimes()
 				cl.EXPECT().RoundTripOpt(gomock.Any(), gomock.Any()).DoAndReturn(func(r *http.Request, _ RoundTripOpt) (*http.Response, error) {
 					roundTripCalled <- struct{}{}
 					<-r.Context().Done()
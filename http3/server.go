@@ -8,18 +8,18 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"runtime"
-	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3/internal/qpackdyn"
 	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/internal/utils"
 	"github.com/quic-go/quic-go/quicvarint"
-
-	"github.com/quic-go/qpack"
 )
 
 // allows mocking of quic.Listen and quic.ListenAddr
@@ -30,7 +30,8 @@ var (
 	quicListenAddr = func(addr string, tlsConf *tls.Config, config *quic.Config) (QUICEarlyListener, error) {
 		return quic.ListenAddrEarly(addr, tlsConf, config)
 	}
-	errPanicked = errors.New("panicked")
+	errPanicked     = errors.New("panicked")
+	errWriteTimeout = errors.New("write timeout")
 )
 
 // NextProtoH3 is the ALPN protocol negotiated during the TLS handshake, for QUIC v1 and v2.
@@ -126,6 +127,17 @@ var ServerContextKey = &contextKey{"http3-server"}
 // than its string representation.
 var RemoteAddrContextKey = &contextKey{"remote-addr"}
 
+// HandshakeCompleteContextKey is a context key. It is only set
+// for requests that were received in 0-RTT, before completion
+// of the handshake. The associated value will be of type
+// <-chan struct{}, and the channel is closed once the handshake
+// completes.
+//
+// Requests received in 0-RTT can be replayed by an attacker.
+// Handlers that perform non-idempotent operations can wait for the
+// handshake to complete before doing so.
+var HandshakeCompleteContextKey = &contextKey{"handshake-complete"}
+
 type requestError struct {
 	err       error
 	streamErr ErrCode
@@ -193,6 +205,18 @@ type Server struct {
 	// used.
 	MaxHeaderBytes int
 
+	// QPACKMaxTableCapacity limits the size of the QPACK dynamic tables used on a connection,
+	// both for decoding request headers and for encoding response headers.
+	// If zero, a default value of 4096 bytes is used.
+	// If negative, the QPACK dynamic table is disabled.
+	QPACKMaxTableCapacity int
+
+	// QPACKBlockedStreams is the maximum number of request streams that may be blocked
+	// waiting for QPACK dynamic table updates sent by the client.
+	// If zero, a default value of 16 is used.
+	// If negative, the client is not allowed to send headers that could block a stream.
+	QPACKBlockedStreams int
+
 	// AdditionalSettings specifies additional HTTP/3 settings.
 	// It is invalid to specify any settings defined by the HTTP/3 draft and the datagram draft.
 	AdditionalSettings map[uint64]uint64
@@ -211,15 +235,66 @@ type Server struct {
 	// In that case, the stream type will not be set.
 	UniStreamHijacker func(StreamType, quic.Connection, quic.ReceiveStream, error) (hijacked bool)
 
+	// Allow0RTTRequest decides whether a request received in 0-RTT is passed to the Handler.
+	// Requests received in 0-RTT can be replayed by an attacker, see RFC 8470.
+	// Rejected requests are answered with a 425 (Too Early) status code,
+	// which signals the client to retry the request after the handshake has completed.
+	// If nil, only requests using a safe method (GET, HEAD, OPTIONS and TRACE) are allowed.
+	//
+	// The Early-Data header field of requests received in 0-RTT is set to 1,
+	// and their context has a HandshakeCompleteContextKey value.
+	Allow0RTTRequest func(*http.Request) bool
+
 	// ConnContext optionally specifies a function that modifies
 	// the context used for a new connection c. The provided ctx
 	// has a ServerContextKey value.
 	ConnContext func(ctx context.Context, c quic.Connection) context.Context
 
+	// ReadHeaderTimeout is the amount of time allowed to read the request headers.
+	// If zero, the value of ReadTimeout is used. If both are zero, there is no timeout.
+	ReadHeaderTimeout time.Duration
+
+	// ReadTimeout is the maximum duration for reading the entire request, including the body.
+	// It is enforced on each request stream separately.
+	// If zero, there is no timeout.
+	ReadTimeout time.Duration
+
+	// WriteTimeout is the maximum duration before timing out writes of the response.
+	// It is reset when the request headers have been read.
+	// If the response wasn't written in time, the request stream is reset.
+	// If zero, there is no timeout.
+	WriteTimeout time.Duration
+
+	// IdleTimeout is the maximum amount of time a connection is kept open without any active requests.
+	// If zero, connections are only closed when the QUIC idle timeout expires.
+	IdleTimeout time.Duration
+
+	// MaxConcurrentRequests limits the number of requests handled concurrently on a single connection.
+	// Requests exceeding this limit are rejected with H3_REQUEST_REJECTED, and can be retried by the client.
+	// To make the client wait instead, use quic.Config.MaxIncomingStreams.
+	// If zero, the number of concurrent requests is only limited by quic.Config.MaxIncomingStreams.
+	MaxConcurrentRequests int
+
+	// MaxRequestsPerConn is the number of requests handled on a single connection.
+	// Once this number of requests was received, the server sends a GOAWAY frame,
+	// and rejects all further requests, asking the client to use a new connection.
+	// If zero, there is no limit.
+	MaxRequestsPerConn int
+
+	// ConnState specifies an optional callback function that is called when a QUIC connection changes state.
+	// Like for the http.Server, connections start in http.StateNew. They transition to http.StateActive
+	// when a request is received, and to http.StateIdle once all requests have been handled.
+	// http.StateClosed is entered when the connection is closed. http.StateHijacked is not used.
+	// The callback is called synchronously, and must not block.
+	ConnState func(quic.Connection, http.ConnState)
+
 	mutex     sync.RWMutex
 	listeners map[*QUICEarlyListener]listenerInfo
+	conns     map[*connRequests]struct{}
 
-	closed bool
+	closed     bool
+	inShutdown bool
+	onShutdown []func()
 
 	altSvcHeader string
 
@@ -264,7 +339,11 @@ func (s *Server) ServeQUICConn(conn quic.Connection) error {
 	if s.logger == nil {
 		s.logger = utils.DefaultLogger.WithPrefix("server")
 	}
+	closed := s.closed
 	s.mutex.Unlock()
+	if closed {
+		return http.ErrServerClosed
+	}
 
 	return s.handleConn(conn)
 }
@@ -406,6 +485,25 @@ func (s *Server) generateAltSvcHeader() {
 	s.altSvcHeader = strings.Join(altSvc, ",")
 }
 
+// trackConn adds the connection to the set of active connections.
+// It returns false if the server is shutting down.
+func (s *Server) trackConn(r *connRequests) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.conns == nil {
+		s.conns = make(map[*connRequests]struct{})
+	}
+	s.conns[r] = struct{}{}
+	return !s.inShutdown
+}
+
+func (s *Server) untrackConn(r *connRequests) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.conns, r)
+}
+
 // We store a pointer to interface in the map set. This is safe because we only
 // call trackListener via Serve and can track+defer untrack the same pointer to
 // local variable there. We never need to compare a Listener from another caller.
@@ -442,22 +540,55 @@ func (s *Server) removeListener(l *QUICEarlyListener) {
 }
 
 func (s *Server) handleConn(conn quic.Connection) error {
-	decoder := qpack.NewDecoder(nil)
+	reqs := &connRequests{
+		conn:          conn,
+		maxConcurrent: s.MaxConcurrentRequests,
+		maxTotal:      s.MaxRequestsPerConn,
+		idleTimeout:   s.IdleTimeout,
+	}
+	if s.ConnState != nil {
+		reqs.onStateChange = func(state http.ConnState) { s.ConnState(conn, state) }
+		s.ConnState(conn, http.StateNew)
+	}
+	defer reqs.close()
+
+	maxTableCapacity, blockedStreams := qpackLimits(s.QPACKMaxTableCapacity, s.QPACKBlockedStreams)
+	encoder := qpackdyn.NewEncoder(maxTableCapacity)
+	decoder := newConnQPACKDecoder(conn, maxTableCapacity, blockedStreams)
 
 	// send a SETTINGS frame
-	str, err := conn.OpenUniStream()
+	ctrlStr, err := conn.OpenUniStream()
 	if err != nil {
 		return fmt.Errorf("opening the control stream failed: %w", err)
 	}
 	b := make([]byte, 0, 64)
 	b = quicvarint.Append(b, streamTypeControlStream) // stream type
-	b = (&settingsFrame{Datagram: s.EnableDatagrams, Other: s.AdditionalSettings}).Append(b)
-	str.Write(b)
+	b = (&settingsFrame{
+		QPACKMaxTableCapacity: maxTableCapacity,
+		QPACKBlockedStreams:   blockedStreams,
+		Datagram:              s.EnableDatagrams,
+		Other:                 s.AdditionalSettings,
+	}).Append(b)
+	ctrlStr.Write(b)
+	reqs.ctrlStr = ctrlStr
+
+	pushes := newServerPushes(ctrlStr)
+	go s.handleUnidirectionalStreams(conn, encoder, decoder, pushes)
+
+	if !s.trackConn(reqs) {
+		// The server is shutting down, and doesn't accept any new connections.
+		conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), "")
+		return http.ErrServerClosed
+	}
+	defer s.untrackConn(reqs)
 
-	go s.handleUnidirectionalStreams(conn)
+	if s.IdleTimeout > 0 {
+		reqs.idleTimer = time.AfterFunc(s.IdleTimeout, reqs.closeIfIdle)
+		defer reqs.idleTimer.Stop()
+	}
 
 	// Process all requests immediately.
-	// It's the client's responsibility to decide which requests are eligible for 0-RTT.
+	// Requests received in 0-RTT are subject to the Allow0RTTRequest policy.
 	for {
 		str, err := conn.AcceptStream(context.Background())
 		if err != nil {
@@ -467,8 +598,14 @@ func (s *Server) handleConn(conn quic.Connection) error {
 			}
 			return fmt.Errorf("accepting stream failed: %w", err)
 		}
+		if !reqs.start(str) {
+			str.CancelRead(quic.StreamErrorCode(ErrCodeRequestRejected))
+			str.CancelWrite(quic.StreamErrorCode(ErrCodeRequestRejected))
+			continue
+		}
 		go func() {
-			rerr := s.handleRequest(conn, str, decoder, func() {
+			defer reqs.done()
+			rerr := s.handleRequest(conn, str, encoder, decoder, pushes, func() {
 				conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), "")
 			})
 			if rerr.err == errHijacked {
@@ -493,11 +630,126 @@ func (s *Server) handleConn(conn quic.Connection) error {
 	}
 }
 
-func (s *Server) handleUnidirectionalStreams(conn quic.Connection) {
+// connRequests tracks the requests on a connection, and enforces the per-connection limits.
+type connRequests struct {
+	conn                    quic.Connection
+	ctrlStr                 quic.SendStream
+	maxConcurrent, maxTotal int
+	idleTimeout             time.Duration
+	onStateChange           func(http.ConnState)
+
+	mutex        sync.Mutex
+	active       int
+	total        int
+	nextStreamID quic.StreamID // the ID of the next client-initiated bidirectional stream
+	goingAway    bool
+	goAwayID     quic.StreamID // the first stream that isn't processed, after sending the GOAWAY frame
+	closed       bool
+	idleTimer    *time.Timer
+}
+
+// start is called when a new request stream is accepted.
+// It returns if the request should be handled.
+// If the MaxRequestsPerConn limit is reached, a GOAWAY frame is sent.
+func (r *connRequests) start(str quic.Stream) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	id := str.StreamID()
+	if r.goingAway && id >= r.goAwayID {
+		return false
+	}
+	if r.maxConcurrent > 0 && r.active >= r.maxConcurrent {
+		return false
+	}
+	// client-initiated bidirectional streams are spaced 4 apart
+	r.nextStreamID = max(r.nextStreamID, id+4)
+	r.active++
+	r.total++
+	if r.idleTimer != nil {
+		r.idleTimer.Stop()
+	}
+	if r.active == 1 {
+		r.setState(http.StateActive)
+	}
+	if r.maxTotal > 0 && r.total >= r.maxTotal {
+		r.goAway(r.nextStreamID)
+	}
+	return true
+}
+
+// done is called when a request has been handled.
+func (r *connRequests) done() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.active--
+	if r.active > 0 {
+		return
+	}
+	r.setState(http.StateIdle)
+	if r.idleTimer != nil {
+		r.idleTimer.Reset(r.idleTimeout)
+	}
+}
+
+// closeIfIdle closes the connection if no requests are being processed.
+// A GOAWAY frame is sent first, such that the client knows that requests sent
+// after this point weren't processed, see Section 5.2 of RFC 9114.
+func (r *connRequests) closeIfIdle() {
+	r.mutex.Lock()
+	if r.active > 0 {
+		r.mutex.Unlock()
+		return
+	}
+	r.goAway(r.nextStreamID)
+	r.mutex.Unlock()
+	r.conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), "idle timeout")
+}
+
+// shutdown initiates the graceful shutdown of the connection by sending a GOAWAY frame.
+// Requests that were already received are still processed.
+// The client closes the connection once it has received the responses, see Section 5.2 of RFC 9114.
+func (r *connRequests) shutdown() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.goAway(r.nextStreamID)
+}
+
+// goAway sends a GOAWAY frame, unless a GOAWAY frame with a lower stream ID was already sent.
+// It must be called with the mutex held.
+func (r *connRequests) goAway(id quic.StreamID) {
+	if r.goingAway && id >= r.goAwayID {
+		return
+	}
+	r.goingAway = true
+	r.goAwayID = id
+	r.ctrlStr.Write((&goAwayFrame{StreamID: id}).Append(nil))
+}
+
+// close is called when the connection is closed.
+func (r *connRequests) close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.setState(http.StateClosed)
+	r.closed = true
+}
+
+// setState calls the ConnState callback. It must be called with the mutex held.
+func (r *connRequests) setState(state http.ConnState) {
+	if r.onStateChange == nil || r.closed {
+		return
+	}
+	r.onStateChange(state)
+}
+
+func (s *Server) handleUnidirectionalStreams(conn quic.Connection, encoder *qpackdyn.Encoder, decoder *qpackdyn.Decoder, pushes *serverPushes) {
+	var rcvdQPACKEncoderStr, rcvdQPACKDecoderStr atomic.Bool
+
 	for {
 		str, err := conn.AcceptUniStream(context.Background())
 		if err != nil {
 			s.logger.Debugf("accepting unidirectional stream failed: %s", err)
+			decoder.Close(err)
 			return
 		}
 
@@ -513,9 +765,19 @@ func (s *Server) handleUnidirectionalStreams(conn quic.Connection) {
 			// We're only interested in the control stream here.
 			switch streamType {
 			case streamTypeControlStream:
-			case streamTypeQPACKEncoderStream, streamTypeQPACKDecoderStream:
-				// Our QPACK implementation doesn't use the dynamic table yet.
-				// TODO: check that only one stream of each type is opened.
+			case streamTypeQPACKEncoderStream:
+				if !rcvdQPACKEncoderStr.CompareAndSwap(false, true) {
+					conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeStreamCreationError), "duplicate QPACK encoder stream")
+					return
+				}
+				handleQPACKStream(conn, str, decoder.ReadEncoderStream, qpackdyn.ErrEncoderStream, ErrCodeQPACKEncoderStreamError)
+				return
+			case streamTypeQPACKDecoderStream:
+				if !rcvdQPACKDecoderStr.CompareAndSwap(false, true) {
+					conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeStreamCreationError), "duplicate QPACK decoder stream")
+					return
+				}
+				handleQPACKStream(conn, str, encoder.ReadDecoderStream, qpackdyn.ErrDecoderStream, ErrCodeQPACKDecoderStreamError)
 				return
 			case streamTypePushStream: // only the server can push
 				conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeStreamCreationError), "")
@@ -537,14 +799,39 @@ func (s *Server) handleUnidirectionalStreams(conn quic.Connection) {
 				conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeMissingSettings), "")
 				return
 			}
-			if !sf.Datagram {
+			if err := enableQPACKEncoder(conn, encoder, sf); err != nil {
+				s.logger.Debugf("enabling the QPACK dynamic table failed: %s", err)
+				conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeInternalError), "")
 				return
 			}
 			// If datagram support was enabled on our side as well as on the client side,
 			// we can expect it to have been negotiated both on the transport and on the HTTP/3 layer.
 			// Note: ConnectionState() will block until the handshake is complete (relevant when using 0-RTT).
-			if s.EnableDatagrams && !conn.ConnectionState().SupportsDatagrams {
+			if sf.Datagram && s.EnableDatagrams && !conn.ConnectionState().SupportsDatagrams {
 				conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeSettingsError), "missing QUIC Datagram support")
+				return
+			}
+			for {
+				f, err := parseNextFrame(str, nil)
+				if err != nil {
+					return
+				}
+				switch f := f.(type) {
+				case *maxPushIDFrame:
+					err = pushes.setMaxPushID(f.PushID)
+				case *cancelPushFrame:
+					err = pushes.cancel(f.PushID)
+				case *goAwayFrame:
+					// Sent by the client, the GOAWAY frame contains a push ID.
+					err = pushes.goAway(uint64(f.StreamID))
+				default:
+					conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), "")
+					return
+				}
+				if err != nil {
+					conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeIDError), err.Error())
+					return
+				}
 			}
 		}(str)
 	}
@@ -557,7 +844,11 @@ func (s *Server) maxHeaderBytes() uint64 {
 	return uint64(s.MaxHeaderBytes)
 }
 
-func (s *Server) handleRequest(conn quic.Connection, str quic.Stream, decoder *qpack.Decoder, onFrameError func()) requestError {
+func (s *Server) handleRequest(conn quic.Connection, str quic.Stream, encoder *qpackdyn.Encoder, decoder *qpackdyn.Decoder, pushes *serverPushes, onFrameError func()) requestError {
+	start := time.Now()
+	if d := s.readHeaderTimeout(); d > 0 {
+		str.SetReadDeadline(start.Add(d))
+	}
 	var ufh unknownFrameHandlerFunc
 	if s.StreamHijacker != nil {
 		ufh = func(ft FrameType, e error) (processed bool, err error) { return s.StreamHijacker(ft, conn, str, e) }
@@ -567,7 +858,7 @@ func (s *Server) handleRequest(conn quic.Connection, str quic.Stream, decoder *q
 		if err == errHijacked {
 			return requestError{err: errHijacked}
 		}
-		return newStreamError(ErrCodeRequestIncomplete, err)
+		return s.requestIncomplete(str, err)
 	}
 	hf, ok := frame.(*headersFrame)
 	if !ok {
@@ -578,21 +869,39 @@ func (s *Server) handleRequest(conn quic.Connection, str quic.Stream, decoder *q
 	}
 	headerBlock := make([]byte, hf.Length)
 	if _, err := io.ReadFull(str, headerBlock); err != nil {
-		return newStreamError(ErrCodeRequestIncomplete, err)
+		return s.requestIncomplete(str, err)
 	}
-	hfs, err := decoder.DecodeFull(headerBlock)
+	// The stream's context is canceled when the client cancels the request,
+	// which makes the decoder send a Stream Cancellation if decoding is blocked.
+	ctx := str.Context()
+	hfs, err := decoder.Decode(ctx, uint64(str.StreamID()), headerBlock)
 	if err != nil {
-		// TODO: use the right error code
-		return newConnError(ErrCodeGeneralProtocolError, err)
+		if errors.Is(err, qpackdyn.ErrDecompressionFailed) {
+			return newConnError(ErrCodeQPACKDecompressionFailed, err)
+		}
+		return newStreamError(ErrCodeRequestIncomplete, err)
 	}
 	req, err := requestFromHeaders(hfs)
 	if err != nil {
 		return newStreamError(ErrCodeMessageError, err)
 	}
 
-	connState := conn.ConnectionState().TLS
-	req.TLS = &connState
+	if s.ReadTimeout > 0 {
+		str.SetReadDeadline(start.Add(s.ReadTimeout))
+	} else if s.ReadHeaderTimeout > 0 {
+		str.SetReadDeadline(time.Time{})
+	}
+	if s.WriteTimeout > 0 {
+		str.SetWriteDeadline(time.Now().Add(s.WriteTimeout))
+	}
+
+	connState := conn.ConnectionState()
+	req.TLS = &connState.TLS
 	req.RemoteAddr = conn.RemoteAddr().String()
+	handshakeComplete := pendingHandshake(conn, connState)
+	if handshakeComplete != nil {
+		req.Header.Set("Early-Data", "1")
+	}
 
 	// Check that the client doesn't send more data in DATA frames than indicated by the Content-Length header (if set).
 	// See section 4.1.2 of RFC 9114.
@@ -611,66 +920,130 @@ func (s *Server) handleRequest(conn quic.Connection, str quic.Stream, decoder *q
 		s.logger.Infof("%s %s%s", req.Method, req.Host, req.RequestURI)
 	}
 
-	ctx := str.Context()
+	req = req.WithContext(s.newRequestContext(ctx, conn, handshakeComplete))
+	r := newResponseWriter(str, conn, encoder, s.logger)
+	if req.Method == http.MethodHead {
+		r.isHead = true
+	}
+	r.pusher = &pusher{server: s, conn: conn, pushes: pushes, encoder: encoder, req: req}
+	var panicked bool
+	if handshakeComplete != nil && !s.allow0RTTRequest(req) {
+		r.WriteHeader(http.StatusTooEarly)
+	} else {
+		panicked = s.serveHTTP(r, req)
+	}
+
+	if body.wasStreamHijacked() {
+		return requestError{err: errHijacked}
+	}
+
+	// only write response when there is no panic
+	var writeErr error
+	if !panicked {
+		writeErr = r.finish()
+	}
+	// If the EOF was read by the handler, CancelRead() is a no-op.
+	str.CancelRead(quic.StreamErrorCode(ErrCodeNoError))
+
+	// abort the stream when there is a panic
+	if panicked {
+		return newStreamError(ErrCodeInternalError, errPanicked)
+	}
+	// The response wasn't written completely if writing ran into the write deadline.
+	if writeErr != nil {
+		if nerr, ok := writeErr.(net.Error); (ok && nerr.Timeout()) || errors.Is(writeErr, os.ErrDeadlineExceeded) {
+			return newStreamError(ErrCodeRequestCanceled, errWriteTimeout)
+		}
+	}
+	return requestError{}
+}
+
+// newRequestContext adds the values that are available to handlers to the context of a stream.
+func (s *Server) newRequestContext(ctx context.Context, conn quic.Connection, handshakeComplete <-chan struct{}) context.Context {
 	ctx = context.WithValue(ctx, ServerContextKey, s)
 	ctx = context.WithValue(ctx, http.LocalAddrContextKey, conn.LocalAddr())
 	ctx = context.WithValue(ctx, RemoteAddrContextKey, conn.RemoteAddr())
+	if handshakeComplete != nil {
+		ctx = context.WithValue(ctx, HandshakeCompleteContextKey, handshakeComplete)
+	}
 	if s.ConnContext != nil {
 		ctx = s.ConnContext(ctx, conn)
 		if ctx == nil {
 			panic("http3: ConnContext returned nil")
 		}
 	}
-	req = req.WithContext(ctx)
-	r := newResponseWriter(str, conn, s.logger)
-	if req.Method == http.MethodHead {
-		r.isHead = true
-	}
+	return ctx
+}
+
+// serveHTTP calls the handler. It returns true if the handler panicked.
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) (panicked bool) {
 	handler := s.Handler
 	if handler == nil {
 		handler = http.DefaultServeMux
 	}
-
-	var panicked bool
-	func() {
-		defer func() {
-			if p := recover(); p != nil {
-				panicked = true
-				if p == http.ErrAbortHandler {
-					return
-				}
-				// Copied from net/http/server.go
-				const size = 64 << 10
-				buf := make([]byte, size)
-				buf = buf[:runtime.Stack(buf, false)]
-				s.logger.Errorf("http: panic serving: %v\n%s", p, buf)
+	defer func() {
+		if p := recover(); p != nil {
+			panicked = true
+			if p == http.ErrAbortHandler {
+				return
 			}
-		}()
-		handler.ServeHTTP(r, req)
+			// Copied from net/http/server.go
+			const size = 64 << 10
+			buf := make([]byte, size)
+			buf = buf[:runtime.Stack(buf, false)]
+			s.logger.Errorf("http: panic serving: %v\n%s", p, buf)
+		}
 	}()
+	handler.ServeHTTP(w, req)
+	return false
+}
 
-	if body.wasStreamHijacked() {
-		return requestError{err: errHijacked}
+// requestIncomplete is called when reading the request headers failed.
+// If the ReadHeaderTimeout expired, reading from the stream is canceled as well,
+// so that clients can't keep the stream open.
+func (s *Server) requestIncomplete(str quic.Stream, err error) requestError {
+	if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+		str.CancelRead(quic.StreamErrorCode(ErrCodeRequestIncomplete))
 	}
+	return newStreamError(ErrCodeRequestIncomplete, err)
+}
 
-	// only write response when there is no panic
-	if !panicked {
-		// response not written to the client yet, set Content-Length
-		if !r.written {
-			if _, haveCL := r.header["Content-Length"]; !haveCL {
-				r.header.Set("Content-Length", strconv.FormatInt(r.numWritten, 10))
-			}
-		}
-		r.Flush()
+func (s *Server) readHeaderTimeout() time.Duration {
+	if s.ReadHeaderTimeout > 0 {
+		return s.ReadHeaderTimeout
 	}
-	// If the EOF was read by the handler, CancelRead() is a no-op.
-	str.CancelRead(quic.StreamErrorCode(ErrCodeNoError))
+	return s.ReadTimeout
+}
 
-	// abort the stream when there is a panic
-	if panicked {
-		return newStreamError(ErrCodeInternalError, errPanicked)
+// pendingHandshake returns a channel that is closed when the handshake completes,
+// if 0-RTT was used and the handshake hasn't completed yet.
+// Otherwise, it returns nil.
+func pendingHandshake(conn quic.Connection, connState quic.ConnectionState) <-chan struct{} {
+	if !connState.Used0RTT {
+		return nil
+	}
+	c, ok := conn.(interface{ HandshakeComplete() <-chan struct{} })
+	if !ok {
+		return nil
+	}
+	ch := c.HandshakeComplete()
+	select {
+	case <-ch:
+		return nil
+	default:
+		return ch
 	}
-	return requestError{}
+}
+
+func (s *Server) allow0RTTRequest(req *http.Request) bool {
+	if s.Allow0RTTRequest != nil {
+		return s.Allow0RTTRequest(req)
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
 }
 
 // Close the server immediately, aborting requests and sending CONNECTION_CLOSE frames to connected clients.
@@ -679,6 +1052,20 @@ func (s *Server) Close() error {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
+	err := s.closeListenersLocked()
+	for r := range s.conns {
+		r.conn.CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), "")
+	}
+	return err
+}
+
+func (s *Server) closeListeners() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closeListenersLocked()
+}
+
+func (s *Server) closeListenersLocked() error {
 	s.closed = true
 
 	var err error
@@ -691,12 +1078,81 @@ func (s *Server) Close() error {
 }
 
 // CloseGracefully shuts down the server gracefully. The server sends a GOAWAY frame first, then waits for either timeout to trigger, or for all running requests to complete.
+// Connections that are still active when the timeout expires are closed.
 // CloseGracefully in combination with ListenAndServe() (instead of Serve()) may race if it is called before a UDP socket is established.
 func (s *Server) CloseGracefully(timeout time.Duration) error {
-	// TODO: implement
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		s.Close()
+		return err
+	}
 	return nil
 }
 
+// shutdownPollIntervalMax is the maximum interval at which Shutdown polls for the connections to be closed.
+const shutdownPollIntervalMax = 500 * time.Millisecond
+
+// Shutdown gracefully shuts down the server without interrupting any active requests.
+// Like http.Server.Shutdown, it stops accepting new connections, sends a GOAWAY frame on all connections,
+// and then waits for the requests that were already received to complete.
+// Since closing a QUIC connection discards all data that hasn't been delivered yet,
+// the server doesn't close the connections itself. It waits for the clients to close them
+// once they have received all responses, as required by Section 5.2 of RFC 9114.
+// The listeners are closed once all connections have been closed.
+//
+// If the provided context expires before the shutdown is complete, Shutdown closes the listeners
+// and returns the context's error. The connections that are still active are not closed in that case,
+// Close can be used to close them.
+//
+// Once Shutdown has been called, Serve, ListenAndServe and ServeQUICConn return http.ErrServerClosed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mutex.Lock()
+	s.closed = true
+	s.inShutdown = true
+	for _, f := range s.onShutdown {
+		go f()
+	}
+	conns := make([]*connRequests, 0, len(s.conns))
+	for r := range s.conns {
+		conns = append(conns, r)
+	}
+	s.mutex.Unlock()
+
+	for _, r := range conns {
+		r.shutdown()
+	}
+
+	pollInterval := time.Millisecond
+	timer := time.NewTimer(pollInterval)
+	defer timer.Stop()
+	for {
+		s.mutex.RLock()
+		numConns := len(s.conns)
+		s.mutex.RUnlock()
+		if numConns == 0 {
+			return s.closeListeners()
+		}
+		select {
+		case <-ctx.Done():
+			s.closeListeners()
+			return ctx.Err()
+		case <-timer.C:
+			pollInterval = min(2*pollInterval, shutdownPollIntervalMax)
+			timer.Reset(pollInterval)
+		}
+	}
+}
+
+// RegisterOnShutdown registers a function to call on Shutdown.
+// This can be used to gracefully shut down connections that have been taken over using the StreamHijacker or the UniStreamHijacker.
+// Each function is called in its own goroutine.
+func (s *Server) RegisterOnShutdown(f func()) {
+	s.mutex.Lock()
+	s.onShutdown = append(s.onShutdown, f)
+	s.mutex.Unlock()
+}
+
 // ErrNoAltSvcPort is the error returned by SetQuicHeaders when no port was found
 // for Alt-Svc to announce. This can happen if listening on a PacketConn without a port
 // (UNIX socket, for example) and no port is specified in Server.Port or Server.Addr.
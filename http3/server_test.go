@@ -9,11 +9,14 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"os"
 	"runtime"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3/internal/qpackdyn"
 	mockquic "github.com/quic-go/quic-go/internal/mocks/quic"
 	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/internal/testdata"
@@ -86,7 +89,7 @@ var _ = Describe("Server", func() {
 
 	Context("handling requests", func() {
 		var (
-			qpackDecoder       *qpack.Decoder
+			qpackDecoder       *qpackdyn.Decoder
 			str                *mockquic.MockStream
 			conn               *mockquic.MockEarlyConnection
 			exampleGetRequest  *http.Request
@@ -116,8 +119,9 @@ var _ = Describe("Server", func() {
 		encodeRequest := func(req *http.Request) []byte {
 			buf := &bytes.Buffer{}
 			str := mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().StreamID().AnyTimes()
 			str.EXPECT().Write(gomock.Any()).DoAndReturn(buf.Write).AnyTimes()
-			rw := newRequestWriter(utils.DefaultLogger)
+			rw := newRequestWriter(qpackdyn.NewEncoder(0), utils.DefaultLogger)
 			Expect(rw.WriteRequestHeader(str, req, false)).To(Succeed())
 			return buf.Bytes()
 		}
@@ -139,8 +143,9 @@ var _ = Describe("Server", func() {
 			examplePostRequest, err = http.NewRequest("POST", "https://www.example.com", bytes.NewReader([]byte("foobar")))
 			Expect(err).ToNot(HaveOccurred())
 
-			qpackDecoder = qpack.NewDecoder(nil)
+			qpackDecoder = qpackdyn.NewDecoder(0, 0, nil)
 			str = mockquic.NewMockStream(mockCtrl)
+			str.EXPECT().StreamID().AnyTimes()
 			conn = mockquic.NewMockEarlyConnection(mockCtrl)
 			addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
 			conn.EXPECT().RemoteAddr().Return(addr).AnyTimes()
@@ -161,7 +166,7 @@ var _ = Describe("Server", func() {
 			}).AnyTimes()
 			str.EXPECT().CancelRead(gomock.Any())
 
-			Expect(s.handleRequest(conn, str, qpackDecoder, nil)).To(Equal(requestError{}))
+			Expect(s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)).To(Equal(requestError{}))
 			var req *http.Request
 			Eventually(requestChan).Should(Receive(&req))
 			Expect(req.Host).To(Equal("www.example.com"))
@@ -179,12 +184,94 @@ var _ = Describe("Server", func() {
 			str.EXPECT().Write(gomock.Any()).DoAndReturn(responseBuf.Write).AnyTimes()
 			str.EXPECT().CancelRead(gomock.Any())
 
-			serr := s.handleRequest(conn, str, qpackDecoder, nil)
+			serr := s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)
 			Expect(serr.err).ToNot(HaveOccurred())
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
 		})
 
+		Context("0-RTT", func() {
+			var handshakeComplete chan struct{}
+
+			BeforeEach(func() {
+				handshakeComplete = make(chan struct{})
+				conn = mockquic.NewMockEarlyConnection(mockCtrl)
+				addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+				conn.EXPECT().RemoteAddr().Return(addr).AnyTimes()
+				conn.EXPECT().LocalAddr().AnyTimes()
+				conn.EXPECT().ConnectionState().Return(quic.ConnectionState{Used0RTT: true}).AnyTimes()
+				conn.EXPECT().HandshakeComplete().Return(handshakeComplete).AnyTimes()
+			})
+
+			handle := func(req *http.Request) (*http.Request, map[string][]string) {
+				requestChan := make(chan *http.Request, 1)
+				s.Handler = http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+					requestChan <- r
+				})
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().StreamID().AnyTimes()
+				buf := bytes.NewBuffer(encodeRequest(req))
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+					if buf.Len() == 0 {
+						return 0, io.EOF
+					}
+					return buf.Read(p)
+				}).AnyTimes()
+				responseBuf := &bytes.Buffer{}
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(responseBuf.Write).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any())
+				serr := s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)
+				Expect(serr.err).ToNot(HaveOccurred())
+				hfs := decodeHeader(responseBuf)
+				select {
+				case r := <-requestChan:
+					return r, hfs
+				default:
+					return nil, hfs
+				}
+			}
+
+			It("marks requests received before completion of the handshake", func() {
+				req, hfs := handle(exampleGetRequest)
+				Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
+				Expect(req).ToNot(BeNil())
+				Expect(req.Header.Get("Early-Data")).To(Equal("1"))
+				ch, ok := req.Context().Value(HandshakeCompleteContextKey).(<-chan struct{})
+				Expect(ok).To(BeTrue())
+				Expect(ch).ToNot(BeClosed())
+				close(handshakeComplete)
+				Expect(ch).To(BeClosed())
+			})
+
+			It("doesn't mark requests received after completion of the handshake", func() {
+				close(handshakeComplete)
+				req, hfs := handle(examplePostRequest)
+				Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
+				Expect(req).ToNot(BeNil())
+				Expect(req.Header.Get("Early-Data")).To(BeEmpty())
+				Expect(req.Context().Value(HandshakeCompleteContextKey)).To(BeNil())
+			})
+
+			It("rejects requests using unsafe methods", func() {
+				req, hfs := handle(examplePostRequest)
+				Expect(req).To(BeNil())
+				Expect(hfs).To(HaveKeyWithValue(":status", []string{"425"}))
+			})
+
+			It("uses a custom policy", func() {
+				s.Allow0RTTRequest = func(r *http.Request) bool { return r.URL.Path == "/idempotent" }
+				r, err := http.NewRequest(http.MethodPost, "https://www.example.com/idempotent", nil)
+				Expect(err).ToNot(HaveOccurred())
+				req, hfs := handle(r)
+				Expect(req).ToNot(BeNil())
+				Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
+				req, hfs = handle(exampleGetRequest)
+				Expect(req).To(BeNil())
+				Expect(hfs).To(HaveKeyWithValue(":status", []string{"425"}))
+			})
+		})
+
 		It("sets Content-Length when the handler doesn't flush to the client", func() {
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.Write([]byte("foobar"))
@@ -196,7 +283,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().Write(gomock.Any()).DoAndReturn(responseBuf.Write).AnyTimes()
 			str.EXPECT().CancelRead(gomock.Any())
 
-			serr := s.handleRequest(conn, str, qpackDecoder, nil)
+			serr := s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)
 			Expect(serr.err).ToNot(HaveOccurred())
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
@@ -218,7 +305,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().Write(gomock.Any()).DoAndReturn(responseBuf.Write).AnyTimes()
 			str.EXPECT().CancelRead(gomock.Any())
 
-			serr := s.handleRequest(conn, str, qpackDecoder, nil)
+			serr := s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)
 			Expect(serr.err).ToNot(HaveOccurred())
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
@@ -238,7 +325,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().Context().Return(reqContext)
 			str.EXPECT().Write(gomock.Any()).DoAndReturn(responseBuf.Write).AnyTimes()
 			str.EXPECT().CancelRead(gomock.Any())
-			serr := s.handleRequest(conn, str, qpackDecoder, nil)
+			serr := s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)
 			Expect(serr.err).ToNot(HaveOccurred())
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
@@ -257,7 +344,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().Context().Return(reqContext)
 			str.EXPECT().Write(gomock.Any()).DoAndReturn(responseBuf.Write).AnyTimes()
 			str.EXPECT().CancelRead(gomock.Any())
-			serr := s.handleRequest(conn, str, qpackDecoder, nil)
+			serr := s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)
 			Expect(serr.err).ToNot(HaveOccurred())
 			hfs := decodeHeader(responseBuf)
 			Expect(hfs).To(HaveKeyWithValue(":status", []string{"200"}))
@@ -276,7 +363,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().Write(gomock.Any()).DoAndReturn(responseBuf.Write).AnyTimes()
 			str.EXPECT().CancelRead(gomock.Any())
 
-			serr := s.handleRequest(conn, str, qpackDecoder, nil)
+			serr := s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)
 			Expect(serr.err).To(MatchError(errPanicked))
 			Expect(responseBuf.Bytes()).To(HaveLen(0))
 		})
@@ -292,7 +379,7 @@ var _ = Describe("Server", func() {
 			str.EXPECT().Write(gomock.Any()).DoAndReturn(responseBuf.Write).AnyTimes()
 			str.EXPECT().CancelRead(gomock.Any())
 
-			serr := s.handleRequest(conn, str, qpackDecoder, nil)
+			serr := s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)
 			Expect(serr.err).To(MatchError(errPanicked))
 			Expect(responseBuf.Bytes()).To(HaveLen(0))
 		})
@@ -323,6 +410,7 @@ var _ = Describe("Server", func() {
 
 				buf := bytes.NewBuffer(quicvarint.Append(nil, 0x41))
 				unknownStr := mockquic.NewMockStream(mockCtrl)
+				unknownStr.EXPECT().StreamID().AnyTimes()
 				unknownStr.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
 				conn.EXPECT().AcceptStream(gomock.Any()).Return(unknownStr, nil)
 				conn.EXPECT().AcceptStream(gomock.Any()).Return(nil, errors.New("done"))
@@ -345,6 +433,7 @@ var _ = Describe("Server", func() {
 
 				buf := bytes.NewBuffer(quicvarint.Append(nil, 0x41))
 				unknownStr := mockquic.NewMockStream(mockCtrl)
+				unknownStr.EXPECT().StreamID().AnyTimes()
 				unknownStr.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
 				unknownStr.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestIncomplete))
 				conn.EXPECT().AcceptStream(gomock.Any()).Return(unknownStr, nil)
@@ -368,6 +457,7 @@ var _ = Describe("Server", func() {
 
 				buf := bytes.NewBuffer(quicvarint.Append(nil, 0x41))
 				unknownStr := mockquic.NewMockStream(mockCtrl)
+				unknownStr.EXPECT().StreamID().AnyTimes()
 				unknownStr.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
 				unknownStr.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestIncomplete))
 				conn.EXPECT().AcceptStream(gomock.Any()).Return(unknownStr, nil)
@@ -385,6 +475,7 @@ var _ = Describe("Server", func() {
 				testErr := errors.New("test error")
 				done := make(chan struct{})
 				unknownStr := mockquic.NewMockStream(mockCtrl)
+				unknownStr.EXPECT().StreamID().AnyTimes()
 				s.StreamHijacker = func(ft FrameType, _ quic.Connection, str quic.Stream, err error) (bool, error) {
 					defer close(done)
 					Expect(ft).To(BeZero())
@@ -535,7 +626,7 @@ var _ = Describe("Server", func() {
 					name = "decoder"
 				}
 
-				It(fmt.Sprintf("ignores the QPACK %s streams", name), func() {
+				It(fmt.Sprintf("closes the connection when the QPACK %s stream is closed", name), func() {
 					buf := bytes.NewBuffer(quicvarint.Append(nil, streamType))
 					str := mockquic.NewMockStream(mockCtrl)
 					str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
@@ -547,8 +638,37 @@ var _ = Describe("Server", func() {
 						<-testDone
 						return nil, errors.New("test done")
 					})
+					done := make(chan struct{})
+					conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeClosedCriticalStream), gomock.Any()).Do(func(quic.ApplicationErrorCode, string) error {
+						close(done)
+						return nil
+					})
+					s.handleConn(conn)
+					Eventually(done).Should(BeClosed())
+				})
+
+				It(fmt.Sprintf("rejects duplicate QPACK %s streams", name), func() {
+					buf1 := bytes.NewBuffer(quicvarint.Append(nil, streamType))
+					str1 := mockquic.NewMockStream(mockCtrl)
+					str1.EXPECT().Read(gomock.Any()).DoAndReturn(buf1.Read).AnyTimes()
+					buf2 := bytes.NewBuffer(quicvarint.Append(nil, streamType))
+					str2 := mockquic.NewMockStream(mockCtrl)
+					str2.EXPECT().Read(gomock.Any()).DoAndReturn(buf2.Read).AnyTimes()
+
+					conn.EXPECT().AcceptUniStream(gomock.Any()).Return(str1, nil)
+					conn.EXPECT().AcceptUniStream(gomock.Any()).Return(str2, nil)
+					conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+						<-testDone
+						return nil, errors.New("test done")
+					})
+					done := make(chan struct{})
+					conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeClosedCriticalStream), gomock.Any())
+					conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeStreamCreationError), fmt.Sprintf("duplicate QPACK %s stream", name)).Do(func(quic.ApplicationErrorCode, string) error {
+						close(done)
+						return nil
+					})
 					s.handleConn(conn)
-					time.Sleep(scaleDuration(20 * time.Millisecond)) // don't EXPECT any calls to str.CancelRead
+					Eventually(done).Should(BeClosed())
 				})
 			}
 
@@ -636,6 +756,53 @@ var _ = Describe("Server", func() {
 				Eventually(done).Should(BeClosed())
 			})
 
+			It("closes the connection when the client reduces the MAX_PUSH_ID", func() {
+				b := quicvarint.Append(nil, streamTypeControlStream)
+				b = (&settingsFrame{}).Append(b)
+				b = (&maxPushIDFrame{PushID: 10}).Append(b)
+				b = (&maxPushIDFrame{PushID: 9}).Append(b)
+				r := bytes.NewReader(b)
+				controlStr := mockquic.NewMockStream(mockCtrl)
+				controlStr.EXPECT().Read(gomock.Any()).DoAndReturn(r.Read).AnyTimes()
+				conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					return controlStr, nil
+				})
+				conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-testDone
+					return nil, errors.New("test done")
+				})
+				done := make(chan struct{})
+				conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeIDError), "MAX_PUSH_ID reduced from 10 to 9").Do(func(quic.ApplicationErrorCode, string) error {
+					close(done)
+					return nil
+				})
+				s.handleConn(conn)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("closes the connection when receiving an unexpected frame on the control stream", func() {
+				b := quicvarint.Append(nil, streamTypeControlStream)
+				b = (&settingsFrame{}).Append(b)
+				b = (&settingsFrame{}).Append(b)
+				r := bytes.NewReader(b)
+				controlStr := mockquic.NewMockStream(mockCtrl)
+				controlStr.EXPECT().Read(gomock.Any()).DoAndReturn(r.Read).AnyTimes()
+				conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					return controlStr, nil
+				})
+				conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-testDone
+					return nil, errors.New("test done")
+				})
+				done := make(chan struct{})
+				conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), gomock.Any()).Do(func(quic.ApplicationErrorCode, string) error {
+					close(done)
+					return nil
+				})
+				s.handleConn(conn)
+				Eventually(done).Should(BeClosed())
+			})
+
 			It("errors when the client advertises datagram support (and we enabled support for it)", func() {
 				s.EnableDatagrams = true
 				b := quicvarint.Append(nil, streamTypeControlStream)
@@ -807,6 +974,335 @@ var _ = Describe("Server", func() {
 			})
 		})
 
+		Context("timeouts", func() {
+			It("times out reading the request headers", func() {
+				s.ReadHeaderTimeout = time.Second
+				s.ReadTimeout = time.Hour
+				str.EXPECT().SetReadDeadline(gomock.Any()).Do(func(t time.Time) error {
+					Expect(t).To(BeTemporally("~", time.Now().Add(time.Second), scaleDuration(10*time.Millisecond)))
+					return nil
+				})
+				str.EXPECT().Read(gomock.Any()).Return(0, os.ErrDeadlineExceeded)
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestIncomplete))
+				rerr := s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)
+				Expect(rerr.streamErr).To(Equal(ErrCodeRequestIncomplete))
+				Expect(rerr.err).To(MatchError(os.ErrDeadlineExceeded))
+			})
+
+			It("uses the ReadTimeout for reading the whole request", func() {
+				s.ReadTimeout = time.Second
+				var deadlines []time.Time
+				str.EXPECT().SetReadDeadline(gomock.Any()).Do(func(t time.Time) error {
+					deadlines = append(deadlines, t)
+					return nil
+				}).Times(2)
+				setRequest(encodeRequest(exampleGetRequest))
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any())
+				Expect(s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)).To(Equal(requestError{}))
+				Expect(deadlines).To(HaveLen(2))
+				Expect(deadlines[0]).To(BeTemporally("~", time.Now().Add(time.Second), scaleDuration(10*time.Millisecond)))
+				Expect(deadlines[1]).To(Equal(deadlines[0]))
+			})
+
+			It("clears the read deadline after reading the headers, if only the ReadHeaderTimeout is set", func() {
+				s.ReadHeaderTimeout = time.Second
+				var deadlines []time.Time
+				str.EXPECT().SetReadDeadline(gomock.Any()).Do(func(t time.Time) error {
+					deadlines = append(deadlines, t)
+					return nil
+				}).Times(2)
+				setRequest(encodeRequest(exampleGetRequest))
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any())
+				Expect(s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)).To(Equal(requestError{}))
+				Expect(deadlines[1]).To(BeZero())
+			})
+
+			It("resets the stream if the response isn't written before the WriteTimeout", func() {
+				s.WriteTimeout = scaleDuration(10 * time.Millisecond)
+				s.Handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+					time.Sleep(s.WriteTimeout * 2)
+				})
+				str.EXPECT().SetWriteDeadline(gomock.Any()).Do(func(t time.Time) error {
+					Expect(t).To(BeTemporally("~", time.Now().Add(s.WriteTimeout), scaleDuration(5*time.Millisecond)))
+					return nil
+				})
+				setRequest(encodeRequest(exampleGetRequest))
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).Return(0, os.ErrDeadlineExceeded).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any())
+				rerr := s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)
+				Expect(rerr.streamErr).To(Equal(ErrCodeRequestCanceled))
+				Expect(rerr.err).To(MatchError(errWriteTimeout))
+			})
+
+			It("doesn't reset the stream if the response was written before the WriteTimeout", func() {
+				s.WriteTimeout = scaleDuration(10 * time.Millisecond)
+				s.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+					w.Write([]byte("foobar"))
+				})
+				str.EXPECT().SetWriteDeadline(gomock.Any())
+				setRequest(encodeRequest(exampleGetRequest))
+				str.EXPECT().Context().Return(reqContext)
+				// The write succeeds, but it only returns after the deadline has passed.
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) {
+					time.Sleep(s.WriteTimeout * 2)
+					return len(p), nil
+				}).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any())
+				Expect(s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)).To(Equal(requestError{}))
+			})
+
+			It("doesn't reset the stream if writing the response failed for a reason other than the WriteTimeout", func() {
+				s.WriteTimeout = time.Hour
+				str.EXPECT().SetWriteDeadline(gomock.Any())
+				setRequest(encodeRequest(exampleGetRequest))
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).Return(0, errors.New("write failed")).AnyTimes()
+				str.EXPECT().CancelRead(gomock.Any())
+				Expect(s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)).To(Equal(requestError{}))
+			})
+		})
+
+		Context("connection limits", func() {
+			var (
+				controlStr *mockquic.MockStream
+				testDone   chan struct{}
+			)
+
+			BeforeEach(func() {
+				done := make(chan struct{})
+				testDone = done
+				controlStr = mockquic.NewMockStream(mockCtrl)
+				controlStr.EXPECT().Write(gomock.Any()) // SETTINGS frame
+				conn.EXPECT().OpenUniStream().Return(controlStr, nil)
+				conn.EXPECT().AcceptUniStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.ReceiveStream, error) {
+					<-done
+					return nil, errors.New("test done")
+				})
+			})
+
+			AfterEach(func() { close(testDone) })
+
+			newRequestStream := func(id quic.StreamID) (*mockquic.MockStream, <-chan struct{}) {
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().StreamID().Return(id).AnyTimes()
+				buf := bytes.NewBuffer(encodeRequest(exampleGetRequest))
+				str.EXPECT().Read(gomock.Any()).DoAndReturn(buf.Read).AnyTimes()
+				str.EXPECT().Context().Return(reqContext)
+				str.EXPECT().Write(gomock.Any()).DoAndReturn(func(p []byte) (int, error) { return len(p), nil }).AnyTimes()
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeNoError))
+				done := make(chan struct{})
+				str.EXPECT().Close().Do(func() error { close(done); return nil })
+				return str, done
+			}
+
+			newRejectedStream := func(id quic.StreamID) (*mockquic.MockStream, <-chan struct{}) {
+				str := mockquic.NewMockStream(mockCtrl)
+				str.EXPECT().StreamID().Return(id).AnyTimes()
+				done := make(chan struct{})
+				str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeRequestRejected))
+				str.EXPECT().CancelWrite(quic.StreamErrorCode(ErrCodeRequestRejected)).Do(func(quic.StreamErrorCode) { close(done) })
+				return str, done
+			}
+
+			It("sends a GOAWAY frame after MaxRequestsPerConn requests", func() {
+				s.MaxRequestsPerConn = 2
+				s.Handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+				str1, done1 := newRequestStream(0)
+				str2, done2 := newRequestStream(4)
+				str3, done3 := newRejectedStream(8)
+				goAway := make(chan []byte, 1)
+				controlStr.EXPECT().Write(gomock.Any()).Do(func(b []byte) (int, error) {
+					goAway <- b
+					return len(b), nil
+				})
+				gomock.InOrder(
+					conn.EXPECT().AcceptStream(gomock.Any()).Return(str1, nil),
+					conn.EXPECT().AcceptStream(gomock.Any()).Return(str2, nil),
+					conn.EXPECT().AcceptStream(gomock.Any()).Return(str3, nil),
+					conn.EXPECT().AcceptStream(gomock.Any()).Return(nil, errors.New("done")),
+				)
+				s.handleConn(conn)
+				Eventually(done1).Should(BeClosed())
+				Eventually(done2).Should(BeClosed())
+				Eventually(done3).Should(BeClosed())
+				var b []byte
+				Expect(goAway).To(Receive(&b))
+				frame, err := parseNextFrame(bytes.NewReader(b), nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame).To(Equal(&goAwayFrame{StreamID: 8}))
+			})
+
+			It("rejects requests exceeding MaxConcurrentRequests", func() {
+				s.MaxConcurrentRequests = 1
+				handlerBlock := make(chan struct{})
+				s.Handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) { <-handlerBlock })
+				str1, done1 := newRequestStream(0)
+				str2, done2 := newRejectedStream(4)
+				gomock.InOrder(
+					conn.EXPECT().AcceptStream(gomock.Any()).Return(str1, nil),
+					conn.EXPECT().AcceptStream(gomock.Any()).Return(str2, nil),
+					conn.EXPECT().AcceptStream(gomock.Any()).Return(nil, errors.New("done")),
+				)
+				s.handleConn(conn)
+				Eventually(done2).Should(BeClosed())
+				close(handlerBlock)
+				Eventually(done1).Should(BeClosed())
+			})
+
+			It("closes idle connections", func() {
+				s.IdleTimeout = scaleDuration(20 * time.Millisecond)
+				s.Handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+				str1, done1 := newRequestStream(0)
+				goAway := make(chan []byte, 1)
+				closed := make(chan struct{})
+				gomock.InOrder(
+					controlStr.EXPECT().Write(gomock.Any()).Do(func(b []byte) (int, error) {
+						goAway <- b
+						return len(b), nil
+					}),
+					conn.EXPECT().CloseWithError(quic.ApplicationErrorCode(ErrCodeNoError), gomock.Any()).Do(func(quic.ApplicationErrorCode, string) error {
+						close(closed)
+						return nil
+					}),
+				)
+				start := time.Now()
+				gomock.InOrder(
+					conn.EXPECT().AcceptStream(gomock.Any()).Return(str1, nil),
+					conn.EXPECT().AcceptStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+						<-closed
+						return nil, &quic.ApplicationError{ErrorCode: quic.ApplicationErrorCode(ErrCodeNoError)}
+					}),
+				)
+				Expect(s.handleConn(conn)).To(Succeed())
+				Expect(done1).To(BeClosed())
+				Expect(time.Since(start)).To(BeNumerically(">=", s.IdleTimeout))
+				var b []byte
+				Expect(goAway).To(Receive(&b))
+				frame, err := parseNextFrame(bytes.NewReader(b), nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame).To(Equal(&goAwayFrame{StreamID: 4}))
+			})
+
+			It("reports connection state changes", func() {
+				var mutex sync.Mutex
+				var states []http.ConnState
+				s.ConnState = func(c quic.Connection, state http.ConnState) {
+					defer GinkgoRecover()
+					Expect(c).To(Equal(conn))
+					mutex.Lock()
+					states = append(states, state)
+					mutex.Unlock()
+				}
+				getStates := func() []http.ConnState {
+					mutex.Lock()
+					defer mutex.Unlock()
+					return append([]http.ConnState{}, states...)
+				}
+				s.Handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+				str1, done1 := newRequestStream(0)
+				gomock.InOrder(
+					conn.EXPECT().AcceptStream(gomock.Any()).Return(str1, nil),
+					conn.EXPECT().AcceptStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+						Eventually(done1).Should(BeClosed())
+						Eventually(getStates).Should(HaveLen(3))
+						return nil, errors.New("done")
+					}),
+				)
+				s.handleConn(conn)
+				Expect(getStates()).To(Equal([]http.ConnState{http.StateNew, http.StateActive, http.StateIdle, http.StateClosed}))
+			})
+
+			It("shuts down gracefully, waiting for active requests", func() {
+				handlerStarted := make(chan struct{})
+				handlerBlock := make(chan struct{})
+				s.Handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+					close(handlerStarted)
+					<-handlerBlock
+				})
+				onShutdownCalled := make(chan struct{})
+				s.RegisterOnShutdown(func() { close(onShutdownCalled) })
+				str1, done1 := newRequestStream(0)
+				goAway := make(chan []byte, 1)
+				controlStr.EXPECT().Write(gomock.Any()).Do(func(b []byte) (int, error) {
+					goAway <- b
+					return len(b), nil
+				})
+				peerClosed := make(chan struct{})
+				gomock.InOrder(
+					conn.EXPECT().AcceptStream(gomock.Any()).Return(str1, nil),
+					conn.EXPECT().AcceptStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+						<-peerClosed
+						return nil, &quic.ApplicationError{Remote: true, ErrorCode: quic.ApplicationErrorCode(ErrCodeNoError)}
+					}),
+				)
+				connDone := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(connDone)
+					Expect(s.handleConn(conn)).To(Succeed())
+				}()
+				Eventually(handlerStarted).Should(BeClosed())
+
+				shutdownErr := make(chan error, 1)
+				go func() { shutdownErr <- s.Shutdown(context.Background()) }()
+				var b []byte
+				Eventually(goAway).Should(Receive(&b))
+				frame, err := parseNextFrame(bytes.NewReader(b), nil)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(frame).To(Equal(&goAwayFrame{StreamID: 4}))
+				Eventually(onShutdownCalled).Should(BeClosed())
+				Consistently(shutdownErr, scaleDuration(20*time.Millisecond)).ShouldNot(Receive())
+
+				close(handlerBlock)
+				Eventually(done1).Should(BeClosed())
+				// the server waits for the client to close the connection
+				Consistently(shutdownErr, scaleDuration(20*time.Millisecond)).ShouldNot(Receive())
+				close(peerClosed)
+				Eventually(connDone).Should(BeClosed())
+				Eventually(shutdownErr).Should(Receive(BeNil()))
+				Expect(s.ServeQUICConn(conn)).To(MatchError(http.ErrServerClosed))
+			})
+
+			It("returns from Shutdown when the context expires", func() {
+				handlerStarted := make(chan struct{})
+				handlerBlock := make(chan struct{})
+				s.Handler = http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+					close(handlerStarted)
+					<-handlerBlock
+				})
+				str1, done1 := newRequestStream(0)
+				controlStr.EXPECT().Write(gomock.Any()) // GOAWAY frame
+				peerClosed := make(chan struct{})
+				gomock.InOrder(
+					conn.EXPECT().AcceptStream(gomock.Any()).Return(str1, nil),
+					conn.EXPECT().AcceptStream(gomock.Any()).DoAndReturn(func(context.Context) (quic.Stream, error) {
+						<-peerClosed
+						return nil, &quic.ApplicationError{Remote: true, ErrorCode: quic.ApplicationErrorCode(ErrCodeNoError)}
+					}),
+				)
+				connDone := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(connDone)
+					s.handleConn(conn)
+				}()
+				Eventually(handlerStarted).Should(BeClosed())
+
+				ctx, cancel := context.WithTimeout(context.Background(), scaleDuration(20*time.Millisecond))
+				defer cancel()
+				Expect(s.Shutdown(ctx)).To(MatchError(context.DeadlineExceeded))
+				close(handlerBlock)
+				Eventually(done1).Should(BeClosed())
+				close(peerClosed)
+				Eventually(connDone).Should(BeClosed())
+			})
+		})
+
 		It("resets the stream when the body of POST request is not read, and the request handler replaces the request.Body", func() {
 			handlerCalled := make(chan struct{})
 			s.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -824,7 +1320,7 @@ var _ = Describe("Server", func() {
 			}).AnyTimes()
 			str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeNoError))
 
-			serr := s.handleRequest(conn, str, qpackDecoder, nil)
+			serr := s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)
 			Expect(serr.err).ToNot(HaveOccurred())
 			Eventually(handlerCalled).Should(BeClosed())
 		})
@@ -847,7 +1343,7 @@ var _ = Describe("Server", func() {
 			}).AnyTimes()
 			str.EXPECT().CancelRead(quic.StreamErrorCode(ErrCodeNoError))
 
-			serr := s.handleRequest(conn, str, qpackDecoder, nil)
+			serr := s.handleRequest(conn, str, qpackdyn.NewEncoder(0), qpackDecoder, newServerPushes(nil), nil)
 			Expect(serr.err).ToNot(HaveOccurred())
 			Eventually(handlerCalled).Should(BeClosed())
 		})
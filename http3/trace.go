@@ -0,0 +1,132 @@
+package http3
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http/httptrace"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// traceConn is passed to httptrace.ClientTrace.GotConn as the httptrace.GotConnInfo.Conn.
+// HTTP/3 requests are sent on QUIC streams, so there's no net.Conn that could be used to
+// read from or write to the connection. Only the addresses are exposed, all other methods
+// return errors.ErrUnsupported.
+//
+// In addition to the net.Conn interface, traceConn implements
+//
+//	interface{ Used0RTT() bool }
+//
+// which reports whether the request is sent in 0-RTT.
+type traceConn struct {
+	conn     quic.EarlyConnection
+	used0RTT bool
+}
+
+var _ net.Conn = &traceConn{}
+
+func (c *traceConn) Used0RTT() bool                   { return c.used0RTT }
+func (c *traceConn) LocalAddr() net.Addr              { return c.conn.LocalAddr() }
+func (c *traceConn) RemoteAddr() net.Addr             { return c.conn.RemoteAddr() }
+func (c *traceConn) Read([]byte) (int, error)         { return 0, errors.ErrUnsupported }
+func (c *traceConn) Write([]byte) (int, error)        { return 0, errors.ErrUnsupported }
+func (c *traceConn) Close() error                     { return errors.ErrUnsupported }
+func (c *traceConn) SetDeadline(time.Time) error      { return errors.ErrUnsupported }
+func (c *traceConn) SetReadDeadline(time.Time) error  { return errors.ErrUnsupported }
+func (c *traceConn) SetWriteDeadline(time.Time) error { return errors.ErrUnsupported }
+
+func traceGetConn(trace *httptrace.ClientTrace, hostPort string) {
+	if trace != nil && trace.GetConn != nil {
+		trace.GetConn(hostPort)
+	}
+}
+
+func traceGotConn(trace *httptrace.ClientTrace, conn quic.EarlyConnection, reused, used0RTT bool) {
+	if trace != nil && trace.GotConn != nil {
+		trace.GotConn(httptrace.GotConnInfo{
+			Conn:   &traceConn{conn: conn, used0RTT: used0RTT},
+			Reused: reused,
+		})
+	}
+}
+
+func traceDNSStart(trace *httptrace.ClientTrace, host string) {
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+}
+
+func traceDNSDone(trace *httptrace.ClientTrace, addr *net.UDPAddr, err error) {
+	if trace != nil && trace.DNSDone != nil {
+		var addrs []net.IPAddr
+		if addr != nil {
+			addrs = []net.IPAddr{{IP: addr.IP, Zone: addr.Zone}}
+		}
+		trace.DNSDone(httptrace.DNSDoneInfo{Addrs: addrs, Err: err})
+	}
+}
+
+func traceTLSHandshakeStart(trace *httptrace.ClientTrace) {
+	if trace != nil && trace.TLSHandshakeStart != nil {
+		trace.TLSHandshakeStart()
+	}
+}
+
+func traceTLSHandshakeDone(trace *httptrace.ClientTrace, state tls.ConnectionState, err error) {
+	if trace != nil && trace.TLSHandshakeDone != nil {
+		trace.TLSHandshakeDone(state, err)
+	}
+}
+
+// traceHandshakeDone traces the completion of the handshake of a newly dialed connection.
+// When sending a request in 0-RTT, the handshake might not have completed yet.
+// In that case, TLSHandshakeDone is called once it completes.
+func traceHandshakeDone(trace *httptrace.ClientTrace, conn quic.EarlyConnection) {
+	if trace == nil || trace.TLSHandshakeDone == nil {
+		return
+	}
+	select {
+	case <-conn.HandshakeComplete():
+		trace.TLSHandshakeDone(conn.ConnectionState().TLS, nil)
+	default:
+		go func() {
+			select {
+			case <-conn.HandshakeComplete():
+				trace.TLSHandshakeDone(conn.ConnectionState().TLS, nil)
+			case <-conn.Context().Done():
+				trace.TLSHandshakeDone(tls.ConnectionState{}, context.Cause(conn.Context()))
+			}
+		}()
+	}
+}
+
+func traceHasWroteHeaderField(trace *httptrace.ClientTrace) bool {
+	return trace != nil && trace.WroteHeaderField != nil
+}
+
+func traceWroteHeaderField(trace *httptrace.ClientTrace, k, v string) {
+	if trace != nil && trace.WroteHeaderField != nil {
+		trace.WroteHeaderField(k, []string{v})
+	}
+}
+
+func traceWroteHeaders(trace *httptrace.ClientTrace) {
+	if trace != nil && trace.WroteHeaders != nil {
+		trace.WroteHeaders()
+	}
+}
+
+func traceWroteRequest(trace *httptrace.ClientTrace, err error) {
+	if trace != nil && trace.WroteRequest != nil {
+		trace.WroteRequest(httptrace.WroteRequestInfo{Err: err})
+	}
+}
+
+func traceGotFirstResponseByte(trace *httptrace.ClientTrace) {
+	if trace != nil && trace.GotFirstResponseByte != nil {
+		trace.GotFirstResponseByte()
+	}
+}
@@ -2,11 +2,14 @@ package self_test
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go"
@@ -14,6 +17,7 @@ import (
 	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/internal/qerr"
 	"github.com/quic-go/quic-go/internal/qtls"
+	"github.com/quic-go/quic-go/logging"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -45,6 +49,30 @@ func (c *tokenStore) Pop(key string) *quic.ClientToken {
 	return c.store.Pop(key)
 }
 
+// replayingTokenStore stores the first token it receives, and uses it for all connection attempts
+type replayingTokenStore struct {
+	mutex sync.Mutex
+	token *quic.ClientToken
+}
+
+var _ quic.TokenStore = &replayingTokenStore{}
+
+func (s *replayingTokenStore) Put(_ string, token *quic.ClientToken) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.token == nil {
+		s.token = token
+	}
+}
+
+func (s *replayingTokenStore) Pop(string) *quic.ClientToken { return s.Token() }
+
+func (s *replayingTokenStore) Token() *quic.ClientToken {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.token
+}
+
 var _ = Describe("Handshake tests", func() {
 	var (
 		server        *quic.Listener
@@ -336,7 +364,7 @@ var _ = Describe("Handshake tests", func() {
 		})
 
 		It("rejects new connection attempts if connections don't get accepted", func() {
-			for i := 0; i < protocol.MaxAcceptQueueSize; i++ {
+			for i := 0; i < protocol.DefaultAcceptQueueSize; i++ {
 				conn, err := dial()
 				Expect(err).ToNot(HaveOccurred())
 				defer conn.CloseWithError(0, "")
@@ -368,7 +396,7 @@ var _ = Describe("Handshake tests", func() {
 			firstConn, err := dial()
 			Expect(err).ToNot(HaveOccurred())
 
-			for i := 1; i < protocol.MaxAcceptQueueSize; i++ {
+			for i := 1; i < protocol.DefaultAcceptQueueSize; i++ {
 				conn, err := dial()
 				Expect(err).ToNot(HaveOccurred())
 				defer conn.CloseWithError(0, "")
@@ -395,7 +423,7 @@ var _ = Describe("Handshake tests", func() {
 
 			// now accept all connections
 			var closedConn quic.Connection
-			for i := 0; i < protocol.MaxAcceptQueueSize; i++ {
+			for i := 0; i < protocol.DefaultAcceptQueueSize; i++ {
 				conn, err := server.Accept(context.Background())
 				Expect(err).ToNot(HaveOccurred())
 				if conn.Context().Err() != nil {
@@ -494,6 +522,45 @@ var _ = Describe("Handshake tests", func() {
 			Expect(transportErr.ErrorCode.IsCryptoError()).To(BeTrue())
 			Expect(transportErr.Error()).To(ContainSubstring("no application protocol"))
 		})
+
+		It("routes connections to multiple listeners on the same Transport", func() {
+			udpConn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			tr := &quic.Transport{Conn: udpConn}
+			defer tr.Close()
+
+			listeners := make(map[string]*quic.Listener)
+			for _, proto := range []string{"proto1", "proto2"} {
+				tlsConf := getTLSConfig()
+				tlsConf.NextProtos = []string{proto}
+				ln, err := tr.ListenWithRoute(&quic.ListenerRoute{NextProtos: []string{proto}}, tlsConf, serverConfig)
+				Expect(err).ToNot(HaveOccurred())
+				defer ln.Close()
+				listeners[proto] = ln
+			}
+
+			for _, proto := range []string{"proto2", "proto1"} {
+				tlsConf := getTLSClientConfig()
+				tlsConf.NextProtos = []string{proto}
+				conn, err := quic.DialAddr(context.Background(), udpConn.LocalAddr().String(), tlsConf, getQuicConfig(nil))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(conn.ConnectionState().TLS.NegotiatedProtocol).To(Equal(proto))
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				sconn, err := listeners[proto].Accept(ctx)
+				cancel()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(sconn.ConnectionState().TLS.NegotiatedProtocol).To(Equal(proto))
+				conn.CloseWithError(0, "")
+			}
+
+			// no listener for this ALPN
+			tlsConf := getTLSClientConfig()
+			tlsConf.NextProtos = []string{"proto3"}
+			_, err = quic.DialAddr(context.Background(), udpConn.LocalAddr().String(), tlsConf, getQuicConfig(nil))
+			var transportErr *quic.TransportError
+			Expect(errors.As(err, &transportErr)).To(BeTrue())
+			Expect(transportErr.ErrorCode).To(Equal(quic.ConnectionRefused))
+		})
 	})
 
 	Context("using tokens", func() {
@@ -546,6 +613,70 @@ var _ = Describe("Handshake tests", func() {
 			Eventually(done).Should(BeClosed())
 		})
 
+		It("accepts tokens encrypted with a previous key, and rejects replayed tokens", func() {
+			serverConfig.RequireAddressValidation = func(net.Addr) bool { return true }
+			var oldKey, newKey quic.TokenGeneratorKey
+			rand.Read(oldKey[:])
+			rand.Read(newKey[:])
+
+			listen := func(tr *quic.Transport) *quic.Listener {
+				ln, err := tr.Listen(getTLSConfig(), serverConfig)
+				Expect(err).ToNot(HaveOccurred())
+				go func() {
+					for {
+						if _, err := ln.Accept(context.Background()); err != nil {
+							return
+						}
+					}
+				}()
+				return ln
+			}
+			// The token store always returns the first token it received.
+			store := &replayingTokenStore{}
+			// dial returns true if the server sent a Retry, i.e. if it didn't accept the token
+			dial := func(addr net.Addr) bool {
+				var retried atomic.Bool
+				conn, err := quic.DialAddr(
+					context.Background(),
+					addr.String(),
+					getTLSClientConfig(),
+					getQuicConfig(&quic.Config{
+						TokenStore: store,
+						Tracer: newTracer(&logging.ConnectionTracer{
+							ReceivedRetry: func(*logging.Header) { retried.Store(true) },
+						}),
+					}),
+				)
+				Expect(err).ToNot(HaveOccurred())
+				// wait for the NEW_TOKEN frame
+				time.Sleep(scaleDuration(10 * time.Millisecond))
+				conn.CloseWithError(0, "")
+				return retried.Load()
+			}
+
+			udpConn1, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			tr1 := &quic.Transport{Conn: udpConn1, TokenGeneratorKey: &oldKey}
+			defer tr1.Close()
+			ln1 := listen(tr1)
+			Expect(dial(ln1.Addr())).To(BeTrue())
+			Expect(store.Token()).ToNot(BeNil())
+
+			udpConn2, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			tr2 := &quic.Transport{
+				Conn:                udpConn2,
+				TokenGeneratorKey:   &newKey,
+				TokenDecryptionKeys: []quic.TokenGeneratorKey{oldKey},
+				TokenReplayCache:    quic.NewMemoryTokenReplayCache(100),
+				MaxTokenAge:         time.Hour,
+			}
+			defer tr2.Close()
+			ln2 := listen(tr2)
+			Expect(dial(ln2.Addr())).To(BeFalse()) // the token issued by the first server is accepted
+			Expect(dial(ln2.Addr())).To(BeTrue())  // the token was already used
+		})
+
 		It("rejects invalid Retry token with the INVALID_TOKEN error", func() {
 			const rtt = 10 * time.Millisecond
 			serverConfig.RequireAddressValidation = func(net.Addr) bool { return true }
@@ -585,11 +716,11 @@ var _ = Describe("Handshake tests", func() {
 	Context("GetConfigForClient", func() {
 		It("uses the quic.Config returned by GetConfigForClient", func() {
 			serverConfig.EnableDatagrams = false
-			var calledFrom net.Addr
+			var clientInfo *quic.ClientHelloInfo
 			serverConfig.GetConfigForClient = func(info *quic.ClientHelloInfo) (*quic.Config, error) {
 				conf := serverConfig.Clone()
 				conf.EnableDatagrams = true
-				calledFrom = info.RemoteAddr
+				clientInfo = info
 				return getQuicConfig(conf), nil
 			}
 			ln, err := quic.ListenAddr("localhost:0", getTLSConfig(), serverConfig)
@@ -615,7 +746,11 @@ var _ = Describe("Handshake tests", func() {
 			Expect(cs.SupportsDatagrams).To(BeTrue())
 			Eventually(done).Should(BeClosed())
 			Expect(ln.Close()).To(Succeed())
-			Expect(calledFrom.(*net.UDPAddr).Port).To(Equal(conn.LocalAddr().(*net.UDPAddr).Port))
+			Expect(clientInfo.RemoteAddr.(*net.UDPAddr).Port).To(Equal(conn.LocalAddr().(*net.UDPAddr).Port))
+			Expect(clientInfo.ServerName).To(Equal("localhost"))
+			Expect(clientInfo.SupportedProtos).To(Equal([]string{alpn}))
+			Expect(clientInfo.Version).To(Equal(version))
+			Expect(clientInfo.AddrVerified).To(BeFalse())
 		})
 
 		It("rejects the connection attempt if GetConfigForClient errors", func() {
@@ -5,13 +5,17 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"os"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/sync/errgroup"
@@ -128,6 +132,64 @@ var _ = Describe("HTTP tests", func() {
 		Expect(string(body)).To(Equal("Hello, World!\n"))
 	})
 
+	It("traces requests", func() {
+		var mutex sync.Mutex
+		var events []string
+		addEvent := func(e string) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			events = append(events, e)
+		}
+		getEvents := func() []string {
+			mutex.Lock()
+			defer mutex.Unlock()
+			e := events
+			events = nil
+			return e
+		}
+		trace := &httptrace.ClientTrace{
+			GetConn:           func(string) { addEvent("GetConn") },
+			DNSStart:          func(httptrace.DNSStartInfo) { addEvent("DNSStart") },
+			DNSDone:           func(httptrace.DNSDoneInfo) { addEvent("DNSDone") },
+			TLSHandshakeStart: func() { addEvent("TLSHandshakeStart") },
+			TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+				defer GinkgoRecover()
+				Expect(err).ToNot(HaveOccurred())
+				addEvent("TLSHandshakeDone")
+			},
+			GotConn:              func(info httptrace.GotConnInfo) { addEvent(fmt.Sprintf("GotConn (reused: %t)", info.Reused)) },
+			WroteHeaders:         func() { addEvent("WroteHeaders") },
+			WroteRequest:         func(httptrace.WroteRequestInfo) { addEvent("WroteRequest") },
+			GotFirstResponseByte: func() { addEvent("GotFirstResponseByte") },
+		}
+		for i := 0; i < 2; i++ {
+			ctx := httptrace.WithClientTrace(context.Background(), trace)
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://localhost:%d/hello", port), nil)
+			Expect(err).ToNot(HaveOccurred())
+			resp, err := client.Do(req)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(200))
+			_, err = io.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(getEvents()).To(Equal([]string{
+			"GetConn",
+			"DNSStart",
+			"DNSDone",
+			"TLSHandshakeStart",
+			"TLSHandshakeDone",
+			"GotConn (reused: false)",
+			"WroteHeaders",
+			"WroteRequest",
+			"GotFirstResponseByte",
+			"GetConn",
+			"GotConn (reused: true)",
+			"WroteHeaders",
+			"WroteRequest",
+			"GotFirstResponseByte",
+		}))
+	})
+
 	It("sets content-length for small response", func() {
 		mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
 			defer GinkgoRecover()
@@ -259,6 +321,122 @@ var _ = Describe("HTTP tests", func() {
 		}
 	})
 
+	It("uses new connections after MaxRequestsPerConn requests", func() {
+		var conns sync.Map
+		server.MaxRequestsPerConn = 2
+		server.ConnContext = func(ctx context.Context, c quic.Connection) context.Context {
+			conns.Store(c, struct{}{})
+			return ctx
+		}
+		for i := 0; i < 5; i++ {
+			resp, err := client.Get(fmt.Sprintf("https://localhost:%d/hello", port))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(200))
+			body, err := io.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal("Hello, World!\n"))
+		}
+		var numConns int
+		conns.Range(func(_, _ any) bool {
+			numConns++
+			return true
+		})
+		Expect(numConns).To(Equal(3))
+	})
+
+	It("shuts down gracefully", func() {
+		states := make(chan http.ConnState, 10)
+		server.ConnState = func(_ quic.Connection, state http.ConnState) { states <- state }
+		handlerStarted := make(chan struct{})
+		handlerBlock := make(chan struct{})
+		mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			close(handlerStarted)
+			<-handlerBlock
+			io.WriteString(w, "done")
+		})
+
+		respChan := make(chan *http.Response, 1)
+		go func() {
+			defer GinkgoRecover()
+			resp, err := client.Get(fmt.Sprintf("https://localhost:%d/slow", port))
+			Expect(err).ToNot(HaveOccurred())
+			respChan <- resp
+		}()
+		Eventually(handlerStarted).Should(BeClosed())
+
+		shutdownErr := make(chan error, 1)
+		go func() { shutdownErr <- server.Shutdown(context.Background()) }()
+		Consistently(shutdownErr, 50*time.Millisecond).ShouldNot(Receive())
+
+		close(handlerBlock)
+		var resp *http.Response
+		Eventually(respChan).Should(Receive(&resp))
+		Expect(resp.StatusCode).To(Equal(200))
+		body, err := io.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal("done"))
+		Eventually(shutdownErr).Should(Receive(BeNil()))
+		Eventually(stoppedServing).Should(BeClosed())
+
+		Expect(states).To(Receive(Equal(http.StateNew)))
+		Expect(states).To(Receive(Equal(http.StateActive)))
+		Expect(states).To(Receive(Equal(http.StateIdle)))
+		Expect(states).To(Receive(Equal(http.StateClosed)))
+	})
+
+	It("pushes responses", func() {
+		mux.HandleFunc("/push", func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(w.(http.Pusher).Push("/hello", nil)).To(Succeed())
+			io.WriteString(w, "pushed")
+		})
+
+		type pushed struct {
+			req  *http.Request
+			body []byte
+		}
+		pushChan := make(chan pushed, 1)
+		rt.PushHandler = func(p *http3.PushPromise) {
+			defer GinkgoRecover()
+			rsp, err := p.Response(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			defer rsp.Body.Close()
+			Expect(rsp.StatusCode).To(Equal(200))
+			body, err := io.ReadAll(gbytes.TimeoutReader(rsp.Body, 3*time.Second))
+			Expect(err).ToNot(HaveOccurred())
+			pushChan <- pushed{req: p.Request, body: body}
+		}
+		// The server can only push once it received the client's MAX_PUSH_ID frame.
+		resp, err := client.Get(fmt.Sprintf("https://localhost:%d/hello", port))
+		Expect(err).ToNot(HaveOccurred())
+		resp.Body.Close()
+		resp, err = client.Get(fmt.Sprintf("https://localhost:%d/push", port))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+		body, err := io.ReadAll(gbytes.TimeoutReader(resp.Body, 3*time.Second))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(body)).To(Equal("pushed"))
+
+		var p pushed
+		Eventually(pushChan).Should(Receive(&p))
+		Expect(p.req.Method).To(Equal(http.MethodGet))
+		Expect(p.req.URL.String()).To(Equal(fmt.Sprintf("https://localhost:%d/hello", port)))
+		Expect(string(p.body)).To(Equal("Hello, World!\n"))
+	})
+
+	It("doesn't push if the client didn't enable push", func() {
+		errChan := make(chan error, 1)
+		mux.HandleFunc("/push", func(w http.ResponseWriter, r *http.Request) {
+			errChan <- w.(http.Pusher).Push("/hello", nil)
+		})
+
+		resp, err := client.Get(fmt.Sprintf("https://localhost:%d/push", port))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(200))
+		Eventually(errChan).Should(Receive(Equal(http.ErrNotSupported)))
+	})
+
 	It("downloads many files, if the response is not read", func() {
 		const num = 150
 
@@ -517,6 +695,104 @@ var _ = Describe("HTTP tests", func() {
 		Expect(string(body)).To(ContainSubstring("aa"))
 	})
 
+	It("sends requests in 0-RTT", func() {
+		var earlyRequests, requests atomic.Int32
+		mux := http.NewServeMux()
+		mux.HandleFunc("/0rtt", func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			if r.Header.Get("Early-Data") == "1" {
+				earlyRequests.Add(1)
+			}
+			io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusOK)
+		})
+		server := &http3.Server{
+			Handler:    mux,
+			TLSConfig:  getTLSConfig(),
+			QuicConfig: getQuicConfig(&quic.Config{Allow0RTT: true}),
+		}
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4zero, Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		done := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(done)
+			server.Serve(conn)
+		}()
+		defer func() {
+			Expect(server.Close()).To(Succeed())
+			Eventually(done).Should(BeClosed())
+		}()
+		url := fmt.Sprintf("https://localhost:%d/0rtt", conn.LocalAddr().(*net.UDPAddr).Port)
+
+		puts := make(chan string, 10)
+		tlsConf := getTLSClientConfigWithoutServerName()
+		tlsConf.ClientSessionCache = newClientSessionCache(tls.NewLRUClientSessionCache(10), make(chan string, 10), puts)
+		rt1 := &http3.RoundTripper{TLSClientConfig: tlsConf, QuicConfig: getQuicConfig(nil)}
+		rsp, err := (&http.Client{Transport: rt1}).Get(url)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		Expect(http3.ResponseUsed0RTT(rsp)).To(BeFalse())
+		Eventually(puts).Should(Receive())
+		Expect(rt1.Close()).To(Succeed())
+
+		// GET requests are sent in 0-RTT
+		rt2 := &http3.RoundTripper{TLSClientConfig: tlsConf, QuicConfig: getQuicConfig(nil)}
+		defer rt2.Close()
+		rsp, err = (&http.Client{Transport: rt2}).Get(url)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		Expect(http3.ResponseUsed0RTT(rsp)).To(BeTrue())
+		Expect(earlyRequests.Load()).To(BeEquivalentTo(1))
+		Eventually(puts).Should(Receive())
+		Expect(rt2.Close()).To(Succeed())
+
+		// POST requests are rejected by the server, and replayed after completion of the handshake
+		rt3 := &http3.RoundTripper{
+			TLSClientConfig:  tlsConf,
+			QuicConfig:       getQuicConfig(nil),
+			Allow0RTTRequest: func(*http.Request) bool { return true },
+		}
+		defer rt3.Close()
+		rsp, err = (&http.Client{Transport: rt3}).Post(url, "text/plain", bytes.NewReader([]byte("foobar")))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.StatusCode).To(Equal(http.StatusOK))
+		Expect(http3.ResponseUsed0RTT(rsp)).To(BeFalse())
+		Expect(requests.Load()).To(BeEquivalentTo(3))
+		Expect(earlyRequests.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("upgrades to HTTP/3 using Alt-Svc", func() {
+		tlsConf := getTLSConfig()
+		tlsConf.NextProtos = nil
+		ln, err := tls.Listen("tcp", fmt.Sprintf("localhost:%d", port), tlsConf)
+		Expect(err).ToNot(HaveOccurred())
+		tcpServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(server.SetQuicHeaders(w.Header())).To(Succeed())
+			mux.ServeHTTP(w, r)
+		})}
+		go tcpServer.Serve(ln)
+		defer tcpServer.Close()
+
+		rt := &http3.AltSvcRoundTripper{
+			Fallback:        &http.Transport{TLSClientConfig: getTLSClientConfigWithoutServerName()},
+			TLSClientConfig: getTLSClientConfigWithoutServerName(),
+			QuicConfig:      getQuicConfig(nil),
+		}
+		defer rt.Close()
+		client := &http.Client{Transport: rt}
+		rsp, err := client.Get(fmt.Sprintf("https://localhost:%d/hello", port))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.ProtoMajor).To(Equal(1))
+		Expect(rsp.Header.Get("Alt-Svc")).ToNot(BeEmpty())
+		Expect(io.ReadAll(rsp.Body)).To(Equal([]byte("Hello, World!\n")))
+
+		rsp, err = client.Get(fmt.Sprintf("https://localhost:%d/hello", port))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(rsp.ProtoMajor).To(Equal(3))
+		Expect(io.ReadAll(rsp.Body)).To(Equal([]byte("Hello, World!\n")))
+	})
+
 	It("sets remote address", func() {
 		mux.HandleFunc("/remote-addr", func(w http.ResponseWriter, r *http.Request) {
 			defer GinkgoRecover()
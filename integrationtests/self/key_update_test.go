@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
 
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/internal/handshake"
@@ -89,4 +91,109 @@ var _ = Describe("Key Update tests", func() {
 		Expect(keyPhasesReceived).To(BeNumerically(">", 10))
 		Expect(keyPhasesReceived).To(BeNumerically("~", keyPhasesSent, 2))
 	})
+
+	It("uses the key update interval from the config", func() {
+		server, err := quic.ListenAddr("localhost:0", getTLSConfig(), getQuicConfig(&quic.Config{KeyUpdateInterval: 1}))
+		Expect(err).ToNot(HaveOccurred())
+		defer server.Close()
+
+		var numUpdates atomic.Int32
+		go func() {
+			defer GinkgoRecover()
+			conn, err := server.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			str, err := conn.OpenUniStream()
+			Expect(err).ToNot(HaveOccurred())
+			defer str.Close()
+			_, err = str.Write(PRDataLong)
+			Expect(err).ToNot(HaveOccurred())
+		}()
+
+		conn, err := quic.DialAddr(
+			context.Background(),
+			fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			getQuicConfig(&quic.Config{Tracer: func(context.Context, logging.Perspective, quic.ConnectionID) *logging.ConnectionTracer {
+				return &logging.ConnectionTracer{
+					UpdatedKey: func(_ logging.KeyPhase, remote bool) {
+						if remote {
+							numUpdates.Add(1)
+						}
+					},
+				}
+			}}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.CloseWithError(0, "")
+		str, err := conn.AcceptUniStream(context.Background())
+		Expect(err).ToNot(HaveOccurred())
+		data, err := io.ReadAll(str)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(data).To(Equal(PRDataLong))
+		Expect(numUpdates.Load()).To(BeNumerically(">", 10))
+	})
+
+	It("updates keys when requested by the application", func() {
+		server, err := quic.ListenAddr("localhost:0", getTLSConfig(), getQuicConfig(nil))
+		Expect(err).ToNot(HaveOccurred())
+		defer server.Close()
+
+		go func() {
+			defer GinkgoRecover()
+			conn, err := server.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			str, err := conn.AcceptStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			io.Copy(str, str)
+			str.Close()
+		}()
+
+		var mutex sync.Mutex
+		var reasons []logging.KeyUpdateReason
+		conn, err := quic.DialAddr(
+			context.Background(),
+			fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+			getTLSClientConfig(),
+			getQuicConfig(&quic.Config{Tracer: func(context.Context, logging.Perspective, quic.ConnectionID) *logging.ConnectionTracer {
+				return &logging.ConnectionTracer{
+					InitiatedKeyUpdate: func(_ logging.KeyPhase, reason logging.KeyUpdateReason) {
+						mutex.Lock()
+						defer mutex.Unlock()
+						reasons = append(reasons, reason)
+					},
+				}
+			}}),
+		)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.CloseWithError(0, "")
+		str, err := conn.OpenStream()
+		Expect(err).ToNot(HaveOccurred())
+
+		numUpdates := func() int {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return len(reasons)
+		}
+		echo := func() {
+			_, err := str.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			b := make([]byte, 6)
+			_, err = io.ReadFull(str, b)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(b).To(Equal([]byte("foobar")))
+		}
+
+		for i := 1; i <= 3; i++ {
+			Expect(conn.UpdateKeys()).To(Succeed())
+			// The key update is initiated once the previous key update was acknowledged.
+			Eventually(func() int { echo(); return numUpdates() }).Should(Equal(i))
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		Expect(reasons).To(Equal([]logging.KeyUpdateReason{
+			logging.KeyUpdateApplication,
+			logging.KeyUpdateApplication,
+			logging.KeyUpdateApplication,
+		}))
+	})
 })
@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"time"
 
@@ -107,10 +108,10 @@ var _ = Describe("Handshake tests", func() {
 			Expect(clientResult.chosen).To(Equal(expectedVersion))
 			Expect(clientResult.receivedVersionNegotiation).To(BeFalse())
 			Expect(clientResult.clientVersions).To(Equal(protocol.SupportedVersions))
-			Expect(clientResult.serverVersions).To(BeEmpty())
+			Expect(clientResult.serverVersions).To(Equal(serverConfig.Versions))
 			Expect(serverResult.chosen).To(Equal(expectedVersion))
 			Expect(serverResult.serverVersions).To(Equal(serverConfig.Versions))
-			Expect(serverResult.clientVersions).To(BeEmpty())
+			Expect(serverResult.clientVersions).To(Equal(protocol.SupportedVersions))
 		})
 
 		It("when the client supports more versions than the server supports", func() {
@@ -147,7 +148,61 @@ var _ = Describe("Handshake tests", func() {
 			Expect(clientResult.serverVersions).To(ContainElements(supportedVersions)) // may contain greased versions
 			Expect(serverResult.chosen).To(Equal(expectedVersion))
 			Expect(serverResult.serverVersions).To(Equal(serverConfig.Versions))
-			Expect(serverResult.clientVersions).To(BeEmpty())
+			Expect(serverResult.clientVersions).To(Equal(clientVersions))
+		})
+
+		It("switches to a compatible version preferred by the server", func() {
+			serverResult, serverTracer := newVersionNegotiationTracer()
+			serverConfig := &quic.Config{
+				Versions: []protocol.VersionNumber{protocol.Version2, protocol.Version1},
+				Tracer: func(context.Context, logging.Perspective, quic.ConnectionID) *logging.ConnectionTracer {
+					return serverTracer
+				},
+			}
+			server, err := quic.ListenAddr("localhost:0", getTLSConfig(), serverConfig)
+			Expect(err).ToNot(HaveOccurred())
+			defer server.Close()
+
+			clientVersions := []protocol.VersionNumber{protocol.Version1, protocol.Version2}
+			clientResult, clientTracer := newVersionNegotiationTracer()
+			conn, err := quic.DialAddr(
+				context.Background(),
+				fmt.Sprintf("localhost:%d", server.Addr().(*net.UDPAddr).Port),
+				getTLSClientConfig(),
+				maybeAddQLOGTracer(&quic.Config{
+					Versions: clientVersions,
+					Tracer: func(context.Context, logging.Perspective, quic.ConnectionID) *logging.ConnectionTracer {
+						return clientTracer
+					},
+				}),
+			)
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.CloseWithError(0, "")
+			Expect(conn.(versioner).GetVersion()).To(Equal(protocol.Version2))
+			Expect(conn.ConnectionState().Version).To(Equal(protocol.Version2))
+
+			// check that data can be exchanged using the new version
+			sconn, err := server.Accept(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(sconn.ConnectionState().Version).To(Equal(protocol.Version2))
+			str, err := conn.OpenStream()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = str.Write([]byte("foobar"))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(str.Close()).To(Succeed())
+			sstr, err := sconn.AcceptStream(context.Background())
+			Expect(err).ToNot(HaveOccurred())
+			data, err := io.ReadAll(sstr)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(data).To(Equal([]byte("foobar")))
+
+			Expect(clientResult.receivedVersionNegotiation).To(BeFalse())
+			Expect(clientResult.chosen).To(Equal(protocol.Version2))
+			Expect(clientResult.clientVersions).To(Equal(clientVersions))
+			Expect(clientResult.serverVersions).To(Equal(serverConfig.Versions))
+			Expect(serverResult.chosen).To(Equal(protocol.Version2))
+			Expect(serverResult.clientVersions).To(Equal(clientVersions))
+			Expect(serverResult.serverVersions).To(Equal(serverConfig.Versions))
 		})
 
 		It("fails if the server disables version negotiation", func() {
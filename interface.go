@@ -43,6 +43,29 @@ type TokenStore interface {
 	Put(key string, token *ClientToken)
 }
 
+// A TokenSource customizes the address validation tokens that a server sends in NEW_TOKEN frames.
+// This allows the application to embed its own data into tokens, and to validate it when the token is used.
+// Tokens used in Retry packets are not affected.
+type TokenSource interface {
+	// TokenData is called when a token is issued to the client at remoteAddr.
+	// The returned data is encrypted and embedded into the token.
+	TokenData(remoteAddr net.Addr) ([]byte, error)
+	// ValidateToken is called when a client presents a token that was issued for its address and that hasn't expired yet.
+	// data is the data returned by TokenData when the token was issued.
+	// If it returns false, the token is ignored, as if the client hadn't sent a token at all.
+	ValidateToken(remoteAddr net.Addr, issued time.Time, data []byte) bool
+}
+
+// A TokenReplayCache is used to detect the reuse of tokens sent in NEW_TOKEN frames.
+// RFC 9000 requires clients to only use these tokens once. Since multiple servers might
+// accept the same tokens, the cache may be shared between all servers.
+type TokenReplayCache interface {
+	// Seen is called when a client presents a valid token that was sent in a NEW_TOKEN frame.
+	// It records the token, and reports if the token was used before.
+	// The token doesn't need to be remembered after its expiry.
+	Seen(token []byte, expiry time.Time) bool
+}
+
 // Err0RTTRejected is the returned from:
 // * Open{Uni}Stream{Sync}
 // * Accept{Uni}Stream
@@ -95,6 +118,33 @@ type ReceiveStream interface {
 	// A zero value for t means Read will not time out.
 
 	SetReadDeadline(t time.Time) error
+	// ReadChunk returns the next chunk of data received on the stream, without copying it.
+	// The data is only valid until release is called, which must happen exactly once for every chunk.
+	// Until then, the data counts as consumed for the purpose of flow control,
+	// so holding on to many chunks increases memory usage beyond the flow control window.
+	// It returns io.EOF once all data has been read, and never returns data together with an error.
+	// It must not be called concurrently with Read.
+	ReadChunk() (data []byte, release func(), err error)
+	// ReadUnordered switches the stream to unordered mode, and returns the next chunk of data
+	// in the order it was received, together with its offset in the stream.
+	// This avoids head-of-line blocking when data is lost, at the cost of having to reassemble the data.
+	// Every byte of the stream is returned exactly once, including data received before the first call.
+	// Just like for ReadChunk, release must be called exactly once for every chunk.
+	// Once ReadUnordered was called, Read, ReadChunk and WriteTo return an error.
+	// It returns io.EOF once all data up to the end of the stream has been returned.
+	ReadUnordered() (offset int64, data []byte, release func(), err error)
+	// SetReceiveWindow sets the size of the stream-level flow control window for receiving data,
+	// overriding Config.InitialStreamReceiveWindow and Config.MaxStreamReceiveWindow for this stream.
+	// It is usually called right after opening or accepting the stream.
+	// If the application is consuming data quickly enough, the flow control auto-tuning algorithm
+	// will increase the window up to max.
+	// The window can only be changed after the stream was opened or accepted. By then, the peer was
+	// already granted Config.InitialStreamReceiveWindow in the transport parameters, and that credit
+	// can't be revoked. Reducing the window therefore only takes effect once the peer has used up
+	// that credit, and the memory used by a stream can't be limited below Config.InitialStreamReceiveWindow.
+	// To budget memory per stream, set a small Config.InitialStreamReceiveWindow and increase the
+	// window for the streams that need more.
+	SetReceiveWindow(size, max uint64)
 }
 
 // A SendStream is a unidirectional Send Stream.
@@ -131,6 +181,10 @@ type SendStream interface {
 	// some data was successfully written.
 	// A zero value for t means Write will not time out.
 	SetWriteDeadline(t time.Time) error
+	// SetSendBufferSize sets the size of the send buffer, overriding Config.StreamSendBufferSize.
+	// It applies to future Write calls.
+	// Setting it to zero disables buffering: Write then blocks until (almost) all data has been sent out.
+	SetSendBufferSize(size uint64)
 }
 
 // A Connection is a QUIC connection between two peers.
@@ -190,11 +244,30 @@ type Connection interface {
 	// SendDatagram sends a message using a QUIC datagram, as specified in RFC 9221.
 	// There is no delivery guarantee for DATAGRAM frames, they are not retransmitted if lost.
 	// The payload of the datagram needs to fit into a single QUIC packet.
-	// In addition, a datagram may be dropped before being sent out if the available packet size suddenly decreases.
 	// If the payload is too large to be sent at the current time, a DatagramTooLargeError is returned.
+	// What happens when the send queue is full depends on Config.DatagramSendQueuePolicy.
 	SendDatagram(payload []byte) error
+	// SendDatagramWithCallback is like SendDatagram, but calls the callback once the datagram
+	// was either acknowledged by the peer (acked is true), or declared lost (acked is false).
+	// Datagrams that are dropped before being sent out are reported as lost.
+	// The callback is called at most once. It is not called if the connection is closed
+	// before the datagram is acknowledged or declared lost.
+	// Since loss detection can be spurious, a datagram that was declared lost might still have been received.
+	// The callback is usually called from the connection's run loop, and must not block.
+	// In particular, it must not call SendDatagram if the send queue uses the DatagramQueueBlock policy.
+	SendDatagramWithCallback(payload []byte, cb func(acked bool)) error
+	// MaxDatagramSize returns the maximum payload size of a datagram that can currently be sent.
+	// It takes into account the peer's max_datagram_frame_size transport parameter
+	// as well as the current packet size, which can grow as Path MTU discovery progresses.
+	// It returns 0 if datagram support was not negotiated.
+	MaxDatagramSize() int
 	// ReceiveDatagram gets a message received in a datagram, as specified in RFC 9221.
 	ReceiveDatagram(context.Context) ([]byte, error)
+	// UpdateKeys initiates an update of the 1-RTT keys (RFC 9001, Section 6).
+	// The key update happens when the next packet is sent. If a previous key update
+	// hasn't been acknowledged by the peer yet, it is delayed until that is the case.
+	// It returns an error if the handshake hasn't completed yet, or if the connection was closed.
+	UpdateKeys() error
 }
 
 // An EarlyConnection is a connection that is handshaking.
@@ -252,6 +325,8 @@ type ConnectionIDGenerator interface {
 type Config struct {
 	// GetConfigForClient is called for incoming connections.
 	// If the error is not nil, the connection attempt is refused.
+	// The ClientHelloInfo contains information from the TLS ClientHello sent by the client.
+	// If the ClientHello spans multiple packets, the server waits for all packets before calling GetConfigForClient.
 	GetConfigForClient func(info *ClientHelloInfo) (*Config, error)
 	// The QUIC versions that can be negotiated.
 	// If not set, it uses all versions available.
@@ -280,6 +355,8 @@ type Config struct {
 	// InitialStreamReceiveWindow is the initial size of the stream-level flow control window for receiving data.
 	// If the application is consuming data quickly enough, the flow control auto-tuning algorithm
 	// will increase the window up to MaxStreamReceiveWindow.
+	// It can be changed for individual streams using ReceiveStream.SetReceiveWindow,
+	// but it is the lower bound for the memory that a single stream can use.
 	// If this value is zero, it will default to 512 KB.
 	// Values larger than the maximum varint (quicvarint.Max) will be clipped to that value.
 	InitialStreamReceiveWindow uint64
@@ -304,6 +381,13 @@ type Config struct {
 	// To avoid deadlocks, it is not valid to call other functions on the connection or on streams
 	// in this callback.
 	AllowConnectionWindowIncrease func(conn Connection, delta uint64) bool
+	// AllowStreamWindowIncrease is called every time the flow controller of a stream attempts
+	// to increase the stream flow control window.
+	// If set, the caller can prevent an increase of the window, for example to enforce a memory budget
+	// for individual streams.
+	// To avoid deadlocks, it is not valid to call other functions on the connection or on streams
+	// in this callback.
+	AllowStreamWindowIncrease func(conn Connection, streamID StreamID, delta uint64) bool
 	// MaxIncomingStreams is the maximum number of concurrent bidirectional streams that a peer is allowed to open.
 	// If not set, it will default to 100.
 	// If set to a negative value, it doesn't allow any bidirectional streams.
@@ -314,10 +398,26 @@ type Config struct {
 	// If set to a negative value, it doesn't allow any unidirectional streams.
 	// Values larger than 2^60 will be clipped to that value.
 	MaxIncomingUniStreams int64
+	// StreamSendBufferSize is the size of the send buffer of every stream, in bytes.
+	// If set, Write copies data into the send buffer and returns as soon as all data was buffered,
+	// blocking only while the buffer is full.
+	// If zero, Write blocks until (almost) all data passed to it has been sent out.
+	// It can be changed for individual streams using SendStream.SetSendBufferSize.
+	StreamSendBufferSize uint64
 	// KeepAlivePeriod defines whether this peer will periodically send a packet to keep the connection alive.
 	// If set to 0, then no keep alive is sent. Otherwise, the keep alive is sent on that period (or at most
 	// every half of MaxIdleTimeout, whichever is smaller).
 	KeepAlivePeriod time.Duration
+	// KeyUpdateInterval is the maximum number of packets sent or received with the same 1-RTT key
+	// before a key update is initiated.
+	// If zero, it defaults to 100,000 packets.
+	// Values larger than 2^23 will be clipped to that value, the confidentiality limit of AES-GCM (RFC 9001, Section 6.6).
+	KeyUpdateInterval uint64
+	// KeyUpdatePeriod is the maximum duration the same 1-RTT key is used before a key update is initiated.
+	// If zero, keys are not updated based on time.
+	// Keys are only updated when a packet is sent, and a new key update can only be initiated
+	// after the peer acknowledged a packet sent with the current key.
+	KeyUpdatePeriod time.Duration
 	// DisablePathMTUDiscovery disables Path MTU Discovery (RFC 8899).
 	// This allows the sending of QUIC packets that fully utilize the available MTU of the path.
 	// Path MTU discovery is only available on systems that allow setting of the Don't Fragment (DF) bit.
@@ -328,13 +428,52 @@ type Config struct {
 	Allow0RTT bool
 	// Enable QUIC datagram support (RFC 9221).
 	EnableDatagrams bool
-	Tracer          func(context.Context, logging.Perspective, ConnectionID) *logging.ConnectionTracer
+	// DatagramSendQueueLen is the maximum number of datagrams that are queued for sending.
+	// If zero, it defaults to 32.
+	DatagramSendQueueLen int
+	// DatagramReceiveQueueLen is the maximum number of received datagrams that are queued
+	// until they are read by the application using Connection.ReceiveDatagram.
+	// If zero, it defaults to 128.
+	DatagramReceiveQueueLen int
+	// DatagramSendQueuePolicy determines what happens when SendDatagram is called while the send queue is full.
+	// By default, SendDatagram blocks until a datagram has been sent.
+	DatagramSendQueuePolicy DatagramQueuePolicy
+	// DatagramReceiveQueuePolicy determines what happens when a datagram is received while the receive queue is full.
+	// By default, the newly received datagram is dropped.
+	DatagramReceiveQueuePolicy DatagramQueuePolicy
+	Tracer                     func(context.Context, logging.Perspective, ConnectionID) *logging.ConnectionTracer
 }
 
+// ClientHelloInfo contains information about an incoming connection attempt.
 type ClientHelloInfo struct {
+	// RemoteAddr is the remote address of the client.
 	RemoteAddr net.Addr
+	// ServerName is the server name (SNI) requested by the client.
+	ServerName string
+	// SupportedProtos is the list of application protocols offered by the client (using ALPN).
+	SupportedProtos []string
+	// Version is the QUIC version used by the client.
+	Version VersionNumber
+	// AddrVerified says if the client's address was validated,
+	// either by a Retry, or by a token issued in a previous connection.
+	// It is only set when calling Config.GetConfigForClient.
+	AddrVerified bool
 }
 
+// A DatagramQueuePolicy determines what happens when a datagram queue is full.
+type DatagramQueuePolicy uint8
+
+const (
+	// DatagramQueueBlock makes SendDatagram block until there's space in the send queue.
+	// Received datagrams can't be blocked: for the receive queue, this is the same as DatagramQueueDropNewest.
+	DatagramQueueBlock DatagramQueuePolicy = iota
+	// DatagramQueueDropOldest drops the oldest queued datagram to make room for the new one.
+	DatagramQueueDropOldest
+	// DatagramQueueDropNewest drops the new datagram.
+	// SendDatagram then returns ErrDatagramQueueFull.
+	DatagramQueueDropNewest
+)
+
 // ConnectionState records basic details about a QUIC connection
 type ConnectionState struct {
 	// TLS contains information about the TLS connection state, incl. the tls.ConnectionState.
@@ -21,6 +21,8 @@ type StreamFlowController interface {
 	// final has to be to true if this is the final offset of the stream,
 	// as contained in a STREAM frame with FIN bit, and the RESET_STREAM frame
 	UpdateHighestReceived(offset protocol.ByteCount, final bool) error
+	// SetReceiveWindow sets the size of the receive window, and the maximum size it can be auto-tuned to.
+	SetReceiveWindow(size, maxSize protocol.ByteCount)
 	// Abandon should be called when reading from the stream is aborted early,
 	// and there won't be any further calls to AddBytesRead.
 	Abandon()
@@ -30,6 +30,7 @@ func NewStreamFlowController(
 	maxReceiveWindow protocol.ByteCount,
 	initialSendWindow protocol.ByteCount,
 	queueWindowUpdate func(protocol.StreamID),
+	allowWindowIncrease func(size protocol.ByteCount) bool,
 	rttStats *utils.RTTStats,
 	logger utils.Logger,
 ) StreamFlowController {
@@ -42,6 +43,7 @@ func NewStreamFlowController(
 			receiveWindow:        receiveWindow,
 			receiveWindowSize:    receiveWindow,
 			maxReceiveWindowSize: maxReceiveWindow,
+			allowWindowIncrease:  allowWindowIncrease,
 			sendWindow:           initialSendWindow,
 			logger:               logger,
 		},
@@ -117,6 +119,24 @@ func (c *streamFlowController) Abandon() {
 	}
 }
 
+// SetReceiveWindow sets the size of the receive window, and the maximum size auto-tuning may increase it to.
+// Flow control credit that was already granted can't be revoked,
+// so reducing the window only takes effect once the peer has consumed it.
+func (c *streamFlowController) SetReceiveWindow(size, maxSize protocol.ByteCount) {
+	c.mutex.Lock()
+	oldWindowSize := c.receiveWindowSize
+	c.receiveWindowSize = size
+	c.maxReceiveWindowSize = max(size, maxSize)
+	shouldQueueWindowUpdate := c.shouldQueueWindowUpdate()
+	c.mutex.Unlock()
+	if size > oldWindowSize {
+		c.connection.EnsureMinimumWindowSize(protocol.ByteCount(float64(size) * protocol.ConnectionFlowControlMultiplier))
+	}
+	if shouldQueueWindowUpdate {
+		c.queueWindowUpdate()
+	}
+}
+
 func (c *streamFlowController) AddBytesSent(n protocol.ByteCount) {
 	c.baseFlowController.AddBytesSent(n)
 	c.connection.AddBytesSent(n)
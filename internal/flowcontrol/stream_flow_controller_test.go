@@ -45,7 +45,7 @@ var _ = Describe("Stream Flow controller", func() {
 
 		It("sets the send and receive windows", func() {
 			cc := NewConnectionFlowController(0, 0, nil, func(protocol.ByteCount) bool { return true }, nil, utils.DefaultLogger)
-			fc := NewStreamFlowController(5, cc, receiveWindow, maxReceiveWindow, sendWindow, nil, rttStats, utils.DefaultLogger).(*streamFlowController)
+			fc := NewStreamFlowController(5, cc, receiveWindow, maxReceiveWindow, sendWindow, nil, nil, rttStats, utils.DefaultLogger).(*streamFlowController)
 			Expect(fc.streamID).To(Equal(protocol.StreamID(5)))
 			Expect(fc.receiveWindow).To(Equal(receiveWindow))
 			Expect(fc.maxReceiveWindowSize).To(Equal(maxReceiveWindow))
@@ -60,7 +60,7 @@ var _ = Describe("Stream Flow controller", func() {
 			}
 
 			cc := NewConnectionFlowController(receiveWindow, maxReceiveWindow, func() {}, func(protocol.ByteCount) bool { return true }, nil, utils.DefaultLogger)
-			fc := NewStreamFlowController(5, cc, receiveWindow, maxReceiveWindow, sendWindow, queueWindowUpdate, rttStats, utils.DefaultLogger).(*streamFlowController)
+			fc := NewStreamFlowController(5, cc, receiveWindow, maxReceiveWindow, sendWindow, queueWindowUpdate, nil, rttStats, utils.DefaultLogger).(*streamFlowController)
 			fc.AddBytesRead(receiveWindow)
 			Expect(queued).To(BeTrue())
 		})
@@ -228,6 +228,41 @@ var _ = Describe("Stream Flow controller", func() {
 				Expect(controller.connection.(*connectionFlowController).receiveWindowSize).To(Equal(oldConnectionSize))
 			})
 
+			It("asks if it is allowed to auto-tune the window", func() {
+				var allowed protocol.ByteCount
+				controller.allowWindowIncrease = func(size protocol.ByteCount) bool {
+					allowed = size
+					return false
+				}
+				oldOffset := controller.bytesRead
+				setRtt(scaleDuration(20 * time.Millisecond))
+				controller.epochStartOffset = oldOffset
+				controller.epochStartTime = time.Now().Add(-time.Millisecond)
+				controller.AddBytesRead(55)
+				offset := controller.GetWindowUpdate()
+				Expect(allowed).To(Equal(oldWindowSize))
+				Expect(offset).To(Equal(oldOffset + 55 + oldWindowSize))
+				Expect(controller.receiveWindowSize).To(Equal(oldWindowSize))
+			})
+
+			It("queues a window update when the receive window is increased", func() {
+				controller.SetReceiveWindow(200, 400)
+				Expect(queuedWindowUpdate).To(BeTrue())
+				Expect(controller.maxReceiveWindowSize).To(Equal(protocol.ByteCount(400)))
+				Expect(controller.GetWindowUpdate()).To(Equal(controller.bytesRead + 200))
+				Expect(controller.connection.(*connectionFlowController).receiveWindowSize).To(Equal(protocol.ByteCount(200 * protocol.ConnectionFlowControlMultiplier)))
+			})
+
+			It("uses a smaller receive window for future window updates", func() {
+				controller.SetReceiveWindow(40, 30)
+				Expect(queuedWindowUpdate).To(BeFalse())
+				Expect(controller.maxReceiveWindowSize).To(Equal(protocol.ByteCount(40)))
+				Expect(controller.connection.(*connectionFlowController).receiveWindowSize).To(Equal(protocol.ByteCount(120)))
+				controller.AddBytesRead(30)
+				Expect(queuedWindowUpdate).To(BeTrue())
+				Expect(controller.GetWindowUpdate()).To(Equal(controller.bytesRead + 40))
+			})
+
 			It("sends a connection-level window update when a large stream is abandoned", func() {
 				Expect(controller.UpdateHighestReceived(90, true)).To(Succeed())
 				Expect(controller.connection.GetWindowUpdate()).To(BeZero())
@@ -0,0 +1,98 @@
+package handshake
+
+import (
+	"errors"
+
+	"golang.org/x/crypto/cryptobyte"
+)
+
+const (
+	clientHelloMsgType = 1
+
+	extensionServerName = 0
+	extensionALPN       = 16
+)
+
+// A ClientHello contains the information from a TLS ClientHello that is needed
+// to route and configure a connection before the handshake is started.
+type ClientHello struct {
+	ServerName string
+	ALPNs      []string
+}
+
+// ClientHelloLen returns the length of the ClientHello handshake message, including the message header.
+// It returns false if the message header is incomplete.
+func ClientHelloLen(b []byte) (int, bool) {
+	if len(b) < 4 {
+		return 0, false
+	}
+	return 4 + (int(b[1])<<16 | int(b[2])<<8 | int(b[3])), true
+}
+
+// ParseClientHello parses a TLS ClientHello handshake message.
+// Only the server_name and the application_layer_protocol_negotiation extensions are parsed,
+// all other extensions are ignored.
+func ParseClientHello(b []byte) (*ClientHello, error) {
+	s := cryptobyte.String(b)
+	var msgType uint8
+	var msg cryptobyte.String
+	if !s.ReadUint8(&msgType) || !s.ReadUint24LengthPrefixed(&msg) || !s.Empty() {
+		return nil, errors.New("malformed handshake message")
+	}
+	if msgType != clientHelloMsgType {
+		return nil, errors.New("not a ClientHello")
+	}
+	var (
+		random, sessionID, cipherSuites, compressionMethods, extensions cryptobyte.String
+		version                                                         uint16
+	)
+	if !msg.ReadUint16(&version) ||
+		!msg.ReadBytes((*[]byte)(&random), 32) ||
+		!msg.ReadUint8LengthPrefixed(&sessionID) ||
+		!msg.ReadUint16LengthPrefixed(&cipherSuites) ||
+		!msg.ReadUint8LengthPrefixed(&compressionMethods) ||
+		!msg.ReadUint16LengthPrefixed(&extensions) ||
+		!msg.Empty() {
+		return nil, errors.New("malformed ClientHello")
+	}
+
+	ch := &ClientHello{}
+	for !extensions.Empty() {
+		var extType uint16
+		var extData cryptobyte.String
+		if !extensions.ReadUint16(&extType) || !extensions.ReadUint16LengthPrefixed(&extData) {
+			return nil, errors.New("malformed ClientHello extensions")
+		}
+		switch extType {
+		case extensionServerName:
+			var nameList cryptobyte.String
+			if !extData.ReadUint16LengthPrefixed(&nameList) || nameList.Empty() {
+				return nil, errors.New("malformed server_name extension")
+			}
+			for !nameList.Empty() {
+				var nameType uint8
+				var name cryptobyte.String
+				if !nameList.ReadUint8(&nameType) || !nameList.ReadUint16LengthPrefixed(&name) || len(name) == 0 {
+					return nil, errors.New("malformed server_name extension")
+				}
+				// RFC 6066, section 3: the only defined name type is host_name (0)
+				if nameType == 0 && ch.ServerName == "" {
+					ch.ServerName = string(name)
+				}
+			}
+		case extensionALPN:
+			var protoList cryptobyte.String
+			if !extData.ReadUint16LengthPrefixed(&protoList) || protoList.Empty() {
+				return nil, errors.New("malformed ALPN extension")
+			}
+			for !protoList.Empty() {
+				var proto cryptobyte.String
+				if !protoList.ReadUint8LengthPrefixed(&proto) || proto.Empty() {
+					return nil, errors.New("malformed ALPN extension")
+				}
+				ch.ALPNs = append(ch.ALPNs, string(proto))
+			}
+		}
+	}
+	return ch, nil
+}
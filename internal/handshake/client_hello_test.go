@@ -0,0 +1,74 @@
+package handshake
+
+import (
+	"context"
+	"crypto/tls"
+
+	"github.com/quic-go/quic-go/internal/wire"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ClientHello parsing", func() {
+	getClientHello := func(conf *tls.Config) []byte {
+		conn := tls.QUICClient(&tls.QUICConfig{TLSConfig: conf})
+		conn.SetTransportParameters((&wire.TransportParameters{}).Marshal(0))
+		Expect(conn.Start(context.Background())).To(Succeed())
+		defer conn.Close()
+		for {
+			ev := conn.NextEvent()
+			switch ev.Kind {
+			case tls.QUICNoEvent:
+				Fail("didn't receive a ClientHello")
+			case tls.QUICWriteData:
+				Expect(ev.Level).To(Equal(tls.QUICEncryptionLevelInitial))
+				return append([]byte{}, ev.Data...)
+			}
+		}
+	}
+
+	It("parses the server name and the ALPNs", func() {
+		b := getClientHello(&tls.Config{
+			ServerName: "quic-go.net",
+			NextProtos: []string{"h3", "proto"},
+			MinVersion: tls.VersionTLS13,
+		})
+		l, ok := ClientHelloLen(b)
+		Expect(ok).To(BeTrue())
+		Expect(l).To(Equal(len(b)))
+		ch, err := ParseClientHello(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ch.ServerName).To(Equal("quic-go.net"))
+		Expect(ch.ALPNs).To(Equal([]string{"h3", "proto"}))
+	})
+
+	It("parses a ClientHello without a server name", func() {
+		b := getClientHello(&tls.Config{
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"h3"},
+			MinVersion:         tls.VersionTLS13,
+		})
+		ch, err := ParseClientHello(b)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ch.ServerName).To(BeEmpty())
+		Expect(ch.ALPNs).To(Equal([]string{"h3"}))
+	})
+
+	It("errors on incomplete messages", func() {
+		b := getClientHello(&tls.Config{ServerName: "quic-go.net", MinVersion: tls.VersionTLS13})
+		_, ok := ClientHelloLen(b[:3])
+		Expect(ok).To(BeFalse())
+		for i := 0; i < len(b); i++ {
+			_, err := ParseClientHello(b[:i])
+			Expect(err).To(HaveOccurred())
+		}
+	})
+
+	It("errors on other handshake messages", func() {
+		b := getClientHello(&tls.Config{ServerName: "quic-go.net", MinVersion: tls.VersionTLS13})
+		b[0] = typeNewSessionTicket
+		_, err := ParseClientHello(b)
+		Expect(err).To(MatchError("not a ClientHello"))
+	})
+})
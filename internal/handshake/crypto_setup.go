@@ -33,6 +33,11 @@ type cryptoSetup struct {
 	events []Event
 
 	version protocol.VersionNumber
+	// The connection ID used to derive the Initial keys.
+	// This is the connection ID chosen by the client, or the one the server chose in the Retry.
+	initialConnID protocol.ConnectionID
+	// set when the version was changed using compatible version negotiation (RFC 9368)
+	changedVersion bool
 
 	ourParams  *wire.TransportParameters
 	peerParams *wire.TransportParameters
@@ -60,9 +65,10 @@ type cryptoSetup struct {
 
 	used0RTT atomic.Bool
 
-	aead          *updatableAEAD
-	has1RTTSealer bool
-	has1RTTOpener bool
+	aead            *updatableAEAD
+	keyUpdatePolicy KeyUpdatePolicy
+	has1RTTSealer   bool
+	has1RTTOpener   bool
 }
 
 var _ CryptoSetup = &cryptoSetup{}
@@ -73,6 +79,7 @@ func NewCryptoSetupClient(
 	tp *wire.TransportParameters,
 	tlsConf *tls.Config,
 	enable0RTT bool,
+	keyUpdatePolicy KeyUpdatePolicy,
 	rttStats *utils.RTTStats,
 	tracer *logging.ConnectionTracer,
 	logger utils.Logger,
@@ -81,6 +88,7 @@ func NewCryptoSetupClient(
 	cs := newCryptoSetup(
 		connID,
 		tp,
+		keyUpdatePolicy,
 		rttStats,
 		tracer,
 		logger,
@@ -108,6 +116,7 @@ func NewCryptoSetupServer(
 	tp *wire.TransportParameters,
 	tlsConf *tls.Config,
 	allow0RTT bool,
+	keyUpdatePolicy KeyUpdatePolicy,
 	rttStats *utils.RTTStats,
 	tracer *logging.ConnectionTracer,
 	logger utils.Logger,
@@ -116,6 +125,7 @@ func NewCryptoSetupServer(
 	cs := newCryptoSetup(
 		connID,
 		tp,
+		keyUpdatePolicy,
 		rttStats,
 		tracer,
 		logger,
@@ -165,6 +175,7 @@ func addConnToClientHelloInfo(conf *tls.Config, localAddr, remoteAddr net.Addr)
 func newCryptoSetup(
 	connID protocol.ConnectionID,
 	tp *wire.TransportParameters,
+	keyUpdatePolicy KeyUpdatePolicy,
 	rttStats *utils.RTTStats,
 	tracer *logging.ConnectionTracer,
 	logger utils.Logger,
@@ -177,23 +188,47 @@ func newCryptoSetup(
 		tracer.UpdatedKeyFromTLS(protocol.EncryptionInitial, protocol.PerspectiveServer)
 	}
 	return &cryptoSetup{
-		initialSealer: initialSealer,
-		initialOpener: initialOpener,
-		aead:          newUpdatableAEAD(rttStats, tracer, logger, version),
-		events:        make([]Event, 0, 16),
-		ourParams:     tp,
-		rttStats:      rttStats,
-		tracer:        tracer,
-		logger:        logger,
-		perspective:   perspective,
-		version:       version,
+		initialSealer:   initialSealer,
+		initialOpener:   initialOpener,
+		aead:            newUpdatableAEAD(rttStats, keyUpdatePolicy, tracer, logger, version),
+		keyUpdatePolicy: keyUpdatePolicy,
+		events:          make([]Event, 0, 16),
+		ourParams:       tp,
+		rttStats:        rttStats,
+		tracer:          tracer,
+		logger:          logger,
+		perspective:     perspective,
+		version:         version,
+		initialConnID:   connID,
 	}
 }
 
 func (h *cryptoSetup) ChangeConnectionID(id protocol.ConnectionID) {
-	initialSealer, initialOpener := NewInitialAEAD(id, h.perspective, h.version)
-	h.initialSealer = initialSealer
-	h.initialOpener = initialOpener
+	h.initialConnID = id
+	h.deriveInitialKeys()
+}
+
+// ChangeVersion is called by the client when the server switched to a compatible version (RFC 9368).
+// It must be called before processing the first packet sent in the new version.
+// 0-RTT packets can't be sent in the new version, therefore the 0-RTT keys are dropped.
+func (h *cryptoSetup) ChangeVersion(v protocol.VersionNumber) {
+	h.logger.Debugf("Changing version from %s to %s.", h.version, v)
+	h.switchVersion(v)
+	if h.zeroRTTSealer != nil {
+		h.zeroRTTSealer = nil
+		h.events = append(h.events, Event{Kind: EventDiscard0RTTKeys})
+	}
+}
+
+func (h *cryptoSetup) switchVersion(v protocol.VersionNumber) {
+	h.version = v
+	h.changedVersion = true
+	h.aead = newUpdatableAEAD(h.rttStats, h.keyUpdatePolicy, h.tracer, h.logger, v)
+	h.deriveInitialKeys()
+}
+
+func (h *cryptoSetup) deriveInitialKeys() {
+	h.initialSealer, h.initialOpener = NewInitialAEAD(h.initialConnID, h.perspective, h.version)
 	if h.tracer != nil && h.tracer.UpdatedKeyFromTLS != nil {
 		h.tracer.UpdatedKeyFromTLS(protocol.EncryptionInitial, protocol.PerspectiveClient)
 		h.tracer.UpdatedKeyFromTLS(protocol.EncryptionInitial, protocol.PerspectiveServer)
@@ -304,11 +339,51 @@ func (h *cryptoSetup) handleTransportParameters(data []byte) error {
 	if err := tp.Unmarshal(data, h.perspective.Opposite()); err != nil {
 		return err
 	}
+	if h.perspective == protocol.PerspectiveServer && tp.VersionInformation != nil {
+		if err := h.negotiateVersion(tp.VersionInformation); err != nil {
+			return err
+		}
+	}
 	h.peerParams = &tp
 	h.events = append(h.events, Event{Kind: EventReceivedTransportParameters, TransportParameters: h.peerParams})
 	return nil
 }
 
+// negotiateVersion is called by the server when receiving the client's version_information.
+// If the client supports a compatible version that the server prefers over the version
+// of the client's Initial, the server switches to that version (see section 2.3 of RFC 9368).
+// The server hasn't sent any packets at this point, so all packets will be sent in the new version.
+func (h *cryptoSetup) negotiateVersion(vi *wire.VersionInformation) error {
+	if vi.ChosenVersion != h.version {
+		return &qerr.TransportError{
+			ErrorCode:    qerr.VersionNegotiationErrorErrorCode,
+			ErrorMessage: fmt.Sprintf("chosen version (%s) doesn't match the version of the Initial (%s)", vi.ChosenVersion, h.version),
+		}
+	}
+	if h.ourParams.VersionInformation == nil {
+		return nil
+	}
+	for _, v := range h.ourParams.VersionInformation.AvailableVersions {
+		if !protocol.IsSupportedVersion(vi.AvailableVersions, v) || !protocol.AreCompatibleVersions(h.version, v) {
+			continue
+		}
+		if v == h.version {
+			return nil
+		}
+		h.logger.Debugf("Switching to compatible version %s (client's Initial used %s).", v, h.version)
+		h.switchVersion(v)
+		params := *h.ourParams
+		params.VersionInformation = &wire.VersionInformation{
+			ChosenVersion:     v,
+			AvailableVersions: h.ourParams.VersionInformation.AvailableVersions,
+		}
+		h.ourParams = &params
+		h.events = append(h.events, Event{Kind: EventChangedVersion, Version: v})
+		return nil
+	}
+	return nil
+}
+
 // must be called after receiving the transport parameters
 func (h *cryptoSetup) marshalDataForSessionState(earlyData bool) []byte {
 	b := make([]byte, 0, 256)
@@ -414,6 +489,10 @@ func (h *cryptoSetup) handleSessionTicket(sessionTicketData []byte, using0RTT bo
 	if !using0RTT {
 		return false
 	}
+	if h.changedVersion {
+		h.logger.Debugf("Switched to a different version. Rejecting 0-RTT.")
+		return false
+	}
 	valid := h.ourParams.ValidFor0RTT(t.Parameters)
 	if !valid {
 		h.logger.Debugf("Transport parameters changed. Rejecting 0-RTT.")
@@ -558,6 +637,12 @@ func (h *cryptoSetup) handshakeComplete() {
 	h.events = append(h.events, Event{Kind: EventHandshakeComplete})
 }
 
+// RequestKeyUpdate requests a key update of the 1-RTT keys.
+// It may be called from any go routine once the handshake has completed.
+func (h *cryptoSetup) RequestKeyUpdate() {
+	h.aead.RequestKeyUpdate()
+}
+
 func (h *cryptoSetup) SetHandshakeConfirmed() {
 	h.aead.SetHandshakeConfirmed()
 	// drop Handshake keys
@@ -655,6 +740,9 @@ func (h *cryptoSetup) ConnectionState() ConnectionState {
 }
 
 func wrapError(err error) error {
+	if transportErr, ok := err.(*qerr.TransportError); ok {
+		return transportErr
+	}
 	// alert 80 is an internal error
 	if alertErr := tls.AlertError(0); errors.As(err, &alertErr) && alertErr != 80 {
 		return qerr.NewLocalCryptoError(uint8(alertErr), err)
@@ -69,6 +69,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 			&wire.TransportParameters{},
 			tlsConf,
 			false,
+			KeyUpdatePolicy{},
 			&utils.RTTStats{},
 			nil,
 			utils.DefaultLogger.WithPrefix("client"),
@@ -90,6 +91,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 			&wire.TransportParameters{StatelessResetToken: &token},
 			testdata.GetTLSConfig(),
 			false,
+			KeyUpdatePolicy{},
 			&utils.RTTStats{},
 			nil,
 			utils.DefaultLogger.WithPrefix("server"),
@@ -268,6 +270,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 				clientTransportParameters,
 				clientConf,
 				enable0RTT,
+				KeyUpdatePolicy{},
 				clientRTTStats,
 				nil,
 				utils.DefaultLogger.WithPrefix("client"),
@@ -285,6 +288,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 				serverTransportParameters,
 				serverConf,
 				enable0RTT,
+				KeyUpdatePolicy{},
 				serverRTTStats,
 				nil,
 				utils.DefaultLogger.WithPrefix("server"),
@@ -337,6 +341,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 				cTransportParameters,
 				clientConf,
 				false,
+				KeyUpdatePolicy{},
 				&utils.RTTStats{},
 				nil,
 				utils.DefaultLogger.WithPrefix("client"),
@@ -356,6 +361,7 @@ var _ = Describe("Crypto Setup TLS", func() {
 				sTransportParameters,
 				serverConf,
 				false,
+				KeyUpdatePolicy{},
 				&utils.RTTStats{},
 				nil,
 				utils.DefaultLogger.WithPrefix("server"),
@@ -384,6 +390,112 @@ var _ = Describe("Crypto Setup TLS", func() {
 			Expect(serverReceivedTransportParameters.MaxIdleTimeout).To(Equal(42 * time.Second))
 		})
 
+		Context("compatible version negotiation", func() {
+			var token protocol.StatelessResetToken
+
+			newClientAndServer := func(clientVersionInfo, serverVersionInfo *wire.VersionInformation) (CryptoSetup, CryptoSetup) {
+				client := NewCryptoSetupClient(
+					protocol.ConnectionID{},
+					&wire.TransportParameters{ActiveConnectionIDLimit: 2, VersionInformation: clientVersionInfo},
+					clientConf,
+					false,
+					KeyUpdatePolicy{},
+					&utils.RTTStats{},
+					nil,
+					utils.DefaultLogger.WithPrefix("client"),
+					protocol.Version1,
+				)
+				server := NewCryptoSetupServer(
+					protocol.ConnectionID{},
+					&net.UDPAddr{IP: net.IPv6loopback, Port: 1234},
+					&net.UDPAddr{IP: net.IPv6loopback, Port: 4321},
+					&wire.TransportParameters{ActiveConnectionIDLimit: 2, StatelessResetToken: &token, VersionInformation: serverVersionInfo},
+					serverConf,
+					false,
+					KeyUpdatePolicy{},
+					&utils.RTTStats{},
+					nil,
+					utils.DefaultLogger.WithPrefix("server"),
+					protocol.Version1,
+				)
+				return client, server
+			}
+
+			getTransportParameters := func(events []Event) *wire.TransportParameters {
+				for _, ev := range events {
+					if ev.Kind == EventReceivedTransportParameters {
+						return ev.TransportParameters
+					}
+				}
+				return nil
+			}
+
+			It("switches to a compatible version preferred by the server", func() {
+				client, server := newClientAndServer(
+					&wire.VersionInformation{ChosenVersion: protocol.Version1, AvailableVersions: []protocol.VersionNumber{protocol.Version1, protocol.Version2}},
+					&wire.VersionInformation{ChosenVersion: protocol.Version1, AvailableVersions: []protocol.VersionNumber{protocol.Version2, protocol.Version1}},
+				)
+				clientEvents, cErr, serverEvents, sErr := handshake(client, server)
+				Expect(cErr).ToNot(HaveOccurred())
+				Expect(sErr).ToNot(HaveOccurred())
+				Expect(serverEvents).To(ContainElement(Event{Kind: EventChangedVersion, Version: protocol.Version2}))
+				tp := getTransportParameters(clientEvents)
+				Expect(tp).ToNot(BeNil())
+				Expect(tp.VersionInformation.ChosenVersion).To(Equal(protocol.Version2))
+			})
+
+			It("doesn't switch if the client doesn't support the server's preferred version", func() {
+				client, server := newClientAndServer(
+					&wire.VersionInformation{ChosenVersion: protocol.Version1, AvailableVersions: []protocol.VersionNumber{protocol.Version1}},
+					&wire.VersionInformation{ChosenVersion: protocol.Version1, AvailableVersions: []protocol.VersionNumber{protocol.Version2, protocol.Version1}},
+				)
+				clientEvents, cErr, serverEvents, sErr := handshake(client, server)
+				Expect(cErr).ToNot(HaveOccurred())
+				Expect(sErr).ToNot(HaveOccurred())
+				for _, ev := range serverEvents {
+					Expect(ev.Kind).ToNot(Equal(EventChangedVersion))
+				}
+				tp := getTransportParameters(clientEvents)
+				Expect(tp).ToNot(BeNil())
+				Expect(tp.VersionInformation.ChosenVersion).To(Equal(protocol.Version1))
+			})
+
+			It("errors if the client's chosen version doesn't match the version of the Initial", func() {
+				client, server := newClientAndServer(
+					&wire.VersionInformation{ChosenVersion: protocol.Version2, AvailableVersions: []protocol.VersionNumber{protocol.Version1, protocol.Version2}},
+					&wire.VersionInformation{ChosenVersion: protocol.Version1, AvailableVersions: []protocol.VersionNumber{protocol.Version1}},
+				)
+				_, _, _, sErr := handshake(client, server)
+				Expect(sErr).To(MatchError(&qerr.TransportError{
+					ErrorCode:    qerr.VersionNegotiationErrorErrorCode,
+					ErrorMessage: "chosen version (v2) doesn't match the version of the Initial (v1)",
+				}))
+			})
+
+			It("derives new Initial keys when the client changes the version", func() {
+				connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef})
+				client := NewCryptoSetupClient(
+					connID,
+					&wire.TransportParameters{},
+					clientConf,
+					false,
+					KeyUpdatePolicy{},
+					&utils.RTTStats{},
+					nil,
+					utils.DefaultLogger.WithPrefix("client"),
+					protocol.Version1,
+				)
+				client.ChangeVersion(protocol.Version2)
+				_, serverOpener := NewInitialAEAD(connID, protocol.PerspectiveServer, protocol.Version2)
+				sealer, err := client.GetInitialSealer()
+				Expect(err).ToNot(HaveOccurred())
+				sealed := sealer.Seal(nil, []byte("foobar"), 42, []byte("aad"))
+				opened, err := serverOpener.Open(nil, sealed, 42, []byte("aad"))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(opened).To(Equal([]byte("foobar")))
+			})
+		})
+
 		Context("with session tickets", func() {
 			It("errors when the NewSessionTicket is sent at the wrong encryption level", func() {
 				client, _, clientErr, _, _, serverErr := handshakeWithTLSConf(
@@ -80,6 +80,9 @@ const (
 	EventRestoredTransportParameters
 	// EventHandshakeComplete signals that the TLS handshake was completed.
 	EventHandshakeComplete
+	// EventChangedVersion signals that the server switched to a compatible version (RFC 9368).
+	// It is only used for the server.
+	EventChangedVersion
 )
 
 // Event is a handshake event.
@@ -87,6 +90,7 @@ type Event struct {
 	Kind                EventKind
 	Data                []byte
 	TransportParameters *wire.TransportParameters
+	Version             protocol.VersionNumber // only set for EventChangedVersion
 }
 
 // CryptoSetup handles the handshake and protecting / unprotecting packets
@@ -94,6 +98,7 @@ type CryptoSetup interface {
 	StartHandshake() error
 	io.Closer
 	ChangeConnectionID(protocol.ConnectionID)
+	ChangeVersion(protocol.VersionNumber)
 	GetSessionTicket() ([]byte, error)
 
 	HandleMessage([]byte, protocol.EncryptionLevel) error
@@ -102,6 +107,7 @@ type CryptoSetup interface {
 	SetLargest1RTTAcked(protocol.PacketNumber) error
 	DiscardInitialKeys()
 	SetHandshakeConfirmed()
+	RequestKeyUpdate()
 	ConnectionState() ConnectionState
 
 	GetInitialOpener() (LongHeaderOpener, error)
@@ -23,6 +23,8 @@ type Token struct {
 	// only set for retry tokens
 	OriginalDestConnectionID protocol.ConnectionID
 	RetrySrcConnectionID     protocol.ConnectionID
+	// Data is the application-defined data embedded in a (non-retry) token.
+	Data []byte
 }
 
 // ValidateRemoteAddr validates the address, but does not check expiration
@@ -37,16 +39,25 @@ type token struct {
 	Timestamp                int64
 	OriginalDestConnectionID []byte
 	RetrySrcConnectionID     []byte
+	Data                     []byte `asn1:"optional"`
 }
 
 // A TokenGenerator generates tokens
 type TokenGenerator struct {
 	tokenProtector tokenProtector
+	tokenData      func(net.Addr) ([]byte, error)
 }
 
-// NewTokenGenerator initializes a new TokenGenerator
-func NewTokenGenerator(key TokenProtectorKey) *TokenGenerator {
-	return &TokenGenerator{tokenProtector: newTokenProtector(key)}
+// NewTokenGenerator initializes a new TokenGenerator.
+// Tokens are encrypted using key, and decrypted using key or any of the decryptionKeys.
+func NewTokenGenerator(key TokenProtectorKey, decryptionKeys ...TokenProtectorKey) *TokenGenerator {
+	return &TokenGenerator{tokenProtector: newTokenProtector(key, decryptionKeys...)}
+}
+
+// SetTokenData sets a callback that is called when a token for a NEW_TOKEN frame is generated.
+// The data it returns is embedded into the token.
+func (g *TokenGenerator) SetTokenData(f func(net.Addr) ([]byte, error)) {
+	g.tokenData = f
 }
 
 // NewRetryToken generates a new token for a Retry for a given source address
@@ -70,9 +81,18 @@ func (g *TokenGenerator) NewRetryToken(
 
 // NewToken generates a new token to be sent in a NEW_TOKEN frame
 func (g *TokenGenerator) NewToken(raddr net.Addr) ([]byte, error) {
+	var tokenData []byte
+	if g.tokenData != nil {
+		var err error
+		tokenData, err = g.tokenData(raddr)
+		if err != nil {
+			return nil, err
+		}
+	}
 	data, err := asn1.Marshal(token{
 		RemoteAddr: encodeRemoteAddr(raddr),
 		Timestamp:  time.Now().UnixNano(),
+		Data:       tokenData,
 	})
 	if err != nil {
 		return nil, err
@@ -107,6 +127,8 @@ func (g *TokenGenerator) DecodeToken(encrypted []byte) (*Token, error) {
 	if t.IsRetryToken {
 		token.OriginalDestConnectionID = protocol.ParseConnectionID(t.OriginalDestConnectionID)
 		token.RetrySrcConnectionID = protocol.ParseConnectionID(t.RetrySrcConnectionID)
+	} else {
+		token.Data = t.Data
 	}
 	return token, nil
 }
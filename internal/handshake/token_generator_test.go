@@ -3,6 +3,7 @@ package handshake
 import (
 	"crypto/rand"
 	"encoding/asn1"
+	"errors"
 	"net"
 	"time"
 
@@ -58,6 +59,36 @@ var _ = Describe("Token Generator", func() {
 		Expect(token.RetrySrcConnectionID).To(Equal(connID2))
 	})
 
+	It("embeds data into tokens", func() {
+		addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+		tokenGen.SetTokenData(func(a net.Addr) ([]byte, error) {
+			Expect(a).To(Equal(addr))
+			return []byte("foobar"), nil
+		})
+		tokenEnc, err := tokenGen.NewToken(addr)
+		Expect(err).ToNot(HaveOccurred())
+		token, err := tokenGen.DecodeToken(tokenEnc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token.IsRetryToken).To(BeFalse())
+		Expect(token.Data).To(Equal([]byte("foobar")))
+	})
+
+	It("errors when the token data can't be generated", func() {
+		tokenGen.SetTokenData(func(net.Addr) ([]byte, error) { return nil, errors.New("test error") })
+		_, err := tokenGen.NewToken(&net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337})
+		Expect(err).To(MatchError("test error"))
+	})
+
+	It("decodes tokens that don't contain any data", func() {
+		addr := &net.UDPAddr{IP: net.IPv4(192, 168, 0, 1), Port: 1337}
+		tokenEnc, err := tokenGen.NewToken(addr)
+		Expect(err).ToNot(HaveOccurred())
+		token, err := tokenGen.DecodeToken(tokenEnc)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(token.ValidateRemoteAddr(addr)).To(BeTrue())
+		Expect(token.Data).To(BeEmpty())
+	})
+
 	It("rejects invalid tokens", func() {
 		_, err := tokenGen.DecodeToken([]byte("invalid token"))
 		Expect(err).To(HaveOccurred())
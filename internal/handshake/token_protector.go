@@ -27,11 +27,14 @@ const tokenNonceSize = 32
 // tokenProtector is used to create and verify a token
 type tokenProtectorImpl struct {
 	key TokenProtectorKey
+	// additional keys that are only used for decrypting tokens
+	decryptionKeys []TokenProtectorKey
 }
 
-// newTokenProtector creates a source for source address tokens
-func newTokenProtector(key TokenProtectorKey) tokenProtector {
-	return &tokenProtectorImpl{key: key}
+// newTokenProtector creates a source for source address tokens.
+// Tokens are encrypted using key, and decrypted using key or any of the decryptionKeys.
+func newTokenProtector(key TokenProtectorKey, decryptionKeys ...TokenProtectorKey) tokenProtector {
+	return &tokenProtectorImpl{key: key, decryptionKeys: decryptionKeys}
 }
 
 // NewToken encodes data into a new token.
@@ -40,7 +43,7 @@ func (s *tokenProtectorImpl) NewToken(data []byte) ([]byte, error) {
 	if _, err := rand.Read(nonce[:]); err != nil {
 		return nil, err
 	}
-	aead, aeadNonce, err := s.createAEAD(nonce[:])
+	aead, aeadNonce, err := createTokenAEAD(s.key, nonce[:])
 	if err != nil {
 		return nil, err
 	}
@@ -53,15 +56,28 @@ func (s *tokenProtectorImpl) DecodeToken(p []byte) ([]byte, error) {
 		return nil, fmt.Errorf("token too short: %d", len(p))
 	}
 	nonce := p[:tokenNonceSize]
-	aead, aeadNonce, err := s.createAEAD(nonce)
+	data, err := decodeToken(s.key, nonce, p[tokenNonceSize:])
+	if err == nil {
+		return data, nil
+	}
+	for _, key := range s.decryptionKeys {
+		if data, err := decodeToken(key, nonce, p[tokenNonceSize:]); err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+func decodeToken(key TokenProtectorKey, nonce, ciphertext []byte) ([]byte, error) {
+	aead, aeadNonce, err := createTokenAEAD(key, nonce)
 	if err != nil {
 		return nil, err
 	}
-	return aead.Open(nil, aeadNonce, p[tokenNonceSize:], nil)
+	return aead.Open(nil, aeadNonce, ciphertext, nil)
 }
 
-func (s *tokenProtectorImpl) createAEAD(nonce []byte) (cipher.AEAD, []byte, error) {
-	h := hkdf.New(sha256.New, s.key[:], nonce, []byte("quic-go token source"))
+func createTokenAEAD(tokenKey TokenProtectorKey, nonce []byte) (cipher.AEAD, []byte, error) {
+	h := hkdf.New(sha256.New, tokenKey[:], nonce, []byte("quic-go token source"))
 	key := make([]byte, 32) // use a 32 byte key, in order to select AES-256
 	if _, err := io.ReadFull(h, key); err != nil {
 		return nil, nil, err
@@ -51,6 +51,27 @@ var _ = Describe("Token Protector", func() {
 		Expect(err).To(HaveOccurred())
 	})
 
+	It("decodes tokens using the decryption keys", func() {
+		var oldKey, newKey TokenProtectorKey
+		rand.Read(oldKey[:])
+		rand.Read(newKey[:])
+		oldToken, err := newTokenProtector(oldKey).NewToken([]byte("foo"))
+		Expect(err).ToNot(HaveOccurred())
+
+		tp := newTokenProtector(newKey, oldKey)
+		decoded, err := tp.DecodeToken(oldToken)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded).To(Equal([]byte("foo")))
+		// new tokens are encrypted using the new key
+		newToken, err := tp.NewToken([]byte("bar"))
+		Expect(err).ToNot(HaveOccurred())
+		_, err = newTokenProtector(oldKey).DecodeToken(newToken)
+		Expect(err).To(HaveOccurred())
+		decoded, err = newTokenProtector(newKey).DecodeToken(newToken)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(decoded).To(Equal([]byte("bar")))
+	})
+
 	It("doesn't decode invalid tokens", func() {
 		token, err := tp.NewToken([]byte("foobar"))
 		Expect(err).ToNot(HaveOccurred())
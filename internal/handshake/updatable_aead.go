@@ -6,6 +6,7 @@ import (
 	"crypto/tls"
 	"encoding/binary"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go/internal/protocol"
@@ -22,6 +23,16 @@ var KeyUpdateInterval uint64 = protocol.KeyUpdateInterval
 // It's a package-level variable to allow modifying it for testing purposes.
 var FirstKeyUpdateInterval uint64 = 100
 
+// KeyUpdatePolicy determines when we initiate a key update.
+type KeyUpdatePolicy struct {
+	// Interval is the maximum number of packets we send or receive with the same key.
+	// If zero, KeyUpdateInterval is used.
+	Interval uint64
+	// Period is the maximum duration we use the same key.
+	// If zero, keys are not updated based on time.
+	Period time.Duration
+}
+
 type updatableAEAD struct {
 	suite *cipherSuite
 
@@ -42,6 +53,7 @@ type updatableAEAD struct {
 	highestRcvdPN           protocol.PacketNumber // highest packet number received (which could be successfully unprotected)
 	numRcvdWithCurrentKey   uint64
 	numSentWithCurrentKey   uint64
+	currentKeyStartTime     time.Time // time when the current key phase was installed
 	rcvAEAD                 cipher.AEAD
 	sendAEAD                cipher.AEAD
 	// caches cipher.AEAD.Overhead(). This speeds up calls to Overhead().
@@ -55,6 +67,10 @@ type updatableAEAD struct {
 	headerDecrypter headerProtector
 	headerEncrypter headerProtector
 
+	keyUpdateInterval  uint64 // 0 if KeyUpdateInterval is used
+	keyUpdatePeriod    time.Duration
+	keyUpdateRequested atomic.Bool // set by the application, might be set from a different go routine
+
 	rttStats *utils.RTTStats
 
 	tracer  *logging.ConnectionTracer
@@ -70,12 +86,14 @@ var (
 	_ ShortHeaderSealer = &updatableAEAD{}
 )
 
-func newUpdatableAEAD(rttStats *utils.RTTStats, tracer *logging.ConnectionTracer, logger utils.Logger, version protocol.VersionNumber) *updatableAEAD {
+func newUpdatableAEAD(rttStats *utils.RTTStats, policy KeyUpdatePolicy, tracer *logging.ConnectionTracer, logger utils.Logger, version protocol.VersionNumber) *updatableAEAD {
 	return &updatableAEAD{
 		firstPacketNumber:       protocol.InvalidPacketNumber,
 		largestAcked:            protocol.InvalidPacketNumber,
 		firstRcvdWithCurrentKey: protocol.InvalidPacketNumber,
 		firstSentWithCurrentKey: protocol.InvalidPacketNumber,
+		keyUpdateInterval:       policy.Interval,
+		keyUpdatePeriod:         policy.Period,
 		rttStats:                rttStats,
 		tracer:                  tracer,
 		logger:                  logger,
@@ -97,6 +115,9 @@ func (a *updatableAEAD) rollKeys() {
 	a.firstSentWithCurrentKey = protocol.InvalidPacketNumber
 	a.numRcvdWithCurrentKey = 0
 	a.numSentWithCurrentKey = 0
+	a.currentKeyStartTime = time.Now()
+	// A key update initiated by the peer also satisfies a pending request by the application.
+	a.keyUpdateRequested.Store(false)
 	a.prevRcvAEAD = a.rcvAEAD
 	a.rcvAEAD = a.nextRcvAEAD
 	a.sendAEAD = a.nextSendAEAD
@@ -136,6 +157,7 @@ func (a *updatableAEAD) SetReadKey(suite *cipherSuite, trafficSecret []byte) {
 // For the server, this function is called before SetWriteKey.
 func (a *updatableAEAD) SetWriteKey(suite *cipherSuite, trafficSecret []byte) {
 	a.sendAEAD = createAEAD(suite, trafficSecret, a.version)
+	a.currentKeyStartTime = time.Now()
 	a.headerEncrypter = newHeaderProtector(suite, trafficSecret, false, a.version)
 	if a.suite == nil {
 		a.setAEADParameters(a.sendAEAD, suite)
@@ -283,31 +305,46 @@ func (a *updatableAEAD) updateAllowed() bool {
 			a.largestAcked >= a.firstSentWithCurrentKey)
 }
 
-func (a *updatableAEAD) shouldInitiateKeyUpdate() bool {
+func (a *updatableAEAD) shouldInitiateKeyUpdate() (bool, logging.KeyUpdateReason) {
 	if !a.updateAllowed() {
-		return false
+		return false, 0
+	}
+	if a.keyUpdateRequested.Load() {
+		a.logger.Debugf("Application requested a key update. Initiating key update to the next key phase: %d", a.keyPhase+1)
+		return true, logging.KeyUpdateApplication
 	}
 	// Initiate the first key update shortly after the handshake, in order to exercise the key update mechanism.
 	if a.keyPhase == 0 {
 		if a.numRcvdWithCurrentKey >= FirstKeyUpdateInterval || a.numSentWithCurrentKey >= FirstKeyUpdateInterval {
-			return true
+			return true, logging.KeyUpdateFirst
 		}
 	}
-	if a.numRcvdWithCurrentKey >= KeyUpdateInterval {
+	keyUpdateInterval := a.keyUpdateInterval
+	if keyUpdateInterval == 0 {
+		keyUpdateInterval = KeyUpdateInterval
+	}
+	if a.numRcvdWithCurrentKey >= keyUpdateInterval {
 		a.logger.Debugf("Received %d packets with current key phase. Initiating key update to the next key phase: %d", a.numRcvdWithCurrentKey, a.keyPhase+1)
-		return true
+		return true, logging.KeyUpdatePacketLimit
 	}
-	if a.numSentWithCurrentKey >= KeyUpdateInterval {
+	if a.numSentWithCurrentKey >= keyUpdateInterval {
 		a.logger.Debugf("Sent %d packets with current key phase. Initiating key update to the next key phase: %d", a.numSentWithCurrentKey, a.keyPhase+1)
-		return true
+		return true, logging.KeyUpdatePacketLimit
+	}
+	if a.keyUpdatePeriod > 0 && time.Since(a.currentKeyStartTime) >= a.keyUpdatePeriod {
+		a.logger.Debugf("Used current key phase for %s. Initiating key update to the next key phase: %d", a.keyUpdatePeriod, a.keyPhase+1)
+		return true, logging.KeyUpdateTimeLimit
 	}
-	return false
+	return false, 0
 }
 
 func (a *updatableAEAD) KeyPhase() protocol.KeyPhaseBit {
-	if a.shouldInitiateKeyUpdate() {
+	if ok, reason := a.shouldInitiateKeyUpdate(); ok {
 		a.rollKeys()
 		a.logger.Debugf("Initiating key update to key phase %d", a.keyPhase)
+		if a.tracer != nil && a.tracer.InitiatedKeyUpdate != nil {
+			a.tracer.InitiatedKeyUpdate(a.keyPhase, reason)
+		}
 		if a.tracer != nil && a.tracer.UpdatedKey != nil {
 			a.tracer.UpdatedKey(a.keyPhase, false)
 		}
@@ -315,6 +352,13 @@ func (a *updatableAEAD) KeyPhase() protocol.KeyPhaseBit {
 	return a.keyPhase.Bit()
 }
 
+// RequestKeyUpdate requests a key update.
+// The key update is initiated when the next packet is sent, as soon as a key update is allowed.
+// It is safe to call this function from a different go routine.
+func (a *updatableAEAD) RequestKeyUpdate() {
+	a.keyUpdateRequested.Store(true)
+}
+
 func (a *updatableAEAD) Overhead() int {
 	return a.aeadOverhead
 }
@@ -22,7 +22,7 @@ var _ = Describe("Updatable AEAD", func() {
 	DescribeTable("ChaCha test vector",
 		func(v protocol.VersionNumber, expectedPayload, expectedPacket []byte) {
 			secret := splitHexString("9ac312a7f877468ebe69422748ad00a1 5443f18203a07d6060f688f30f21632b")
-			aead := newUpdatableAEAD(&utils.RTTStats{}, nil, nil, v)
+			aead := newUpdatableAEAD(&utils.RTTStats{}, KeyUpdatePolicy{}, nil, nil, v)
 			chacha := cipherSuites[2]
 			Expect(chacha.ID).To(Equal(tls.TLS_CHACHA20_POLY1305_SHA256))
 			aead.SetWriteKey(chacha, secret)
@@ -71,8 +71,8 @@ var _ = Describe("Updatable AEAD", func() {
 						rand.Read(trafficSecret2)
 
 						rttStats = utils.NewRTTStats()
-						client = newUpdatableAEAD(rttStats, nil, utils.DefaultLogger, v)
-						server = newUpdatableAEAD(rttStats, tr, utils.DefaultLogger, v)
+						client = newUpdatableAEAD(rttStats, KeyUpdatePolicy{}, nil, utils.DefaultLogger, v)
+						server = newUpdatableAEAD(rttStats, KeyUpdatePolicy{}, tr, utils.DefaultLogger, v)
 						client.SetReadKey(cs, trafficSecret2)
 						client.SetWriteKey(cs, trafficSecret1)
 						server.SetReadKey(cs, trafficSecret1)
@@ -308,6 +308,7 @@ var _ = Describe("Updatable AEAD", func() {
 										server.Seal(nil, msg, pn, ad)
 									}
 									// the first update is allowed without receiving an acknowledgement
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(1), logging.KeyUpdateFirst)
 									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(1), false)
 									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
 								})
@@ -328,6 +329,7 @@ var _ = Describe("Updatable AEAD", func() {
 									Expect(err).ToNot(HaveOccurred())
 									ExpectWithOffset(1, server.SetLargestAcked(0)).To(Succeed())
 									serverTracer.EXPECT().DroppedKey(protocol.KeyPhase(0))
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(2), logging.KeyUpdatePacketLimit)
 									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(2), false)
 									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseZero))
 								})
@@ -339,6 +341,7 @@ var _ = Describe("Updatable AEAD", func() {
 										Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseZero))
 										server.Seal(nil, msg, pn, ad)
 									}
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(1), logging.KeyUpdateFirst)
 									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(1), false)
 									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
 									// Now that our keys are updated, send a packet using the new keys.
@@ -363,6 +366,7 @@ var _ = Describe("Updatable AEAD", func() {
 									_, err := server.Open(nil, b, time.Now(), 1, protocol.KeyPhaseZero, []byte("ad"))
 									Expect(err).ToNot(HaveOccurred())
 									ExpectWithOffset(1, server.SetLargestAcked(0)).To(Succeed())
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(1), logging.KeyUpdateFirst)
 									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(1), false)
 									// Now that our keys are updated, send a packet using the new keys.
 									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
@@ -380,6 +384,7 @@ var _ = Describe("Updatable AEAD", func() {
 										Expect(err).ToNot(HaveOccurred())
 									}
 									// the first update is allowed without receiving an acknowledgement
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(1), logging.KeyUpdateFirst)
 									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(1), false)
 									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
 								})
@@ -399,10 +404,72 @@ var _ = Describe("Updatable AEAD", func() {
 									server.Seal(nil, msg, 1, ad)
 									Expect(server.SetLargestAcked(1)).To(Succeed())
 									serverTracer.EXPECT().DroppedKey(protocol.KeyPhase(0))
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(2), logging.KeyUpdatePacketLimit)
 									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(2), false)
 									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseZero))
 								})
 
+								It("uses the configured key update interval", func() {
+									server.keyUpdateInterval = 3
+									for i := 0; i < 3; i++ {
+										pn := protocol.PacketNumber(i)
+										Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseZero))
+										server.Seal(nil, msg, pn, ad)
+									}
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(1), logging.KeyUpdatePacketLimit)
+									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(1), false)
+									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
+								})
+
+								It("initiates a key update after the key update period", func() {
+									server.keyUpdatePeriod = time.Hour
+									server.Seal(nil, msg, 0, ad)
+									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseZero))
+									server.currentKeyStartTime = server.currentKeyStartTime.Add(-time.Hour)
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(1), logging.KeyUpdateTimeLimit)
+									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(1), false)
+									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
+									// the timer starts again for the new key phase
+									Expect(time.Since(server.currentKeyStartTime)).To(BeNumerically("<", time.Minute))
+								})
+
+								It("initiates a key update when requested by the application", func() {
+									server.RequestKeyUpdate()
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(1), logging.KeyUpdateApplication)
+									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(1), false)
+									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
+									// the request was processed
+									server.Seal(nil, msg, 0, ad)
+									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
+								})
+
+								It("delays a key update requested by the application until the previous update was acknowledged", func() {
+									server.rollKeys()
+									client.rollKeys()
+									server.RequestKeyUpdate()
+									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
+									server.Seal(nil, msg, 1, ad)
+									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
+									b := client.Seal(nil, msg, 1, ad)
+									_, err := server.Open(nil, b, time.Now(), 1, protocol.KeyPhaseOne, ad)
+									Expect(err).ToNot(HaveOccurred())
+									Expect(server.SetLargestAcked(1)).To(Succeed())
+									serverTracer.EXPECT().DroppedKey(protocol.KeyPhase(0))
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(2), logging.KeyUpdateApplication)
+									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(2), false)
+									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseZero))
+								})
+
+								It("doesn't initiate a key update requested by the application if the peer updated the keys", func() {
+									server.RequestKeyUpdate()
+									client.rollKeys()
+									b := client.Seal(nil, msg, 1, ad)
+									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(1), true)
+									_, err := server.Open(nil, b, time.Now(), 1, protocol.KeyPhaseOne, ad)
+									Expect(err).ToNot(HaveOccurred())
+									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
+								})
+
 								It("drops keys 3 PTOs after a key update", func() {
 									now := time.Now()
 									for i := 0; i < firstKeyUpdateInterval; i++ {
@@ -447,6 +514,7 @@ var _ = Describe("Updatable AEAD", func() {
 										server.Seal(nil, msg, pn, ad)
 										Expect(server.SetLargestAcked(pn)).To(Succeed())
 									}
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(1), logging.KeyUpdateFirst)
 									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(1), false)
 									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
 									// The server never received a packet at key phase 1.
@@ -466,6 +534,7 @@ var _ = Describe("Updatable AEAD", func() {
 									_, err := server.Open(nil, b, time.Now(), 1, protocol.KeyPhaseZero, []byte("ad"))
 									Expect(err).ToNot(HaveOccurred())
 									ExpectWithOffset(1, server.SetLargestAcked(0)).To(Succeed())
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(1), logging.KeyUpdateFirst)
 									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(1), false)
 									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
 									const nextPN = keyUpdateInterval + 1
@@ -503,6 +572,7 @@ var _ = Describe("Updatable AEAD", func() {
 									_, err := server.Open(nil, b, time.Now(), 1, protocol.KeyPhaseZero, []byte("ad"))
 									Expect(err).ToNot(HaveOccurred())
 									ExpectWithOffset(1, server.SetLargestAcked(0)).To(Succeed())
+									serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(1), logging.KeyUpdateFirst)
 									serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(1), false)
 									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseOne))
 									// send so many packets that we initiate the next key update
@@ -519,6 +589,7 @@ var _ = Describe("Updatable AEAD", func() {
 									ExpectWithOffset(1, server.SetLargestAcked(keyUpdateInterval)).To(Succeed())
 									gomock.InOrder(
 										serverTracer.EXPECT().DroppedKey(protocol.KeyPhase(0)),
+										serverTracer.EXPECT().InitiatedKeyUpdate(protocol.KeyPhase(2), logging.KeyUpdatePacketLimit),
 										serverTracer.EXPECT().UpdatedKey(protocol.KeyPhase(2), false),
 									)
 									Expect(server.KeyPhase()).To(Equal(protocol.KeyPhaseZero))
@@ -545,8 +616,8 @@ func getClientAndServer() (client, server *updatableAEAD) {
 
 	cs := cipherSuites[0]
 	rttStats := utils.NewRTTStats()
-	client = newUpdatableAEAD(rttStats, nil, utils.DefaultLogger, protocol.Version1)
-	server = newUpdatableAEAD(rttStats, nil, utils.DefaultLogger, protocol.Version1)
+	client = newUpdatableAEAD(rttStats, KeyUpdatePolicy{}, nil, utils.DefaultLogger, protocol.Version1)
+	server = newUpdatableAEAD(rttStats, KeyUpdatePolicy{}, nil, utils.DefaultLogger, protocol.Version1)
 	client.SetReadKey(cs, trafficSecret2)
 	client.SetWriteKey(cs, trafficSecret1)
 	server.SetReadKey(cs, trafficSecret1)
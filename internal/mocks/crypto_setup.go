@@ -75,6 +75,42 @@ func (c *CryptoSetupChangeConnectionIDCall) DoAndReturn(f func(protocol.Connecti
 	return c
 }
 
+// ChangeVersion mocks base method.
+func (m *MockCryptoSetup) ChangeVersion(arg0 protocol.VersionNumber) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ChangeVersion", arg0)
+}
+
+// ChangeVersion indicates an expected call of ChangeVersion.
+func (mr *MockCryptoSetupMockRecorder) ChangeVersion(arg0 any) *CryptoSetupChangeVersionCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ChangeVersion", reflect.TypeOf((*MockCryptoSetup)(nil).ChangeVersion), arg0)
+	return &CryptoSetupChangeVersionCall{Call: call}
+}
+
+// CryptoSetupChangeVersionCall wrap *gomock.Call
+type CryptoSetupChangeVersionCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *CryptoSetupChangeVersionCall) Return() *CryptoSetupChangeVersionCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *CryptoSetupChangeVersionCall) Do(f func(protocol.VersionNumber)) *CryptoSetupChangeVersionCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *CryptoSetupChangeVersionCall) DoAndReturn(f func(protocol.VersionNumber)) *CryptoSetupChangeVersionCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // Close mocks base method.
 func (m *MockCryptoSetup) Close() error {
 	m.ctrl.T.Helper()
@@ -614,6 +650,42 @@ func (c *CryptoSetupNextEventCall) DoAndReturn(f func() handshake.Event) *Crypto
 	return c
 }
 
+// RequestKeyUpdate mocks base method.
+func (m *MockCryptoSetup) RequestKeyUpdate() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RequestKeyUpdate")
+}
+
+// RequestKeyUpdate indicates an expected call of RequestKeyUpdate.
+func (mr *MockCryptoSetupMockRecorder) RequestKeyUpdate() *CryptoSetupRequestKeyUpdateCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequestKeyUpdate", reflect.TypeOf((*MockCryptoSetup)(nil).RequestKeyUpdate))
+	return &CryptoSetupRequestKeyUpdateCall{Call: call}
+}
+
+// CryptoSetupRequestKeyUpdateCall wrap *gomock.Call
+type CryptoSetupRequestKeyUpdateCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *CryptoSetupRequestKeyUpdateCall) Return() *CryptoSetupRequestKeyUpdateCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *CryptoSetupRequestKeyUpdateCall) Do(f func()) *CryptoSetupRequestKeyUpdateCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *CryptoSetupRequestKeyUpdateCall) DoAndReturn(f func()) *CryptoSetupRequestKeyUpdateCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // SetHandshakeConfirmed mocks base method.
 func (m *MockCryptoSetup) SetHandshakeConfirmed() {
 	m.ctrl.T.Helper()
@@ -80,6 +80,9 @@ func NewMockConnectionTracer(ctrl *gomock.Controller) (*logging.ConnectionTracer
 		UpdatedKey: func(generation logging.KeyPhase, remote bool) {
 			t.UpdatedKey(generation, remote)
 		},
+		InitiatedKeyUpdate: func(generation logging.KeyPhase, reason logging.KeyUpdateReason) {
+			t.InitiatedKeyUpdate(generation, reason)
+		},
 		DroppedEncryptionLevel: func(encLevel logging.EncryptionLevel) {
 			t.DroppedEncryptionLevel(encLevel)
 		},
@@ -403,6 +403,42 @@ func (c *ConnectionTracerECNStateUpdatedCall) DoAndReturn(f func(logging.ECNStat
 	return c
 }
 
+// InitiatedKeyUpdate mocks base method.
+func (m *MockConnectionTracer) InitiatedKeyUpdate(arg0 protocol.KeyPhase, arg1 logging.KeyUpdateReason) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "InitiatedKeyUpdate", arg0, arg1)
+}
+
+// InitiatedKeyUpdate indicates an expected call of InitiatedKeyUpdate.
+func (mr *MockConnectionTracerMockRecorder) InitiatedKeyUpdate(arg0, arg1 any) *ConnectionTracerInitiatedKeyUpdateCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InitiatedKeyUpdate", reflect.TypeOf((*MockConnectionTracer)(nil).InitiatedKeyUpdate), arg0, arg1)
+	return &ConnectionTracerInitiatedKeyUpdateCall{Call: call}
+}
+
+// ConnectionTracerInitiatedKeyUpdateCall wrap *gomock.Call
+type ConnectionTracerInitiatedKeyUpdateCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *ConnectionTracerInitiatedKeyUpdateCall) Return() *ConnectionTracerInitiatedKeyUpdateCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *ConnectionTracerInitiatedKeyUpdateCall) Do(f func(protocol.KeyPhase, logging.KeyUpdateReason)) *ConnectionTracerInitiatedKeyUpdateCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *ConnectionTracerInitiatedKeyUpdateCall) DoAndReturn(f func(protocol.KeyPhase, logging.KeyUpdateReason)) *ConnectionTracerInitiatedKeyUpdateCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // LossTimerCanceled mocks base method.
 func (m *MockConnectionTracer) LossTimerCanceled() {
 	m.ctrl.T.Helper()
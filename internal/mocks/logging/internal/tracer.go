@@ -77,6 +77,42 @@ func (c *TracerDroppedPacketCall) DoAndReturn(f func(net.Addr, logging.PacketTyp
 	return c
 }
 
+// RefusedConnection mocks base method.
+func (m *MockTracer) RefusedConnection(arg0 net.Addr, arg1 logging.ConnectionRefusedReason) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RefusedConnection", arg0, arg1)
+}
+
+// RefusedConnection indicates an expected call of RefusedConnection.
+func (mr *MockTracerMockRecorder) RefusedConnection(arg0, arg1 any) *TracerRefusedConnectionCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefusedConnection", reflect.TypeOf((*MockTracer)(nil).RefusedConnection), arg0, arg1)
+	return &TracerRefusedConnectionCall{Call: call}
+}
+
+// TracerRefusedConnectionCall wrap *gomock.Call
+type TracerRefusedConnectionCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *TracerRefusedConnectionCall) Return() *TracerRefusedConnectionCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *TracerRefusedConnectionCall) Do(f func(net.Addr, logging.ConnectionRefusedReason)) *TracerRefusedConnectionCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *TracerRefusedConnectionCall) DoAndReturn(f func(net.Addr, logging.ConnectionRefusedReason)) *TracerRefusedConnectionCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // SentPacket mocks base method.
 func (m *MockTracer) SentPacket(arg0 net.Addr, arg1 *wire.Header, arg2 protocol.ByteCount, arg3 []logging.Frame) {
 	m.ctrl.T.Helper()
@@ -14,6 +14,7 @@ type Tracer interface {
 	SentPacket(net.Addr, *logging.Header, logging.ByteCount, []logging.Frame)
 	SentVersionNegotiationPacket(_ net.Addr, dest, src logging.ArbitraryLenConnectionID, _ []logging.VersionNumber)
 	DroppedPacket(net.Addr, logging.PacketType, logging.ByteCount, logging.PacketDropReason)
+	RefusedConnection(net.Addr, logging.ConnectionRefusedReason)
 }
 
 //go:generate sh -c "go run go.uber.org/mock/mockgen -typed -build_flags=\"-tags=gomock\" -package internal -destination internal/connection_tracer.go github.com/quic-go/quic-go/internal/mocks/logging ConnectionTracer"
@@ -39,6 +40,7 @@ type ConnectionTracer interface {
 	UpdatedPTOCount(value uint32)
 	UpdatedKeyFromTLS(logging.EncryptionLevel, logging.Perspective)
 	UpdatedKey(generation logging.KeyPhase, remote bool)
+	InitiatedKeyUpdate(generation logging.KeyPhase, reason logging.KeyUpdateReason)
 	DroppedEncryptionLevel(logging.EncryptionLevel)
 	DroppedKey(generation logging.KeyPhase)
 	SetLossTimer(logging.TimerType, logging.EncryptionLevel, time.Time)
@@ -309,6 +309,44 @@ func (c *EarlyConnectionLocalAddrCall) DoAndReturn(f func() net.Addr) *EarlyConn
 	return c
 }
 
+// MaxDatagramSize mocks base method.
+func (m *MockEarlyConnection) MaxDatagramSize() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MaxDatagramSize")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// MaxDatagramSize indicates an expected call of MaxDatagramSize.
+func (mr *MockEarlyConnectionMockRecorder) MaxDatagramSize() *EarlyConnectionMaxDatagramSizeCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MaxDatagramSize", reflect.TypeOf((*MockEarlyConnection)(nil).MaxDatagramSize))
+	return &EarlyConnectionMaxDatagramSizeCall{Call: call}
+}
+
+// EarlyConnectionMaxDatagramSizeCall wrap *gomock.Call
+type EarlyConnectionMaxDatagramSizeCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *EarlyConnectionMaxDatagramSizeCall) Return(arg0 int) *EarlyConnectionMaxDatagramSizeCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *EarlyConnectionMaxDatagramSizeCall) Do(f func() int) *EarlyConnectionMaxDatagramSizeCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *EarlyConnectionMaxDatagramSizeCall) DoAndReturn(f func() int) *EarlyConnectionMaxDatagramSizeCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // NextConnection mocks base method.
 func (m *MockEarlyConnection) NextConnection() quic.Connection {
 	m.ctrl.T.Helper()
@@ -617,3 +655,79 @@ func (c *EarlyConnectionSendDatagramCall) DoAndReturn(f func([]byte) error) *Ear
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
+
+// SendDatagramWithCallback mocks base method.
+func (m *MockEarlyConnection) SendDatagramWithCallback(arg0 []byte, arg1 func(bool)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendDatagramWithCallback", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendDatagramWithCallback indicates an expected call of SendDatagramWithCallback.
+func (mr *MockEarlyConnectionMockRecorder) SendDatagramWithCallback(arg0, arg1 any) *EarlyConnectionSendDatagramWithCallbackCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendDatagramWithCallback", reflect.TypeOf((*MockEarlyConnection)(nil).SendDatagramWithCallback), arg0, arg1)
+	return &EarlyConnectionSendDatagramWithCallbackCall{Call: call}
+}
+
+// EarlyConnectionSendDatagramWithCallbackCall wrap *gomock.Call
+type EarlyConnectionSendDatagramWithCallbackCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *EarlyConnectionSendDatagramWithCallbackCall) Return(arg0 error) *EarlyConnectionSendDatagramWithCallbackCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *EarlyConnectionSendDatagramWithCallbackCall) Do(f func([]byte, func(bool)) error) *EarlyConnectionSendDatagramWithCallbackCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *EarlyConnectionSendDatagramWithCallbackCall) DoAndReturn(f func([]byte, func(bool)) error) *EarlyConnectionSendDatagramWithCallbackCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// UpdateKeys mocks base method.
+func (m *MockEarlyConnection) UpdateKeys() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateKeys")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateKeys indicates an expected call of UpdateKeys.
+func (mr *MockEarlyConnectionMockRecorder) UpdateKeys() *EarlyConnectionUpdateKeysCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateKeys", reflect.TypeOf((*MockEarlyConnection)(nil).UpdateKeys))
+	return &EarlyConnectionUpdateKeysCall{Call: call}
+}
+
+// EarlyConnectionUpdateKeysCall wrap *gomock.Call
+type EarlyConnectionUpdateKeysCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *EarlyConnectionUpdateKeysCall) Return(arg0 error) *EarlyConnectionUpdateKeysCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *EarlyConnectionUpdateKeysCall) Do(f func() error) *EarlyConnectionUpdateKeysCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *EarlyConnectionUpdateKeysCall) DoAndReturn(f func() error) *EarlyConnectionUpdateKeysCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
@@ -228,6 +228,87 @@ func (c *StreamReadCall) DoAndReturn(f func([]byte) (int, error)) *StreamReadCal
 	return c
 }
 
+// ReadChunk mocks base method.
+func (m *MockStream) ReadChunk() ([]byte, func(), error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadChunk")
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(func())
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReadChunk indicates an expected call of ReadChunk.
+func (mr *MockStreamMockRecorder) ReadChunk() *StreamReadChunkCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadChunk", reflect.TypeOf((*MockStream)(nil).ReadChunk))
+	return &StreamReadChunkCall{Call: call}
+}
+
+// StreamReadChunkCall wrap *gomock.Call
+type StreamReadChunkCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *StreamReadChunkCall) Return(arg0 []byte, arg1 func(), arg2 error) *StreamReadChunkCall {
+	c.Call = c.Call.Return(arg0, arg1, arg2)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *StreamReadChunkCall) Do(f func() ([]byte, func(), error)) *StreamReadChunkCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *StreamReadChunkCall) DoAndReturn(f func() ([]byte, func(), error)) *StreamReadChunkCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// ReadUnordered mocks base method.
+func (m *MockStream) ReadUnordered() (int64, []byte, func(), error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadUnordered")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].([]byte)
+	ret2, _ := ret[2].(func())
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// ReadUnordered indicates an expected call of ReadUnordered.
+func (mr *MockStreamMockRecorder) ReadUnordered() *StreamReadUnorderedCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadUnordered", reflect.TypeOf((*MockStream)(nil).ReadUnordered))
+	return &StreamReadUnorderedCall{Call: call}
+}
+
+// StreamReadUnorderedCall wrap *gomock.Call
+type StreamReadUnorderedCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *StreamReadUnorderedCall) Return(arg0 int64, arg1 []byte, arg2 func(), arg3 error) *StreamReadUnorderedCall {
+	c.Call = c.Call.Return(arg0, arg1, arg2, arg3)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *StreamReadUnorderedCall) Do(f func() (int64, []byte, func(), error)) *StreamReadUnorderedCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *StreamReadUnorderedCall) DoAndReturn(f func() (int64, []byte, func(), error)) *StreamReadUnorderedCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // SetDeadline mocks base method.
 func (m *MockStream) SetDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -304,6 +385,78 @@ func (c *StreamSetReadDeadlineCall) DoAndReturn(f func(time.Time) error) *Stream
 	return c
 }
 
+// SetReceiveWindow mocks base method.
+func (m *MockStream) SetReceiveWindow(arg0, arg1 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetReceiveWindow", arg0, arg1)
+}
+
+// SetReceiveWindow indicates an expected call of SetReceiveWindow.
+func (mr *MockStreamMockRecorder) SetReceiveWindow(arg0, arg1 any) *StreamSetReceiveWindowCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReceiveWindow", reflect.TypeOf((*MockStream)(nil).SetReceiveWindow), arg0, arg1)
+	return &StreamSetReceiveWindowCall{Call: call}
+}
+
+// StreamSetReceiveWindowCall wrap *gomock.Call
+type StreamSetReceiveWindowCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *StreamSetReceiveWindowCall) Return() *StreamSetReceiveWindowCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *StreamSetReceiveWindowCall) Do(f func(uint64, uint64)) *StreamSetReceiveWindowCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *StreamSetReceiveWindowCall) DoAndReturn(f func(uint64, uint64)) *StreamSetReceiveWindowCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// SetSendBufferSize mocks base method.
+func (m *MockStream) SetSendBufferSize(arg0 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetSendBufferSize", arg0)
+}
+
+// SetSendBufferSize indicates an expected call of SetSendBufferSize.
+func (mr *MockStreamMockRecorder) SetSendBufferSize(arg0 any) *StreamSetSendBufferSizeCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSendBufferSize", reflect.TypeOf((*MockStream)(nil).SetSendBufferSize), arg0)
+	return &StreamSetSendBufferSizeCall{Call: call}
+}
+
+// StreamSetSendBufferSizeCall wrap *gomock.Call
+type StreamSetSendBufferSizeCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *StreamSetSendBufferSizeCall) Return() *StreamSetSendBufferSizeCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *StreamSetSendBufferSizeCall) Do(f func(uint64)) *StreamSetSendBufferSizeCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *StreamSetSendBufferSizeCall) DoAndReturn(f func(uint64)) *StreamSetSendBufferSizeCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // SetWriteDeadline mocks base method.
 func (m *MockStream) SetWriteDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -261,6 +261,42 @@ func (c *StreamFlowControllerSendWindowSizeCall) DoAndReturn(f func() protocol.B
 	return c
 }
 
+// SetReceiveWindow mocks base method.
+func (m *MockStreamFlowController) SetReceiveWindow(arg0, arg1 protocol.ByteCount) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetReceiveWindow", arg0, arg1)
+}
+
+// SetReceiveWindow indicates an expected call of SetReceiveWindow.
+func (mr *MockStreamFlowControllerMockRecorder) SetReceiveWindow(arg0, arg1 any) *StreamFlowControllerSetReceiveWindowCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReceiveWindow", reflect.TypeOf((*MockStreamFlowController)(nil).SetReceiveWindow), arg0, arg1)
+	return &StreamFlowControllerSetReceiveWindowCall{Call: call}
+}
+
+// StreamFlowControllerSetReceiveWindowCall wrap *gomock.Call
+type StreamFlowControllerSetReceiveWindowCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *StreamFlowControllerSetReceiveWindowCall) Return() *StreamFlowControllerSetReceiveWindowCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *StreamFlowControllerSetReceiveWindowCall) Do(f func(protocol.ByteCount, protocol.ByteCount)) *StreamFlowControllerSetReceiveWindowCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *StreamFlowControllerSetReceiveWindowCall) DoAndReturn(f func(protocol.ByteCount, protocol.ByteCount)) *StreamFlowControllerSetReceiveWindowCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // UpdateHighestReceived mocks base method.
 func (m *MockStreamFlowController) UpdateHighestReceived(arg0 protocol.ByteCount, arg1 bool) error {
 	m.ctrl.T.Helper()
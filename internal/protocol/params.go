@@ -45,6 +45,12 @@ const DefaultMaxIncomingStreams = 100
 // DefaultMaxIncomingUniStreams is the maximum number of unidirectional streams that a peer may open
 const DefaultMaxIncomingUniStreams = 100
 
+// DefaultDatagramSendQueueLen is the default number of DATAGRAM frames that are queued for sending
+const DefaultDatagramSendQueueLen = 32
+
+// DefaultDatagramReceiveQueueLen is the default number of received DATAGRAM frames that are queued until they are read by the application
+const DefaultDatagramReceiveQueueLen = 128
+
 // MaxServerUnprocessedPackets is the max number of packets stored in the server that are not yet processed.
 const MaxServerUnprocessedPackets = 1024
 
@@ -58,9 +64,12 @@ const SkipPacketInitialPeriod PacketNumber = 256
 // SkipPacketMaxPeriod is the maximum period length used for packet number skipping.
 const SkipPacketMaxPeriod PacketNumber = 128 * 1024
 
-// MaxAcceptQueueSize is the maximum number of connections that the server queues for accepting.
+// DefaultTokenReplayCacheCapacity is the default number of tokens stored by the in-memory token replay cache.
+const DefaultTokenReplayCacheCapacity = 1 << 16
+
+// DefaultAcceptQueueSize is the default maximum number of connections that the server queues for accepting.
 // If the queue is full, new connection attempts will be rejected.
-const MaxAcceptQueueSize = 32
+const DefaultAcceptQueueSize = 32
 
 // TokenValidity is the duration that a (non-retry) token is considered valid
 const TokenValidity = 24 * time.Hour
@@ -170,12 +179,34 @@ const MaxAckDelayInclGranularity = MaxAckDelay + TimerGranularity
 // KeyUpdateInterval is the maximum number of packets we send or receive before initiating a key update.
 const KeyUpdateInterval = 100 * 1000
 
+// MaxKeyUpdateInterval is the maximum value of the key update interval that can be configured.
+// It is the confidentiality limit of AEAD_AES_128_GCM and AEAD_AES_256_GCM (see Section 6.6 of RFC 9001).
+const MaxKeyUpdateInterval = 1 << 23
+
 // Max0RTTQueueingDuration is the maximum time that we store 0-RTT packets in order to wait for the corresponding Initial to be received.
 const Max0RTTQueueingDuration = 100 * time.Millisecond
 
 // Max0RTTQueues is the maximum number of connections that we buffer 0-RTT packets for.
 const Max0RTTQueues = 32
 
+// MaxPendingClientHellos is the maximum number of connection attempts for which the server buffers Initial packets,
+// in order to reassemble a ClientHello that spans multiple packets.
+const MaxPendingClientHellos = 32
+
+// MaxPendingClientHelloPackets is the maximum number of packets that we buffer for each pending ClientHello.
+const MaxPendingClientHelloPackets = 8
+
+// MaxClientHelloQueueingDuration is the maximum time that we store Initial packets in order to wait for the remaining parts of the ClientHello.
+const MaxClientHelloQueueingDuration = 100 * time.Millisecond
+
+// MaxRoutedConnectionIDs is the maximum number of connection attempts for which the listener router remembers the listener
+// that the connection attempt was routed to.
+// This is needed to route subsequent Initial and 0-RTT packets before the connection is created.
+const MaxRoutedConnectionIDs = 1024
+
+// RoutedConnectionIDTimeout is the time after which the listener router forgets the listener that a connection attempt was routed to.
+const RoutedConnectionIDTimeout = time.Second
+
 // Max0RTTQueueLen is the maximum number of 0-RTT packets that we buffer for each connection.
 // When a new connection is created, all buffered packets are passed to the connection immediately.
 // To avoid blocking, this value has to be smaller than MaxConnUnprocessedPackets.
@@ -70,6 +70,14 @@ func IsSupportedVersion(supported []VersionNumber, v VersionNumber) bool {
 	return false
 }
 
+// AreCompatibleVersions says if it is possible to switch from one version to the other
+// during the handshake, using compatible version negotiation (RFC 9368).
+// QUIC v1 and QUIC v2 are compatible with each other, see section 4 of RFC 9369.
+func AreCompatibleVersions(v1, v2 VersionNumber) bool {
+	isCompatible := func(v VersionNumber) bool { return v == Version1 || v == Version2 }
+	return isCompatible(v1) && isCompatible(v2)
+}
+
 // ChooseSupportedVersion finds the best version in the overlap of ours and theirs
 // ours is a slice of versions that we support, sorted by our preference (descending)
 // theirs is a slice of versions offered by the peer. The order does not matter.
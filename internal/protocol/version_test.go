@@ -37,6 +37,14 @@ var _ = Describe("Version", func() {
 		Expect(IsSupportedVersion(SupportedVersions, SupportedVersions[len(SupportedVersions)-1])).To(BeTrue())
 	})
 
+	It("says which versions are compatible", func() {
+		Expect(AreCompatibleVersions(Version1, Version2)).To(BeTrue())
+		Expect(AreCompatibleVersions(Version2, Version1)).To(BeTrue())
+		Expect(AreCompatibleVersions(Version1, Version1)).To(BeTrue())
+		Expect(AreCompatibleVersions(Version1, versionDraft29)).To(BeFalse())
+		Expect(AreCompatibleVersions(0x1337, Version2)).To(BeFalse())
+	})
+
 	Context("highest supported version", func() {
 		It("finds the supported version", func() {
 			supportedVersions := []VersionNumber{1, 2, 3}
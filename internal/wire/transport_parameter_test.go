@@ -489,6 +489,72 @@ var _ = Describe("Transport Parameters", func() {
 		})
 	})
 
+	Context("version information", func() {
+		It("marshals and unmarshals", func() {
+			data := (&TransportParameters{
+				ActiveConnectionIDLimit: 2,
+				VersionInformation: &VersionInformation{
+					ChosenVersion:     protocol.Version1,
+					AvailableVersions: []protocol.VersionNumber{protocol.Version2, protocol.Version1},
+				},
+			}).Marshal(protocol.PerspectiveClient)
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(data, protocol.PerspectiveClient)).To(Succeed())
+			Expect(p.VersionInformation).To(Equal(&VersionInformation{
+				ChosenVersion:     protocol.Version1,
+				AvailableVersions: []protocol.VersionNumber{protocol.Version2, protocol.Version1},
+			}))
+		})
+
+		It("allows the server to not include the chosen version in the available versions", func() {
+			data := (&TransportParameters{
+				ActiveConnectionIDLimit: 2,
+				StatelessResetToken:     &protocol.StatelessResetToken{},
+				VersionInformation:      &VersionInformation{ChosenVersion: protocol.Version1},
+			}).Marshal(protocol.PerspectiveServer)
+			p := &TransportParameters{}
+			Expect(p.Unmarshal(data, protocol.PerspectiveServer)).To(Succeed())
+			Expect(p.VersionInformation.ChosenVersion).To(Equal(protocol.Version1))
+			Expect(p.VersionInformation.AvailableVersions).To(BeEmpty())
+		})
+
+		It("errors if the client's chosen version is not contained in the available versions", func() {
+			data := (&TransportParameters{
+				ActiveConnectionIDLimit: 2,
+				VersionInformation: &VersionInformation{
+					ChosenVersion:     protocol.Version1,
+					AvailableVersions: []protocol.VersionNumber{protocol.Version2},
+				},
+			}).Marshal(protocol.PerspectiveClient)
+			Expect((&TransportParameters{}).Unmarshal(data, protocol.PerspectiveClient)).To(MatchError(&qerr.TransportError{
+				ErrorCode:    qerr.TransportParameterError,
+				ErrorMessage: "chosen version v1 not contained in available versions",
+			}))
+		})
+
+		It("errors on version 0", func() {
+			b := quicvarint.Append(nil, uint64(versionInformationParameterID))
+			b = quicvarint.Append(b, 8)
+			b = append(b, []byte{0, 0, 0, 1, 0, 0, 0, 0}...)
+			Expect((&TransportParameters{}).Unmarshal(b, protocol.PerspectiveServer)).To(MatchError(&qerr.TransportError{
+				ErrorCode:    qerr.TransportParameterError,
+				ErrorMessage: "version_information contains version 0",
+			}))
+		})
+
+		It("errors if the length is not a multiple of 4", func() {
+			for _, l := range []int{0, 3, 5} {
+				b := quicvarint.Append(nil, uint64(versionInformationParameterID))
+				b = quicvarint.Append(b, uint64(l))
+				b = append(b, make([]byte, l)...)
+				Expect((&TransportParameters{}).Unmarshal(b, protocol.PerspectiveServer)).To(MatchError(&qerr.TransportError{
+					ErrorCode:    qerr.TransportParameterError,
+					ErrorMessage: fmt.Sprintf("invalid length for version_information: %d", l),
+				}))
+			}
+		})
+	})
+
 	Context("saving and retrieving from a session ticket", func() {
 		It("saves and retrieves the parameters", func() {
 			params := &TransportParameters{
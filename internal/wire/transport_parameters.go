@@ -45,6 +45,7 @@ const (
 	activeConnectionIDLimitParameterID         transportParameterID = 0xe
 	initialSourceConnectionIDParameterID       transportParameterID = 0xf
 	retrySourceConnectionIDParameterID         transportParameterID = 0x10
+	versionInformationParameterID              transportParameterID = 0x11
 	// RFC 9221
 	maxDatagramFrameSizeParameterID transportParameterID = 0x20
 )
@@ -56,6 +57,12 @@ type PreferredAddress struct {
 	StatelessResetToken protocol.StatelessResetToken
 }
 
+// VersionInformation is the value encoded in the version_information transport parameter (RFC 9368)
+type VersionInformation struct {
+	ChosenVersion     protocol.VersionNumber
+	AvailableVersions []protocol.VersionNumber
+}
+
 // TransportParameters are parameters sent to the peer during the handshake
 type TransportParameters struct {
 	InitialMaxStreamDataBidiLocal  protocol.ByteCount
@@ -85,6 +92,8 @@ type TransportParameters struct {
 	ActiveConnectionIDLimit uint64
 
 	MaxDatagramFrameSize protocol.ByteCount
+
+	VersionInformation *VersionInformation
 }
 
 // Unmarshal the transport parameters
@@ -181,6 +190,10 @@ func (p *TransportParameters) unmarshal(r *bytes.Reader, sentBy protocol.Perspec
 			}
 			connID, _ := protocol.ReadConnectionID(r, int(paramLen))
 			p.RetrySourceConnectionID = &connID
+		case versionInformationParameterID:
+			if err := p.readVersionInformation(r, int(paramLen), sentBy); err != nil {
+				return err
+			}
 		default:
 			r.Seek(int64(paramLen), io.SeekCurrent)
 		}
@@ -255,6 +268,45 @@ func (p *TransportParameters) readPreferredAddress(r *bytes.Reader, expectedLen
 	return nil
 }
 
+func (p *TransportParameters) readVersionInformation(r *bytes.Reader, l int, sentBy protocol.Perspective) error {
+	if l < 4 || l%4 != 0 {
+		return fmt.Errorf("invalid length for version_information: %d", l)
+	}
+	readVersion := func() (protocol.VersionNumber, error) {
+		v, err := utils.BigEndian.ReadUint32(r)
+		if err != nil {
+			return 0, err
+		}
+		if v == 0 {
+			return 0, errors.New("version_information contains version 0")
+		}
+		return protocol.VersionNumber(v), nil
+	}
+	chosen, err := readVersion()
+	if err != nil {
+		return err
+	}
+	vi := &VersionInformation{
+		ChosenVersion:     chosen,
+		AvailableVersions: make([]protocol.VersionNumber, 0, l/4-1),
+	}
+	for i := 1; i < l/4; i++ {
+		v, err := readVersion()
+		if err != nil {
+			return err
+		}
+		vi.AvailableVersions = append(vi.AvailableVersions, v)
+	}
+	// The client's Chosen Version has to be included in its Available Versions.
+	// Servers are allowed to omit their Chosen Version from their Available Versions,
+	// see section 3 of RFC 9368.
+	if sentBy == protocol.PerspectiveClient && !protocol.IsSupportedVersion(vi.AvailableVersions, vi.ChosenVersion) {
+		return fmt.Errorf("chosen version %s not contained in available versions", vi.ChosenVersion)
+	}
+	p.VersionInformation = vi
+	return nil
+}
+
 func (p *TransportParameters) readNumericTransportParameter(
 	r *bytes.Reader,
 	paramID transportParameterID,
@@ -407,6 +459,15 @@ func (p *TransportParameters) Marshal(pers protocol.Perspective) []byte {
 	if p.MaxDatagramFrameSize != protocol.InvalidByteCount {
 		b = p.marshalVarintParam(b, maxDatagramFrameSizeParameterID, uint64(p.MaxDatagramFrameSize))
 	}
+	// version_information
+	if p.VersionInformation != nil {
+		b = quicvarint.Append(b, uint64(versionInformationParameterID))
+		b = quicvarint.Append(b, 4*uint64(1+len(p.VersionInformation.AvailableVersions)))
+		b = binary.BigEndian.AppendUint32(b, uint32(p.VersionInformation.ChosenVersion))
+		for _, v := range p.VersionInformation.AvailableVersions {
+			b = binary.BigEndian.AppendUint32(b, uint32(v))
+		}
+	}
 
 	if pers == protocol.PerspectiveClient && len(AdditionalTransportParametersClient) > 0 {
 		for k, v := range AdditionalTransportParametersClient {
@@ -515,6 +576,10 @@ func (p *TransportParameters) String() string {
 		logString += ", MaxDatagramFrameSize: %d"
 		logParams = append(logParams, p.MaxDatagramFrameSize)
 	}
+	if p.VersionInformation != nil {
+		logString += ", VersionInformation: {ChosenVersion: %s, AvailableVersions: %s}"
+		logParams = append(logParams, p.VersionInformation.ChosenVersion, p.VersionInformation.AvailableVersions)
+	}
 	logString += "}"
 	return fmt.Sprintf(logString, logParams...)
 }
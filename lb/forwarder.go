@@ -0,0 +1,271 @@
+package lb
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go/internal/protocol"
+	"github.com/quic-go/quic-go/internal/utils"
+	"github.com/quic-go/quic-go/internal/wire"
+)
+
+// DefaultIdleTimeout is the default time after which the state for a client is removed.
+const DefaultIdleTimeout = 5 * time.Minute
+
+// DefaultMaxFlows is the default maximum number of flows.
+const DefaultMaxFlows = 4096
+
+var (
+	errTooManyFlows = errors.New("too many flows")
+	errNoNewFlow    = errors.New("packet can't start a new flow")
+)
+
+var setBufferWarningOnce sync.Once
+
+// Opts are load balancer options.
+type Opts struct {
+	// IdleTimeout is the time after which the state kept for a client is removed,
+	// if no packets were exchanged between the client and the backend.
+	// If zero, DefaultIdleTimeout is used.
+	IdleTimeout time.Duration
+	// MaxFlows is the maximum number of flows, i.e. pairs of client address and backend.
+	// Every flow uses a separate UDP socket. Once the limit is reached, packets that would
+	// create a new flow are dropped.
+	// If zero, DefaultMaxFlows is used. Negative values are invalid.
+	MaxFlows int
+}
+
+// A flow is the path between a client and a backend.
+type flow struct {
+	key        flowKey
+	clientAddr *net.UDPAddr
+	conn       *net.UDPConn // UDP connection to the backend
+
+	lastActivity atomic.Int64 // as Unix time in nanoseconds
+}
+
+func (f *flow) updateActivity() {
+	f.lastActivity.Store(time.Now().UnixNano())
+}
+
+type flowKey struct {
+	client  string
+	backend string
+}
+
+// A Forwarder is a QUIC-aware UDP load balancer.
+// It receives packets from clients, and forwards them to the backend selected by the Router.
+// Routing decisions only depend on the packet, and not on any per-connection state.
+// However, since the backends send their packets to the Forwarder, it uses a separate UDP socket
+// for every pair of client address and backend, and relays the packets received on this socket
+// back to the client.
+type Forwarder struct {
+	mutex sync.Mutex
+
+	conn        *net.UDPConn
+	router      *Router
+	idleTimeout time.Duration
+	maxFlows    int
+
+	flows  map[flowKey]*flow
+	closed bool
+
+	logger utils.Logger
+}
+
+// NewForwarder creates a new Forwarder listening on the local address.
+func NewForwarder(local string, router *Router, opts *Opts) (*Forwarder, error) {
+	if router == nil {
+		return nil, errors.New("lb: no router")
+	}
+	if opts == nil {
+		opts = &Opts{}
+	}
+	if opts.MaxFlows < 0 {
+		return nil, fmt.Errorf("lb: invalid maximum number of flows: %d", opts.MaxFlows)
+	}
+	laddr, err := net.ResolveUDPAddr("udp", local)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	// The Forwarder works with the default buffer sizes, just not as well under load.
+	if err := conn.SetReadBuffer(protocol.DesiredReceiveBufferSize); err != nil {
+		warnBufferSize(fmt.Errorf("failed to increase receive buffer size: %w", err))
+	}
+	if err := conn.SetWriteBuffer(protocol.DesiredSendBufferSize); err != nil {
+		warnBufferSize(fmt.Errorf("failed to increase send buffer size: %w", err))
+	}
+	idleTimeout := DefaultIdleTimeout
+	if opts.IdleTimeout > 0 {
+		idleTimeout = opts.IdleTimeout
+	}
+	maxFlows := DefaultMaxFlows
+	if opts.MaxFlows > 0 {
+		maxFlows = opts.MaxFlows
+	}
+	f := &Forwarder{
+		conn:        conn,
+		router:      router,
+		idleTimeout: idleTimeout,
+		maxFlows:    maxFlows,
+		flows:       make(map[flowKey]*flow),
+		logger:      utils.DefaultLogger.WithPrefix("lb"),
+	}
+	f.logger.Debugf("Starting load balancer on %s", conn.LocalAddr())
+	go f.run()
+	return f, nil
+}
+
+func warnBufferSize(err error) {
+	setBufferWarningOnce.Do(func() {
+		if disable, _ := strconv.ParseBool(os.Getenv("QUIC_GO_DISABLE_RECEIVE_BUFFER_WARNING")); disable {
+			return
+		}
+		log.Printf("%s. See https://github.com/quic-go/quic-go/wiki/UDP-Buffer-Sizes for details.", err)
+	})
+}
+
+// Close stops the Forwarder.
+func (f *Forwarder) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	for _, fl := range f.flows {
+		fl.conn.Close()
+	}
+	f.flows = nil
+	return f.conn.Close()
+}
+
+// LocalAddr is the address the Forwarder is listening on.
+func (f *Forwarder) LocalAddr() net.Addr {
+	return f.conn.LocalAddr()
+}
+
+// run handles packets received from clients.
+func (f *Forwarder) run() error {
+	for {
+		buffer := make([]byte, protocol.MaxPacketBufferSize)
+		n, cliAddr, err := f.conn.ReadFromUDP(buffer)
+		if err != nil {
+			return err
+		}
+		raw := buffer[:n]
+
+		backend, err := f.router.Route(raw)
+		if err != nil {
+			if f.logger.Debug() {
+				f.logger.Debugf("dropping packet (%d bytes) from %s: %s", n, cliAddr, err)
+			}
+			continue
+		}
+		fl, err := f.getFlow(cliAddr, backend, raw)
+		if err != nil {
+			if f.logger.Debug() {
+				f.logger.Debugf("dropping packet (%d bytes) from %s: %s", n, cliAddr, err)
+			}
+			continue
+		}
+		fl.updateActivity()
+		if f.logger.Debug() {
+			f.logger.Debugf("forwarding packet (%d bytes) from %s to %s", n, cliAddr, backend)
+		}
+		if _, err := fl.conn.Write(raw); err != nil && f.logger.Debug() {
+			f.logger.Debugf("error forwarding packet to %s: %s", backend, err)
+		}
+	}
+}
+
+// getFlow returns the flow between the client and the backend that the packet was routed to.
+// If no such flow exists yet, it is created, unless the packet can't start a new connection,
+// or the MaxFlows limit is reached.
+func (f *Forwarder) getFlow(cliAddr, backend *net.UDPAddr, packet []byte) (*flow, error) {
+	key := flowKey{client: cliAddr.String(), backend: backend.String()}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return nil, net.ErrClosed
+	}
+	if fl, ok := f.flows[key]; ok {
+		return fl, nil
+	}
+	// Clients send their first packets in datagrams of at least 1200 bytes (see Section 14.1 of RFC 9000).
+	// This prevents small long header packets with spoofed source addresses from creating flows.
+	// Short header packets were routed using the server ID, e.g. after the client's address changed.
+	if wire.IsLongHeaderPacket(packet[0]) && len(packet) < protocol.MinInitialPacketSize {
+		return nil, errNoNewFlow
+	}
+	if len(f.flows) >= f.maxFlows {
+		return nil, errTooManyFlows
+	}
+	conn, err := net.DialUDP("udp", nil, backend)
+	if err != nil {
+		return nil, err
+	}
+	fl := &flow{key: key, clientAddr: cliAddr, conn: conn}
+	fl.updateActivity()
+	f.flows[key] = fl
+	go f.runFlow(fl)
+	return fl, nil
+}
+
+// runFlow relays packets from a backend to a single client.
+// It removes the flow once it has been idle for longer than the idle timeout.
+func (f *Forwarder) runFlow(fl *flow) {
+	defer f.removeFlow(fl)
+
+	for {
+		buffer := make([]byte, protocol.MaxPacketBufferSize)
+		deadline := time.Unix(0, fl.lastActivity.Load()).Add(f.idleTimeout)
+		if err := fl.conn.SetReadDeadline(deadline); err != nil {
+			return
+		}
+		n, err := fl.conn.Read(buffer)
+		if err != nil {
+			var nerr net.Error
+			// the deadline might have been reached while the client was still sending packets
+			if errors.As(err, &nerr) && nerr.Timeout() &&
+				time.Since(time.Unix(0, fl.lastActivity.Load())) < f.idleTimeout {
+				continue
+			}
+			return
+		}
+		fl.updateActivity()
+		if f.logger.Debug() {
+			f.logger.Debugf("forwarding packet (%d bytes) from %s to %s", n, fl.conn.RemoteAddr(), fl.clientAddr)
+		}
+		if _, err := f.conn.WriteToUDP(buffer[:n], fl.clientAddr); err != nil {
+			return
+		}
+	}
+}
+
+func (f *Forwarder) removeFlow(fl *flow) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return
+	}
+	if f.logger.Debug() {
+		f.logger.Debugf("removing flow between %s and %s", fl.clientAddr, fl.conn.RemoteAddr())
+	}
+	delete(f.flows, fl.key)
+	fl.conn.Close()
+}
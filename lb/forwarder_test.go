@@ -0,0 +1,259 @@
+package lb
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/integrationtests/tools"
+	quicproxy "github.com/quic-go/quic-go/integrationtests/tools/proxy"
+	"github.com/quic-go/quic-go/internal/wire"
+	"github.com/quic-go/quic-go/quiclb"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Forwarder", func() {
+	const alpn = "lb-test"
+
+	config := &quiclb.Config{
+		ID:          2,
+		ServerIDLen: 1,
+		NonceLen:    8,
+		Key:         []byte("0123456789abcdef"),
+	}
+
+	var (
+		tlsServerConf *tls.Config
+		tlsClientConf *tls.Config
+	)
+
+	BeforeEach(func() {
+		ca, caPrivateKey, err := tools.GenerateCA()
+		Expect(err).ToNot(HaveOccurred())
+		leafCert, leafPrivateKey, err := tools.GenerateLeafCert(ca, caPrivateKey)
+		Expect(err).ToNot(HaveOccurred())
+		tlsServerConf = &tls.Config{
+			Certificates: []tls.Certificate{{
+				Certificate: [][]byte{leafCert.Raw},
+				PrivateKey:  leafPrivateKey,
+			}},
+			NextProtos: []string{alpn},
+		}
+		root := x509.NewCertPool()
+		root.AddCert(ca)
+		tlsClientConf = &tls.Config{
+			ServerName: "localhost",
+			RootCAs:    root,
+			NextProtos: []string{alpn},
+		}
+	})
+
+	// runBackend runs an echo server, and counts the accepted connections
+	runBackend := func(serverID byte, numConns *atomic.Int32) Backend {
+		g, err := quiclb.NewGenerator(config, []byte{serverID})
+		Expect(err).ToNot(HaveOccurred())
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		tr := &quic.Transport{Conn: conn, ConnectionIDGenerator: g}
+		DeferCleanup(tr.Close)
+		ln, err := tr.Listen(tlsServerConf, nil)
+		Expect(err).ToNot(HaveOccurred())
+		go func() {
+			defer GinkgoRecover()
+			for {
+				conn, err := ln.Accept(context.Background())
+				if err != nil {
+					return
+				}
+				numConns.Add(1)
+				go func() {
+					defer GinkgoRecover()
+					str, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					data, err := io.ReadAll(str)
+					if err != nil {
+						return
+					}
+					str.Write([]byte(fmt.Sprintf("%d: %s", serverID, data)))
+					str.Close()
+				}()
+			}
+		}()
+		return Backend{ServerID: []byte{serverID}, Addr: conn.LocalAddr().(*net.UDPAddr)}
+	}
+
+	newForwarder := func(backends ...Backend) *Forwarder {
+		decoder, err := quiclb.NewDecoder(config)
+		Expect(err).ToNot(HaveOccurred())
+		router, err := NewRouter(decoder, backends)
+		Expect(err).ToNot(HaveOccurred())
+		f, err := NewForwarder("localhost:0", router, nil)
+		Expect(err).ToNot(HaveOccurred())
+		DeferCleanup(f.Close)
+		return f
+	}
+
+	// echo dials addr, sends a message and returns the response
+	echo := func(addr string) string {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn, err := quic.DialAddr(ctx, addr, tlsClientConf, &quic.Config{MaxIdleTimeout: time.Second})
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.CloseWithError(0, "")
+		str, err := conn.OpenStream()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = str.Write([]byte("foobar"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(str.Close()).To(Succeed())
+		data, err := io.ReadAll(str)
+		Expect(err).ToNot(HaveOccurred())
+		return string(data)
+	}
+
+	It("forwards connections to the backends", func() {
+		var numConns1, numConns2 atomic.Int32
+		f := newForwarder(runBackend(1, &numConns1), runBackend(2, &numConns2))
+
+		const num = 10
+		for i := 0; i < num; i++ {
+			Expect(echo(f.LocalAddr().String())).To(Or(Equal("1: foobar"), Equal("2: foobar")))
+		}
+		Expect(numConns1.Load() + numConns2.Load()).To(BeEquivalentTo(num))
+	})
+
+	It("routes retransmitted Initial packets to the same backend", func() {
+		var numConns1, numConns2 atomic.Int32
+		f := newForwarder(runBackend(1, &numConns1), runBackend(2, &numConns2))
+
+		// drop the first two packets sent by the client
+		var numDropped atomic.Int32
+		proxy, err := quicproxy.NewQuicProxy("localhost:0", &quicproxy.Opts{
+			RemoteAddr: f.LocalAddr().String(),
+			DropPacket: func(dir quicproxy.Direction, packet []byte) bool {
+				if dir != quicproxy.DirectionIncoming || !wire.IsLongHeaderPacket(packet[0]) {
+					return false
+				}
+				return numDropped.Add(1) <= 2
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+		defer proxy.Close()
+
+		Expect(echo(proxy.LocalAddr().String())).To(Or(Equal("1: foobar"), Equal("2: foobar")))
+		Expect(numDropped.Load()).To(BeNumerically(">", 2))
+		Expect(numConns1.Load() + numConns2.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("drops packets that can't be routed", func() {
+		var numConns atomic.Int32
+		f := newForwarder(runBackend(1, &numConns))
+
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		// short header packet with a connection ID using the unroutable config ID
+		_, err = conn.WriteTo([]byte{0x40, 0xff, 1, 2, 3, 4, 5, 6, 7, 8, 9}, f.LocalAddr())
+		Expect(err).ToNot(HaveOccurred())
+		// make sure the packet was processed
+		Expect(echo(f.LocalAddr().String())).To(Equal("1: foobar"))
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		Expect(f.flows).To(HaveLen(1))
+	})
+
+	numFlows := func(f *Forwarder) int {
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+		return len(f.flows)
+	}
+
+	It("doesn't create flows for long header packets in small datagrams", func() {
+		var numConns atomic.Int32
+		f := newForwarder(runBackend(1, &numConns))
+
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		_, err = conn.WriteTo(longHeaderPacket(1199), f.LocalAddr())
+		Expect(err).ToNot(HaveOccurred())
+		Consistently(func() int { return numFlows(f) }, 50*time.Millisecond).Should(BeZero())
+		_, err = conn.WriteTo(longHeaderPacket(1200), f.LocalAddr())
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() int { return numFlows(f) }).Should(Equal(1))
+	})
+
+	It("limits the number of flows", func() {
+		var numConns atomic.Int32
+		backend := runBackend(1, &numConns)
+		decoder, err := quiclb.NewDecoder(config)
+		Expect(err).ToNot(HaveOccurred())
+		router, err := NewRouter(decoder, []Backend{backend})
+		Expect(err).ToNot(HaveOccurred())
+		f, err := NewForwarder("localhost:0", router, &Opts{MaxFlows: 2})
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+
+		for i := 0; i < 3; i++ {
+			conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			_, err = conn.WriteTo(longHeaderPacket(1200), f.LocalAddr())
+			Expect(err).ToNot(HaveOccurred())
+			Eventually(func() int { return numFlows(f) }).Should(Equal(min(i+1, 2)))
+		}
+		Consistently(func() int { return numFlows(f) }, 50*time.Millisecond).Should(Equal(2))
+	})
+
+	It("rejects a negative maximum number of flows", func() {
+		decoder, err := quiclb.NewDecoder(config)
+		Expect(err).ToNot(HaveOccurred())
+		router, err := NewRouter(decoder, []Backend{{ServerID: []byte{1}, Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}}})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = NewForwarder("localhost:0", router, &Opts{MaxFlows: -1})
+		Expect(err).To(MatchError("lb: invalid maximum number of flows: -1"))
+	})
+
+	It("removes idle flows", func() {
+		var numConns atomic.Int32
+		backend := runBackend(1, &numConns)
+		decoder, err := quiclb.NewDecoder(config)
+		Expect(err).ToNot(HaveOccurred())
+		router, err := NewRouter(decoder, []Backend{backend})
+		Expect(err).ToNot(HaveOccurred())
+		f, err := NewForwarder("localhost:0", router, &Opts{IdleTimeout: 50 * time.Millisecond})
+		Expect(err).ToNot(HaveOccurred())
+		defer f.Close()
+
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		_, err = conn.WriteTo(longHeaderPacket(1200), f.LocalAddr())
+		Expect(err).ToNot(HaveOccurred())
+		Eventually(func() int {
+			f.mutex.Lock()
+			defer f.mutex.Unlock()
+			return len(f.flows)
+		}).Should(Equal(1))
+		Eventually(func() int {
+			f.mutex.Lock()
+			defer f.mutex.Unlock()
+			return len(f.flows)
+		}).Should(BeZero())
+	})
+})
+
+// longHeaderPacket returns a datagram of the given size, starting with a QUIC v1 long header.
+func longHeaderPacket(size int) []byte {
+	b := []byte{0xc0, 0, 0, 0, 1, 4, 1, 2, 3, 4, 0}
+	return append(b, make([]byte, size-len(b))...)
+}
@@ -0,0 +1,133 @@
+// Package lb implements a QUIC-aware layer-4 load balancer.
+// It routes packets to backend servers based on the server ID encoded in the destination connection ID
+// (see the quiclb package), without keeping any per-connection state.
+package lb
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net"
+
+	"github.com/quic-go/quic-go/internal/wire"
+	"github.com/quic-go/quic-go/quiclb"
+)
+
+// ErrNoBackend is returned by the Router if a packet can't be routed to any backend.
+// This is the case for short header packets whose connection ID can't be decoded.
+var ErrNoBackend = errors.New("lb: no backend for packet")
+
+// A Backend is a server behind the load balancer.
+type Backend struct {
+	// ServerID is the server ID the server encodes into its connection IDs.
+	// Its length must match the ServerIDLen of the quiclb.Config.
+	ServerID []byte
+	// Addr is the address of the server.
+	Addr *net.UDPAddr
+}
+
+// A Router decides which backend a QUIC packet is forwarded to.
+// It is safe for concurrent use.
+//
+// Packets carrying a connection ID that decodes to the server ID of a backend are routed to that backend.
+// All other long header packets, most importantly the client's Initial and 0-RTT packets,
+// are routed by consistent hashing of the destination connection ID.
+// Since the client uses the same destination connection ID until it receives the first packet from the server,
+// all these packets end up at the same backend.
+type Router struct {
+	decoder  *quiclb.Decoder
+	backends []Backend
+	// mapping from server ID to backend
+	byServerID map[string]*Backend
+}
+
+// NewRouter creates a new Router.
+// The decoder is used to decode the server ID from connection IDs.
+func NewRouter(decoder *quiclb.Decoder, backends []Backend) (*Router, error) {
+	if decoder == nil {
+		return nil, errors.New("lb: no decoder")
+	}
+	if len(backends) == 0 {
+		return nil, errors.New("lb: no backends")
+	}
+	r := &Router{
+		decoder:    decoder,
+		backends:   make([]Backend, len(backends)),
+		byServerID: make(map[string]*Backend, len(backends)),
+	}
+	copy(r.backends, backends)
+	for i := range r.backends {
+		b := &r.backends[i]
+		if b.Addr == nil {
+			return nil, fmt.Errorf("lb: no address for server ID %x", b.ServerID)
+		}
+		if _, ok := r.byServerID[string(b.ServerID)]; ok {
+			return nil, fmt.Errorf("lb: duplicate server ID %x", b.ServerID)
+		}
+		r.byServerID[string(b.ServerID)] = b
+	}
+	return r, nil
+}
+
+// Route returns the address of the backend that a packet should be forwarded to.
+func (r *Router) Route(packet []byte) (*net.UDPAddr, error) {
+	if len(packet) == 0 {
+		return nil, io.EOF
+	}
+	if !wire.IsLongHeaderPacket(packet[0]) {
+		serverID, err := r.decoder.ServerIDFromPacket(packet)
+		if err != nil {
+			if err == quiclb.ErrUnroutable {
+				return nil, ErrNoBackend
+			}
+			return nil, err
+		}
+		b, ok := r.byServerID[string(serverID)]
+		if !ok {
+			return nil, ErrNoBackend
+		}
+		return b.Addr, nil
+	}
+
+	connID, err := wire.ParseConnectionID(packet, 0)
+	if err != nil {
+		return nil, err
+	}
+	if serverID, err := r.decoder.ServerID(connID.Bytes()); err == nil {
+		if b, ok := r.byServerID[string(serverID)]; ok {
+			return b.Addr, nil
+		}
+	}
+	return r.hash(connID.Bytes()).Addr, nil
+}
+
+// hash selects a backend using rendezvous hashing.
+// Compared to hashing modulo the number of backends, this has the advantage that
+// adding or removing a backend only affects the connection IDs that are routed to that backend.
+func (r *Router) hash(connID []byte) *Backend {
+	var best *Backend
+	var bestWeight uint64
+	for i := range r.backends {
+		b := &r.backends[i]
+		h := fnv.New64a()
+		h.Write(b.ServerID)
+		h.Write(connID)
+		if w := mix(h.Sum64()); best == nil || w > bestWeight {
+			best = b
+			bestWeight = w
+		}
+	}
+	return best
+}
+
+// mix is the finalizer of SplitMix64.
+// FNV doesn't mix the bits well enough for the weights of the different backends to be independent.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
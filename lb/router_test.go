@@ -0,0 +1,154 @@
+package lb
+
+import (
+	"crypto/rand"
+	"io"
+	"net"
+
+	"github.com/quic-go/quic-go/quiclb"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Router", func() {
+	config := &quiclb.Config{
+		ID:          1,
+		ServerIDLen: 2,
+		NonceLen:    6,
+		Key:         []byte("0123456789abcdef"),
+	}
+
+	backends := []Backend{
+		{ServerID: []byte{0, 1}, Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1001}},
+		{ServerID: []byte{0, 2}, Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1002}},
+		{ServerID: []byte{0, 3}, Addr: &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1003}},
+	}
+
+	newRouter := func(backends []Backend) *Router {
+		decoder, err := quiclb.NewDecoder(config)
+		Expect(err).ToNot(HaveOccurred())
+		r, err := NewRouter(decoder, backends)
+		Expect(err).ToNot(HaveOccurred())
+		return r
+	}
+
+	generateConnID := func(serverID []byte) []byte {
+		g, err := quiclb.NewGenerator(config, serverID)
+		Expect(err).ToNot(HaveOccurred())
+		connID, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		return connID.Bytes()
+	}
+
+	randomConnID := func(l int) []byte {
+		b := make([]byte, l)
+		rand.Read(b)
+		b[0] |= 0xe0 // use the unroutable config ID
+		return b
+	}
+
+	shortHeaderPacket := func(connID []byte) []byte {
+		b := append([]byte{0x40}, connID...)
+		return append(b, []byte("foobar")...)
+	}
+
+	longHeaderPacket := func(connID []byte) []byte {
+		b := []byte{0xc0, 0, 0, 0, 1}
+		b = append(b, uint8(len(connID)))
+		b = append(b, connID...)
+		b = append(b, 4, 1, 2, 3, 4) // source connection ID
+		return append(b, []byte("foobar")...)
+	}
+
+	It("rejects invalid configurations", func() {
+		decoder, err := quiclb.NewDecoder(config)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = NewRouter(nil, backends)
+		Expect(err).To(MatchError("lb: no decoder"))
+		_, err = NewRouter(decoder, nil)
+		Expect(err).To(MatchError("lb: no backends"))
+		_, err = NewRouter(decoder, []Backend{backends[0], {ServerID: backends[0].ServerID, Addr: backends[1].Addr}})
+		Expect(err).To(MatchError("lb: duplicate server ID 0001"))
+		_, err = NewRouter(decoder, []Backend{{ServerID: []byte{0, 1}}})
+		Expect(err).To(MatchError("lb: no address for server ID 0001"))
+	})
+
+	It("routes short header packets by server ID", func() {
+		r := newRouter(backends)
+		for _, b := range backends {
+			addr, err := r.Route(shortHeaderPacket(generateConnID(b.ServerID)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(addr).To(Equal(b.Addr))
+		}
+	})
+
+	It("routes long header packets by server ID", func() {
+		r := newRouter(backends)
+		for _, b := range backends {
+			addr, err := r.Route(longHeaderPacket(generateConnID(b.ServerID)))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(addr).To(Equal(b.Addr))
+		}
+	})
+
+	It("doesn't route short header packets with unknown server IDs", func() {
+		r := newRouter(backends)
+		_, err := r.Route(shortHeaderPacket(generateConnID([]byte{0, 42})))
+		Expect(err).To(MatchError(ErrNoBackend))
+		_, err = r.Route(shortHeaderPacket(randomConnID(8)))
+		Expect(err).To(MatchError(ErrNoBackend))
+	})
+
+	It("errors on packets that are too short", func() {
+		r := newRouter(backends)
+		_, err := r.Route(nil)
+		Expect(err).To(MatchError(io.EOF))
+		_, err = r.Route(shortHeaderPacket(generateConnID(backends[0].ServerID))[:5])
+		Expect(err).To(MatchError(io.EOF))
+		_, err = r.Route(longHeaderPacket(randomConnID(8))[:10])
+		Expect(err).To(MatchError(io.EOF))
+	})
+
+	It("routes Initial packets by hashing the destination connection ID", func() {
+		r := newRouter(backends)
+		counts := make(map[int]int)
+		for i := 0; i < 3000; i++ {
+			connID := randomConnID(8 + i%13)
+			addr, err := r.Route(longHeaderPacket(connID))
+			Expect(err).ToNot(HaveOccurred())
+			// packets with the same connection ID are routed to the same backend
+			addr2, err := r.Route(longHeaderPacket(connID))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(addr2).To(Equal(addr))
+			counts[addr.Port]++
+		}
+		Expect(counts).To(HaveLen(3))
+		for _, c := range counts {
+			Expect(c).To(BeNumerically("~", 1000, 150))
+		}
+	})
+
+	It("routes packets with unknown server IDs by hashing the destination connection ID", func() {
+		r := newRouter(backends[1:])
+		connID := generateConnID(backends[0].ServerID)
+		addr, err := r.Route(longHeaderPacket(connID))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(addr).To(Or(Equal(backends[1].Addr), Equal(backends[2].Addr)))
+	})
+
+	It("only reroutes the connection IDs of a removed backend", func() {
+		r := newRouter(backends)
+		r2 := newRouter(backends[:2])
+		for i := 0; i < 1000; i++ {
+			p := longHeaderPacket(randomConnID(10))
+			addr, err := r.Route(p)
+			Expect(err).ToNot(HaveOccurred())
+			addr2, err := r2.Route(p)
+			Expect(err).ToNot(HaveOccurred())
+			if addr != backends[2].Addr {
+				Expect(addr2).To(Equal(addr))
+			}
+		}
+	})
+})
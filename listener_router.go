@@ -0,0 +1,281 @@
+package quic
+
+import (
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go/internal/handshake"
+	"github.com/quic-go/quic-go/internal/protocol"
+	"github.com/quic-go/quic-go/internal/utils"
+	"github.com/quic-go/quic-go/internal/wire"
+	"github.com/quic-go/quic-go/logging"
+)
+
+// A ListenerRoute selects the connection attempts that are handled by a Listener.
+// Routing decisions are made based on the TLS ClientHello sent by the client.
+// A connection attempt matches a ListenerRoute if it matches all of its non-empty fields.
+type ListenerRoute struct {
+	// ServerNames is a list of server names matched against the server name (SNI) sent by the client.
+	// Matching is case-insensitive. A wildcard name, like "*.example.com", matches exactly one label.
+	ServerNames []string
+	// NextProtos is a list of application protocols.
+	// A connection attempt matches if the client offers at least one of these protocols (using ALPN).
+	NextProtos []string
+	// Match is called for every connection attempt that matches the ServerNames and NextProtos.
+	// It can be used to implement custom routing logic.
+	Match func(*ClientHelloInfo) bool
+}
+
+func (r *ListenerRoute) matches(info *ClientHelloInfo) bool {
+	if len(r.ServerNames) > 0 {
+		var found bool
+		for _, name := range r.ServerNames {
+			if matchServerName(name, info.ServerName) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.NextProtos) > 0 {
+		var found bool
+		for _, proto := range r.NextProtos {
+			for _, offered := range info.SupportedProtos {
+				if proto == offered {
+					found = true
+					break
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return r.Match == nil || r.Match(info)
+}
+
+func matchServerName(pattern, serverName string) bool {
+	if serverName == "" {
+		return false
+	}
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		label, rest, ok := strings.Cut(serverName, ".")
+		return ok && label != "" && strings.EqualFold(rest, suffix)
+	}
+	return strings.EqualFold(pattern, serverName)
+}
+
+type routedListener struct {
+	route  *ListenerRoute
+	server *baseServer
+}
+
+type routedConnID struct {
+	server     *baseServer
+	expiration time.Time
+}
+
+// The listenerRouter distributes new connection attempts to the Listeners of a Transport.
+// It runs in its own Go routine, since it decrypts the client's Initial packets in order
+// to parse the ClientHello.
+type listenerRouter struct {
+	// selectServer selects the server for a connection attempt.
+	// It returns nil if no server matches.
+	selectServer func(*ClientHelloInfo) *baseServer
+	// defaultServer returns the server that handles packets that can't be routed.
+	// It returns nil if no server is running.
+	defaultServer func() *baseServer
+
+	receivedPackets chan receivedPacket
+	closed          <-chan struct{}
+
+	nextCleanup time.Time
+	pending     clientHelloQueues
+	routed      map[protocol.ConnectionID]routedConnID
+
+	tracer *logging.Tracer
+	logger utils.Logger
+}
+
+func newListenerRouter(
+	selectServer func(*ClientHelloInfo) *baseServer,
+	defaultServer func() *baseServer,
+	closed <-chan struct{},
+	tracer *logging.Tracer,
+	logger utils.Logger,
+) *listenerRouter {
+	r := &listenerRouter{
+		selectServer:    selectServer,
+		defaultServer:   defaultServer,
+		receivedPackets: make(chan receivedPacket, protocol.MaxServerUnprocessedPackets),
+		closed:          closed,
+		pending:         make(clientHelloQueues),
+		routed:          make(map[protocol.ConnectionID]routedConnID),
+		tracer:          tracer,
+		logger:          logger,
+	}
+	go r.run()
+	return r
+}
+
+func (r *listenerRouter) run() {
+	for {
+		select {
+		case <-r.closed:
+			return
+		case p := <-r.receivedPackets:
+			r.handlePacketImpl(p)
+		}
+	}
+}
+
+func (r *listenerRouter) handlePacket(p receivedPacket) {
+	select {
+	case r.receivedPackets <- p:
+	default:
+		r.logger.Debugf("Dropping packet from %s (%d bytes). Listener router queue full.", p.remoteAddr, p.Size())
+		r.dropPacket(p, logging.PacketTypeNotDetermined, logging.PacketDropDOSPrevention)
+	}
+}
+
+func (r *listenerRouter) handlePacketImpl(p receivedPacket) {
+	if !r.nextCleanup.IsZero() && p.rcvTime.After(r.nextCleanup) {
+		defer r.cleanup(p.rcvTime)
+	}
+
+	v, err := wire.ParseVersion(p.data)
+	if err != nil || !protocol.IsSupportedVersion(protocol.SupportedVersions, v) {
+		// Let the server deal with this packet. It might send a Version Negotiation packet.
+		r.forward(p, r.defaultServer())
+		return
+	}
+	connID, err := wire.ParseConnectionID(p.data, 0)
+	if err != nil {
+		r.dropPacket(p, logging.PacketTypeNotDetermined, logging.PacketDropHeaderParseError)
+		return
+	}
+	if rc, ok := r.routed[connID]; ok && rc.expiration.After(p.rcvTime) {
+		r.forward(p, rc.server)
+		return
+	}
+	if wire.Is0RTTPacket(p.data) {
+		// 0-RTT packets are routed together with the Initial packet that carries the ClientHello.
+		if pending, ok := r.pending[connID]; ok && len(pending.packets) < protocol.Max0RTTQueueLen {
+			pending.packets = append(pending.packets, p)
+			return
+		}
+		r.dropPacket(p, logging.PacketType0RTT, logging.PacketDropDOSPrevention)
+		return
+	}
+	hdr, _, _, err := wire.ParsePacket(p.data)
+	if err != nil || hdr.Type != protocol.PacketTypeInitial {
+		// Let the server deal with this packet. It will drop it.
+		r.forward(p, r.defaultServer())
+		return
+	}
+
+	pending, isNew := r.pending.GetOrCreate(connID, p.rcvTime)
+	if pending == nil {
+		r.dropPacket(p, logging.PacketTypeInitial, logging.PacketDropDOSPrevention)
+		return
+	}
+	if isNew && (r.nextCleanup.IsZero() || r.nextCleanup.After(pending.expiration)) {
+		r.nextCleanup = pending.expiration
+	}
+	ch, err := pending.HandlePacket(p, hdr)
+	if err != nil {
+		r.logger.Debugf("Failed to parse ClientHello from %s: %s", p.remoteAddr, err)
+		r.route(connID, pending, r.defaultServer(), nil, p.rcvTime)
+		return
+	}
+	if ch == nil {
+		// Wait for the remaining parts of the ClientHello.
+		if len(pending.packets) >= protocol.MaxPendingClientHelloPackets {
+			r.route(connID, pending, r.defaultServer(), nil, p.rcvTime)
+		}
+		return
+	}
+	s := r.selectServer(&ClientHelloInfo{
+		RemoteAddr:      p.remoteAddr,
+		ServerName:      ch.ServerName,
+		SupportedProtos: ch.ALPNs,
+		Version:         hdr.Version,
+	})
+	if s == nil {
+		delete(r.pending, connID)
+		// Release all packets but the last one, which is used to send the CONNECTION_REFUSED.
+		for _, p := range pending.packets[:len(pending.packets)-1] {
+			p.buffer.Release()
+		}
+		ds := r.defaultServer()
+		if ds == nil {
+			p.buffer.Release()
+			return
+		}
+		r.logger.Debugf("Refusing connection from %s. No listener for server name %q and ALPNs %q.", p.remoteAddr, ch.ServerName, ch.ALPNs)
+		ds.refuseConnection(p, hdr, logging.ConnectionRefusedNoListener)
+		return
+	}
+	r.route(connID, pending, s, ch, p.rcvTime)
+}
+
+// route forwards the pending packets to the server, and routes subsequent packets for this connection ID to the same server.
+// If the ClientHello was parsed, it is passed to the server along with the first packet,
+// so that the server doesn't need to queue and decrypt the Initial packets again.
+func (r *listenerRouter) route(connID protocol.ConnectionID, pending *pendingClientHello, s *baseServer, ch *handshake.ClientHello, now time.Time) {
+	delete(r.pending, connID)
+	if ch != nil {
+		pending.packets[0].clientHello = ch
+	}
+	for _, p := range pending.packets {
+		r.forward(p, s)
+	}
+	if s == nil {
+		return
+	}
+	if len(r.routed) >= protocol.MaxRoutedConnectionIDs {
+		r.cleanup(now)
+		if len(r.routed) >= protocol.MaxRoutedConnectionIDs {
+			r.logger.Debugf("Not tracking connection ID %s. Too many routed connection attempts.", connID)
+			return
+		}
+	}
+	expiration := now.Add(protocol.RoutedConnectionIDTimeout)
+	r.routed[connID] = routedConnID{server: s, expiration: expiration}
+	if r.nextCleanup.IsZero() || r.nextCleanup.After(expiration) {
+		r.nextCleanup = expiration
+	}
+}
+
+func (r *listenerRouter) forward(p receivedPacket, s *baseServer) {
+	if s == nil {
+		p.buffer.Release()
+		return
+	}
+	s.handlePacket(p)
+}
+
+func (r *listenerRouter) cleanup(now time.Time) {
+	nextCleanup := r.pending.Cleanup(now, func(p receivedPacket) {
+		r.dropPacket(p, logging.PacketTypeNotDetermined, logging.PacketDropDOSPrevention)
+	})
+	for connID, rc := range r.routed {
+		if rc.expiration.After(now) {
+			if nextCleanup.IsZero() || nextCleanup.After(rc.expiration) {
+				nextCleanup = rc.expiration
+			}
+			continue
+		}
+		delete(r.routed, connID)
+	}
+	r.nextCleanup = nextCleanup
+}
+
+func (r *listenerRouter) dropPacket(p receivedPacket, typ logging.PacketType, reason logging.PacketDropReason) {
+	if r.tracer != nil && r.tracer.DroppedPacket != nil {
+		r.tracer.DroppedPacket(p.remoteAddr, typ, p.Size(), reason)
+	}
+	p.buffer.Release()
+}
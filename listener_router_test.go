@@ -0,0 +1,324 @@
+package quic
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/quic-go/quic-go/internal/handshake"
+	"github.com/quic-go/quic-go/internal/protocol"
+	"github.com/quic-go/quic-go/internal/utils"
+	"github.com/quic-go/quic-go/internal/wire"
+	"github.com/quic-go/quic-go/logging"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Listener Routes", func() {
+	It("matches everything if no fields are set", func() {
+		r := &ListenerRoute{}
+		Expect(r.matches(&ClientHelloInfo{})).To(BeTrue())
+		Expect(r.matches(&ClientHelloInfo{ServerName: "quic-go.net", SupportedProtos: []string{"h3"}})).To(BeTrue())
+	})
+
+	It("matches server names", func() {
+		r := &ListenerRoute{ServerNames: []string{"quic-go.net", "*.example.com"}}
+		Expect(r.matches(&ClientHelloInfo{ServerName: "quic-go.net"})).To(BeTrue())
+		Expect(r.matches(&ClientHelloInfo{ServerName: "QUIC-go.NET"})).To(BeTrue())
+		Expect(r.matches(&ClientHelloInfo{ServerName: "www.quic-go.net"})).To(BeFalse())
+		Expect(r.matches(&ClientHelloInfo{ServerName: "foo.example.com"})).To(BeTrue())
+		Expect(r.matches(&ClientHelloInfo{ServerName: "foo.bar.example.com"})).To(BeFalse())
+		Expect(r.matches(&ClientHelloInfo{ServerName: "example.com"})).To(BeFalse())
+		Expect(r.matches(&ClientHelloInfo{})).To(BeFalse())
+	})
+
+	It("matches ALPNs", func() {
+		r := &ListenerRoute{NextProtos: []string{"h3", "doq"}}
+		Expect(r.matches(&ClientHelloInfo{SupportedProtos: []string{"foo", "doq"}})).To(BeTrue())
+		Expect(r.matches(&ClientHelloInfo{SupportedProtos: []string{"foo", "bar"}})).To(BeFalse())
+		Expect(r.matches(&ClientHelloInfo{})).To(BeFalse())
+	})
+
+	It("requires all fields to match", func() {
+		var called bool
+		r := &ListenerRoute{
+			ServerNames: []string{"quic-go.net"},
+			NextProtos:  []string{"h3"},
+			Match: func(info *ClientHelloInfo) bool {
+				called = true
+				return info.RemoteAddr.(*net.UDPAddr).Port == 1234
+			},
+		}
+		Expect(r.matches(&ClientHelloInfo{ServerName: "example.com", SupportedProtos: []string{"h3"}})).To(BeFalse())
+		Expect(called).To(BeFalse())
+		Expect(r.matches(&ClientHelloInfo{ServerName: "quic-go.net", SupportedProtos: []string{"h3"}, RemoteAddr: &net.UDPAddr{Port: 4321}})).To(BeFalse())
+		Expect(called).To(BeTrue())
+		Expect(r.matches(&ClientHelloInfo{ServerName: "quic-go.net", SupportedProtos: []string{"h3"}, RemoteAddr: &net.UDPAddr{Port: 1234}})).To(BeTrue())
+	})
+})
+
+var _ = Describe("Listener Router", func() {
+	const version = protocol.Version1
+	remoteAddr := &net.UDPAddr{IP: net.IPv4(192, 168, 13, 37), Port: 1234}
+
+	getClientHello := func(serverName string, alpns ...string) []byte {
+		conn := tls.QUICClient(&tls.QUICConfig{TLSConfig: &tls.Config{
+			ServerName: serverName,
+			NextProtos: alpns,
+			MinVersion: tls.VersionTLS13,
+		}})
+		conn.SetTransportParameters((&wire.TransportParameters{}).Marshal(protocol.PerspectiveClient))
+		Expect(conn.Start(context.Background())).To(Succeed())
+		defer conn.Close()
+		for {
+			ev := conn.NextEvent()
+			switch ev.Kind {
+			case tls.QUICNoEvent:
+				Fail("didn't receive a ClientHello")
+			case tls.QUICWriteData:
+				return append([]byte{}, ev.Data...)
+			}
+		}
+	}
+
+	// getInitial composes an Initial packet sent by the client.
+	getInitial := func(connID protocol.ConnectionID, pn protocol.PacketNumber, frames ...wire.Frame) receivedPacket {
+		sealer, _ := handshake.NewInitialAEAD(connID, protocol.PerspectiveClient, version)
+		var payload []byte
+		for _, f := range frames {
+			var err error
+			payload, err = f.Append(payload, version)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		payload = append(payload, make([]byte, protocol.MinInitialPacketSize-len(payload))...)
+		hdr := &wire.ExtendedHeader{
+			Header: wire.Header{
+				Type:             protocol.PacketTypeInitial,
+				SrcConnectionID:  protocol.ParseConnectionID([]byte{1, 2, 3, 4}),
+				DestConnectionID: connID,
+				Length:           protocol.ByteCount(len(payload) + 4 + sealer.Overhead()),
+				Version:          version,
+			},
+			PacketNumberLen: protocol.PacketNumberLen4,
+			PacketNumber:    pn,
+		}
+		raw, err := hdr.Append(nil, version)
+		Expect(err).ToNot(HaveOccurred())
+		hdrLen := len(raw)
+		raw = sealer.Seal(raw, payload, pn, raw)
+		sealer.EncryptHeader(raw[hdrLen:hdrLen+16], &raw[0], raw[hdrLen-4:hdrLen])
+		buf := getPacketBuffer()
+		buf.Data = append(buf.Data[:0], raw...)
+		return receivedPacket{
+			remoteAddr: remoteAddr,
+			rcvTime:    time.Now(),
+			data:       buf.Data,
+			buffer:     buf,
+		}
+	}
+
+	newTestServer := func() *baseServer {
+		return &baseServer{
+			receivedPackets:        make(chan receivedPacket, 100),
+			connectionRefusedQueue: make(chan rejectedPacket, 10),
+			logger:                 utils.DefaultLogger,
+		}
+	}
+
+	newRouter := func(selectServer func(*ClientHelloInfo) *baseServer, defaultServer func() *baseServer, tracer *logging.Tracer) *listenerRouter {
+		closed := make(chan struct{})
+		close(closed)
+		return newListenerRouter(selectServer, defaultServer, closed, tracer, utils.DefaultLogger)
+	}
+
+	It("routes a connection attempt based on the ClientHello", func() {
+		s1 := newTestServer()
+		s2 := newTestServer()
+		var info *ClientHelloInfo
+		r := newRouter(
+			func(i *ClientHelloInfo) *baseServer {
+				info = i
+				if i.ServerName == "quic-go.net" {
+					return s2
+				}
+				return s1
+			},
+			func() *baseServer { return s1 },
+			nil,
+		)
+		connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4})
+		r.handlePacketImpl(getInitial(connID, 0, &wire.CryptoFrame{Data: getClientHello("quic-go.net", "h3")}))
+		Expect(info).ToNot(BeNil())
+		Expect(info.ServerName).To(Equal("quic-go.net"))
+		Expect(info.SupportedProtos).To(Equal([]string{"h3"}))
+		Expect(info.RemoteAddr).To(Equal(remoteAddr))
+		Expect(s1.receivedPackets).To(BeEmpty())
+		Expect(s2.receivedPackets).To(HaveLen(1))
+		// subsequent packets are routed to the same server
+		r.handlePacketImpl(getInitial(connID, 1, &wire.PingFrame{}))
+		Expect(s2.receivedPackets).To(HaveLen(2))
+	})
+
+	It("reassembles a ClientHello that spans multiple packets", func() {
+		s := newTestServer()
+		var selected int
+		r := newRouter(
+			func(*ClientHelloInfo) *baseServer { selected++; return s },
+			func() *baseServer { return nil },
+			nil,
+		)
+		connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4})
+		ch := getClientHello("quic-go.net", "h3")
+		r.handlePacketImpl(getInitial(connID, 1, &wire.CryptoFrame{Offset: 100, Data: ch[100:]}))
+		Expect(selected).To(BeZero())
+		Expect(s.receivedPackets).To(BeEmpty())
+		r.handlePacketImpl(getInitial(connID, 0, &wire.CryptoFrame{Data: ch[:100]}))
+		Expect(selected).To(Equal(1))
+		Expect(s.receivedPackets).To(HaveLen(2))
+	})
+
+	It("passes packets that can't be parsed to the default server", func() {
+		s := newTestServer()
+		r := newRouter(
+			func(*ClientHelloInfo) *baseServer { Fail("didn't expect a routing decision"); return nil },
+			func() *baseServer { return s },
+			nil,
+		)
+		connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4})
+		p := getInitial(connID, 0, &wire.CryptoFrame{Data: getClientHello("quic-go.net")})
+		p.data[len(p.data)-1] ^= 0xff // invalidate the AEAD tag
+		r.handlePacketImpl(p)
+		Expect(s.receivedPackets).To(HaveLen(1))
+	})
+
+	It("refuses connection attempts that don't match any listener", func() {
+		s := newTestServer()
+		var refused logging.ConnectionRefusedReason
+		s.tracer = &logging.Tracer{
+			RefusedConnection: func(_ net.Addr, reason logging.ConnectionRefusedReason) { refused = reason },
+		}
+		r := newRouter(
+			func(*ClientHelloInfo) *baseServer { return nil },
+			func() *baseServer { return s },
+			nil,
+		)
+		connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4})
+		r.handlePacketImpl(getInitial(connID, 0, &wire.CryptoFrame{Data: getClientHello("quic-go.net")}))
+		Expect(s.receivedPackets).To(BeEmpty())
+		Expect(s.connectionRefusedQueue).To(HaveLen(1))
+		Expect(refused).To(Equal(logging.ConnectionRefusedNoListener))
+	})
+
+	It("passes the parsed ClientHello to the server", func() {
+		s := newTestServer()
+		r := newRouter(
+			func(*ClientHelloInfo) *baseServer { return s },
+			func() *baseServer { return s },
+			nil,
+		)
+		connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4})
+		ch := getClientHello("quic-go.net", "h3")
+		r.handlePacketImpl(getInitial(connID, 1, &wire.CryptoFrame{Offset: 100, Data: ch[100:]}))
+		r.handlePacketImpl(getInitial(connID, 0, &wire.CryptoFrame{Data: ch[:100]}))
+		Expect(s.receivedPackets).To(HaveLen(2))
+		p := <-s.receivedPackets
+		Expect(p.clientHello).ToNot(BeNil())
+		Expect(p.clientHello.ServerName).To(Equal("quic-go.net"))
+		Expect(p.clientHello.ALPNs).To(Equal([]string{"h3"}))
+		Expect((<-s.receivedPackets).clientHello).To(BeNil())
+	})
+
+	Context("routing subsequent packets", func() {
+		compose0RTTPacket := func(connID protocol.ConnectionID, rcvTime time.Time) receivedPacket {
+			hdr := &wire.ExtendedHeader{
+				Header: wire.Header{
+					Type:             protocol.PacketType0RTT,
+					SrcConnectionID:  protocol.ParseConnectionID([]byte{1, 2, 3, 4}),
+					DestConnectionID: connID,
+					Length:           100,
+					Version:          protocol.Version1,
+				},
+				PacketNumberLen: protocol.PacketNumberLen4,
+			}
+			raw, err := hdr.Append(nil, protocol.Version1)
+			Expect(err).ToNot(HaveOccurred())
+			raw = append(raw, make([]byte, 100)...)
+			buf := getPacketBuffer()
+			buf.Data = append(buf.Data[:0], raw...)
+			return receivedPacket{remoteAddr: remoteAddr, rcvTime: rcvTime, data: buf.Data, buffer: buf}
+		}
+
+		It("routes 0-RTT packets when more connection attempts are in flight than ClientHellos are buffered", func() {
+			s := newTestServer()
+			s.receivedPackets = make(chan receivedPacket, 2*protocol.MaxPendingClientHellos)
+			r := newRouter(
+				func(*ClientHelloInfo) *baseServer { return s },
+				func() *baseServer { return nil },
+				nil,
+			)
+			ch := getClientHello("quic-go.net")
+			now := time.Now()
+			for i := 0; i <= protocol.MaxPendingClientHellos; i++ {
+				connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 0, 0, 0, byte(i)})
+				p := getInitial(connID, 0, &wire.CryptoFrame{Data: ch})
+				p.rcvTime = now
+				r.handlePacketImpl(p)
+			}
+			Expect(s.receivedPackets).To(HaveLen(protocol.MaxPendingClientHellos + 1))
+			r.handlePacketImpl(compose0RTTPacket(protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 0, 0, 0, 0}), now))
+			Expect(s.receivedPackets).To(HaveLen(protocol.MaxPendingClientHellos + 2))
+		})
+
+		It("forgets routed connection IDs after a while", func() {
+			s := newTestServer()
+			var dropped []logging.PacketType
+			r := newRouter(
+				func(*ClientHelloInfo) *baseServer { return s },
+				func() *baseServer { return nil },
+				&logging.Tracer{
+					DroppedPacket: func(_ net.Addr, typ logging.PacketType, _ protocol.ByteCount, _ logging.PacketDropReason) {
+						dropped = append(dropped, typ)
+					},
+				},
+			)
+			connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4})
+			p := getInitial(connID, 0, &wire.CryptoFrame{Data: getClientHello("quic-go.net")})
+			r.handlePacketImpl(p)
+			Expect(r.routed).To(HaveKey(connID))
+			r.handlePacketImpl(compose0RTTPacket(connID, p.rcvTime.Add(protocol.RoutedConnectionIDTimeout/2)))
+			Expect(s.receivedPackets).To(HaveLen(2))
+			r.handlePacketImpl(compose0RTTPacket(connID, p.rcvTime.Add(protocol.RoutedConnectionIDTimeout+time.Millisecond)))
+			Expect(r.routed).To(BeEmpty())
+			Expect(s.receivedPackets).To(HaveLen(2))
+			Expect(dropped).To(Equal([]logging.PacketType{logging.PacketType0RTT}))
+		})
+	})
+
+	It("drops incomplete ClientHellos after a while", func() {
+		s := newTestServer()
+		var dropped []logging.PacketDropReason
+		r := newRouter(
+			func(*ClientHelloInfo) *baseServer { return s },
+			func() *baseServer { return s },
+			&logging.Tracer{
+				DroppedPacket: func(_ net.Addr, _ logging.PacketType, _ protocol.ByteCount, reason logging.PacketDropReason) {
+					dropped = append(dropped, reason)
+				},
+			},
+		)
+		connID1 := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4})
+		connID2 := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 4, 3, 2, 1})
+		ch := getClientHello("quic-go.net")
+		p1 := getInitial(connID1, 1, &wire.CryptoFrame{Offset: 100, Data: ch[100:]})
+		r.handlePacketImpl(p1)
+		Expect(r.pending).To(HaveLen(1))
+		p2 := getInitial(connID2, 0, &wire.CryptoFrame{Data: ch})
+		p2.rcvTime = p1.rcvTime.Add(protocol.MaxClientHelloQueueingDuration + time.Millisecond)
+		r.handlePacketImpl(p2)
+		Expect(r.pending).To(BeEmpty())
+		Expect(dropped).To(Equal([]logging.PacketDropReason{logging.PacketDropDOSPrevention}))
+		Expect(s.receivedPackets).To(HaveLen(1))
+	})
+})
@@ -28,6 +28,7 @@ type ConnectionTracer struct {
 	UpdatedPTOCount                  func(value uint32)
 	UpdatedKeyFromTLS                func(EncryptionLevel, Perspective)
 	UpdatedKey                       func(generation KeyPhase, remote bool)
+	InitiatedKeyUpdate               func(generation KeyPhase, reason KeyUpdateReason) // called before UpdatedKey
 	DroppedEncryptionLevel           func(EncryptionLevel)
 	DroppedKey                       func(generation KeyPhase)
 	SetLossTimer                     func(TimerType, EncryptionLevel, time.Time)
@@ -196,6 +197,13 @@ func NewMultiplexedConnectionTracer(tracers ...*ConnectionTracer) *ConnectionTra
 				}
 			}
 		},
+		InitiatedKeyUpdate: func(generation KeyPhase, reason KeyUpdateReason) {
+			for _, t := range tracers {
+				if t.InitiatedKeyUpdate != nil {
+					t.InitiatedKeyUpdate(generation, reason)
+				}
+			}
+		},
 		DroppedEncryptionLevel: func(encLevel EncryptionLevel) {
 			for _, t := range tracers {
 				if t.DroppedEncryptionLevel != nil {
@@ -64,6 +64,13 @@ var _ = Describe("Tracing", func() {
 				tr2.EXPECT().DroppedPacket(remote, PacketTypeRetry, ByteCount(1024), PacketDropDuplicate)
 				tracer.DroppedPacket(remote, PacketTypeRetry, 1024, PacketDropDuplicate)
 			})
+
+			It("traces the RefusedConnection event", func() {
+				remote := &net.UDPAddr{IP: net.IPv4(4, 3, 2, 1)}
+				tr1.EXPECT().RefusedConnection(remote, ConnectionRefusedRateLimited)
+				tr2.EXPECT().RefusedConnection(remote, ConnectionRefusedRateLimited)
+				tracer.RefusedConnection(remote, ConnectionRefusedRateLimited)
+			})
 		})
 	})
 
@@ -233,6 +240,12 @@ var _ = Describe("Tracing", func() {
 			tracer.UpdatedKey(KeyPhase(42), true)
 		})
 
+		It("traces the InitiatedKeyUpdate event", func() {
+			tr1.EXPECT().InitiatedKeyUpdate(KeyPhase(42), KeyUpdateApplication)
+			tr2.EXPECT().InitiatedKeyUpdate(KeyPhase(42), KeyUpdateApplication)
+			tracer.InitiatedKeyUpdate(KeyPhase(42), KeyUpdateApplication)
+		})
+
 		It("traces the DroppedEncryptionLevel event", func() {
 			tr1.EXPECT().DroppedEncryptionLevel(EncryptionHandshake)
 			tr2.EXPECT().DroppedEncryptionLevel(EncryptionHandshake)
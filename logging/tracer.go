@@ -7,6 +7,7 @@ type Tracer struct {
 	SentPacket                   func(net.Addr, *Header, ByteCount, []Frame)
 	SentVersionNegotiationPacket func(_ net.Addr, dest, src ArbitraryLenConnectionID, _ []VersionNumber)
 	DroppedPacket                func(net.Addr, PacketType, ByteCount, PacketDropReason)
+	RefusedConnection            func(net.Addr, ConnectionRefusedReason)
 }
 
 // NewMultiplexedTracer creates a new tracer that multiplexes events to multiple tracers.
@@ -39,5 +40,12 @@ func NewMultiplexedTracer(tracers ...*Tracer) *Tracer {
 				}
 			}
 		},
+		RefusedConnection: func(remote net.Addr, reason ConnectionRefusedReason) {
+			for _, t := range tracers {
+				if t.RefusedConnection != nil {
+					t.RefusedConnection(remote, reason)
+				}
+			}
+		},
 	}
 }
@@ -58,6 +58,21 @@ const (
 	PacketDropDuplicate
 )
 
+// KeyUpdateReason is the reason why we initiated a key update
+type KeyUpdateReason uint8
+
+const (
+	// KeyUpdateFirst is used for the first key update, which is initiated shortly after the handshake
+	// in order to exercise the key update mechanism
+	KeyUpdateFirst KeyUpdateReason = iota
+	// KeyUpdatePacketLimit is used when the maximum number of packets was sent or received with the current key
+	KeyUpdatePacketLimit
+	// KeyUpdateTimeLimit is used when the current key has been in use for longer than the key update period
+	KeyUpdateTimeLimit
+	// KeyUpdateApplication is used when the key update was requested by the application
+	KeyUpdateApplication
+)
+
 // TimerType is the type of the loss detection timer
 type TimerType uint8
 
@@ -126,3 +141,17 @@ const (
 	// ECNFailedManglingDetected is emitted when the path marks all ECN-marked packets as CE
 	ECNFailedManglingDetected
 )
+
+// ConnectionRefusedReason is the reason why the server refused a connection attempt
+type ConnectionRefusedReason uint8
+
+const (
+	// ConnectionRefusedHandshakeLimit is used when the maximum number of concurrent handshakes was reached
+	ConnectionRefusedHandshakeLimit ConnectionRefusedReason = iota
+	// ConnectionRefusedRateLimited is used when the source subnet exceeded the handshake rate limit
+	ConnectionRefusedRateLimited
+	// ConnectionRefusedAcceptQueueFull is used when the application didn't accept connections fast enough
+	ConnectionRefusedAcceptQueueFull
+	// ConnectionRefusedNoListener is used when no Listener matches the connection attempt
+	ConnectionRefusedNoListener
+)
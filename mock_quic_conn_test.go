@@ -347,6 +347,44 @@ func (c *QUICConnLocalAddrCall) DoAndReturn(f func() net.Addr) *QUICConnLocalAdd
 	return c
 }
 
+// MaxDatagramSize mocks base method.
+func (m *MockQUICConn) MaxDatagramSize() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MaxDatagramSize")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// MaxDatagramSize indicates an expected call of MaxDatagramSize.
+func (mr *MockQUICConnMockRecorder) MaxDatagramSize() *QUICConnMaxDatagramSizeCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MaxDatagramSize", reflect.TypeOf((*MockQUICConn)(nil).MaxDatagramSize))
+	return &QUICConnMaxDatagramSizeCall{Call: call}
+}
+
+// QUICConnMaxDatagramSizeCall wrap *gomock.Call
+type QUICConnMaxDatagramSizeCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *QUICConnMaxDatagramSizeCall) Return(arg0 int) *QUICConnMaxDatagramSizeCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *QUICConnMaxDatagramSizeCall) Do(f func() int) *QUICConnMaxDatagramSizeCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *QUICConnMaxDatagramSizeCall) DoAndReturn(f func() int) *QUICConnMaxDatagramSizeCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // NextConnection mocks base method.
 func (m *MockQUICConn) NextConnection() Connection {
 	m.ctrl.T.Helper()
@@ -656,6 +694,82 @@ func (c *QUICConnSendDatagramCall) DoAndReturn(f func([]byte) error) *QUICConnSe
 	return c
 }
 
+// SendDatagramWithCallback mocks base method.
+func (m *MockQUICConn) SendDatagramWithCallback(arg0 []byte, arg1 func(bool)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendDatagramWithCallback", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SendDatagramWithCallback indicates an expected call of SendDatagramWithCallback.
+func (mr *MockQUICConnMockRecorder) SendDatagramWithCallback(arg0, arg1 any) *QUICConnSendDatagramWithCallbackCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendDatagramWithCallback", reflect.TypeOf((*MockQUICConn)(nil).SendDatagramWithCallback), arg0, arg1)
+	return &QUICConnSendDatagramWithCallbackCall{Call: call}
+}
+
+// QUICConnSendDatagramWithCallbackCall wrap *gomock.Call
+type QUICConnSendDatagramWithCallbackCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *QUICConnSendDatagramWithCallbackCall) Return(arg0 error) *QUICConnSendDatagramWithCallbackCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *QUICConnSendDatagramWithCallbackCall) Do(f func([]byte, func(bool)) error) *QUICConnSendDatagramWithCallbackCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *QUICConnSendDatagramWithCallbackCall) DoAndReturn(f func([]byte, func(bool)) error) *QUICConnSendDatagramWithCallbackCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// UpdateKeys mocks base method.
+func (m *MockQUICConn) UpdateKeys() error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateKeys")
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateKeys indicates an expected call of UpdateKeys.
+func (mr *MockQUICConnMockRecorder) UpdateKeys() *QUICConnUpdateKeysCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateKeys", reflect.TypeOf((*MockQUICConn)(nil).UpdateKeys))
+	return &QUICConnUpdateKeysCall{Call: call}
+}
+
+// QUICConnUpdateKeysCall wrap *gomock.Call
+type QUICConnUpdateKeysCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *QUICConnUpdateKeysCall) Return(arg0 error) *QUICConnUpdateKeysCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *QUICConnUpdateKeysCall) Do(f func() error) *QUICConnUpdateKeysCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *QUICConnUpdateKeysCall) DoAndReturn(f func() error) *QUICConnUpdateKeysCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // closeWithTransportError mocks base method.
 func (m *MockQUICConn) closeWithTransportError(arg0 qerr.TransportErrorCode) {
 	m.ctrl.T.Helper()
@@ -116,6 +116,87 @@ func (c *ReceiveStreamIReadCall) DoAndReturn(f func([]byte) (int, error)) *Recei
 	return c
 }
 
+// ReadChunk mocks base method.
+func (m *MockReceiveStreamI) ReadChunk() ([]byte, func(), error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadChunk")
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(func())
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReadChunk indicates an expected call of ReadChunk.
+func (mr *MockReceiveStreamIMockRecorder) ReadChunk() *ReceiveStreamIReadChunkCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadChunk", reflect.TypeOf((*MockReceiveStreamI)(nil).ReadChunk))
+	return &ReceiveStreamIReadChunkCall{Call: call}
+}
+
+// ReceiveStreamIReadChunkCall wrap *gomock.Call
+type ReceiveStreamIReadChunkCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *ReceiveStreamIReadChunkCall) Return(arg0 []byte, arg1 func(), arg2 error) *ReceiveStreamIReadChunkCall {
+	c.Call = c.Call.Return(arg0, arg1, arg2)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *ReceiveStreamIReadChunkCall) Do(f func() ([]byte, func(), error)) *ReceiveStreamIReadChunkCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *ReceiveStreamIReadChunkCall) DoAndReturn(f func() ([]byte, func(), error)) *ReceiveStreamIReadChunkCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// ReadUnordered mocks base method.
+func (m *MockReceiveStreamI) ReadUnordered() (int64, []byte, func(), error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadUnordered")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].([]byte)
+	ret2, _ := ret[2].(func())
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// ReadUnordered indicates an expected call of ReadUnordered.
+func (mr *MockReceiveStreamIMockRecorder) ReadUnordered() *ReceiveStreamIReadUnorderedCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadUnordered", reflect.TypeOf((*MockReceiveStreamI)(nil).ReadUnordered))
+	return &ReceiveStreamIReadUnorderedCall{Call: call}
+}
+
+// ReceiveStreamIReadUnorderedCall wrap *gomock.Call
+type ReceiveStreamIReadUnorderedCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *ReceiveStreamIReadUnorderedCall) Return(arg0 int64, arg1 []byte, arg2 func(), arg3 error) *ReceiveStreamIReadUnorderedCall {
+	c.Call = c.Call.Return(arg0, arg1, arg2, arg3)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *ReceiveStreamIReadUnorderedCall) Do(f func() (int64, []byte, func(), error)) *ReceiveStreamIReadUnorderedCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *ReceiveStreamIReadUnorderedCall) DoAndReturn(f func() (int64, []byte, func(), error)) *ReceiveStreamIReadUnorderedCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // SetReadDeadline mocks base method.
 func (m *MockReceiveStreamI) SetReadDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -154,6 +235,42 @@ func (c *ReceiveStreamISetReadDeadlineCall) DoAndReturn(f func(time.Time) error)
 	return c
 }
 
+// SetReceiveWindow mocks base method.
+func (m *MockReceiveStreamI) SetReceiveWindow(arg0, arg1 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetReceiveWindow", arg0, arg1)
+}
+
+// SetReceiveWindow indicates an expected call of SetReceiveWindow.
+func (mr *MockReceiveStreamIMockRecorder) SetReceiveWindow(arg0, arg1 any) *ReceiveStreamISetReceiveWindowCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReceiveWindow", reflect.TypeOf((*MockReceiveStreamI)(nil).SetReceiveWindow), arg0, arg1)
+	return &ReceiveStreamISetReceiveWindowCall{Call: call}
+}
+
+// ReceiveStreamISetReceiveWindowCall wrap *gomock.Call
+type ReceiveStreamISetReceiveWindowCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *ReceiveStreamISetReceiveWindowCall) Return() *ReceiveStreamISetReceiveWindowCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *ReceiveStreamISetReceiveWindowCall) Do(f func(uint64, uint64)) *ReceiveStreamISetReceiveWindowCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *ReceiveStreamISetReceiveWindowCall) DoAndReturn(f func(uint64, uint64)) *ReceiveStreamISetReceiveWindowCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // StreamID mocks base method.
 func (m *MockReceiveStreamI) StreamID() protocol.StreamID {
 	m.ctrl.T.Helper()
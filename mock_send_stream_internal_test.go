@@ -155,6 +155,42 @@ func (c *SendStreamIContextCall) DoAndReturn(f func() context.Context) *SendStre
 	return c
 }
 
+// SetSendBufferSize mocks base method.
+func (m *MockSendStreamI) SetSendBufferSize(arg0 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetSendBufferSize", arg0)
+}
+
+// SetSendBufferSize indicates an expected call of SetSendBufferSize.
+func (mr *MockSendStreamIMockRecorder) SetSendBufferSize(arg0 any) *SendStreamISetSendBufferSizeCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSendBufferSize", reflect.TypeOf((*MockSendStreamI)(nil).SetSendBufferSize), arg0)
+	return &SendStreamISetSendBufferSizeCall{Call: call}
+}
+
+// SendStreamISetSendBufferSizeCall wrap *gomock.Call
+type SendStreamISetSendBufferSizeCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *SendStreamISetSendBufferSizeCall) Return() *SendStreamISetSendBufferSizeCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *SendStreamISetSendBufferSizeCall) Do(f func(uint64)) *SendStreamISetSendBufferSizeCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *SendStreamISetSendBufferSizeCall) DoAndReturn(f func(uint64)) *SendStreamISetSendBufferSizeCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // SetWriteDeadline mocks base method.
 func (m *MockSendStreamI) SetWriteDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -230,6 +230,87 @@ func (c *StreamIReadCall) DoAndReturn(f func([]byte) (int, error)) *StreamIReadC
 	return c
 }
 
+// ReadChunk mocks base method.
+func (m *MockStreamI) ReadChunk() ([]byte, func(), error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadChunk")
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(func())
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ReadChunk indicates an expected call of ReadChunk.
+func (mr *MockStreamIMockRecorder) ReadChunk() *StreamIReadChunkCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadChunk", reflect.TypeOf((*MockStreamI)(nil).ReadChunk))
+	return &StreamIReadChunkCall{Call: call}
+}
+
+// StreamIReadChunkCall wrap *gomock.Call
+type StreamIReadChunkCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *StreamIReadChunkCall) Return(arg0 []byte, arg1 func(), arg2 error) *StreamIReadChunkCall {
+	c.Call = c.Call.Return(arg0, arg1, arg2)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *StreamIReadChunkCall) Do(f func() ([]byte, func(), error)) *StreamIReadChunkCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *StreamIReadChunkCall) DoAndReturn(f func() ([]byte, func(), error)) *StreamIReadChunkCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// ReadUnordered mocks base method.
+func (m *MockStreamI) ReadUnordered() (int64, []byte, func(), error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadUnordered")
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].([]byte)
+	ret2, _ := ret[2].(func())
+	ret3, _ := ret[3].(error)
+	return ret0, ret1, ret2, ret3
+}
+
+// ReadUnordered indicates an expected call of ReadUnordered.
+func (mr *MockStreamIMockRecorder) ReadUnordered() *StreamIReadUnorderedCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadUnordered", reflect.TypeOf((*MockStreamI)(nil).ReadUnordered))
+	return &StreamIReadUnorderedCall{Call: call}
+}
+
+// StreamIReadUnorderedCall wrap *gomock.Call
+type StreamIReadUnorderedCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *StreamIReadUnorderedCall) Return(arg0 int64, arg1 []byte, arg2 func(), arg3 error) *StreamIReadUnorderedCall {
+	c.Call = c.Call.Return(arg0, arg1, arg2, arg3)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *StreamIReadUnorderedCall) Do(f func() (int64, []byte, func(), error)) *StreamIReadUnorderedCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *StreamIReadUnorderedCall) DoAndReturn(f func() (int64, []byte, func(), error)) *StreamIReadUnorderedCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // SetDeadline mocks base method.
 func (m *MockStreamI) SetDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -306,6 +387,78 @@ func (c *StreamISetReadDeadlineCall) DoAndReturn(f func(time.Time) error) *Strea
 	return c
 }
 
+// SetReceiveWindow mocks base method.
+func (m *MockStreamI) SetReceiveWindow(arg0, arg1 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetReceiveWindow", arg0, arg1)
+}
+
+// SetReceiveWindow indicates an expected call of SetReceiveWindow.
+func (mr *MockStreamIMockRecorder) SetReceiveWindow(arg0, arg1 any) *StreamISetReceiveWindowCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReceiveWindow", reflect.TypeOf((*MockStreamI)(nil).SetReceiveWindow), arg0, arg1)
+	return &StreamISetReceiveWindowCall{Call: call}
+}
+
+// StreamISetReceiveWindowCall wrap *gomock.Call
+type StreamISetReceiveWindowCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *StreamISetReceiveWindowCall) Return() *StreamISetReceiveWindowCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *StreamISetReceiveWindowCall) Do(f func(uint64, uint64)) *StreamISetReceiveWindowCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *StreamISetReceiveWindowCall) DoAndReturn(f func(uint64, uint64)) *StreamISetReceiveWindowCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// SetSendBufferSize mocks base method.
+func (m *MockStreamI) SetSendBufferSize(arg0 uint64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetSendBufferSize", arg0)
+}
+
+// SetSendBufferSize indicates an expected call of SetSendBufferSize.
+func (mr *MockStreamIMockRecorder) SetSendBufferSize(arg0 any) *StreamISetSendBufferSizeCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetSendBufferSize", reflect.TypeOf((*MockStreamI)(nil).SetSendBufferSize), arg0)
+	return &StreamISetSendBufferSizeCall{Call: call}
+}
+
+// StreamISetSendBufferSizeCall wrap *gomock.Call
+type StreamISetSendBufferSizeCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *StreamISetSendBufferSizeCall) Return() *StreamISetSendBufferSizeCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *StreamISetSendBufferSizeCall) Do(f func(uint64)) *StreamISetSendBufferSizeCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *StreamISetSendBufferSizeCall) DoAndReturn(f func(uint64)) *StreamISetSendBufferSizeCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // SetWriteDeadline mocks base method.
 func (m *MockStreamI) SetWriteDeadline(arg0 time.Time) error {
 	m.ctrl.T.Helper()
@@ -95,7 +95,7 @@ var _ = Describe("Packet packer", func() {
 		ackFramer = NewMockAckFrameSource(mockCtrl)
 		sealingManager = NewMockSealingManager(mockCtrl)
 		pnManager = mockackhandler.NewMockSentPacketHandler(mockCtrl)
-		datagramQueue = newDatagramQueue(func() {}, utils.DefaultLogger)
+		datagramQueue = newDatagramQueue(func() {}, protocol.DefaultDatagramSendQueueLen, protocol.DefaultDatagramReceiveQueueLen, DatagramQueueBlock, DatagramQueueBlock, utils.DefaultLogger)
 
 		packer = newPacketPacker(protocol.ParseConnectionID([]byte{1, 2, 3, 4, 5, 6, 7, 8}), func() protocol.ConnectionID { return connID }, initialStream, handshakeStream, pnManager, retransmissionQueue, sealingManager, framer, ackFramer, datagramQueue, protocol.PerspectiveServer)
 	})
@@ -598,11 +598,12 @@ var _ = Describe("Packet packer", func() {
 					DataLenPresent: true,
 					Data:           []byte("foobar"),
 				}
+				acked := make(chan bool, 1)
 				done := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
 					defer close(done)
-					datagramQueue.Add(f)
+					datagramQueue.Add(f, datagramAckHandler(func(a bool) { acked <- a }))
 				}()
 				// make sure the DATAGRAM has actually been queued
 				time.Sleep(scaleDuration(20 * time.Millisecond))
@@ -615,6 +616,9 @@ var _ = Describe("Packet packer", func() {
 				Expect(p.Frames[0].Frame).To(Equal(f))
 				Expect(buffer.Data).ToNot(BeEmpty())
 				Eventually(done).Should(BeClosed())
+				Expect(p.Frames[0].Handler).ToNot(BeNil())
+				p.Frames[0].Handler.OnAcked(f)
+				Expect(acked).To(Receive(BeTrue()))
 			})
 
 			It("doesn't pack a DATAGRAM frame if the ACK frame is too large", func() {
@@ -630,7 +634,7 @@ var _ = Describe("Packet packer", func() {
 				go func() {
 					defer GinkgoRecover()
 					defer close(done)
-					datagramQueue.Add(f)
+					datagramQueue.Add(f, nil)
 				}()
 				// make sure the DATAGRAM has actually been queued
 				time.Sleep(scaleDuration(20 * time.Millisecond))
@@ -655,11 +659,12 @@ var _ = Describe("Packet packer", func() {
 					DataLenPresent: true,
 					Data:           make([]byte, maxPacketSize+10), // won't fit
 				}
+				acked := make(chan bool, 1)
 				done := make(chan struct{})
 				go func() {
 					defer GinkgoRecover()
 					defer close(done)
-					datagramQueue.Add(f)
+					datagramQueue.Add(f, datagramAckHandler(func(a bool) { acked <- a }))
 				}()
 				// make sure the DATAGRAM has actually been queued
 				time.Sleep(scaleDuration(20 * time.Millisecond))
@@ -672,6 +677,7 @@ var _ = Describe("Packet packer", func() {
 				Expect(p.Ack).To(BeNil())
 				Expect(datagramQueue.Peek()).To(BeNil())
 				Eventually(done).Should(BeClosed())
+				Expect(acked).To(Receive(BeFalse()))
 			})
 
 			It("accounts for the space consumed by control frames", func() {
@@ -61,6 +61,11 @@ type connectionTracer struct {
 	runStopped chan struct{}
 
 	lastMetrics *metrics
+
+	// set by InitiatedKeyUpdate, used for the key_updated events logged by the subsequent UpdatedKey call
+	initiatedKeyUpdate        bool
+	initiatedKeyUpdateGen     protocol.KeyPhase
+	initiatedKeyUpdateTrigger keyUpdateTrigger
 }
 
 // NewConnectionTracer creates a new tracer to record a qlog for a connection.
@@ -127,6 +132,9 @@ func NewConnectionTracer(w io.WriteCloser, p protocol.Perspective, odcid protoco
 		UpdatedKey: func(generation protocol.KeyPhase, remote bool) {
 			t.UpdatedKey(generation, remote)
 		},
+		InitiatedKeyUpdate: func(generation protocol.KeyPhase, reason logging.KeyUpdateReason) {
+			t.InitiatedKeyUpdate(generation, reason)
+		},
 		DroppedEncryptionLevel: func(encLevel protocol.EncryptionLevel) {
 			t.DroppedEncryptionLevel(encLevel)
 		},
@@ -510,12 +518,25 @@ func (t *connectionTracer) UpdatedKeyFromTLS(encLevel protocol.EncryptionLevel,
 	t.mutex.Unlock()
 }
 
+// InitiatedKeyUpdate is called right before UpdatedKey, for key updates that we initiated.
+// The reason is recorded as the trigger of the key_updated events.
+func (t *connectionTracer) InitiatedKeyUpdate(generation protocol.KeyPhase, reason logging.KeyUpdateReason) {
+	t.mutex.Lock()
+	t.initiatedKeyUpdate = true
+	t.initiatedKeyUpdateGen = generation
+	t.initiatedKeyUpdateTrigger = keyUpdateTriggerFromReason(reason)
+	t.mutex.Unlock()
+}
+
 func (t *connectionTracer) UpdatedKey(generation protocol.KeyPhase, remote bool) {
+	t.mutex.Lock()
 	trigger := keyUpdateLocal
 	if remote {
 		trigger = keyUpdateRemote
+	} else if t.initiatedKeyUpdate && t.initiatedKeyUpdateGen == generation {
+		trigger = t.initiatedKeyUpdateTrigger
 	}
-	t.mutex.Lock()
+	t.initiatedKeyUpdate = false
 	now := time.Now()
 	t.recordEvent(now, &eventKeyUpdated{
 		Trigger:    trigger,
@@ -795,6 +795,28 @@ var _ = Describe("Tracing", func() {
 				Expect(keyTypes).To(ContainElement("client_1rtt_secret"))
 			})
 
+			It("records the reason for key updates that we initiated", func() {
+				tracer.InitiatedKeyUpdate(42, logging.KeyUpdatePacketLimit)
+				tracer.UpdatedKey(42, false)
+				entries := exportAndParse()
+				Expect(entries).To(HaveLen(2))
+				for _, entry := range entries {
+					Expect(entry.Name).To(Equal("security:key_updated"))
+					ev := entry.Event
+					Expect(ev).To(HaveKeyWithValue("generation", float64(42)))
+					Expect(ev).To(HaveKeyWithValue("trigger", "local_update_packet_limit"))
+				}
+			})
+
+			It("records key updates that we initiated without a reason", func() {
+				tracer.UpdatedKey(42, false)
+				entries := exportAndParse()
+				Expect(entries).To(HaveLen(2))
+				for _, entry := range entries {
+					Expect(entry.Event).To(HaveKeyWithValue("trigger", "local_update"))
+				}
+			})
+
 			It("records dropped encryption levels", func() {
 				tracer.DroppedEncryptionLevel(protocol.EncryptionInitial)
 				entries := exportAndParse()
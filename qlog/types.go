@@ -156,8 +156,30 @@ const (
 	keyUpdateTLS keyUpdateTrigger = iota
 	keyUpdateRemote
 	keyUpdateLocal
+	// The following triggers extend the qlog schema.
+	// They are used for key updates that we initiated, and carry the reason for the key update.
+	keyUpdateLocalFirst
+	keyUpdateLocalPacketLimit
+	keyUpdateLocalTimeLimit
+	keyUpdateLocalApplication
 )
 
+// keyUpdateTriggerFromReason returns the trigger for a key update that we initiated.
+func keyUpdateTriggerFromReason(r logging.KeyUpdateReason) keyUpdateTrigger {
+	switch r {
+	case logging.KeyUpdateFirst:
+		return keyUpdateLocalFirst
+	case logging.KeyUpdatePacketLimit:
+		return keyUpdateLocalPacketLimit
+	case logging.KeyUpdateTimeLimit:
+		return keyUpdateLocalTimeLimit
+	case logging.KeyUpdateApplication:
+		return keyUpdateLocalApplication
+	default:
+		return keyUpdateLocal
+	}
+}
+
 func (t keyUpdateTrigger) String() string {
 	switch t {
 	case keyUpdateTLS:
@@ -166,6 +188,14 @@ func (t keyUpdateTrigger) String() string {
 		return "remote_update"
 	case keyUpdateLocal:
 		return "local_update"
+	case keyUpdateLocalFirst:
+		return "local_update_first"
+	case keyUpdateLocalPacketLimit:
+		return "local_update_packet_limit"
+	case keyUpdateLocalTimeLimit:
+		return "local_update_time_limit"
+	case keyUpdateLocalApplication:
+		return "local_update_application"
 	default:
 		return "unknown key update trigger"
 	}
@@ -209,6 +239,8 @@ func (e transportError) String() string {
 		return "aead_limit_reached"
 	case qerr.NoViablePathError:
 		return "no_viable_path"
+	case qerr.VersionNegotiationErrorErrorCode:
+		return "version_negotiation_error"
 	default:
 		return ""
 	}
@@ -73,6 +73,10 @@ var _ = Describe("Types", func() {
 		Expect(keyUpdateTLS.String()).To(Equal("tls"))
 		Expect(keyUpdateRemote.String()).To(Equal("remote_update"))
 		Expect(keyUpdateLocal.String()).To(Equal("local_update"))
+		Expect(keyUpdateTriggerFromReason(logging.KeyUpdateFirst).String()).To(Equal("local_update_first"))
+		Expect(keyUpdateTriggerFromReason(logging.KeyUpdatePacketLimit).String()).To(Equal("local_update_packet_limit"))
+		Expect(keyUpdateTriggerFromReason(logging.KeyUpdateTimeLimit).String()).To(Equal("local_update_time_limit"))
+		Expect(keyUpdateTriggerFromReason(logging.KeyUpdateApplication).String()).To(Equal("local_update_application"))
 	})
 
 	It("tells the packet number space from the encryption level", func() {
@@ -117,6 +121,7 @@ var _ = Describe("Types", func() {
 			Expect(transportError(qerr.ApplicationErrorErrorCode).String()).To(Equal("application_error"))
 			Expect(transportError(qerr.CryptoBufferExceeded).String()).To(Equal("crypto_buffer_exceeded"))
 			Expect(transportError(qerr.NoViablePathError).String()).To(Equal("no_viable_path"))
+			Expect(transportError(qerr.VersionNegotiationErrorErrorCode).String()).To(Equal("version_negotiation_error"))
 			Expect(transportError(1337).String()).To(BeEmpty())
 		})
 	})
@@ -0,0 +1,123 @@
+package quiclb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+)
+
+// A cidCipher encrypts and decrypts the server ID and nonce part of a connection ID.
+// Depending on the configuration, it uses one of the three QUIC-LB algorithms:
+// * plaintext: if no key is configured
+// * single-pass encryption: if the server ID and nonce add up to exactly 16 bytes
+// * four-pass encryption: a four-round Feistel network using AES-ECB as the round function, otherwise
+type cidCipher struct {
+	block cipher.Block // nil for plaintext connection IDs
+	len   int          // length of server ID and nonce
+}
+
+func newCIDCipher(c *Config) (*cidCipher, error) {
+	cc := &cidCipher{len: c.ServerIDLen + c.NonceLen}
+	if c.Key != nil {
+		block, err := aes.NewCipher(c.Key)
+		if err != nil {
+			return nil, err
+		}
+		cc.block = block
+	}
+	return cc, nil
+}
+
+// Encrypt encrypts the plaintext (the concatenation of server ID and nonce) to dst.
+// dst and plaintext may overlap entirely.
+func (c *cidCipher) Encrypt(dst, plaintext []byte) {
+	switch {
+	case c.block == nil:
+		copy(dst, plaintext[:c.len])
+	case c.len == aes.BlockSize:
+		c.block.Encrypt(dst, plaintext)
+	default:
+		left, right := c.split(plaintext)
+		c.round(right, left, 1)
+		c.round(left, right, 2)
+		c.round(right, left, 3)
+		c.round(left, right, 4)
+		c.join(dst, left, right)
+	}
+}
+
+// Decrypt decrypts the ciphertext to dst.
+// dst and ciphertext may overlap entirely.
+func (c *cidCipher) Decrypt(dst, ciphertext []byte) {
+	switch {
+	case c.block == nil:
+		copy(dst, ciphertext[:c.len])
+	case c.len == aes.BlockSize:
+		c.block.Decrypt(dst, ciphertext)
+	default:
+		left, right := c.split(ciphertext)
+		c.round(left, right, 4)
+		c.round(right, left, 3)
+		c.round(left, right, 2)
+		c.round(right, left, 1)
+		c.join(dst, left, right)
+	}
+}
+
+func (c *cidCipher) halfLen() int { return (c.len + 1) / 2 }
+
+// split splits b into two halves of equal length.
+// If the length is odd, the octet in the middle is split:
+// its most significant 4 bits become part of the left half, the least significant 4 bits part of the right half.
+func (c *cidCipher) split(b []byte) (left, right []byte) {
+	l := c.halfLen()
+	left = make([]byte, l)
+	right = make([]byte, l)
+	copy(left, b[:l])
+	copy(right, b[c.len-l:c.len])
+	c.mask(left, right)
+	return left, right
+}
+
+func (c *cidCipher) join(dst, left, right []byte) {
+	l := c.halfLen()
+	if c.len%2 == 0 {
+		copy(dst, left)
+		copy(dst[l:], right)
+		return
+	}
+	copy(dst, left[:l-1])
+	dst[l-1] = left[l-1] | right[0]
+	copy(dst[l:], right[1:])
+}
+
+// mask clears the bits that don't belong to the respective half, if the length is odd.
+func (c *cidCipher) mask(left, right []byte) {
+	if c.len%2 == 0 {
+		return
+	}
+	if left != nil {
+		left[len(left)-1] &= 0xf0
+	}
+	if right != nil {
+		right[0] &= 0x0f
+	}
+}
+
+// round XORs dst with the AES-ECB encryption of the expanded src.
+func (c *cidCipher) round(dst, src []byte, pass byte) {
+	// expand the input to 16 bytes:
+	// the half, followed by zero padding, the length of server ID and nonce, and the pass number
+	var buf [aes.BlockSize]byte
+	copy(buf[:], src)
+	buf[aes.BlockSize-2] = byte(c.len)
+	buf[aes.BlockSize-1] = pass
+	c.block.Encrypt(buf[:], buf[:])
+	for i := range dst {
+		dst[i] ^= buf[i]
+	}
+	if pass%2 == 1 { // odd passes modify the right half
+		c.mask(nil, dst)
+	} else {
+		c.mask(dst, nil)
+	}
+}
@@ -0,0 +1,111 @@
+package quiclb
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/hex"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// test vectors from draft-ietf-quic-load-balancers, Appendix B
+var testVectorKey = mustDecodeHex("8f95f09245765f80256934e50c66207f")
+
+var testVectors = []struct {
+	config   *Config
+	serverID string
+	nonce    string
+	connID   string
+}{
+	{
+		config:   &Config{ID: 0, ServerIDLen: 3, NonceLen: 4, Key: testVectorKey, EncodeLength: true},
+		serverID: "ed793a",
+		nonce:    "ee080dbf",
+		connID:   "0720b1d07b359d3c",
+	},
+	{
+		config:   &Config{ID: 1, ServerIDLen: 10, NonceLen: 5, Key: testVectorKey},
+		serverID: "ed793a51d49b8f5fab65",
+		nonce:    "ee080dbf48",
+		connID:   "2fcc381bc74cb4fbad2823a3d1f8fed2",
+	},
+	{
+		config:   &Config{ID: 2, ServerIDLen: 8, NonceLen: 8, Key: testVectorKey, EncodeLength: true},
+		serverID: "ed793a51d49b8f5f",
+		nonce:    "ee080dbf48c0d1e5",
+		connID:   "504dd2d05a7b0de9b2b9907afb5ecf8cc3",
+	},
+	{
+		config:   &Config{ID: 0, ServerIDLen: 9, NonceLen: 9, Key: testVectorKey, EncodeLength: true},
+		serverID: "ed793a51d49b8f5fab",
+		nonce:    "ee080dbf48c0d1e55d",
+		connID:   "125779c9cc86beb3a3a4a3ca96fce4bfe0cdbc",
+	},
+}
+
+var _ = Describe("Connection ID cipher", func() {
+	for i := range testVectors {
+		v := testVectors[i]
+
+		It("encrypts and decrypts the test vectors", func() {
+			c, err := newCIDCipher(v.config)
+			Expect(err).ToNot(HaveOccurred())
+			plaintext := append(mustDecodeHex(v.serverID), mustDecodeHex(v.nonce)...)
+			ciphertext := make([]byte, len(plaintext))
+			c.Encrypt(ciphertext, plaintext)
+			connID := mustDecodeHex(v.connID)
+			Expect(connID[0]).To(Equal(v.config.firstOctet(connID[0])))
+			Expect(ciphertext).To(Equal(connID[1:]))
+			decrypted := make([]byte, len(ciphertext))
+			c.Decrypt(decrypted, ciphertext)
+			Expect(decrypted).To(Equal(plaintext))
+		})
+	}
+
+	It("doesn't encrypt if no key is configured", func() {
+		c, err := newCIDCipher(&Config{ServerIDLen: 2, NonceLen: 4})
+		Expect(err).ToNot(HaveOccurred())
+		b := []byte{1, 2, 3, 4, 5, 6}
+		c.Encrypt(b, b)
+		Expect(b).To(Equal([]byte{1, 2, 3, 4, 5, 6}))
+	})
+
+	It("uses single-pass encryption for 16 byte plaintexts", func() {
+		c, err := newCIDCipher(&Config{ServerIDLen: 6, NonceLen: 10, Key: testVectorKey})
+		Expect(err).ToNot(HaveOccurred())
+		plaintext := make([]byte, 16)
+		rand.Read(plaintext)
+		ciphertext := make([]byte, 16)
+		c.Encrypt(ciphertext, plaintext)
+		block, err := aes.NewCipher(testVectorKey)
+		Expect(err).ToNot(HaveOccurred())
+		expected := make([]byte, 16)
+		block.Encrypt(expected, plaintext)
+		Expect(ciphertext).To(Equal(expected))
+	})
+
+	It("encrypts and decrypts for all valid lengths", func() {
+		for sidLen := minServerIDLen; sidLen <= maxServerIDLen; sidLen++ {
+			for nonceLen := minNonceLen; nonceLen <= maxNonceLen && sidLen+nonceLen <= maxServerIDAndNonceLen; nonceLen++ {
+				c, err := newCIDCipher(&Config{ServerIDLen: sidLen, NonceLen: nonceLen, Key: testVectorKey})
+				Expect(err).ToNot(HaveOccurred())
+				plaintext := make([]byte, sidLen+nonceLen)
+				rand.Read(plaintext)
+				b := make([]byte, len(plaintext))
+				c.Encrypt(b, plaintext)
+				Expect(b).ToNot(Equal(plaintext))
+				c.Decrypt(b, b)
+				Expect(b).To(Equal(plaintext))
+			}
+		}
+	})
+})
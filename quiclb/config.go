@@ -0,0 +1,76 @@
+// Package quiclb implements the connection ID encodings of QUIC-LB (draft-ietf-quic-load-balancers),
+// which allow a layer-4 load balancer to route QUIC packets to the server that generated the connection ID,
+// without keeping any per-connection state.
+package quiclb
+
+import (
+	"crypto/aes"
+	"errors"
+	"fmt"
+)
+
+// UnroutableConfigID is the config ID used for connection IDs that can't be routed by the load balancer.
+const UnroutableConfigID = 0b111
+
+const (
+	minServerIDLen = 1
+	maxServerIDLen = 15
+	minNonceLen    = 4
+	maxNonceLen    = 18
+	// The first octet, server ID and nonce have to fit into a 20 byte connection ID.
+	maxServerIDAndNonceLen = 19
+)
+
+// A Config is a QUIC-LB configuration.
+// It is shared between the load balancer and the servers behind it.
+type Config struct {
+	// ID is the config ID.
+	// It is encoded in the config rotation bits, the 3 most significant bits of the first octet of the connection ID.
+	// Valid values are 0 to 6, the value 7 (UnroutableConfigID) is reserved for unroutable connection IDs.
+	ID uint8
+	// ServerIDLen is the length of the server ID, in bytes.
+	// It must be between 1 and 15.
+	ServerIDLen int
+	// NonceLen is the length of the nonce, in bytes.
+	// It must be between 4 and 18, and ServerIDLen + NonceLen must not exceed 19.
+	NonceLen int
+	// Key is the AES-128 key used to encrypt the server ID and the nonce.
+	// If nil, connection IDs are not encrypted, and the server ID is visible to observers.
+	Key []byte
+	// EncodeLength says if the length of the connection ID is encoded in the
+	// 5 least significant bits of the first octet.
+	// If false, these bits are set randomly.
+	EncodeLength bool
+}
+
+func (c *Config) validate() error {
+	if c.ID >= UnroutableConfigID {
+		return fmt.Errorf("quiclb: invalid config ID %d", c.ID)
+	}
+	if c.ServerIDLen < minServerIDLen || c.ServerIDLen > maxServerIDLen {
+		return fmt.Errorf("quiclb: invalid server ID length %d", c.ServerIDLen)
+	}
+	if c.NonceLen < minNonceLen || c.NonceLen > maxNonceLen {
+		return fmt.Errorf("quiclb: invalid nonce length %d", c.NonceLen)
+	}
+	if c.ServerIDLen+c.NonceLen > maxServerIDAndNonceLen {
+		return errors.New("quiclb: server ID and nonce too long")
+	}
+	if c.Key != nil && len(c.Key) != aes.BlockSize {
+		return fmt.Errorf("quiclb: invalid key length %d", len(c.Key))
+	}
+	return nil
+}
+
+// ConnectionIDLen returns the length of the connection IDs generated using this config.
+func (c *Config) ConnectionIDLen() int {
+	return 1 + c.ServerIDLen + c.NonceLen
+}
+
+func (c *Config) firstOctet(random byte) byte {
+	b := c.ID << 5
+	if c.EncodeLength {
+		return b | byte(c.ConnectionIDLen()-1)
+	}
+	return b | random&0x1f
+}
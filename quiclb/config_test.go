@@ -0,0 +1,31 @@
+package quiclb
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	It("accepts valid configs", func() {
+		Expect((&Config{ID: 6, ServerIDLen: 1, NonceLen: 18}).validate()).To(Succeed())
+		Expect((&Config{ServerIDLen: 15, NonceLen: 4, Key: make([]byte, 16)}).validate()).To(Succeed())
+	})
+
+	It("rejects invalid configs", func() {
+		Expect((&Config{ID: 7, ServerIDLen: 3, NonceLen: 4}).validate()).To(MatchError("quiclb: invalid config ID 7"))
+		Expect((&Config{ServerIDLen: 0, NonceLen: 4}).validate()).To(MatchError("quiclb: invalid server ID length 0"))
+		Expect((&Config{ServerIDLen: 16, NonceLen: 4}).validate()).To(MatchError("quiclb: invalid server ID length 16"))
+		Expect((&Config{ServerIDLen: 3, NonceLen: 3}).validate()).To(MatchError("quiclb: invalid nonce length 3"))
+		Expect((&Config{ServerIDLen: 2, NonceLen: 18}).validate()).To(MatchError("quiclb: server ID and nonce too long"))
+		Expect((&Config{ServerIDLen: 3, NonceLen: 4, Key: make([]byte, 32)}).validate()).To(MatchError("quiclb: invalid key length 32"))
+	})
+
+	It("encodes the config ID and the length in the first octet", func() {
+		c := &Config{ID: 5, ServerIDLen: 3, NonceLen: 4, EncodeLength: true}
+		Expect(c.ConnectionIDLen()).To(Equal(8))
+		Expect(c.firstOctet(0xff)).To(Equal(byte(0b101_00111)))
+		c.EncodeLength = false
+		Expect(c.firstOctet(0xff)).To(Equal(byte(0b101_11111)))
+		Expect(c.firstOctet(0x42)).To(Equal(byte(0b101_00010)))
+	})
+})
@@ -0,0 +1,106 @@
+package quiclb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/quic-go/quic-go/internal/wire"
+)
+
+// ErrUnroutable is returned by the Decoder if a connection ID can't be decoded.
+// This is the case for connection IDs using the unroutable config ID, or a config ID unknown to the Decoder,
+// and for connection IDs that are too short for the config.
+// Packets carrying such connection IDs can be routed using a fallback algorithm,
+// for example by hashing the 4-tuple.
+var ErrUnroutable = errors.New("quiclb: unroutable connection ID")
+
+type decoderConfig struct {
+	config *Config
+	cipher *cidCipher
+}
+
+// A Decoder decodes the server ID from connection IDs generated by a Generator.
+// It is intended to be used by a load balancer, and doesn't keep any per-connection state.
+// It is safe for concurrent use.
+type Decoder struct {
+	configs [UnroutableConfigID]*decoderConfig
+}
+
+// NewDecoder creates a new Decoder.
+// During a config rotation, servers might use multiple configs at the same time.
+// The Decoder can decode connection IDs for all configs passed to it, as long as they use different config IDs.
+func NewDecoder(configs ...*Config) (*Decoder, error) {
+	d := &Decoder{}
+	for _, c := range configs {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+		if d.configs[c.ID] != nil {
+			return nil, fmt.Errorf("quiclb: duplicate config ID %d", c.ID)
+		}
+		cc, err := newCIDCipher(c)
+		if err != nil {
+			return nil, err
+		}
+		d.configs[c.ID] = &decoderConfig{config: c, cipher: cc}
+	}
+	return d, nil
+}
+
+func (d *Decoder) getConfig(firstOctet byte) *decoderConfig {
+	id := firstOctet >> 5
+	if id == UnroutableConfigID {
+		return nil
+	}
+	return d.configs[id]
+}
+
+// ServerID decodes the server ID from a connection ID.
+func (d *Decoder) ServerID(connID []byte) ([]byte, error) {
+	if len(connID) == 0 {
+		return nil, ErrUnroutable
+	}
+	c := d.getConfig(connID[0])
+	if c == nil || len(connID) < c.config.ConnectionIDLen() {
+		return nil, ErrUnroutable
+	}
+	plaintext := make([]byte, c.cipher.len)
+	c.cipher.Decrypt(plaintext, connID[1:1+c.cipher.len])
+	return plaintext[:c.config.ServerIDLen], nil
+}
+
+// ConnectionIDFromPacket parses the destination connection ID of a QUIC packet.
+// For short header packets, the length of the connection ID is derived from the config ID.
+func (d *Decoder) ConnectionIDFromPacket(packet []byte) ([]byte, error) {
+	if len(packet) == 0 {
+		return nil, io.EOF
+	}
+	var shortHeaderConnIDLen int
+	if !wire.IsLongHeaderPacket(packet[0]) {
+		if len(packet) < 2 {
+			return nil, io.EOF
+		}
+		c := d.getConfig(packet[1])
+		if c == nil {
+			return nil, ErrUnroutable
+		}
+		shortHeaderConnIDLen = c.config.ConnectionIDLen()
+	}
+	connID, err := wire.ParseConnectionID(packet, shortHeaderConnIDLen)
+	if err != nil {
+		return nil, err
+	}
+	return connID.Bytes(), nil
+}
+
+// ServerIDFromPacket decodes the server ID from the destination connection ID of a QUIC packet.
+// Note that the destination connection ID of the first packets sent by a client is chosen randomly,
+// and might not decode to a known server ID.
+func (d *Decoder) ServerIDFromPacket(packet []byte) ([]byte, error) {
+	connID, err := d.ConnectionIDFromPacket(packet)
+	if err != nil {
+		return nil, err
+	}
+	return d.ServerID(connID)
+}
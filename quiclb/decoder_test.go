@@ -0,0 +1,99 @@
+package quiclb
+
+import (
+	"io"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Decoder", func() {
+	It("rejects duplicate config IDs", func() {
+		_, err := NewDecoder(
+			&Config{ID: 2, ServerIDLen: 3, NonceLen: 4},
+			&Config{ID: 2, ServerIDLen: 4, NonceLen: 4},
+		)
+		Expect(err).To(MatchError("quiclb: duplicate config ID 2"))
+	})
+
+	It("decodes the test vectors", func() {
+		for _, v := range testVectors {
+			d, err := NewDecoder(v.config)
+			Expect(err).ToNot(HaveOccurred())
+			serverID, err := d.ServerID(mustDecodeHex(v.connID))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serverID).To(Equal(mustDecodeHex(v.serverID)))
+		}
+	})
+
+	It("decodes connection IDs using multiple configs", func() {
+		d, err := NewDecoder(testVectors[1].config, testVectors[2].config)
+		Expect(err).ToNot(HaveOccurred())
+		for _, v := range testVectors[1:3] {
+			serverID, err := d.ServerID(mustDecodeHex(v.connID))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serverID).To(Equal(mustDecodeHex(v.serverID)))
+		}
+		// uses config ID 0
+		_, err = d.ServerID(mustDecodeHex(testVectors[0].connID))
+		Expect(err).To(MatchError(ErrUnroutable))
+	})
+
+	It("rejects unroutable connection IDs", func() {
+		d, err := NewDecoder(&Config{ID: 0, ServerIDLen: 3, NonceLen: 4})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = d.ServerID(nil)
+		Expect(err).To(MatchError(ErrUnroutable))
+		_, err = d.ServerID([]byte{0b111_00000, 1, 2, 3, 4, 5, 6, 7})
+		Expect(err).To(MatchError(ErrUnroutable))
+		_, err = d.ServerID([]byte{0, 1, 2, 3, 4, 5, 6}) // too short
+		Expect(err).To(MatchError(ErrUnroutable))
+		serverID, err := d.ServerID([]byte{0, 1, 2, 3, 4, 5, 6, 7})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serverID).To(Equal([]byte{1, 2, 3}))
+	})
+
+	Context("parsing packets", func() {
+		var d *Decoder
+		connID := mustDecodeHex(testVectors[0].connID)
+
+		BeforeEach(func() {
+			var err error
+			d, err = NewDecoder(testVectors[0].config)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("decodes the server ID from a short header packet", func() {
+			packet := append([]byte{0x40}, connID...)
+			packet = append(packet, []byte("foobar")...)
+			c, err := d.ConnectionIDFromPacket(packet)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c).To(Equal(connID))
+			serverID, err := d.ServerIDFromPacket(packet)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serverID).To(Equal(mustDecodeHex(testVectors[0].serverID)))
+		})
+
+		It("decodes the server ID from a long header packet", func() {
+			packet := []byte{0xc0, 0, 0, 0, 1, byte(len(connID))}
+			packet = append(packet, connID...)
+			packet = append(packet, 0) // source connection ID length
+			serverID, err := d.ServerIDFromPacket(packet)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serverID).To(Equal(mustDecodeHex(testVectors[0].serverID)))
+		})
+
+		It("errors on short packets", func() {
+			_, err := d.ServerIDFromPacket([]byte{0x40})
+			Expect(err).To(MatchError(io.EOF))
+			packet := append([]byte{0x40}, connID[:5]...)
+			_, err = d.ServerIDFromPacket(packet)
+			Expect(err).To(MatchError(io.EOF))
+		})
+
+		It("rejects short header packets with an unknown config ID", func() {
+			_, err := d.ServerIDFromPacket([]byte{0x40, 0b001_00000, 1, 2, 3, 4, 5, 6, 7})
+			Expect(err).To(MatchError(ErrUnroutable))
+		})
+	})
+})
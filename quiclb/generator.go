@@ -0,0 +1,122 @@
+package quiclb
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+)
+
+// A Generator generates connection IDs that encode the server ID, according to a QUIC-LB config.
+// It implements the quic.ConnectionIDGenerator interface, and can be used as the
+// ConnectionIDGenerator of a quic.Transport.
+// It is safe for concurrent use.
+type Generator struct {
+	mutex sync.Mutex
+
+	config   *Config
+	cipher   *cidCipher
+	serverID []byte
+
+	// The nonce is a counter, starting at a random value.
+	// This guarantees that the same nonce is never used twice with the same config.
+	nonce     []byte
+	numNonces uint64 // number of nonces used with the current config
+	maxNonces uint64 // 0 if the nonce space is larger than 2^64
+}
+
+var _ quic.ConnectionIDGenerator = &Generator{}
+
+// NewGenerator creates a new Generator for the server with the given server ID.
+func NewGenerator(config *Config, serverID []byte) (*Generator, error) {
+	g := &Generator{}
+	if err := g.setConfig(config, serverID); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+// Rotate switches to a new config.
+// Since the length of the connection IDs can't change over the lifetime of a quic.Transport,
+// the new config must result in connection IDs of the same length.
+// Connection IDs generated with the old config remain valid as long as the load balancer
+// still knows about the old config.
+func (g *Generator) Rotate(config *Config, serverID []byte) error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if config.ConnectionIDLen() != g.config.ConnectionIDLen() {
+		return fmt.Errorf("quiclb: can't change connection ID length from %d to %d", g.config.ConnectionIDLen(), config.ConnectionIDLen())
+	}
+	return g.setConfig(config, serverID)
+}
+
+func (g *Generator) setConfig(config *Config, serverID []byte) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if len(serverID) != config.ServerIDLen {
+		return fmt.Errorf("quiclb: server ID has length %d, expected %d", len(serverID), config.ServerIDLen)
+	}
+	c, err := newCIDCipher(config)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, config.NonceLen)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	g.config = config
+	g.cipher = c
+	g.serverID = append([]byte(nil), serverID...)
+	g.nonce = nonce
+	g.numNonces = 0
+	g.maxNonces = 0
+	if config.NonceLen < 8 {
+		g.maxNonces = 1 << (8 * config.NonceLen)
+	}
+	return nil
+}
+
+// GenerateConnectionID generates a new connection ID.
+// It returns an error once all nonces of the current config have been used.
+func (g *Generator) GenerateConnectionID() (quic.ConnectionID, error) {
+	var random [1]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return quic.ConnectionID{}, err
+	}
+
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.maxNonces > 0 && g.numNonces >= g.maxNonces {
+		return quic.ConnectionID{}, errors.New("quiclb: nonces exhausted, config needs to be rotated")
+	}
+	g.numNonces++
+
+	b := make([]byte, g.config.ConnectionIDLen())
+	b[0] = g.config.firstOctet(random[0])
+	copy(b[1:], g.serverID)
+	copy(b[1+len(g.serverID):], g.nonce)
+	g.cipher.Encrypt(b[1:], b[1:])
+	g.incrementNonce()
+	return quic.ConnectionIDFromBytes(b), nil
+}
+
+func (g *Generator) incrementNonce() {
+	for i := len(g.nonce) - 1; i >= 0; i-- {
+		g.nonce[i]++
+		if g.nonce[i] != 0 {
+			return
+		}
+	}
+}
+
+// ConnectionIDLen returns the length of the generated connection IDs.
+func (g *Generator) ConnectionIDLen() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.config.ConnectionIDLen()
+}
@@ -0,0 +1,79 @@
+package quiclb
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Generator", func() {
+	It("rejects invalid configs", func() {
+		_, err := NewGenerator(&Config{ID: 7, ServerIDLen: 3, NonceLen: 4}, []byte{1, 2, 3})
+		Expect(err).To(MatchError("quiclb: invalid config ID 7"))
+	})
+
+	It("rejects server IDs of the wrong length", func() {
+		_, err := NewGenerator(&Config{ServerIDLen: 3, NonceLen: 4}, []byte{1, 2})
+		Expect(err).To(MatchError("quiclb: server ID has length 2, expected 3"))
+	})
+
+	It("generates plaintext connection IDs", func() {
+		g, err := NewGenerator(&Config{ID: 3, ServerIDLen: 3, NonceLen: 4, EncodeLength: true}, []byte{1, 2, 3})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(g.ConnectionIDLen()).To(Equal(8))
+		c1, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		c2, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c1.Len()).To(Equal(8))
+		Expect(c1.Bytes()[:4]).To(Equal([]byte{0b011_00111, 1, 2, 3}))
+		Expect(c2.Bytes()[:4]).To(Equal([]byte{0b011_00111, 1, 2, 3}))
+		// the nonce is a counter
+		Expect(c1.Bytes()[4:]).ToNot(Equal(c2.Bytes()[4:]))
+	})
+
+	It("generates unique encrypted connection IDs", func() {
+		conf := &Config{ID: 1, ServerIDLen: 3, NonceLen: 4, Key: testVectorKey}
+		g, err := NewGenerator(conf, []byte{1, 2, 3})
+		Expect(err).ToNot(HaveOccurred())
+		d, err := NewDecoder(conf)
+		Expect(err).ToNot(HaveOccurred())
+		seen := make(map[string]struct{})
+		for i := 0; i < 1000; i++ {
+			c, err := g.GenerateConnectionID()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(c.Bytes()[0] >> 5).To(BeEquivalentTo(1))
+			Expect(seen).ToNot(HaveKey(string(c.Bytes())))
+			seen[string(c.Bytes())] = struct{}{}
+			serverID, err := d.ServerID(c.Bytes())
+			Expect(err).ToNot(HaveOccurred())
+			Expect(serverID).To(Equal([]byte{1, 2, 3}))
+		}
+	})
+
+	It("errors when the nonces are exhausted", func() {
+		g, err := NewGenerator(&Config{ServerIDLen: 3, NonceLen: 4}, []byte{1, 2, 3})
+		Expect(err).ToNot(HaveOccurred())
+		g.numNonces = g.maxNonces - 1
+		_, err = g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = g.GenerateConnectionID()
+		Expect(err).To(MatchError("quiclb: nonces exhausted, config needs to be rotated"))
+	})
+
+	It("rotates the config", func() {
+		g, err := NewGenerator(&Config{ID: 0, ServerIDLen: 3, NonceLen: 4}, []byte{1, 2, 3})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(g.Rotate(&Config{ID: 1, ServerIDLen: 4, NonceLen: 3}, []byte{1, 2, 3, 4})).To(MatchError("quiclb: invalid nonce length 3"))
+		Expect(g.Rotate(&Config{ID: 1, ServerIDLen: 4, NonceLen: 4}, []byte{1, 2, 3, 4})).To(MatchError("quiclb: can't change connection ID length from 8 to 9"))
+		conf := &Config{ID: 1, ServerIDLen: 2, NonceLen: 5, Key: testVectorKey}
+		Expect(g.Rotate(conf, []byte{4, 2})).To(Succeed())
+		c, err := g.GenerateConnectionID()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(c.Bytes()[0] >> 5).To(BeEquivalentTo(1))
+		d, err := NewDecoder(conf)
+		Expect(err).ToNot(HaveOccurred())
+		serverID, err := d.ServerID(c.Bytes())
+		Expect(err).ToNot(HaveOccurred())
+		Expect(serverID).To(Equal([]byte{4, 2}))
+	})
+})
@@ -1,6 +1,7 @@
 package quic
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -11,8 +12,11 @@ import (
 	"github.com/quic-go/quic-go/internal/qerr"
 	"github.com/quic-go/quic-go/internal/utils"
 	"github.com/quic-go/quic-go/internal/wire"
+	"github.com/quic-go/quic-go/quicvarint"
 )
 
+var errUnorderedMode = errors.New("stream is read in unordered mode")
+
 type receiveStreamI interface {
 	ReceiveStream
 
@@ -31,6 +35,8 @@ type receiveStream struct {
 
 	frameQueue  *frameSorter
 	finalOffset protocol.ByteCount
+	// set once ReadUnordered is called, replacing the frameQueue
+	unorderedQueue *unorderedFrameQueue
 
 	currentFrame       []byte
 	currentFrameDone   func()
@@ -96,6 +102,9 @@ func (s *receiveStream) readImpl(p []byte) (bool /*stream completed */, int, err
 	if s.finRead {
 		return false, 0, io.EOF
 	}
+	if s.unorderedQueue != nil {
+		return false, 0, errUnorderedMode
+	}
 	if s.cancelReadErr != nil {
 		return false, 0, s.cancelReadErr
 	}
@@ -189,6 +198,212 @@ func (s *receiveStream) readImpl(p []byte) (bool /*stream completed */, int, err
 	return false, bytesRead, nil
 }
 
+// ReadChunk returns the next chunk of received data, without copying it.
+func (s *receiveStream) ReadChunk() ([]byte, func(), error) {
+	s.readOnce <- struct{}{}
+	defer func() { <-s.readOnce }()
+
+	s.mutex.Lock()
+	completed, data, release, err := s.readChunkImpl()
+	s.mutex.Unlock()
+
+	if completed {
+		s.sender.onStreamCompleted(s.streamID)
+	}
+	return data, release, err
+}
+
+// WriteTo implements io.WriterTo.
+// It writes the received frame data to w, without copying it first.
+func (s *receiveStream) WriteTo(w io.Writer) (int64, error) {
+	s.readOnce <- struct{}{}
+	defer func() { <-s.readOnce }()
+
+	var n int64
+	for {
+		s.mutex.Lock()
+		completed, data, release, err := s.readChunkImpl()
+		s.mutex.Unlock()
+
+		if completed {
+			s.sender.onStreamCompleted(s.streamID)
+		}
+		if err != nil {
+			if err == io.EOF {
+				return n, nil
+			}
+			return n, err
+		}
+		m, err := w.Write(data)
+		release()
+		n += int64(m)
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// readChunkImpl hands out the remainder of the current frame.
+// The caller takes ownership of the frame's buffer, and returns it to the pool by calling release.
+func (s *receiveStream) readChunkImpl() (bool /*stream completed */, []byte, func(), error) {
+	if s.finRead {
+		return false, nil, nil, io.EOF
+	}
+	if s.unorderedQueue != nil {
+		return false, nil, nil, errUnorderedMode
+	}
+
+	var deadlineTimer *utils.Timer
+	for {
+		if s.currentFrame == nil || s.readPosInFrame >= len(s.currentFrame) {
+			s.dequeueNextFrame()
+		}
+		if s.closeForShutdownErr != nil {
+			return false, nil, nil, s.closeForShutdownErr
+		}
+		if s.cancelReadErr != nil {
+			return false, nil, nil, s.cancelReadErr
+		}
+		if s.resetRemotelyErr != nil {
+			return false, nil, nil, s.resetRemotelyErr
+		}
+		if s.currentFrame != nil || s.currentFrameIsLast {
+			break
+		}
+
+		deadline := s.deadline
+		if !deadline.IsZero() {
+			if !time.Now().Before(deadline) {
+				return false, nil, nil, errDeadline
+			}
+			if deadlineTimer == nil {
+				deadlineTimer = utils.NewTimer()
+				defer deadlineTimer.Stop()
+			}
+			deadlineTimer.Reset(deadline)
+		}
+		s.mutex.Unlock()
+		if deadline.IsZero() {
+			<-s.readChan
+		} else {
+			select {
+			case <-s.readChan:
+			case <-deadlineTimer.Chan():
+				deadlineTimer.SetRead()
+			}
+		}
+		s.mutex.Lock()
+	}
+
+	data := s.currentFrame[s.readPosInFrame:]
+	release := s.currentFrameDone
+	if release == nil {
+		release = func() {}
+	}
+	s.currentFrame = nil
+	s.currentFrameDone = nil
+	s.readPosInFrame = 0
+	s.flowController.AddBytesRead(protocol.ByteCount(len(data)))
+	if !s.currentFrameIsLast {
+		return false, data, release, nil
+	}
+	s.finRead = true
+	if len(data) == 0 {
+		release()
+		return true, nil, nil, io.EOF
+	}
+	return true, data, release, nil
+}
+
+// ReadUnordered returns the stream data in the order it was received.
+func (s *receiveStream) ReadUnordered() (int64, []byte, func(), error) {
+	s.readOnce <- struct{}{}
+	defer func() { <-s.readOnce }()
+
+	s.mutex.Lock()
+	completed, offset, data, release, err := s.readUnorderedImpl()
+	s.mutex.Unlock()
+
+	if completed {
+		s.sender.onStreamCompleted(s.streamID)
+	}
+	return int64(offset), data, release, err
+}
+
+func (s *receiveStream) readUnorderedImpl() (bool /*stream completed */, protocol.ByteCount, []byte, func(), error) {
+	if s.finRead {
+		return false, 0, nil, nil, io.EOF
+	}
+	if s.unorderedQueue == nil {
+		s.switchToUnorderedMode()
+	}
+
+	var deadlineTimer *utils.Timer
+	for {
+		if s.closeForShutdownErr != nil {
+			return false, 0, nil, nil, s.closeForShutdownErr
+		}
+		if s.cancelReadErr != nil {
+			return false, 0, nil, nil, s.cancelReadErr
+		}
+		if s.resetRemotelyErr != nil {
+			return false, 0, nil, nil, s.resetRemotelyErr
+		}
+		if offset, data, doneCb, ok := s.unorderedQueue.Pop(); ok {
+			s.flowController.AddBytesRead(protocol.ByteCount(len(data)))
+			if doneCb == nil {
+				doneCb = func() {}
+			}
+			return false, offset, data, doneCb, nil
+		}
+		if s.unorderedQueue.ReceivedAll(s.finalOffset) {
+			s.finRead = true
+			return true, 0, nil, nil, io.EOF
+		}
+
+		deadline := s.deadline
+		if !deadline.IsZero() {
+			if !time.Now().Before(deadline) {
+				return false, 0, nil, nil, errDeadline
+			}
+			if deadlineTimer == nil {
+				deadlineTimer = utils.NewTimer()
+				defer deadlineTimer.Stop()
+			}
+			deadlineTimer.Reset(deadline)
+		}
+		s.mutex.Unlock()
+		if deadline.IsZero() {
+			<-s.readChan
+		} else {
+			select {
+			case <-s.readChan:
+			case <-deadlineTimer.Chan():
+				deadlineTimer.SetRead()
+			}
+		}
+		s.mutex.Lock()
+	}
+}
+
+// switchToUnorderedMode moves all data that hasn't been read yet to the unorderedQueue.
+func (s *receiveStream) switchToUnorderedMode() {
+	s.unorderedQueue = newUnorderedFrameQueue(s.frameQueue)
+	if s.currentFrame != nil && s.readPosInFrame < len(s.currentFrame) {
+		// The frameSorter's read position is at the end of the current frame.
+		offset := s.frameQueue.readPos - protocol.ByteCount(len(s.currentFrame)-s.readPosInFrame)
+		s.unorderedQueue.queue = append(
+			[]unorderedFrameQueueEntry{{Offset: offset, Data: s.currentFrame[s.readPosInFrame:], DoneCb: s.currentFrameDone}},
+			s.unorderedQueue.queue...,
+		)
+	} else if s.currentFrameDone != nil {
+		s.currentFrameDone()
+	}
+	s.currentFrame = nil
+	s.currentFrameDone = nil
+	s.readPosInFrame = 0
+}
+
 func (s *receiveStream) dequeueNextFrame() {
 	var offset protocol.ByteCount
 	// We're done with the last frame. Release the buffer.
@@ -250,7 +465,11 @@ func (s *receiveStream) handleStreamFrameImpl(frame *wire.StreamFrame) (bool /*
 	if s.cancelReadErr != nil {
 		return newlyRcvdFinalOffset, nil
 	}
-	if err := s.frameQueue.Push(frame.Data, frame.Offset, frame.PutBack); err != nil {
+	if s.unorderedQueue != nil {
+		if err := s.unorderedQueue.Push(frame.Data, frame.Offset, frame.PutBack); err != nil {
+			return false, err
+		}
+	} else if err := s.frameQueue.Push(frame.Data, frame.Offset, frame.PutBack); err != nil {
 		return false, err
 	}
 	s.signalRead()
@@ -296,6 +515,13 @@ func (s *receiveStream) CloseRemote(offset protocol.ByteCount) {
 	s.handleStreamFrame(&wire.StreamFrame{Fin: true, Offset: offset})
 }
 
+func (s *receiveStream) SetReceiveWindow(size, max uint64) {
+	s.flowController.SetReceiveWindow(
+		protocol.ByteCount(min(size, quicvarint.Max)),
+		protocol.ByteCount(min(max, quicvarint.Max)),
+	)
+}
+
 func (s *receiveStream) SetReadDeadline(t time.Time) error {
 	s.mutex.Lock()
 	s.deadline = t
@@ -1,8 +1,10 @@
 package quic
 
 import (
+	"bytes"
 	"errors"
 	"io"
+	"math"
 	"runtime"
 	"sync"
 	"sync/atomic"
@@ -11,6 +13,7 @@ import (
 	"github.com/quic-go/quic-go/internal/mocks"
 	"github.com/quic-go/quic-go/internal/protocol"
 	"github.com/quic-go/quic-go/internal/wire"
+	"github.com/quic-go/quic-go/quicvarint"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -218,6 +221,13 @@ var _ = Describe("Receive Stream", func() {
 			Expect(b).To(Equal([]byte("foobar")))
 		})
 
+		It("sets the receive window", func() {
+			mockFC.EXPECT().SetReceiveWindow(protocol.ByteCount(1000), protocol.ByteCount(5000))
+			str.SetReceiveWindow(1000, 5000)
+			mockFC.EXPECT().SetReceiveWindow(protocol.ByteCount(1000), protocol.ByteCount(quicvarint.Max))
+			str.SetReceiveWindow(1000, math.MaxUint64)
+		})
+
 		Context("deadlines", func() {
 			It("the deadline error has the right net.Error properties", func() {
 				Expect(errDeadline.Timeout()).To(BeTrue())
@@ -456,6 +466,174 @@ var _ = Describe("Receive Stream", func() {
 			})
 		})
 
+		Context("reading without copying", func() {
+			It("returns chunks", func() {
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(1))
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(3))
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(2))
+				var released1, released2 bool
+				Expect(str.frameQueue.Push([]byte("foob"), 0, func() { released1 = true })).To(Succeed())
+				Expect(str.frameQueue.Push([]byte("ar"), 4, func() { released2 = true })).To(Succeed())
+				str.finalOffset = 6
+				b := make([]byte, 1)
+				_, err := strWithTimeout.Read(b)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(b).To(Equal([]byte("f")))
+				data, release, err := str.ReadChunk()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("oob")))
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				data2, release2, err := str.ReadChunk()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data2).To(Equal([]byte("ar")))
+				// the buffers are only released when release is called
+				Expect(released1).To(BeFalse())
+				Expect(released2).To(BeFalse())
+				release()
+				Expect(released1).To(BeTrue())
+				release2()
+				Expect(released2).To(BeTrue())
+				_, _, err = str.ReadChunk()
+				Expect(err).To(MatchError(io.EOF))
+			})
+
+			It("waits until data is available", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(6))
+				go func() {
+					defer GinkgoRecover()
+					time.Sleep(scaleDuration(10 * time.Millisecond))
+					Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foobar")})).To(Succeed())
+				}()
+				data, release, err := str.ReadChunk()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(data).To(Equal([]byte("foobar")))
+				release()
+			})
+
+			It("returns EOF for immediate FINs", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(0), true)
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(0))
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Fin: true})).To(Succeed())
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				data, _, err := str.ReadChunk()
+				Expect(err).To(MatchError(io.EOF))
+				Expect(data).To(BeEmpty())
+			})
+
+			It("respects the deadline", func() {
+				str.SetReadDeadline(time.Now().Add(scaleDuration(20 * time.Millisecond)))
+				_, _, err := str.ReadChunk()
+				Expect(err).To(MatchError(errDeadline))
+			})
+
+			It("returns errors when the stream is reset", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(42), true)
+				mockFC.EXPECT().Abandon()
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				Expect(str.handleResetStreamFrame(&wire.ResetStreamFrame{StreamID: streamID, FinalSize: 42, ErrorCode: 1234})).To(Succeed())
+				_, _, err := str.ReadChunk()
+				Expect(err).To(MatchError(&StreamError{StreamID: streamID, ErrorCode: 1234, Remote: true}))
+			})
+
+			It("writes to an io.Writer", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(3), false)
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(3)).Times(2)
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foo")})).To(Succeed())
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 3, Data: []byte("bar"), Fin: true})).To(Succeed())
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				var buf bytes.Buffer
+				n, err := str.WriteTo(&buf)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(BeEquivalentTo(6))
+				Expect(buf.String()).To(Equal("foobar"))
+			})
+
+			It("returns write errors from WriteTo", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(3), false)
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(3))
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foo")})).To(Succeed())
+				testErr := errors.New("test error")
+				_, err := str.WriteTo(&errorWriter{err: testErr})
+				Expect(err).To(MatchError(testErr))
+			})
+		})
+
+		Context("reading in unordered mode", func() {
+			It("returns data in the order it was received", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), false)
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(3), false)
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(3)).Times(2)
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 3, Data: []byte("bar")})).To(Succeed())
+				offset, data, release, err := str.ReadUnordered()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(offset).To(BeEquivalentTo(3))
+				Expect(data).To(Equal([]byte("bar")))
+				release()
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foo")})).To(Succeed())
+				offset, data, release, err = str.ReadUnordered()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(offset).To(BeZero())
+				Expect(data).To(Equal([]byte("foo")))
+				release()
+			})
+
+			It("returns the data that wasn't read yet when switching to unordered mode", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(4), false)
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(9), false)
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(1))
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(3))
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(3))
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foob")})).To(Succeed())
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 6, Data: []byte("baz")})).To(Succeed())
+				b := make([]byte, 1)
+				_, err := strWithTimeout.Read(b)
+				Expect(err).ToNot(HaveOccurred())
+				offset, data, _, err := str.ReadUnordered()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(offset).To(BeEquivalentTo(1))
+				Expect(data).To(Equal([]byte("oob")))
+				offset, data, _, err = str.ReadUnordered()
+				Expect(err).ToNot(HaveOccurred())
+				Expect(offset).To(BeEquivalentTo(6))
+				Expect(data).To(Equal([]byte("baz")))
+				// ordered reads are not possible anymore
+				_, err = strWithTimeout.Read(b)
+				Expect(err).To(MatchError(errUnorderedMode))
+			})
+
+			It("returns EOF once all data was read", func() {
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(6), true)
+				mockFC.EXPECT().UpdateHighestReceived(protocol.ByteCount(3), false)
+				mockFC.EXPECT().AddBytesRead(protocol.ByteCount(3)).Times(2)
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Offset: 3, Data: []byte("bar"), Fin: true})).To(Succeed())
+				_, _, _, err := str.ReadUnordered()
+				Expect(err).ToNot(HaveOccurred())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					offset, data, _, err := str.ReadUnordered()
+					Expect(err).ToNot(HaveOccurred())
+					Expect(offset).To(BeZero())
+					Expect(data).To(Equal([]byte("foo")))
+				}()
+				Consistently(done).ShouldNot(BeClosed())
+				Expect(str.handleStreamFrame(&wire.StreamFrame{Data: []byte("foo")})).To(Succeed())
+				Eventually(done).Should(BeClosed())
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				_, _, _, err = str.ReadUnordered()
+				Expect(err).To(MatchError(io.EOF))
+			})
+
+			It("respects the deadline", func() {
+				str.SetReadDeadline(time.Now().Add(scaleDuration(20 * time.Millisecond)))
+				_, _, _, err := str.ReadUnordered()
+				Expect(err).To(MatchError(errDeadline))
+			})
+		})
+
 		Context("closing for shutdown", func() {
 			testErr := errors.New("test error")
 
@@ -707,3 +885,7 @@ var _ = Describe("Receive Stream", func() {
 		})
 	})
 })
+
+type errorWriter struct{ err error }
+
+func (w *errorWriter) Write([]byte) (int, error) { return 0, w.err }
@@ -3,6 +3,7 @@ package quic
 import (
 	"context"
 	"fmt"
+	"io"
 	"sync"
 	"time"
 
@@ -47,6 +48,10 @@ type sendStream struct {
 	dataForWriting []byte // during a Write() call, this slice is the part of p that still needs to be sent out
 	nextFrame      *wire.StreamFrame
 
+	// If set, Write copies the data into dataForWriting and returns as soon as it fits into the send buffer.
+	// In that case, dataForWriting may still contain data after Write returned.
+	sendBufferSize protocol.ByteCount
+
 	writeChan chan struct{}
 	writeOnce chan struct{}
 	deadline  time.Time
@@ -63,11 +68,13 @@ func newSendStream(
 	streamID protocol.StreamID,
 	sender streamSender,
 	flowController flowcontrol.StreamFlowController,
+	sendBufferSize protocol.ByteCount,
 ) *sendStream {
 	s := &sendStream{
 		streamID:       streamID,
 		sender:         sender,
 		flowController: flowController,
+		sendBufferSize: sendBufferSize,
 		writeChan:      make(chan struct{}, 1),
 		writeOnce:      make(chan struct{}, 1), // cap: 1, to protect against concurrent use of Write
 	}
@@ -89,22 +96,23 @@ func (s *sendStream) Write(p []byte) (int, error) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
 
-	if s.finishedWriting {
-		return 0, fmt.Errorf("write on closed stream %d", s.streamID)
-	}
-	if s.cancelWriteErr != nil {
-		return 0, s.cancelWriteErr
-	}
-	if s.closeForShutdownErr != nil {
-		return 0, s.closeForShutdownErr
-	}
-	if !s.deadline.IsZero() && !time.Now().Before(s.deadline) {
-		return 0, errDeadline
+	if err := s.checkWritable(); err != nil {
+		return 0, err
 	}
 	if len(p) == 0 {
 		return 0, nil
 	}
 
+	bufferSize := s.sendBufferSize
+	if bufferSize == 0 && s.dataForWriting != nil {
+		// The send buffer was disabled, but there's still buffered data left.
+		// Keep copying until this data has been sent out.
+		bufferSize = protocol.MaxPacketBufferSize
+	}
+	if bufferSize > 0 {
+		return s.writeBuffered(p, bufferSize)
+	}
+
 	s.dataForWriting = p
 
 	var (
@@ -188,6 +196,163 @@ func (s *sendStream) Write(p []byte) (int, error) {
 	return bytesWritten, nil
 }
 
+// ReadFrom implements io.ReaderFrom.
+// It reads from r directly into the buffers of the STREAM frames that are then sent out.
+// Just like Write, it returns as soon as the last frame has been queued for sending.
+func (s *sendStream) ReadFrom(r io.Reader) (int64, error) {
+	s.writeOnce <- struct{}{}
+	defer func() { <-s.writeOnce }()
+
+	deadlineTimer := utils.NewTimer()
+	defer deadlineTimer.Stop()
+
+	var n int64
+	for {
+		s.mutex.Lock()
+		err := s.checkWritable()
+		s.mutex.Unlock()
+		if err != nil {
+			return n, err
+		}
+
+		f := wire.GetStreamFrame()
+		l, rerr := r.Read(f.Data[:cap(f.Data)])
+		f.Data = f.Data[:l]
+		if l > 0 {
+			s.mutex.Lock()
+			err := s.queueFrame(f, deadlineTimer)
+			s.mutex.Unlock()
+			if err != nil {
+				f.PutBack()
+				return n, err
+			}
+			s.sender.onHasStreamData(s.streamID) // must be called without holding the mutex
+			n += int64(l)
+		} else {
+			f.PutBack()
+		}
+		if rerr == io.EOF {
+			return n, nil
+		}
+		if rerr != nil {
+			return n, rerr
+		}
+	}
+}
+
+// queueFrame waits until all previously written data has been dequeued, and then queues f for sending.
+// It must be called with the mutex held.
+func (s *sendStream) queueFrame(f *wire.StreamFrame, deadlineTimer *utils.Timer) error {
+	for s.nextFrame != nil || s.dataForWriting != nil {
+		if err := s.checkWritable(); err != nil {
+			return err
+		}
+		deadline := s.deadline
+		if !deadline.IsZero() {
+			deadlineTimer.Reset(deadline)
+		}
+		s.mutex.Unlock()
+		if deadline.IsZero() {
+			<-s.writeChan
+		} else {
+			select {
+			case <-s.writeChan:
+			case <-deadlineTimer.Chan():
+				deadlineTimer.SetRead()
+			}
+		}
+		s.mutex.Lock()
+	}
+	if err := s.checkWritable(); err != nil {
+		return err
+	}
+	f.StreamID = s.streamID
+	f.Offset = s.writeOffset
+	f.DataLenPresent = true
+	f.Fin = false
+	s.nextFrame = f
+	return nil
+}
+
+// checkWritable checks if data can be written to the stream.
+// It must be called with the mutex held.
+func (s *sendStream) checkWritable() error {
+	if s.finishedWriting {
+		return fmt.Errorf("write on closed stream %d", s.streamID)
+	}
+	if s.cancelWriteErr != nil {
+		return s.cancelWriteErr
+	}
+	if s.closeForShutdownErr != nil {
+		return s.closeForShutdownErr
+	}
+	if !s.deadline.IsZero() && !time.Now().Before(s.deadline) {
+		return errDeadline
+	}
+	return nil
+}
+
+// writeBuffered copies p into the send buffer.
+// It only blocks while the send buffer is full.
+// It must be called with the mutex held.
+func (s *sendStream) writeBuffered(p []byte, bufferSize protocol.ByteCount) (int, error) {
+	var (
+		deadlineTimer *utils.Timer
+		bytesWritten  int
+	)
+	for {
+		if s.closeForShutdownErr != nil {
+			return bytesWritten, s.closeForShutdownErr
+		}
+		if s.cancelWriteErr != nil {
+			return bytesWritten, s.cancelWriteErr
+		}
+		if space := bufferSize - s.bufferedDataLen(); space > 0 {
+			n := min(int(space), len(p)-bytesWritten)
+			s.dataForWriting = append(s.dataForWriting, p[bytesWritten:bytesWritten+n]...)
+			bytesWritten += n
+			s.mutex.Unlock()
+			s.sender.onHasStreamData(s.streamID) // must be called without holding the mutex
+			s.mutex.Lock()
+			if bytesWritten == len(p) {
+				return bytesWritten, nil
+			}
+			continue
+		}
+
+		deadline := s.deadline
+		if !deadline.IsZero() {
+			if !time.Now().Before(deadline) {
+				return bytesWritten, errDeadline
+			}
+			if deadlineTimer == nil {
+				deadlineTimer = utils.NewTimer()
+				defer deadlineTimer.Stop()
+			}
+			deadlineTimer.Reset(deadline)
+		}
+		s.mutex.Unlock()
+		if deadline.IsZero() {
+			<-s.writeChan
+		} else {
+			select {
+			case <-s.writeChan:
+			case <-deadlineTimer.Chan():
+				deadlineTimer.SetRead()
+			}
+		}
+		s.mutex.Lock()
+	}
+}
+
+func (s *sendStream) bufferedDataLen() protocol.ByteCount {
+	l := protocol.ByteCount(len(s.dataForWriting))
+	if s.nextFrame != nil {
+		l += s.nextFrame.DataLen()
+	}
+	return l
+}
+
 func (s *sendStream) canBufferStreamFrame() bool {
 	var l protocol.ByteCount
 	if s.nextFrame != nil {
@@ -342,7 +507,7 @@ func (s *sendStream) getDataForWriting(f *wire.StreamFrame, maxBytes protocol.By
 	f.Data = f.Data[:maxBytes]
 	copy(f.Data, s.dataForWriting)
 	s.dataForWriting = s.dataForWriting[maxBytes:]
-	if s.canBufferStreamFrame() {
+	if s.sendBufferSize > 0 || s.canBufferStreamFrame() {
 		s.signalWrite()
 	}
 }
@@ -418,6 +583,13 @@ func (s *sendStream) handleStopSendingFrame(frame *wire.StopSendingFrame) {
 	s.cancelWriteImpl(frame.ErrorCode, true)
 }
 
+func (s *sendStream) SetSendBufferSize(size uint64) {
+	s.mutex.Lock()
+	s.sendBufferSize = protocol.ByteCount(min(size, uint64(protocol.MaxByteCount)))
+	s.mutex.Unlock()
+	s.signalWrite()
+}
+
 func (s *sendStream) Context() context.Context {
 	return s.ctx
 }
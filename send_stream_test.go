@@ -7,6 +7,7 @@ import (
 	"io"
 	mrand "math/rand"
 	"runtime"
+	"testing/iotest"
 	"time"
 
 	"golang.org/x/exp/rand"
@@ -35,7 +36,7 @@ var _ = Describe("Send Stream", func() {
 	BeforeEach(func() {
 		mockSender = NewMockStreamSender(mockCtrl)
 		mockFC = mocks.NewMockStreamFlowController(mockCtrl)
-		str = newSendStream(streamID, mockSender, mockFC)
+		str = newSendStream(streamID, mockSender, mockFC, 0)
 
 		timeout := scaleDuration(250 * time.Millisecond)
 		strWithTimeout = gbytes.TimeoutWriter(str, timeout)
@@ -537,6 +538,191 @@ var _ = Describe("Send Stream", func() {
 			})
 		})
 
+		Context("with a send buffer", func() {
+			It("returns as soon as the data has been copied to the send buffer", func() {
+				str.SetSendBufferSize(10000)
+				mockSender.EXPECT().onHasStreamData(streamID).Times(2)
+				data := getData(5000)
+				n, err := strWithTimeout.Write(data)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(5000))
+				n, err = strWithTimeout.Write(getDataAtOffset(5000, 3000))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(Equal(3000))
+				data[0] = 0xff // modifying the slice doesn't change the data that's sent
+				mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount).AnyTimes()
+				mockFC.EXPECT().AddBytesSent(gomock.Any()).AnyTimes()
+				var received []byte
+				for {
+					frame, ok, _ := str.popStreamFrame(1000, protocol.Version1)
+					if !ok {
+						break
+					}
+					Expect(frame.Frame.Offset).To(Equal(protocol.ByteCount(len(received))))
+					received = append(received, frame.Frame.Data...)
+				}
+				Expect(received).To(Equal(getData(8000)))
+			})
+
+			It("blocks Write until there's space in the send buffer", func() {
+				str.SetSendBufferSize(1000)
+				mockSender.EXPECT().onHasStreamData(streamID).Times(2)
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					n, err := str.Write(getData(1500))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(Equal(1500))
+				}()
+				waitForWrite()
+				Consistently(done).ShouldNot(BeClosed())
+				mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount)
+				mockFC.EXPECT().AddBytesSent(gomock.Any())
+				frame, ok, hasMoreData := str.popStreamFrame(600, protocol.Version1)
+				Expect(ok).To(BeTrue())
+				Expect(hasMoreData).To(BeTrue())
+				l := frame.Frame.DataLen()
+				Expect(frame.Frame.Data).To(Equal(getData(l)))
+				Eventually(done).Should(BeClosed())
+				str.mutex.Lock()
+				Expect(str.dataForWriting).To(Equal(getDataAtOffset(l, 1500-l)))
+				str.mutex.Unlock()
+			})
+
+			It("returns the number of bytes buffered when the deadline expires", func() {
+				str.SetSendBufferSize(1000)
+				mockSender.EXPECT().onHasStreamData(streamID)
+				deadline := time.Now().Add(scaleDuration(50 * time.Millisecond))
+				str.SetWriteDeadline(deadline)
+				n, err := strWithTimeout.Write(getData(1500))
+				Expect(err).To(MatchError(errDeadline))
+				Expect(n).To(Equal(1000))
+				Expect(time.Now()).To(BeTemporally("~", deadline, scaleDuration(20*time.Millisecond)))
+			})
+
+			It("unblocks Write when the stream is canceled", func() {
+				str.SetSendBufferSize(1000)
+				mockSender.EXPECT().onHasStreamData(streamID)
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					n, err := str.Write(getData(1500))
+					Expect(err).To(MatchError(&StreamError{StreamID: streamID, ErrorCode: 1234}))
+					Expect(n).To(Equal(1000))
+				}()
+				waitForWrite()
+				Consistently(done).ShouldNot(BeClosed())
+				mockSender.EXPECT().queueControlFrame(gomock.Any())
+				mockSender.EXPECT().onStreamCompleted(streamID)
+				str.CancelWrite(1234)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("sends buffered data before new data when the send buffer is disabled", func() {
+				str.SetSendBufferSize(1000)
+				mockSender.EXPECT().onHasStreamData(streamID).Times(2)
+				_, err := strWithTimeout.Write([]byte("foo"))
+				Expect(err).ToNot(HaveOccurred())
+				str.SetSendBufferSize(0)
+				_, err = strWithTimeout.Write([]byte("bar"))
+				Expect(err).ToNot(HaveOccurred())
+				mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount)
+				mockFC.EXPECT().AddBytesSent(protocol.ByteCount(6))
+				frame, ok, _ := str.popStreamFrame(protocol.MaxByteCount, protocol.Version1)
+				Expect(ok).To(BeTrue())
+				Expect(frame.Frame.Data).To(Equal([]byte("foobar")))
+			})
+		})
+
+		Context("reading from an io.Reader", func() {
+			It("reads data into STREAM frames", func() {
+				mockSender.EXPECT().onHasStreamData(streamID).AnyTimes()
+				data := getData(5000)
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					n, err := str.ReadFrom(bytes.NewReader(data))
+					Expect(err).ToNot(HaveOccurred())
+					Expect(n).To(BeEquivalentTo(5000))
+				}()
+				mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount).AnyTimes()
+				mockFC.EXPECT().AddBytesSent(gomock.Any()).AnyTimes()
+				var received []byte
+				for len(received) < len(data) {
+					frame, ok, _ := str.popStreamFrame(protocol.MaxPacketBufferSize, protocol.Version1)
+					if !ok {
+						continue
+					}
+					Expect(frame.Frame.Offset).To(Equal(protocol.ByteCount(len(received))))
+					received = append(received, frame.Frame.Data...)
+				}
+				Expect(received).To(Equal(data))
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("returns as soon as the last frame was queued", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				n, err := str.ReadFrom(bytes.NewReader([]byte("foobar")))
+				Expect(err).ToNot(HaveOccurred())
+				Expect(n).To(BeEquivalentTo(6))
+				mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount)
+				mockFC.EXPECT().AddBytesSent(protocol.ByteCount(6))
+				frame, ok, _ := str.popStreamFrame(protocol.MaxByteCount, protocol.Version1)
+				Expect(ok).To(BeTrue())
+				Expect(frame.Frame.Data).To(Equal([]byte("foobar")))
+			})
+
+			It("sends data written before", func() {
+				mockSender.EXPECT().onHasStreamData(streamID).Times(2)
+				_, err := strWithTimeout.Write([]byte("foo"))
+				Expect(err).ToNot(HaveOccurred())
+				done := make(chan struct{})
+				go func() {
+					defer GinkgoRecover()
+					defer close(done)
+					_, err := str.ReadFrom(bytes.NewReader([]byte("bar")))
+					Expect(err).ToNot(HaveOccurred())
+				}()
+				Consistently(done).ShouldNot(BeClosed())
+				mockFC.EXPECT().SendWindowSize().Return(protocol.MaxByteCount).Times(2)
+				mockFC.EXPECT().AddBytesSent(protocol.ByteCount(3)).Times(2)
+				frame, ok, _ := str.popStreamFrame(protocol.MaxByteCount, protocol.Version1)
+				Expect(ok).To(BeTrue())
+				Expect(frame.Frame.Data).To(Equal([]byte("foo")))
+				Eventually(done).Should(BeClosed())
+				frame, ok, _ = str.popStreamFrame(protocol.MaxByteCount, protocol.Version1)
+				Expect(ok).To(BeTrue())
+				Expect(frame.Frame.Offset).To(Equal(protocol.ByteCount(3)))
+				Expect(frame.Frame.Data).To(Equal([]byte("bar")))
+			})
+
+			It("returns read errors", func() {
+				testErr := errors.New("test error")
+				_, err := str.ReadFrom(iotest.ErrReader(testErr))
+				Expect(err).To(MatchError(testErr))
+			})
+
+			It("returns an error when the deadline expires", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				_, err := str.ReadFrom(bytes.NewReader([]byte("foo")))
+				Expect(err).ToNot(HaveOccurred())
+				str.SetWriteDeadline(time.Now().Add(scaleDuration(20 * time.Millisecond)))
+				n, err := str.ReadFrom(bytes.NewReader([]byte("bar")))
+				Expect(err).To(MatchError(errDeadline))
+				Expect(n).To(BeZero())
+			})
+
+			It("doesn't allow reading after the stream was closed", func() {
+				mockSender.EXPECT().onHasStreamData(streamID)
+				Expect(str.Close()).To(Succeed())
+				_, err := str.ReadFrom(bytes.NewReader([]byte("foo")))
+				Expect(err).To(MatchError("write on closed stream 1337"))
+			})
+		})
+
 		Context("closing", func() {
 			It("doesn't allow writes after it has been closed", func() {
 				mockSender.EXPECT().onHasStreamData(streamID)
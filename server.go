@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/quic-go/quic-go/internal/handshake"
@@ -61,14 +62,24 @@ type rejectedPacket struct {
 type baseServer struct {
 	disableVersionNegotiation bool
 	acceptEarlyConns          bool
+	holdConnsOnFullQueue      bool
 
 	tlsConf *tls.Config
 	config  *Config
 
 	conn rawConn
 
-	tokenGenerator *handshake.TokenGenerator
-	maxTokenAge    time.Duration
+	tokenGenerator   *handshake.TokenGenerator
+	tokenSource      TokenSource
+	tokenReplayCache TokenReplayCache
+	maxTokenAge      time.Duration
+
+	maxHandshakes              int
+	addressValidationThreshold int
+	// only set if handshake rate limiting is enabled
+	rateLimiter *handshakeRateLimiter
+	// only tracked if maxHandshakes or addressValidationThreshold is set
+	handshakeCount atomic.Int64
 
 	connIDGenerator ConnectionIDGenerator
 	connHandler     packetHandlerManager
@@ -79,6 +90,11 @@ type baseServer struct {
 	nextZeroRTTCleanup time.Time
 	zeroRTTQueues      map[protocol.ConnectionID]*zeroRTTQueue // only initialized if acceptEarlyConns == true
 
+	// Initial packets are queued until the ClientHello was received completely,
+	// so that GetConfigForClient can be called with the information from the ClientHello.
+	nextClientHelloCleanup time.Time
+	clientHelloQueues      clientHelloQueues
+
 	// set as a member, so they can be set in the tests
 	newConn func(
 		sendConn,
@@ -237,36 +253,59 @@ func newServer(
 	tracer *logging.Tracer,
 	onClose func(),
 	tokenGeneratorKey TokenGeneratorKey,
+	tokenDecryptionKeys []TokenGeneratorKey,
+	tokenSource TokenSource,
+	tokenReplayCache TokenReplayCache,
 	maxTokenAge time.Duration,
+	maxHandshakes int,
+	addressValidationThreshold int,
+	rateLimit *HandshakeRateLimit,
+	acceptQueueSize int,
+	holdConnsOnFullQueue bool,
 	disableVersionNegotiation bool,
 	acceptEarly bool,
 ) *baseServer {
+	if acceptQueueSize == 0 {
+		acceptQueueSize = protocol.DefaultAcceptQueueSize
+	}
 	s := &baseServer{
-		conn:                      conn,
-		tlsConf:                   tlsConf,
-		config:                    config,
-		tokenGenerator:            handshake.NewTokenGenerator(tokenGeneratorKey),
-		maxTokenAge:               maxTokenAge,
-		connIDGenerator:           connIDGenerator,
-		connHandler:               connHandler,
-		connQueue:                 make(chan quicConn, protocol.MaxAcceptQueueSize),
-		errorChan:                 make(chan struct{}),
-		running:                   make(chan struct{}),
-		receivedPackets:           make(chan receivedPacket, protocol.MaxServerUnprocessedPackets),
-		versionNegotiationQueue:   make(chan receivedPacket, 4),
-		invalidTokenQueue:         make(chan rejectedPacket, 4),
-		connectionRefusedQueue:    make(chan rejectedPacket, 4),
-		retryQueue:                make(chan rejectedPacket, 8),
-		newConn:                   newConnection,
-		tracer:                    tracer,
-		logger:                    utils.DefaultLogger.WithPrefix("server"),
-		acceptEarlyConns:          acceptEarly,
-		disableVersionNegotiation: disableVersionNegotiation,
-		onClose:                   onClose,
+		conn:                       conn,
+		tlsConf:                    tlsConf,
+		config:                     config,
+		tokenGenerator:             handshake.NewTokenGenerator(tokenGeneratorKey, tokenDecryptionKeys...),
+		tokenSource:                tokenSource,
+		tokenReplayCache:           tokenReplayCache,
+		maxTokenAge:                maxTokenAge,
+		maxHandshakes:              maxHandshakes,
+		addressValidationThreshold: addressValidationThreshold,
+		connIDGenerator:            connIDGenerator,
+		connHandler:                connHandler,
+		connQueue:                  make(chan quicConn, acceptQueueSize),
+		errorChan:                  make(chan struct{}),
+		running:                    make(chan struct{}),
+		receivedPackets:            make(chan receivedPacket, protocol.MaxServerUnprocessedPackets),
+		versionNegotiationQueue:    make(chan receivedPacket, 4),
+		invalidTokenQueue:          make(chan rejectedPacket, 4),
+		connectionRefusedQueue:     make(chan rejectedPacket, 4),
+		retryQueue:                 make(chan rejectedPacket, 8),
+		clientHelloQueues:          make(clientHelloQueues),
+		newConn:                    newConnection,
+		tracer:                     tracer,
+		logger:                     utils.DefaultLogger.WithPrefix("server"),
+		acceptEarlyConns:           acceptEarly,
+		holdConnsOnFullQueue:       holdConnsOnFullQueue,
+		disableVersionNegotiation:  disableVersionNegotiation,
+		onClose:                    onClose,
 	}
 	if acceptEarly {
 		s.zeroRTTQueues = map[protocol.ConnectionID]*zeroRTTQueue{}
 	}
+	if rateLimit != nil {
+		s.rateLimiter = newHandshakeRateLimiter(rateLimit)
+	}
+	if tokenSource != nil {
+		s.tokenGenerator.SetTokenData(tokenSource.TokenData)
+	}
 	go s.run()
 	go s.runSendQueue()
 	s.logger.Debugf("Listening for %s connections on %s", conn.LocalAddr().Network(), conn.LocalAddr().String())
@@ -363,6 +402,9 @@ func (s *baseServer) handlePacketImpl(p receivedPacket) bool /* is the buffer st
 	if !s.nextZeroRTTCleanup.IsZero() && p.rcvTime.After(s.nextZeroRTTCleanup) {
 		defer s.cleanupZeroRTTQueues(p.rcvTime)
 	}
+	if !s.nextClientHelloCleanup.IsZero() && p.rcvTime.After(s.nextClientHelloCleanup) {
+		defer s.cleanupClientHelloQueues(p.rcvTime)
+	}
 
 	if wire.IsVersionNegotiationPacket(p.data) {
 		s.logger.Debugf("Dropping Version Negotiation packet.")
@@ -517,10 +559,63 @@ func (s *baseServer) cleanupZeroRTTQueues(now time.Time) {
 	s.nextZeroRTTCleanup = nextCleanup
 }
 
+// handleClientHelloPacket queues Initial packets until the ClientHello was received completely.
+// It returns false if the packet was queued.
+// Otherwise, it returns the ClientHello (if it could be parsed), as well as previously queued packets.
+func (s *baseServer) handleClientHelloPacket(p receivedPacket, hdr *wire.Header) (*handshake.ClientHello, []receivedPacket, bool) {
+	connID := hdr.DestConnectionID
+	q, isNew := s.clientHelloQueues.GetOrCreate(connID, p.rcvTime)
+	if q == nil {
+		// Don't wait for the rest of the ClientHello, if the ClientHello spans multiple packets.
+		q = &pendingClientHello{}
+	} else if isNew && (s.nextClientHelloCleanup.IsZero() || s.nextClientHelloCleanup.After(q.expiration)) {
+		s.nextClientHelloCleanup = q.expiration
+	}
+	ch, err := q.HandlePacket(p, hdr)
+	queued := q.packets[:len(q.packets)-1]
+	if err != nil {
+		s.logger.Debugf("Failed to parse ClientHello from %s: %s", p.remoteAddr, err)
+		delete(s.clientHelloQueues, connID)
+		return nil, queued, true
+	}
+	if ch == nil {
+		// Wait for the remaining parts of the ClientHello, unless we're already queueing too many packets.
+		if q.expiration.IsZero() || len(q.packets) >= protocol.MaxPendingClientHelloPackets {
+			delete(s.clientHelloQueues, connID)
+			return nil, queued, true
+		}
+		return nil, nil, false
+	}
+	delete(s.clientHelloQueues, connID)
+	return ch, queued, true
+}
+
+func (s *baseServer) cleanupClientHelloQueues(now time.Time) {
+	s.nextClientHelloCleanup = s.clientHelloQueues.Cleanup(now, func(p receivedPacket) {
+		if s.tracer != nil && s.tracer.DroppedPacket != nil {
+			s.tracer.DroppedPacket(p.remoteAddr, logging.PacketTypeInitial, p.Size(), logging.PacketDropDOSPrevention)
+		}
+		p.buffer.Release()
+	})
+}
+
+// queueRetry queues a Retry packet to be sent in response to an Initial packet.
+func (s *baseServer) queueRetry(p receivedPacket, hdr *wire.Header) {
+	// Retry invalidates all 0-RTT packets sent.
+	delete(s.zeroRTTQueues, hdr.DestConnectionID)
+	select {
+	case s.retryQueue <- rejectedPacket{receivedPacket: p, hdr: hdr}:
+	default:
+		// drop packet if we can't send out Retry packets fast enough
+		p.buffer.Release()
+	}
+}
+
 // validateToken returns false if:
 //   - address is invalid
 //   - token is expired
 //   - token is null
+//   - the TokenSource rejects the token
 func (s *baseServer) validateToken(token *handshake.Token, addr net.Addr) bool {
 	if token == nil {
 		return false
@@ -534,6 +629,9 @@ func (s *baseServer) validateToken(token *handshake.Token, addr net.Addr) bool {
 	if token.IsRetryToken && time.Since(token.SentTime) > s.config.maxRetryTokenAge() {
 		return false
 	}
+	if !token.IsRetryToken && s.tokenSource != nil && !s.tokenSource.ValidateToken(addr, token.SentTime, token.Data) {
+		return false
+	}
 	return true
 }
 
@@ -590,29 +688,65 @@ func (s *baseServer) handleInitialImpl(p receivedPacket, hdr *wire.Header) error
 			return nil
 		}
 	}
-	if token == nil && s.config.RequireAddressValidation(p.remoteAddr) {
-		// Retry invalidates all 0-RTT packets sent.
-		delete(s.zeroRTTQueues, hdr.DestConnectionID)
-		select {
-		case s.retryQueue <- rejectedPacket{receivedPacket: p, hdr: hdr}:
-		default:
-			// drop packet if we can't send out Retry packets fast enough
-			p.buffer.Release()
-		}
+	if token == nil && s.requireAddressValidation(p.remoteAddr) {
+		s.queueRetry(p, hdr)
 		return nil
 	}
 
-	if queueLen := len(s.connQueue); queueLen >= protocol.MaxAcceptQueueSize {
-		s.logger.Debugf("Rejecting new connection. Server currently busy. Accept queue length: %d (max %d)", queueLen, protocol.MaxAcceptQueueSize)
-		select {
-		case s.connectionRefusedQueue <- rejectedPacket{receivedPacket: p, hdr: hdr}:
-		default:
-			// drop packet if we can't send out the CONNECTION_REFUSED fast enough
-			p.buffer.Release()
+	var (
+		clientHello *handshake.ClientHello
+		// Initial packets that were queued until the ClientHello was received completely.
+		queued []receivedPacket
+	)
+	if s.config.GetConfigForClient != nil {
+		if p.clientHello != nil {
+			// The listener router already reassembled and parsed the ClientHello.
+			clientHello = p.clientHello
+		} else {
+			var ok bool
+			clientHello, queued, ok = s.handleClientHelloPacket(p, hdr)
+			if !ok {
+				return nil
+			}
+			// The queued packets are passed to the connection when it is created.
+			// If the connection attempt is rejected, they're not needed anymore.
+			defer func() {
+				for _, p := range queued {
+					p.buffer.Release()
+				}
+			}()
 		}
+	}
+
+	if s.maxHandshakes > 0 && s.handshakeCount.Load() >= int64(s.maxHandshakes) {
+		s.logger.Debugf("Rejecting new connection. Too many handshakes in progress (max %d).", s.maxHandshakes)
+		s.refuseConnection(p, hdr, logging.ConnectionRefusedHandshakeLimit)
+		return nil
+	}
+	if s.rateLimiter != nil && !s.rateLimiter.Allow(p.remoteAddr, p.rcvTime) {
+		s.logger.Debugf("Rejecting new connection from %s. Handshake rate limit exceeded.", p.remoteAddr)
+		s.refuseConnection(p, hdr, logging.ConnectionRefusedRateLimited)
+		return nil
+	}
+
+	if queueLen := len(s.connQueue); !s.holdConnsOnFullQueue && queueLen >= cap(s.connQueue) {
+		s.logger.Debugf("Rejecting new connection. Server currently busy. Accept queue length: %d (max %d)", queueLen, cap(s.connQueue))
+		s.refuseConnection(p, hdr, logging.ConnectionRefusedAcceptQueueFull)
 		return nil
 	}
 
+	// Only record the token once the connection attempt passed all admission checks.
+	// Otherwise, a client that is refused couldn't use the token on its next attempt.
+	if clientAddrIsValid && !token.IsRetryToken && s.tokenReplayCache != nil &&
+		s.tokenReplayCache.Seen(hdr.Token, token.SentTime.Add(s.maxTokenAge)) {
+		s.logger.Debugf("Ignoring token from %s that was already used before.", p.remoteAddr)
+		clientAddrIsValid = false
+		if s.requireAddressValidation(p.remoteAddr) {
+			s.queueRetry(p, hdr)
+			return nil
+		}
+	}
+
 	connID, err := s.connIDGenerator.GenerateConnectionID()
 	if err != nil {
 		return err
@@ -623,7 +757,16 @@ func (s *baseServer) handleInitialImpl(p receivedPacket, hdr *wire.Header) error
 	if added := s.connHandler.AddWithConnID(hdr.DestConnectionID, connID, func() (packetHandler, bool) {
 		config := s.config
 		if s.config.GetConfigForClient != nil {
-			conf, err := s.config.GetConfigForClient(&ClientHelloInfo{RemoteAddr: p.remoteAddr})
+			info := &ClientHelloInfo{
+				RemoteAddr:   p.remoteAddr,
+				Version:      hdr.Version,
+				AddrVerified: clientAddrIsValid,
+			}
+			if clientHello != nil {
+				info.ServerName = clientHello.ServerName
+				info.SupportedProtos = clientHello.ALPNs
+			}
+			conf, err := s.config.GetConfigForClient(info)
 			if err != nil {
 				s.logger.Debugf("Rejecting new connection due to GetConfigForClient callback")
 				return nil, false
@@ -658,6 +801,10 @@ func (s *baseServer) handleInitialImpl(p receivedPacket, hdr *wire.Header) error
 			s.logger,
 			hdr.Version,
 		)
+		for _, p := range queued {
+			conn.handlePacket(p)
+		}
+		queued = nil
 		conn.handlePacket(p)
 
 		if q, ok := s.zeroRTTQueues[hdr.DestConnectionID]; ok {
@@ -677,6 +824,9 @@ func (s *baseServer) handleInitialImpl(p receivedPacket, hdr *wire.Header) error
 		}
 		return nil
 	}
+	if s.trackHandshakes() {
+		s.handshakeCount.Add(1)
+	}
 	go conn.run()
 	go s.handleNewConn(conn)
 	if conn == nil {
@@ -686,9 +836,50 @@ func (s *baseServer) handleInitialImpl(p receivedPacket, hdr *wire.Header) error
 	return nil
 }
 
+// requireAddressValidation says if the client needs to validate its address before we create a connection.
+// This is the case if the application requires it, or if there are too many handshakes in progress.
+func (s *baseServer) requireAddressValidation(addr net.Addr) bool {
+	if s.addressValidationThreshold > 0 && s.handshakeCount.Load() >= int64(s.addressValidationThreshold) {
+		return true
+	}
+	return s.config.RequireAddressValidation(addr)
+}
+
+func (s *baseServer) trackHandshakes() bool {
+	return s.maxHandshakes > 0 || s.addressValidationThreshold > 0
+}
+
+// handshakeDone is called when a handshake completes or fails.
+func (s *baseServer) handshakeDone() {
+	if s.trackHandshakes() {
+		s.handshakeCount.Add(-1)
+	}
+}
+
+func (s *baseServer) refuseConnection(p receivedPacket, hdr *wire.Header, reason logging.ConnectionRefusedReason) {
+	if s.tracer != nil && s.tracer.RefusedConnection != nil {
+		s.tracer.RefusedConnection(p.remoteAddr, reason)
+	}
+	select {
+	case s.connectionRefusedQueue <- rejectedPacket{receivedPacket: p, hdr: hdr}:
+	default:
+		// drop packet if we can't send out the CONNECTION_REFUSED fast enough
+		p.buffer.Release()
+	}
+}
+
 func (s *baseServer) handleNewConn(conn quicConn) {
 	connCtx := conn.Context()
 	if s.acceptEarlyConns {
+		if s.trackHandshakes() {
+			go func() {
+				select {
+				case <-conn.HandshakeComplete():
+				case <-connCtx.Done():
+				}
+				s.handshakeDone()
+			}()
+		}
 		// wait until the early connection is ready, the handshake fails, or the server is closed
 		select {
 		case <-s.errorChan:
@@ -702,17 +893,35 @@ func (s *baseServer) handleNewConn(conn quicConn) {
 		// wait until the handshake is complete (or fails)
 		select {
 		case <-s.errorChan:
+			s.handshakeDone()
 			conn.closeWithTransportError(ConnectionRefused)
 			return
 		case <-conn.HandshakeComplete():
+			// Like for early connections, the handshake doesn't count against the limit
+			// while the connection waits in the accept queue.
+			s.handshakeDone()
 		case <-connCtx.Done():
+			s.handshakeDone()
 			return
 		}
 	}
 
+	if s.holdConnsOnFullQueue {
+		// wait until there's space in the accept queue, the connection is closed, or the server is closed
+		select {
+		case s.connQueue <- conn:
+		case <-s.errorChan:
+			conn.closeWithTransportError(ConnectionRefused)
+		case <-connCtx.Done():
+		}
+		return
+	}
 	select {
 	case s.connQueue <- conn:
 	default:
+		if s.tracer != nil && s.tracer.RefusedConnection != nil {
+			s.tracer.RefusedConnection(conn.RemoteAddr(), logging.ConnectionRefusedAcceptQueueFull)
+		}
 		conn.destroy(&qerr.TransportError{ErrorCode: ConnectionRefused})
 	}
 }
@@ -25,6 +25,21 @@ import (
 	"go.uber.org/mock/gomock"
 )
 
+// testTokenSource embeds data into tokens, and rejects all tokens
+type testTokenSource struct {
+	data      []byte
+	validated []byte
+}
+
+var _ TokenSource = &testTokenSource{}
+
+func (s *testTokenSource) TokenData(net.Addr) ([]byte, error) { return s.data, nil }
+
+func (s *testTokenSource) ValidateToken(_ net.Addr, _ time.Time, data []byte) bool {
+	s.validated = data
+	return false
+}
+
 var _ = Describe("Server", func() {
 	var (
 		conn    *MockPacketConn
@@ -106,6 +121,13 @@ var _ = Describe("Server", func() {
 		Expect(err.Error()).To(ContainSubstring("quic: tls.Config not set"))
 	})
 
+	It("errors when the accept queue size is negative", func() {
+		tr := &Transport{Conn: conn, AcceptQueueSize: -1}
+		defer tr.Close()
+		_, err := tr.Listen(tlsConf, nil)
+		Expect(err).To(MatchError("quic: invalid accept queue size: -1"))
+	})
+
 	It("errors when the Config contains an invalid version", func() {
 		version := protocol.VersionNumber(0x1234)
 		_, err := Listen(nil, tlsConf, &Config{Versions: []protocol.VersionNumber{version}})
@@ -148,6 +170,14 @@ var _ = Describe("Server", func() {
 		Expect(ln.Close()).To(Succeed())
 	})
 
+	It("uses the accept queue size configured on the Transport", func() {
+		tr := &Transport{Conn: conn, AcceptQueueSize: 100}
+		ln, err := tr.Listen(tlsConf, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cap(ln.baseServer.connQueue)).To(Equal(100))
+		Expect(tr.Close()).To(Succeed())
+	})
+
 	It("listens on a given address", func() {
 		addr := "127.0.0.1:13579"
 		ln, err := ListenAddr(addr, tlsConf, &Config{})
@@ -663,16 +693,16 @@ var _ = Describe("Server", func() {
 					return conn
 				}
 
-				phm.EXPECT().Get(gomock.Any()).Times(protocol.MaxAcceptQueueSize + 1)
+				phm.EXPECT().Get(gomock.Any()).Times(protocol.DefaultAcceptQueueSize + 1)
 				phm.EXPECT().AddWithConnID(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_, _ protocol.ConnectionID, fn func() (packetHandler, bool)) bool {
 					phm.EXPECT().GetStatelessResetToken(gomock.Any())
 					_, ok := fn()
 					return ok
-				}).Times(protocol.MaxAcceptQueueSize)
+				}).Times(protocol.DefaultAcceptQueueSize)
 
 				var wg sync.WaitGroup
-				wg.Add(protocol.MaxAcceptQueueSize)
-				for i := 0; i < protocol.MaxAcceptQueueSize; i++ {
+				wg.Add(protocol.DefaultAcceptQueueSize)
+				for i := 0; i < protocol.DefaultAcceptQueueSize; i++ {
 					go func() {
 						defer GinkgoRecover()
 						defer wg.Done()
@@ -685,6 +715,7 @@ var _ = Describe("Server", func() {
 				p := getInitialWithRandomDestConnID()
 				hdr, _, _, err := wire.ParsePacket(p.data)
 				Expect(err).ToNot(HaveOccurred())
+				tracer.EXPECT().RefusedConnection(p.remoteAddr, logging.ConnectionRefusedAcceptQueueFull)
 				tracer.EXPECT().SentPacket(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any())
 				done := make(chan struct{})
 				conn.EXPECT().WriteTo(gomock.Any(), p.remoteAddr).DoAndReturn(func(b []byte, _ net.Addr) (int, error) {
@@ -699,6 +730,204 @@ var _ = Describe("Server", func() {
 				serv.handlePacket(p)
 				Eventually(done).Should(BeClosed())
 			})
+
+			It("holds connections if the accept queue is full", func() {
+				serv.holdConnsOnFullQueue = true
+				serv.connQueue = make(chan quicConn, 1)
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				var conns []*MockQUICConn
+				serv.newConn = func(
+					_ sendConn,
+					_ connRunner,
+					_ protocol.ConnectionID,
+					_ *protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ ConnectionIDGenerator,
+					_ protocol.StatelessResetToken,
+					_ *Config,
+					_ *tls.Config,
+					_ *handshake.TokenGenerator,
+					_ bool,
+					_ *logging.ConnectionTracer,
+					_ uint64,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) quicConn {
+					conn := NewMockQUICConn(mockCtrl)
+					conn.EXPECT().handlePacket(gomock.Any())
+					conn.EXPECT().run()
+					conn.EXPECT().Context().Return(ctx)
+					c := make(chan struct{})
+					close(c)
+					conn.EXPECT().HandshakeComplete().Return(c)
+					conns = append(conns, conn)
+					return conn
+				}
+
+				phm.EXPECT().Get(gomock.Any()).Times(3)
+				phm.EXPECT().AddWithConnID(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_, _ protocol.ConnectionID, fn func() (packetHandler, bool)) bool {
+					phm.EXPECT().GetStatelessResetToken(gomock.Any())
+					_, ok := fn()
+					return ok
+				}).Times(3)
+				for i := 0; i < 3; i++ {
+					serv.handlePacket(getInitialWithRandomDestConnID())
+				}
+				Eventually(func() int { return len(serv.connQueue) }).Should(Equal(1))
+				// make sure there are no Write calls on the packet conn
+				time.Sleep(50 * time.Millisecond)
+
+				for i := 0; i < 3; i++ {
+					c, err := serv.Accept(context.Background())
+					Expect(err).ToNot(HaveOccurred())
+					Expect(c).To(BeElementOf(conns))
+				}
+			})
+
+			It("refuses new connection attempts if too many handshakes are in progress", func() {
+				serv.maxHandshakes = 2
+				serv.handshakeCount.Store(2)
+				p := getInitialWithRandomDestConnID()
+				hdr := parseHeader(p.data)
+				phm.EXPECT().Get(hdr.DestConnectionID)
+				tracer.EXPECT().RefusedConnection(p.remoteAddr, logging.ConnectionRefusedHandshakeLimit)
+				tracer.EXPECT().SentPacket(p.remoteAddr, gomock.Any(), gomock.Any(), gomock.Any())
+				done := make(chan struct{})
+				conn.EXPECT().WriteTo(gomock.Any(), p.remoteAddr).DoAndReturn(func(b []byte, _ net.Addr) (int, error) {
+					defer close(done)
+					rejectHdr := parseHeader(b)
+					Expect(rejectHdr.Type).To(Equal(protocol.PacketTypeInitial))
+					Expect(rejectHdr.DestConnectionID).To(Equal(hdr.SrcConnectionID))
+					Expect(rejectHdr.SrcConnectionID).To(Equal(hdr.DestConnectionID))
+					return len(b), nil
+				})
+				serv.handlePacket(p)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("sends a Retry if the address validation threshold is reached", func() {
+				serv.addressValidationThreshold = 2
+				serv.handshakeCount.Store(2)
+				p := getInitialWithRandomDestConnID()
+				hdr := parseHeader(p.data)
+				phm.EXPECT().Get(hdr.DestConnectionID)
+				tracer.EXPECT().SentPacket(p.remoteAddr, gomock.Any(), gomock.Any(), nil)
+				done := make(chan struct{})
+				conn.EXPECT().WriteTo(gomock.Any(), p.remoteAddr).DoAndReturn(func(b []byte, _ net.Addr) (int, error) {
+					defer close(done)
+					Expect(parseHeader(b).Type).To(Equal(protocol.PacketTypeRetry))
+					return len(b), nil
+				})
+				serv.handlePacket(p)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("refuses new connection attempts exceeding the handshake rate limit", func() {
+				serv.rateLimiter = newHandshakeRateLimiter(&HandshakeRateLimit{Rate: 1})
+				p := getInitialWithRandomDestConnID()
+				p.rcvTime = time.Now()
+				Expect(serv.rateLimiter.Allow(p.remoteAddr, p.rcvTime)).To(BeTrue())
+				hdr := parseHeader(p.data)
+				phm.EXPECT().Get(hdr.DestConnectionID)
+				tracer.EXPECT().RefusedConnection(p.remoteAddr, logging.ConnectionRefusedRateLimited)
+				tracer.EXPECT().SentPacket(p.remoteAddr, gomock.Any(), gomock.Any(), gomock.Any())
+				done := make(chan struct{})
+				conn.EXPECT().WriteTo(gomock.Any(), p.remoteAddr).DoAndReturn(func(b []byte, _ net.Addr) (int, error) {
+					defer close(done)
+					Expect(parseHeader(b).Type).To(Equal(protocol.PacketTypeInitial))
+					return len(b), nil
+				})
+				serv.handlePacket(p)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("tracks the number of handshakes in progress", func() {
+				serv.maxHandshakes = 10
+				handshakeChan := make(chan struct{})
+				serv.newConn = func(
+					_ sendConn,
+					_ connRunner,
+					_ protocol.ConnectionID,
+					_ *protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ ConnectionIDGenerator,
+					_ protocol.StatelessResetToken,
+					_ *Config,
+					_ *tls.Config,
+					_ *handshake.TokenGenerator,
+					_ bool,
+					_ *logging.ConnectionTracer,
+					_ uint64,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) quicConn {
+					conn := NewMockQUICConn(mockCtrl)
+					conn.EXPECT().handlePacket(gomock.Any())
+					conn.EXPECT().run()
+					conn.EXPECT().Context().Return(context.Background())
+					conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+					return conn
+				}
+				phm.EXPECT().Get(gomock.Any())
+				phm.EXPECT().AddWithConnID(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_, _ protocol.ConnectionID, fn func() (packetHandler, bool)) bool {
+					phm.EXPECT().GetStatelessResetToken(gomock.Any())
+					_, ok := fn()
+					return ok
+				})
+				serv.handlePacket(getInitialWithRandomDestConnID())
+				Eventually(serv.handshakeCount.Load).Should(BeEquivalentTo(1))
+				close(handshakeChan)
+				Eventually(serv.handshakeCount.Load).Should(BeZero())
+			})
+
+			It("stops counting a handshake when it completes, even if the connection is held in the accept queue", func() {
+				serv.maxHandshakes = 10
+				serv.holdConnsOnFullQueue = true
+				serv.connQueue = make(chan quicConn) // nobody accepts connections
+				handshakeChan := make(chan struct{})
+				serv.newConn = func(
+					_ sendConn,
+					_ connRunner,
+					_ protocol.ConnectionID,
+					_ *protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ ConnectionIDGenerator,
+					_ protocol.StatelessResetToken,
+					_ *Config,
+					_ *tls.Config,
+					_ *handshake.TokenGenerator,
+					_ bool,
+					_ *logging.ConnectionTracer,
+					_ uint64,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) quicConn {
+					conn := NewMockQUICConn(mockCtrl)
+					conn.EXPECT().handlePacket(gomock.Any())
+					conn.EXPECT().run()
+					conn.EXPECT().Context().Return(context.Background())
+					conn.EXPECT().closeWithTransportError(ConnectionRefused).MaxTimes(1) // when the server is closed
+					conn.EXPECT().HandshakeComplete().Return(handshakeChan)
+					return conn
+				}
+				phm.EXPECT().Get(gomock.Any())
+				phm.EXPECT().AddWithConnID(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_, _ protocol.ConnectionID, fn func() (packetHandler, bool)) bool {
+					phm.EXPECT().GetStatelessResetToken(gomock.Any())
+					_, ok := fn()
+					return ok
+				})
+				serv.handlePacket(getInitialWithRandomDestConnID())
+				Eventually(serv.handshakeCount.Load).Should(BeEquivalentTo(1))
+				close(handshakeChan)
+				Eventually(serv.handshakeCount.Load).Should(BeZero())
+			})
 		})
 
 		Context("token validation", func() {
@@ -875,6 +1104,97 @@ var _ = Describe("Server", func() {
 				Eventually(done).Should(BeClosed())
 			})
 
+			It("sends a Retry, if a non-retry token is replayed", func() {
+				serv.config.RequireAddressValidation = func(net.Addr) bool { return true }
+				serv.tokenReplayCache = NewMemoryTokenReplayCache(10)
+				raddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+				token, err := serv.tokenGenerator.NewToken(raddr)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(serv.tokenReplayCache.Seen(token, time.Now().Add(time.Hour))).To(BeFalse())
+				hdr := &wire.Header{
+					Type:             protocol.PacketTypeInitial,
+					SrcConnectionID:  protocol.ParseConnectionID([]byte{5, 4, 3, 2, 1}),
+					DestConnectionID: protocol.ParseConnectionID([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}),
+					Token:            token,
+					Version:          protocol.Version1,
+				}
+				packet := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				packet.remoteAddr = raddr
+				tracer.EXPECT().SentPacket(packet.remoteAddr, gomock.Any(), gomock.Any(), gomock.Any()).Do(func(_ net.Addr, replyHdr *logging.Header, _ logging.ByteCount, frames []logging.Frame) {
+					Expect(replyHdr.Type).To(Equal(protocol.PacketTypeRetry))
+				})
+				done := make(chan struct{})
+				conn.EXPECT().WriteTo(gomock.Any(), raddr).DoAndReturn(func(b []byte, _ net.Addr) (int, error) {
+					defer close(done)
+					return len(b), nil
+				})
+				phm.EXPECT().Get(gomock.Any())
+				serv.handlePacket(packet)
+				Eventually(done).Should(BeClosed())
+			})
+
+			It("doesn't record a token in the replay cache if the connection attempt is refused", func() {
+				serv.maxHandshakes = 2
+				serv.handshakeCount.Store(2)
+				serv.tokenReplayCache = NewMemoryTokenReplayCache(10)
+				raddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+				token, err := serv.tokenGenerator.NewToken(raddr)
+				Expect(err).ToNot(HaveOccurred())
+				hdr := &wire.Header{
+					Type:             protocol.PacketTypeInitial,
+					SrcConnectionID:  protocol.ParseConnectionID([]byte{5, 4, 3, 2, 1}),
+					DestConnectionID: protocol.ParseConnectionID([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}),
+					Token:            token,
+					Version:          protocol.Version1,
+				}
+				packet := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				packet.remoteAddr = raddr
+				tracer.EXPECT().RefusedConnection(raddr, logging.ConnectionRefusedHandshakeLimit)
+				tracer.EXPECT().SentPacket(raddr, gomock.Any(), gomock.Any(), gomock.Any())
+				done := make(chan struct{})
+				conn.EXPECT().WriteTo(gomock.Any(), raddr).DoAndReturn(func(b []byte, _ net.Addr) (int, error) {
+					defer close(done)
+					return len(b), nil
+				})
+				phm.EXPECT().Get(gomock.Any())
+				serv.handlePacket(packet)
+				Eventually(done).Should(BeClosed())
+				// the token can still be used for the next connection attempt
+				Expect(serv.tokenReplayCache.Seen(token, time.Now().Add(time.Hour))).To(BeFalse())
+			})
+
+			It("sends a Retry, if the TokenSource rejects a non-retry token", func() {
+				serv.config.RequireAddressValidation = func(net.Addr) bool { return true }
+				serv.maxTokenAge = time.Hour
+				ts := &testTokenSource{data: []byte("foobar")}
+				serv.tokenSource = ts
+				serv.tokenGenerator.SetTokenData(ts.TokenData)
+				raddr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1337}
+				token, err := serv.tokenGenerator.NewToken(raddr)
+				Expect(err).ToNot(HaveOccurred())
+				hdr := &wire.Header{
+					Type:             protocol.PacketTypeInitial,
+					SrcConnectionID:  protocol.ParseConnectionID([]byte{5, 4, 3, 2, 1}),
+					DestConnectionID: protocol.ParseConnectionID([]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}),
+					Token:            token,
+					Version:          protocol.Version1,
+				}
+				packet := getPacket(hdr, make([]byte, protocol.MinInitialPacketSize))
+				packet.remoteAddr = raddr
+				tracer.EXPECT().SentPacket(packet.remoteAddr, gomock.Any(), gomock.Any(), gomock.Any()).Do(func(_ net.Addr, replyHdr *logging.Header, _ logging.ByteCount, frames []logging.Frame) {
+					Expect(replyHdr.Type).To(Equal(protocol.PacketTypeRetry))
+				})
+				done := make(chan struct{})
+				conn.EXPECT().WriteTo(gomock.Any(), raddr).DoAndReturn(func(b []byte, _ net.Addr) (int, error) {
+					defer close(done)
+					return len(b), nil
+				})
+				phm.EXPECT().Get(gomock.Any())
+				serv.handlePacket(packet)
+				Eventually(done).Should(BeClosed())
+				Expect(ts.validated).To(Equal([]byte("foobar")))
+			})
+
 			It("doesn't send an INVALID_TOKEN error, if the packet is corrupted", func() {
 				serv.config.RequireAddressValidation = func(net.Addr) bool { return true }
 				token, err := serv.tokenGenerator.NewRetryToken(&net.UDPAddr{}, protocol.ConnectionID{}, protocol.ConnectionID{})
@@ -1036,6 +1356,181 @@ var _ = Describe("Server", func() {
 				Eventually(done).Should(BeClosed())
 			})
 
+			It("passes information from the ClientHello to GetConfigClient", func() {
+				conn := NewMockQUICConn(mockCtrl)
+				var info *ClientHelloInfo
+				serv.config = populateServerConfig(&Config{
+					GetConfigForClient: func(i *ClientHelloInfo) (*Config, error) {
+						info = i
+						return nil, nil
+					},
+				})
+				serv.newConn = func(
+					_ sendConn,
+					_ connRunner,
+					_ protocol.ConnectionID,
+					_ *protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ ConnectionIDGenerator,
+					_ protocol.StatelessResetToken,
+					_ *Config,
+					_ *tls.Config,
+					_ *handshake.TokenGenerator,
+					_ bool,
+					_ *logging.ConnectionTracer,
+					_ uint64,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) quicConn {
+					conn.EXPECT().handlePacket(gomock.Any()).Times(2) // the queued packet, and the packet completing the ClientHello
+					conn.EXPECT().HandshakeComplete().Return(make(chan struct{}))
+					conn.EXPECT().run()
+					conn.EXPECT().Context().Return(context.Background())
+					conn.EXPECT().closeWithTransportError(gomock.Any()).MaxTimes(1)
+					return conn
+				}
+
+				connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4})
+				ch := composeClientHello("quic-go.net", "h3", "foo")
+				handleInitial := func(p receivedPacket) {
+					hdr, _, _, err := wire.ParsePacket(p.data)
+					Expect(err).ToNot(HaveOccurred())
+					Expect(serv.handleInitialImpl(p, hdr)).To(Succeed())
+				}
+				// The first packet only contains the second half of the ClientHello.
+				phm.EXPECT().Get(connID)
+				handleInitial(composeClientInitial(connID, 1, &wire.CryptoFrame{Offset: 100, Data: ch[100:]}))
+				Expect(info).To(BeNil())
+
+				phm.EXPECT().Get(connID)
+				phm.EXPECT().AddWithConnID(connID, gomock.Any(), gomock.Any()).DoAndReturn(func(_, _ protocol.ConnectionID, fn func() (packetHandler, bool)) bool {
+					phm.EXPECT().GetStatelessResetToken(gomock.Any())
+					_, ok := fn()
+					return ok
+				})
+				handleInitial(composeClientInitial(connID, 0, &wire.CryptoFrame{Data: ch[:100]}))
+				Expect(info).ToNot(BeNil())
+				Expect(info.RemoteAddr).To(Equal(clientInitialRemoteAddr))
+				Expect(info.ServerName).To(Equal("quic-go.net"))
+				Expect(info.SupportedProtos).To(Equal([]string{"h3", "foo"}))
+				Expect(info.Version).To(Equal(protocol.Version1))
+				Expect(info.AddrVerified).To(BeFalse())
+				Expect(serv.clientHelloQueues).To(BeEmpty())
+			})
+
+			It("drops Initial packets if the ClientHello is not completed in time", func() {
+				serv.config = populateServerConfig(&Config{
+					GetConfigForClient: func(*ClientHelloInfo) (*Config, error) {
+						Fail("GetConfigForClient should not have been called")
+						return nil, nil
+					},
+				})
+				connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4})
+				ch := composeClientHello("quic-go.net")
+				p := composeClientInitial(connID, 1, &wire.CryptoFrame{Offset: 100, Data: ch[100:]})
+				phm.EXPECT().Get(connID)
+				Expect(serv.handlePacketImpl(p)).To(BeTrue())
+				Expect(serv.clientHelloQueues).To(HaveLen(1))
+
+				tracer.EXPECT().DroppedPacket(clientInitialRemoteAddr, logging.PacketTypeInitial, p.Size(), logging.PacketDropDOSPrevention)
+				// receiving any packet triggers the cleanup
+				vnp := getPacket(&wire.Header{
+					Type:             protocol.PacketTypeHandshake,
+					SrcConnectionID:  protocol.ParseConnectionID([]byte{1, 2, 3, 4, 5}),
+					DestConnectionID: protocol.ParseConnectionID([]byte{1, 2, 3, 4, 5, 6, 7, 8}),
+					Version:          protocol.Version1,
+				}, make([]byte, protocol.MinInitialPacketSize))
+				vnp.rcvTime = p.rcvTime.Add(protocol.MaxClientHelloQueueingDuration + time.Millisecond)
+				tracer.EXPECT().DroppedPacket(gomock.Any(), logging.PacketTypeHandshake, gomock.Any(), logging.PacketDropUnexpectedPacket)
+				serv.handlePacketImpl(vnp)
+				Expect(serv.clientHelloQueues).To(BeEmpty())
+			})
+
+			It("uses the ClientHello parsed by the listener router", func() {
+				conn := NewMockQUICConn(mockCtrl)
+				var info *ClientHelloInfo
+				serv.config = populateServerConfig(&Config{
+					GetConfigForClient: func(i *ClientHelloInfo) (*Config, error) {
+						info = i
+						return nil, nil
+					},
+				})
+				serv.newConn = func(
+					_ sendConn,
+					_ connRunner,
+					_ protocol.ConnectionID,
+					_ *protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ protocol.ConnectionID,
+					_ ConnectionIDGenerator,
+					_ protocol.StatelessResetToken,
+					_ *Config,
+					_ *tls.Config,
+					_ *handshake.TokenGenerator,
+					_ bool,
+					_ *logging.ConnectionTracer,
+					_ uint64,
+					_ utils.Logger,
+					_ protocol.VersionNumber,
+				) quicConn {
+					conn.EXPECT().handlePacket(gomock.Any())
+					conn.EXPECT().HandshakeComplete().Return(make(chan struct{}))
+					conn.EXPECT().run()
+					conn.EXPECT().Context().Return(context.Background())
+					conn.EXPECT().closeWithTransportError(gomock.Any()).MaxTimes(1)
+					return conn
+				}
+
+				connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4})
+				ch := composeClientHello("quic-go.net", "h3")
+				// The packet only contains the second half of the ClientHello,
+				// but the listener router already reassembled the ClientHello.
+				p := composeClientInitial(connID, 1, &wire.CryptoFrame{Offset: 100, Data: ch[100:]})
+				p.clientHello = &handshake.ClientHello{ServerName: "quic-go.net", ALPNs: []string{"h3"}}
+				hdr, _, _, err := wire.ParsePacket(p.data)
+				Expect(err).ToNot(HaveOccurred())
+				phm.EXPECT().Get(connID)
+				phm.EXPECT().AddWithConnID(connID, gomock.Any(), gomock.Any()).DoAndReturn(func(_, _ protocol.ConnectionID, fn func() (packetHandler, bool)) bool {
+					phm.EXPECT().GetStatelessResetToken(gomock.Any())
+					_, ok := fn()
+					return ok
+				})
+				Expect(serv.handleInitialImpl(p, hdr)).To(Succeed())
+				Expect(info).ToNot(BeNil())
+				Expect(info.ServerName).To(Equal("quic-go.net"))
+				Expect(info.SupportedProtos).To(Equal([]string{"h3"}))
+				Expect(serv.clientHelloQueues).To(BeEmpty())
+			})
+
+			It("validates the client's address before queueing Initial packets", func() {
+				serv.config = populateServerConfig(&Config{
+					GetConfigForClient: func(*ClientHelloInfo) (*Config, error) {
+						Fail("GetConfigForClient should not have been called")
+						return nil, nil
+					},
+					RequireAddressValidation: func(net.Addr) bool { return true },
+				})
+				connID := protocol.ParseConnectionID([]byte{0xde, 0xad, 0xbe, 0xef, 1, 2, 3, 4})
+				ch := composeClientHello("quic-go.net")
+				p := composeClientInitial(connID, 1, &wire.CryptoFrame{Offset: 100, Data: ch[100:]})
+				done := make(chan struct{})
+				tracer.EXPECT().SentPacket(clientInitialRemoteAddr, gomock.Any(), gomock.Any(), nil).Do(func(_ net.Addr, replyHdr *logging.Header, _ logging.ByteCount, _ []logging.Frame) {
+					Expect(replyHdr.Type).To(Equal(protocol.PacketTypeRetry))
+				})
+				conn.EXPECT().WriteTo(gomock.Any(), clientInitialRemoteAddr).DoAndReturn(func(b []byte, _ net.Addr) (int, error) {
+					defer close(done)
+					Expect(parseHeader(b).Type).To(Equal(protocol.PacketTypeRetry))
+					return len(b), nil
+				})
+				phm.EXPECT().Get(connID)
+				Expect(serv.handlePacketImpl(p)).To(BeTrue())
+				Expect(serv.clientHelloQueues).To(BeEmpty())
+				Eventually(done).Should(BeClosed())
+			})
+
 			It("rejects a connection attempt when GetConfigClient returns an error", func() {
 				serv.config = populateServerConfig(&Config{GetConfigForClient: func(*ClientHelloInfo) (*Config, error) { return nil, errors.New("rejected") }})
 
@@ -1222,12 +1717,12 @@ var _ = Describe("Server", func() {
 				phm.EXPECT().GetStatelessResetToken(gomock.Any())
 				_, ok := fn()
 				return ok
-			}).Times(protocol.MaxAcceptQueueSize)
-			for i := 0; i < protocol.MaxAcceptQueueSize; i++ {
+			}).Times(protocol.DefaultAcceptQueueSize)
+			for i := 0; i < protocol.DefaultAcceptQueueSize; i++ {
 				serv.baseServer.handlePacket(getInitialWithRandomDestConnID())
 			}
 
-			Eventually(serv.baseServer.connQueue).Should(HaveLen(protocol.MaxAcceptQueueSize))
+			Eventually(serv.baseServer.connQueue).Should(HaveLen(protocol.DefaultAcceptQueueSize))
 			// make sure there are no Write calls on the packet conn
 			time.Sleep(50 * time.Millisecond)
 
@@ -88,6 +88,7 @@ var _ Stream = &stream{}
 func newStream(streamID protocol.StreamID,
 	sender streamSender,
 	flowController flowcontrol.StreamFlowController,
+	sendBufferSize protocol.ByteCount,
 ) *stream {
 	s := &stream{sender: sender}
 	senderForSendStream := &uniStreamSender{
@@ -99,7 +100,7 @@ func newStream(streamID protocol.StreamID,
 			s.completedMutex.Unlock()
 		},
 	}
-	s.sendStream = *newSendStream(streamID, senderForSendStream, flowController)
+	s.sendStream = *newSendStream(streamID, senderForSendStream, flowController, sendBufferSize)
 	senderForReceiveStream := &uniStreamSender{
 		streamSender: sender,
 		onStreamCompletedImpl: func() {
@@ -41,7 +41,7 @@ var _ = Describe("Stream", func() {
 	BeforeEach(func() {
 		mockSender = NewMockStreamSender(mockCtrl)
 		mockFC = mocks.NewMockStreamFlowController(mockCtrl)
-		str = newStream(streamID, mockSender, mockFC)
+		str = newStream(streamID, mockSender, mockFC, 0)
 
 		timeout := scaleDuration(250 * time.Millisecond)
 		strWithTimeout = struct {
@@ -52,6 +52,7 @@ type streamsMap struct {
 
 	sender            streamSender
 	newFlowController func(protocol.StreamID) flowcontrol.StreamFlowController
+	sendBufferSize    protocol.ByteCount
 
 	mutex               sync.Mutex
 	outgoingBidiStreams *outgoingStreamsMap[streamI]
@@ -68,6 +69,7 @@ func newStreamsMap(
 	newFlowController func(protocol.StreamID) flowcontrol.StreamFlowController,
 	maxIncomingBidiStreams uint64,
 	maxIncomingUniStreams uint64,
+	sendBufferSize protocol.ByteCount,
 	perspective protocol.Perspective,
 ) streamManager {
 	m := &streamsMap{
@@ -75,6 +77,7 @@ func newStreamsMap(
 		newFlowController:      newFlowController,
 		maxIncomingBidiStreams: maxIncomingBidiStreams,
 		maxIncomingUniStreams:  maxIncomingUniStreams,
+		sendBufferSize:         sendBufferSize,
 		sender:                 sender,
 	}
 	m.initMaps()
@@ -86,7 +89,7 @@ func (m *streamsMap) initMaps() {
 		protocol.StreamTypeBidi,
 		func(num protocol.StreamNum) streamI {
 			id := num.StreamID(protocol.StreamTypeBidi, m.perspective)
-			return newStream(id, m.sender, m.newFlowController(id))
+			return newStream(id, m.sender, m.newFlowController(id), m.sendBufferSize)
 		},
 		m.sender.queueControlFrame,
 	)
@@ -94,7 +97,7 @@ func (m *streamsMap) initMaps() {
 		protocol.StreamTypeBidi,
 		func(num protocol.StreamNum) streamI {
 			id := num.StreamID(protocol.StreamTypeBidi, m.perspective.Opposite())
-			return newStream(id, m.sender, m.newFlowController(id))
+			return newStream(id, m.sender, m.newFlowController(id), m.sendBufferSize)
 		},
 		m.maxIncomingBidiStreams,
 		m.sender.queueControlFrame,
@@ -103,7 +106,7 @@ func (m *streamsMap) initMaps() {
 		protocol.StreamTypeUni,
 		func(num protocol.StreamNum) sendStreamI {
 			id := num.StreamID(protocol.StreamTypeUni, m.perspective)
-			return newSendStream(id, m.sender, m.newFlowController(id))
+			return newSendStream(id, m.sender, m.newFlowController(id), m.sendBufferSize)
 		},
 		m.sender.queueControlFrame,
 	)
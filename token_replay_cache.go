@@ -0,0 +1,81 @@
+package quic
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go/internal/protocol"
+)
+
+type replayCacheEntry struct {
+	token  string
+	expiry time.Time
+}
+
+// replayCacheQueue is a min-heap of tokens, ordered by their expiry
+type replayCacheQueue []replayCacheEntry
+
+var _ heap.Interface = &replayCacheQueue{}
+
+func (q replayCacheQueue) Len() int           { return len(q) }
+func (q replayCacheQueue) Less(i, j int) bool { return q[i].expiry.Before(q[j].expiry) }
+func (q replayCacheQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+func (q *replayCacheQueue) Push(x any)        { *q = append(*q, x.(replayCacheEntry)) }
+func (q *replayCacheQueue) Pop() any {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	*q = old[:n-1]
+	return e
+}
+
+type memoryTokenReplayCache struct {
+	mutex    sync.Mutex
+	capacity int
+	tokens   map[string]struct{}
+	// queue contains the same tokens as the map, such that expired tokens can be removed
+	// without iterating over all tokens
+	queue replayCacheQueue
+}
+
+var _ TokenReplayCache = &memoryTokenReplayCache{}
+
+// NewMemoryTokenReplayCache creates an in-memory TokenReplayCache that stores up to capacity tokens.
+// Once the capacity is reached, tokens are treated as replayed until previously stored tokens expire.
+// This means that clients might need to validate their address using a Retry.
+// If capacity is not positive, a default capacity of 65536 tokens is used.
+func NewMemoryTokenReplayCache(capacity int) TokenReplayCache {
+	if capacity < 1 {
+		capacity = protocol.DefaultTokenReplayCacheCapacity
+	}
+	return &memoryTokenReplayCache{
+		capacity: capacity,
+		tokens:   make(map[string]struct{}),
+	}
+}
+
+func (c *memoryTokenReplayCache) Seen(token []byte, expiry time.Time) bool {
+	now := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.removeExpired(now)
+	if _, ok := c.tokens[string(token)]; ok {
+		return true
+	}
+	if len(c.tokens) >= c.capacity {
+		return true
+	}
+	c.tokens[string(token)] = struct{}{}
+	heap.Push(&c.queue, replayCacheEntry{token: string(token), expiry: expiry})
+	return false
+}
+
+func (c *memoryTokenReplayCache) removeExpired(now time.Time) {
+	for len(c.queue) > 0 && !c.queue[0].expiry.After(now) {
+		e := heap.Pop(&c.queue).(replayCacheEntry)
+		delete(c.tokens, e.token)
+	}
+}
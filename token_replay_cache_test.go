@@ -0,0 +1,60 @@
+package quic
+
+import (
+	"time"
+
+	"github.com/quic-go/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Token Replay Cache", func() {
+	It("detects replayed tokens", func() {
+		c := NewMemoryTokenReplayCache(10)
+		expiry := time.Now().Add(time.Hour)
+		Expect(c.Seen([]byte("foo"), expiry)).To(BeFalse())
+		Expect(c.Seen([]byte("bar"), expiry)).To(BeFalse())
+		Expect(c.Seen([]byte("foo"), expiry)).To(BeTrue())
+		Expect(c.Seen([]byte("bar"), expiry)).To(BeTrue())
+	})
+
+	It("forgets expired tokens", func() {
+		c := NewMemoryTokenReplayCache(10)
+		Expect(c.Seen([]byte("foo"), time.Now().Add(-time.Second))).To(BeFalse())
+		Expect(c.Seen([]byte("foo"), time.Now().Add(time.Hour))).To(BeFalse())
+		Expect(c.Seen([]byte("foo"), time.Now().Add(time.Hour))).To(BeTrue())
+	})
+
+	It("treats tokens as replayed when the capacity is reached", func() {
+		c := NewMemoryTokenReplayCache(2).(*memoryTokenReplayCache)
+		Expect(c.Seen([]byte("foo"), time.Now().Add(time.Hour))).To(BeFalse())
+		Expect(c.Seen([]byte("bar"), time.Now().Add(-time.Second))).To(BeFalse())
+		// The expired token is removed to make space for the new one.
+		Expect(c.Seen([]byte("baz"), time.Now().Add(time.Hour))).To(BeFalse())
+		Expect(c.tokens).To(HaveLen(2))
+		Expect(c.Seen([]byte("qux"), time.Now().Add(time.Hour))).To(BeTrue())
+	})
+
+	It("removes tokens in the order they expire", func() {
+		c := NewMemoryTokenReplayCache(10).(*memoryTokenReplayCache)
+		now := time.Now()
+		Expect(c.Seen([]byte("foo"), now.Add(time.Hour))).To(BeFalse())
+		Expect(c.Seen([]byte("bar"), now.Add(-2*time.Second))).To(BeFalse())
+		Expect(c.Seen([]byte("baz"), now.Add(2*time.Hour))).To(BeFalse())
+		Expect(c.Seen([]byte("qux"), now.Add(-time.Second))).To(BeFalse())
+		Expect(c.Seen([]byte("foo"), now.Add(time.Hour))).To(BeTrue())
+		Expect(c.tokens).To(HaveLen(2))
+		Expect(c.tokens).To(HaveKey("foo"))
+		Expect(c.tokens).To(HaveKey("baz"))
+		Expect(c.queue).To(HaveLen(2))
+		Expect(c.queue[0].token).To(Equal("foo"))
+	})
+
+	It("uses a default capacity if the capacity is not positive", func() {
+		c := NewMemoryTokenReplayCache(0).(*memoryTokenReplayCache)
+		Expect(c.capacity).To(Equal(protocol.DefaultTokenReplayCacheCapacity))
+		Expect(c.Seen([]byte("foo"), time.Now().Add(time.Hour))).To(BeFalse())
+		Expect(c.Seen([]byte("foo"), time.Now().Add(time.Hour))).To(BeTrue())
+	})
+})
@@ -5,6 +5,7 @@ import (
 	"crypto/rand"
 	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
 	"sync"
 	"sync/atomic"
@@ -65,6 +66,20 @@ type Transport struct {
 	// see section 8.1.3 of RFC 9000 for details.
 	TokenGeneratorKey *TokenGeneratorKey
 
+	// TokenDecryptionKeys are additional keys used to decrypt tokens.
+	// This allows rotating the TokenGeneratorKey: New tokens are always encrypted using the TokenGeneratorKey,
+	// tokens encrypted with a previous key remain valid as long as that key is listed here.
+	TokenDecryptionKeys []TokenGeneratorKey
+
+	// TokenSource allows embedding application-defined data into the tokens sent in NEW_TOKEN frames,
+	// and validating this data when the token is used.
+	// If nil, tokens are only validated based on their age and the client's address.
+	TokenSource TokenSource
+
+	// TokenReplayCache is used to reject tokens sent in NEW_TOKEN frames that were already used before.
+	// If nil, replayed tokens are not detected.
+	TokenReplayCache TokenReplayCache
+
 	// MaxTokenAge is the maximum age of the resumption token presented during the handshake.
 	// These tokens allow skipping address resumption when resuming a QUIC connection,
 	// and are especially useful when using 0-RTT.
@@ -72,6 +87,36 @@ type Transport struct {
 	// See section 8.1.3 of RFC 9000 for details.
 	MaxTokenAge time.Duration
 
+	// MaxHandshakes is the maximum number of handshakes that a server processes concurrently.
+	// Once this limit is reached, new connection attempts are refused with a CONNECTION_REFUSED error.
+	// If zero, the number of concurrent handshakes is not limited.
+	MaxHandshakes int
+
+	// AddressValidationThreshold is the number of concurrent handshakes above which the server
+	// requires clients to validate their address (by sending a Retry packet) before creating a new connection,
+	// independent of the value returned by Config.RequireAddressValidation.
+	// This prevents an attacker from using spoofed source addresses to exhaust MaxHandshakes.
+	// If zero, address validation is only performed as configured by Config.RequireAddressValidation.
+	AddressValidationThreshold int
+
+	// HandshakeRateLimit limits the rate of new connection attempts per source subnet.
+	// If nil, no rate limit is enforced.
+	HandshakeRateLimit *HandshakeRateLimit
+
+	// AcceptQueueSize is the maximum number of connections that are queued until they are accepted by the application.
+	// Connection attempts that arrive while the queue is full are refused with a CONNECTION_REFUSED error,
+	// unless HoldConnectionsOnFullAcceptQueue is set.
+	// If zero, it defaults to 32.
+	// Negative values are invalid, and cause Listen and ListenEarly to return an error.
+	AcceptQueueSize int
+
+	// HoldConnectionsOnFullAcceptQueue changes the behavior when the accept queue is full:
+	// Instead of refusing new connection attempts, the server continues the handshakes,
+	// and holds the connections until there's space in the accept queue.
+	// This is useful for servers that receive a burst of connection attempts (e.g. after a restart).
+	// Since held connections consume resources, it should be combined with a limit on MaxHandshakes.
+	HoldConnectionsOnFullAcceptQueue bool
+
 	// DisableVersionNegotiationPackets disables the sending of Version Negotiation packets.
 	// This can be useful if version information is exchanged out-of-band.
 	// It has no effect for clients.
@@ -94,6 +139,10 @@ type Transport struct {
 	connIDGenerator ConnectionIDGenerator
 
 	server *baseServer
+	// routes are the Listeners created using ListenWithRoute and ListenEarlyWithRoute.
+	// They take precedence over the server.
+	routes []*routedListener
+	router *listenerRouter // created when the first route is added
 
 	conn rawConn
 
@@ -112,10 +161,11 @@ type Transport struct {
 }
 
 // Listen starts listening for incoming QUIC connections.
-// There can only be a single listener on any net.PacketConn.
+// There can only be a single listener on any net.PacketConn that is not created using ListenWithRoute.
+// This listener handles all connection attempts that don't match any route.
 // Listen may only be called again after the current Listener was closed.
 func (t *Transport) Listen(tlsConf *tls.Config, conf *Config) (*Listener, error) {
-	s, err := t.createServer(tlsConf, conf, false)
+	s, err := t.createServer(nil, tlsConf, conf, false)
 	if err != nil {
 		return nil, err
 	}
@@ -123,20 +173,56 @@ func (t *Transport) Listen(tlsConf *tls.Config, conf *Config) (*Listener, error)
 }
 
 // ListenEarly starts listening for incoming QUIC connections.
-// There can only be a single listener on any net.PacketConn.
+// There can only be a single listener on any net.PacketConn that is not created using ListenEarlyWithRoute.
+// This listener handles all connection attempts that don't match any route.
 // Listen may only be called again after the current Listener was closed.
 func (t *Transport) ListenEarly(tlsConf *tls.Config, conf *Config) (*EarlyListener, error) {
-	s, err := t.createServer(tlsConf, conf, true)
+	s, err := t.createServer(nil, tlsConf, conf, true)
 	if err != nil {
 		return nil, err
 	}
 	return &EarlyListener{baseServer: s}, nil
 }
 
-func (t *Transport) createServer(tlsConf *tls.Config, conf *Config, allow0RTT bool) (*baseServer, error) {
+// ListenWithRoute starts listening for incoming QUIC connections that match the route.
+// Multiple listeners can be created on the same Transport, each handling a different route.
+// Routes are matched in the order the listeners were created.
+// Connection attempts that don't match any route are handled by the listener created using Listen.
+// If there's no such listener, they are refused.
+//
+// Routing requires the server to parse the ClientHello before creating a new connection.
+// Compared to using a single listener, this adds some processing cost to every connection attempt.
+func (t *Transport) ListenWithRoute(route *ListenerRoute, tlsConf *tls.Config, conf *Config) (*Listener, error) {
+	if route == nil {
+		return nil, errors.New("quic: route not set")
+	}
+	s, err := t.createServer(route, tlsConf, conf, false)
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{baseServer: s}, nil
+}
+
+// ListenEarlyWithRoute starts listening for incoming QUIC connections that match the route.
+// See ListenWithRoute for details.
+func (t *Transport) ListenEarlyWithRoute(route *ListenerRoute, tlsConf *tls.Config, conf *Config) (*EarlyListener, error) {
+	if route == nil {
+		return nil, errors.New("quic: route not set")
+	}
+	s, err := t.createServer(route, tlsConf, conf, true)
+	if err != nil {
+		return nil, err
+	}
+	return &EarlyListener{baseServer: s}, nil
+}
+
+func (t *Transport) createServer(route *ListenerRoute, tlsConf *tls.Config, conf *Config, allow0RTT bool) (*baseServer, error) {
 	if tlsConf == nil {
 		return nil, errors.New("quic: tls.Config not set")
 	}
+	if t.AcceptQueueSize < 0 {
+		return nil, fmt.Errorf("quic: invalid accept queue size: %d", t.AcceptQueueSize)
+	}
 	if err := validateConfig(conf); err != nil {
 		return nil, err
 	}
@@ -144,30 +230,77 @@ func (t *Transport) createServer(tlsConf *tls.Config, conf *Config, allow0RTT bo
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
 
-	if t.server != nil {
+	if route == nil && t.server != nil {
 		return nil, errListenerAlreadySet
 	}
 	conf = populateServerConfig(conf)
 	if err := t.init(false); err != nil {
 		return nil, err
 	}
-	s := newServer(
+	var s *baseServer
+	s = newServer(
 		t.conn,
 		t.handlerMap,
 		t.connIDGenerator,
 		tlsConf,
 		conf,
 		t.Tracer,
-		t.closeServer,
+		func() { t.closeServer(s) },
 		*t.TokenGeneratorKey,
+		t.TokenDecryptionKeys,
+		t.TokenSource,
+		t.TokenReplayCache,
 		t.MaxTokenAge,
+		t.MaxHandshakes,
+		t.AddressValidationThreshold,
+		t.HandshakeRateLimit,
+		t.AcceptQueueSize,
+		t.HoldConnectionsOnFullAcceptQueue,
 		t.DisableVersionNegotiationPackets,
 		allow0RTT,
 	)
-	t.server = s
+	if route == nil {
+		t.server = s
+		return s, nil
+	}
+	t.routes = append(t.routes, &routedListener{route: route, server: s})
+	if t.router == nil {
+		t.router = newListenerRouter(t.selectServer, t.defaultServer, t.listening, t.Tracer, t.logger)
+	}
 	return s, nil
 }
 
+// selectServer selects the server for a connection attempt.
+// It returns nil if no server matches.
+func (t *Transport) selectServer(info *ClientHelloInfo) *baseServer {
+	t.mutex.Lock()
+	routes := t.routes
+	server := t.server
+	t.mutex.Unlock()
+
+	// The route is matched without holding the mutex, since it might call into the application.
+	for _, r := range routes {
+		if r.route.matches(info) {
+			return r.server
+		}
+	}
+	return server
+}
+
+// defaultServer returns the server that handles packets that can't be routed.
+// It returns nil if no server is running.
+func (t *Transport) defaultServer() *baseServer {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.server != nil {
+		return t.server
+	}
+	if len(t.routes) > 0 {
+		return t.routes[0].server
+	}
+	return nil
+}
+
 // Dial dials a new connection to a remote host (not using 0-RTT).
 func (t *Transport) Dial(ctx context.Context, addr net.Addr, tlsConf *tls.Config, conf *Config) (Connection, error) {
 	return t.dial(ctx, addr, "", tlsConf, conf, false)
@@ -293,9 +426,18 @@ func (t *Transport) Close() error {
 	return nil
 }
 
-func (t *Transport) closeServer() {
+func (t *Transport) closeServer(s *baseServer) {
 	t.mutex.Lock()
-	t.server = nil
+	if t.server == s {
+		t.server = nil
+	}
+	for i, r := range t.routes {
+		if r.server == s {
+			// Copy the slice, since selectServer might be iterating over it.
+			t.routes = append(t.routes[:i:i], t.routes[i+1:]...)
+			break
+		}
+	}
 	if t.isSingleUse {
 		t.closed = true
 	}
@@ -323,6 +465,9 @@ func (t *Transport) close(e error) {
 	if t.server != nil {
 		t.server.close(e, false)
 	}
+	for _, r := range t.routes {
+		r.server.close(e, false)
+	}
 	t.closed = true
 }
 
@@ -393,6 +538,10 @@ func (t *Transport) handlePacket(p receivedPacket) {
 
 	t.mutex.Lock()
 	defer t.mutex.Unlock()
+	if len(t.routes) > 0 {
+		t.router.handlePacket(p)
+		return
+	}
 	if t.server == nil { // no server set
 		t.logger.Debugf("received a packet with an unexpected connection ID %s", connID)
 		return
@@ -0,0 +1,108 @@
+package quic
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"sync/atomic"
+
+	"github.com/quic-go/quic-go/internal/protocol"
+)
+
+type unorderedFrameQueueEntry struct {
+	Offset protocol.ByteCount
+	Data   []byte
+	DoneCb func()
+}
+
+// The unorderedFrameQueue is used for streams that are read in unordered mode.
+// It delivers stream data in the order it was received,
+// making sure that every byte of the stream is only delivered once.
+type unorderedFrameQueue struct {
+	gaps  []byteInterval // ranges of the stream that haven't been received yet, sorted by offset
+	queue []unorderedFrameQueueEntry
+}
+
+// newUnorderedFrameQueue creates a new unorderedFrameQueue from the state of a frameSorter.
+// All data queued in the frameSorter is moved to the unorderedFrameQueue.
+func newUnorderedFrameQueue(sorter *frameSorter) *unorderedFrameQueue {
+	q := &unorderedFrameQueue{
+		gaps:  make([]byteInterval, 0, sorter.gaps.Len()),
+		queue: make([]unorderedFrameQueueEntry, 0, len(sorter.queue)),
+	}
+	for gap := sorter.gaps.Front(); gap != nil; gap = gap.Next() {
+		q.gaps = append(q.gaps, gap.Value)
+	}
+	for offset, entry := range sorter.queue {
+		q.queue = append(q.queue, unorderedFrameQueueEntry{Offset: offset, Data: entry.Data, DoneCb: entry.DoneCb})
+		delete(sorter.queue, offset)
+	}
+	sort.Slice(q.queue, func(i, j int) bool { return q.queue[i].Offset < q.queue[j].Offset })
+	return q
+}
+
+func (q *unorderedFrameQueue) Push(data []byte, offset protocol.ByteCount, doneCb func()) error {
+	start := offset
+	end := offset + protocol.ByteCount(len(data))
+
+	// find the first gap that ends after the start of the frame
+	first := sort.Search(len(q.gaps), func(i int) bool { return q.gaps[i].End > start })
+	var remaining []byteInterval
+	var entries []unorderedFrameQueueEntry
+	last := first
+	for ; last < len(q.gaps) && q.gaps[last].Start < end; last++ {
+		gap := q.gaps[last]
+		s := max(start, gap.Start)
+		e := min(end, gap.End)
+		entries = append(entries, unorderedFrameQueueEntry{Offset: s, Data: data[s-start : e-start]})
+		if gap.Start < s {
+			remaining = append(remaining, byteInterval{Start: gap.Start, End: s})
+		}
+		if e < gap.End {
+			remaining = append(remaining, byteInterval{Start: e, End: gap.End})
+		}
+	}
+	if len(entries) == 0 { // duplicate data
+		if doneCb != nil {
+			doneCb()
+		}
+		return nil
+	}
+	q.gaps = slices.Replace(q.gaps, first, last, remaining...)
+	if len(q.gaps) > protocol.MaxStreamFrameSorterGaps {
+		return errors.New("too many gaps in received data")
+	}
+
+	// If the frame was split, the buffer can only be released once all parts have been released.
+	if doneCb != nil && len(entries) > 1 {
+		var refCount atomic.Int32
+		refCount.Store(int32(len(entries)))
+		cb := doneCb
+		doneCb = func() {
+			if refCount.Add(-1) == 0 {
+				cb()
+			}
+		}
+	}
+	for _, e := range entries {
+		e.DoneCb = doneCb
+		q.queue = append(q.queue, e)
+	}
+	return nil
+}
+
+// Pop returns the data that was received first.
+func (q *unorderedFrameQueue) Pop() (protocol.ByteCount, []byte, func(), bool) {
+	if len(q.queue) == 0 {
+		return 0, nil, nil, false
+	}
+	entry := q.queue[0]
+	q.queue[0] = unorderedFrameQueueEntry{}
+	q.queue = q.queue[1:]
+	return entry.Offset, entry.Data, entry.DoneCb, true
+}
+
+// ReceivedAll says if all data up to finalOffset has been received.
+func (q *unorderedFrameQueue) ReceivedAll(finalOffset protocol.ByteCount) bool {
+	return len(q.gaps) == 0 || q.gaps[0].Start >= finalOffset
+}
@@ -0,0 +1,128 @@
+package quic
+
+import (
+	"bytes"
+
+	"golang.org/x/exp/rand"
+
+	"github.com/quic-go/quic-go/internal/protocol"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("unordered frame queue", func() {
+	var q *unorderedFrameQueue
+
+	BeforeEach(func() {
+		q = newUnorderedFrameQueue(newFrameSorter())
+	})
+
+	popAll := func() []unorderedFrameQueueEntry {
+		var entries []unorderedFrameQueueEntry
+		for {
+			offset, data, doneCb, ok := q.Pop()
+			if !ok {
+				return entries
+			}
+			entries = append(entries, unorderedFrameQueueEntry{Offset: offset, Data: data, DoneCb: doneCb})
+		}
+	}
+
+	It("returns data in the order it was received", func() {
+		Expect(q.Push([]byte("bar"), 3, nil)).To(Succeed())
+		Expect(q.Push([]byte("foo"), 0, nil)).To(Succeed())
+		entries := popAll()
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Offset).To(Equal(protocol.ByteCount(3)))
+		Expect(entries[0].Data).To(Equal([]byte("bar")))
+		Expect(entries[1].Offset).To(BeZero())
+		Expect(entries[1].Data).To(Equal([]byte("foo")))
+		Expect(q.gaps).To(Equal([]byteInterval{{Start: 6, End: protocol.MaxByteCount}}))
+	})
+
+	It("drops duplicate data", func() {
+		var called bool
+		Expect(q.Push([]byte("foobar"), 0, nil)).To(Succeed())
+		Expect(q.Push([]byte("oba"), 2, func() { called = true })).To(Succeed())
+		Expect(called).To(BeTrue())
+		Expect(popAll()).To(HaveLen(1))
+	})
+
+	It("doesn't deliver data again after it was popped", func() {
+		Expect(q.Push([]byte("ob"), 2, nil)).To(Succeed())
+		Expect(popAll()).To(HaveLen(1))
+		Expect(q.Push([]byte("foobar"), 0, nil)).To(Succeed())
+		entries := popAll()
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Offset).To(BeZero())
+		Expect(entries[0].Data).To(Equal([]byte("fo")))
+		Expect(entries[1].Offset).To(Equal(protocol.ByteCount(4)))
+		Expect(entries[1].Data).To(Equal([]byte("ar")))
+	})
+
+	It("only releases a split frame once all parts have been released", func() {
+		Expect(q.Push([]byte("b"), 3, nil)).To(Succeed())
+		var called bool
+		Expect(q.Push([]byte("foobar"), 0, func() { called = true })).To(Succeed())
+		entries := popAll()
+		Expect(entries).To(HaveLen(3))
+		entries[1].DoneCb()
+		Expect(called).To(BeFalse())
+		entries[2].DoneCb()
+		Expect(called).To(BeTrue())
+	})
+
+	It("says if all data was received", func() {
+		Expect(q.ReceivedAll(6)).To(BeFalse())
+		Expect(q.Push([]byte("bar"), 3, nil)).To(Succeed())
+		Expect(q.ReceivedAll(6)).To(BeFalse())
+		Expect(q.Push([]byte("foo"), 0, nil)).To(Succeed())
+		Expect(q.ReceivedAll(6)).To(BeTrue())
+	})
+
+	It("errors when there are too many gaps", func() {
+		for i := 0; i < protocol.MaxStreamFrameSorterGaps-1; i++ {
+			Expect(q.Push([]byte("a"), protocol.ByteCount(2*i+1), nil)).To(Succeed())
+		}
+		Expect(q.Push([]byte("a"), protocol.ByteCount(2*protocol.MaxStreamFrameSorterGaps-1), nil)).To(MatchError("too many gaps in received data"))
+	})
+
+	It("takes over the data from a frame sorter", func() {
+		sorter := newFrameSorter()
+		Expect(sorter.Push([]byte("foo"), 0, nil)).To(Succeed())
+		Expect(sorter.Push([]byte("baz"), 6, nil)).To(Succeed())
+		_, data, _ := sorter.Pop()
+		Expect(data).To(Equal([]byte("foo")))
+		Expect(sorter.Push([]byte("bar"), 12, nil)).To(Succeed())
+		q = newUnorderedFrameQueue(sorter)
+		entries := popAll()
+		Expect(entries).To(HaveLen(2))
+		Expect(entries[0].Offset).To(Equal(protocol.ByteCount(6)))
+		Expect(entries[1].Offset).To(Equal(protocol.ByteCount(12)))
+		Expect(q.gaps).To(Equal([]byteInterval{{Start: 3, End: 6}, {Start: 9, End: 12}, {Start: 15, End: protocol.MaxByteCount}}))
+	})
+
+	It("reassembles randomly ordered, overlapping frames", func() {
+		const num = 1000
+		data := make([]byte, num*10)
+		rand.Read(data)
+		for i := 0; i < 3*num; i++ {
+			start := rand.Intn(len(data) - 20)
+			end := start + 1 + rand.Intn(20)
+			Expect(q.Push(data[start:end], protocol.ByteCount(start), nil)).To(Succeed())
+		}
+		for i := 0; i < len(data); i += 10 {
+			Expect(q.Push(data[i:i+10], protocol.ByteCount(i), nil)).To(Succeed())
+		}
+		Expect(q.ReceivedAll(protocol.ByteCount(len(data)))).To(BeTrue())
+		reassembled := make([]byte, len(data))
+		var total int
+		for _, e := range popAll() {
+			n := copy(reassembled[e.Offset:], e.Data)
+			total += n
+		}
+		Expect(total).To(Equal(len(data)))
+		Expect(bytes.Equal(reassembled, data)).To(BeTrue())
+	})
+})